@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strings"
+	"time"
 )
 
 // Config holds application configuration
@@ -12,6 +13,9 @@ type Config struct {
 	// Server configuration
 	ServerHostname string
 	ServerNames    []string // Alternative names the server might be known by
+
+	// How often computers are probed for reachability
+	ReachabilityInterval time.Duration
 }
 
 // LoadConfig loads configuration from environment variables
@@ -46,10 +50,19 @@ func LoadConfig() *Config {
 		serverNames = []string{"server", "dc", "domain-controller"}
 	}
 
+	// Reachability probe interval, e.g. "2m"
+	reachabilityInterval := 2 * time.Minute
+	if value := os.Getenv("REACHABILITY_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 10*time.Second {
+			reachabilityInterval = d
+		}
+	}
+
 	return &Config{
-		Environment:    env,
-		ServerHostname: serverHostname,
-		ServerNames:    serverNames,
+		Environment:          env,
+		ServerHostname:       serverHostname,
+		ServerNames:          serverNames,
+		ReachabilityInterval: reachabilityInterval,
 	}
 }
 
@@ -1,12 +1,18 @@
 package exec
 
 import (
-	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/griffinwebnet/vexa/api/utils"
 )
 
-// HeadscaleTool provides an interface for executing headscale commands
+const headscaleConfigPath = "/etc/headscale/config.yaml"
+
+// HeadscaleTool provides an interface for executing headscale commands.
+// Users, nodes, keys, routes and the policy are managed through the API
+// client in the headscale package; the CLI is only used for what the API
+// does not offer.
 type HeadscaleTool struct{}
 
 // NewHeadscaleTool creates a new HeadscaleTool instance
@@ -24,74 +30,46 @@ func (h *HeadscaleTool) Run(args ...string) (string, error) {
 	return string(output), err
 }
 
-// PreAuthKey represents a pre-auth key response from headscale
-type PreAuthKey struct {
-	User       string   `json:"user"`
-	ID         string   `json:"id"`
-	Key        string   `json:"key"`
-	Reusable   bool     `json:"reusable"`
-	Ephemeral  bool     `json:"ephemeral"`
-	Used       bool     `json:"used"`
-	Expiration string   `json:"expiration"`
-	CreatedAt  string   `json:"created_at"`
-	ACLTags    []string `json:"acl_tags"`
-}
-
-// CreatePreAuthKey creates a new pre-auth key
-func (h *HeadscaleTool) CreatePreAuthKey(user string, reusable bool, ephemeral bool) (*PreAuthKey, error) {
-	args := []string{"preauthkeys", "create", "--user", user, "--output", "json"}
-
-	if reusable {
-		args = append(args, "--reusable")
-	}
-	if ephemeral {
-		args = append(args, "--ephemeral")
-	}
-
-	output, err := h.Run(args...)
-	if err != nil {
-		return nil, err
-	}
-
-	var key PreAuthKey
-	err = json.Unmarshal([]byte(output), &key)
-	if err != nil {
-		return nil, err
+// output executes a headscale command and returns stdout only, so log lines
+// written to stderr do not corrupt the result
+func (h *HeadscaleTool) output(args ...string) (string, error) {
+	cmd, cmdErr := utils.SafeCommand("headscale", args...)
+	if cmdErr != nil {
+		return "", cmdErr
 	}
-
-	return &key, nil
+	output, err := cmd.Output()
+	return string(output), err
 }
 
-// ListPreAuthKeys lists all pre-auth keys for a user
-func (h *HeadscaleTool) ListPreAuthKeys(user string) ([]PreAuthKey, error) {
-	args := []string{"preauthkeys", "list", "--user", user, "--output", "json"}
-
-	output, err := h.Run(args...)
+// CreateAPIKey creates an API key valid for expiration, e.g. "87600h"
+func (h *HeadscaleTool) CreateAPIKey(expiration string) (string, error) {
+	output, err := h.output("apikeys", "create", "--expiration", expiration, "-c", headscaleConfigPath)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("failed to create API key: %v", err)
 	}
-
-	var keys []PreAuthKey
-	err = json.Unmarshal([]byte(output), &keys)
-	if err != nil {
-		return nil, err
+	key := strings.TrimSpace(output)
+	if key == "" || strings.ContainsAny(key, " \n") {
+		return "", fmt.Errorf("failed to create API key: unexpected output")
 	}
-
-	return keys, nil
+	return key, nil
 }
 
-// GetStatus returns the current headscale status
-func (h *HeadscaleTool) GetStatus() (string, error) {
-	return h.Run("status")
+// ExpireAPIKey expires the API key with the given prefix
+func (h *HeadscaleTool) ExpireAPIKey(prefix string) error {
+	if _, err := h.output("apikeys", "expire", "--prefix", prefix, "-c", headscaleConfigPath); err != nil {
+		return fmt.Errorf("failed to expire API key: %v", err)
+	}
+	return nil
 }
 
-// ListUsers lists all users in headscale
-func (h *HeadscaleTool) ListUsers() (string, error) {
-	return h.Run("users", "list")
+// CheckPolicy validates a policy file, returning headscale's explanation
+// when it is rejected
+func (h *HeadscaleTool) CheckPolicy(path string) (string, error) {
+	return h.Run("policy", "check", "--file", path, "-c", headscaleConfigPath)
 }
 
-// IsEnabled checks if headscale is available and configured
-func (h *HeadscaleTool) IsEnabled() bool {
-	_, err := h.GetStatus()
-	return err == nil
+// TestConfig loads the config file at path the way headscale serve would and
+// returns headscale's output
+func (h *HeadscaleTool) TestConfig(path string) (string, error) {
+	return h.Run("configtest", "-c", path)
 }
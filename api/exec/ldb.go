@@ -0,0 +1,465 @@
+package exec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// SamDBPath is the local Samba AD database used by the ldb tools
+const SamDBPath = "/var/lib/samba/private/sam.ldb"
+
+// LdbTool provides an interface for executing ldbsearch/ldbmodify against sam.ldb
+type LdbTool struct {
+	url string
+}
+
+// NewLdbTool creates a new LdbTool instance
+func NewLdbTool() *LdbTool {
+	return &LdbTool{url: SamDBPath}
+}
+
+// LDIFEntry represents a single record from LDIF output
+type LDIFEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of an attribute, or empty string
+func (e LDIFEntry) Get(attribute string) string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// GetAll returns all values of an attribute
+func (e LDIFEntry) GetAll(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Search runs a subtree ldbsearch with the given base, filter and attributes
+func (l *LdbTool) Search(base, filter string, attributes ...string) ([]LDIFEntry, error) {
+	return l.SearchScope(base, "sub", filter, attributes...)
+}
+
+// SearchScope runs ldbsearch with an explicit scope (base, one or sub)
+func (l *LdbTool) SearchScope(base, scope, filter string, attributes ...string) ([]LDIFEntry, error) {
+	args := []string{"-H", l.url, "-s", scope}
+	if base != "" {
+		args = append(args, "-b", base)
+	}
+	args = append(args, filter)
+	args = append(args, attributes...)
+
+	cmd, cmdErr := utils.SafeCommand("ldbsearch", args...)
+	if cmdErr != nil {
+		return nil, fmt.Errorf("command sanitization failed: %v", cmdErr)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ldbsearch failed: %s", string(output))
+	}
+
+	return ParseLDIF(string(output)), nil
+}
+
+// Modify applies an LDIF change record with ldbmodify
+func (l *LdbTool) Modify(ldif string) error {
+	cmd, cmdErr := utils.SafeCommand("ldbmodify", "-H", l.url)
+	if cmdErr != nil {
+		return fmt.Errorf("command sanitization failed: %v", cmdErr)
+	}
+
+	// Pass LDIF via stdin
+	cmd.Stdin = strings.NewReader(ldif)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ldbmodify failed: %s", string(output))
+	}
+	return nil
+}
+
+// ModifySchema applies an LDIF change record to the schema partition, which
+// Samba only accepts with schema updates explicitly allowed
+func (l *LdbTool) ModifySchema(ldif string) error {
+	cmd, cmdErr := utils.SafeCommand("ldbmodify", "-H", l.url, "--option=dsdb:schema update allowed=true")
+	if cmdErr != nil {
+		return fmt.Errorf("command sanitization failed: %v", cmdErr)
+	}
+
+	cmd.Stdin = strings.NewReader(ldif)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ldbmodify failed: %s", string(output))
+	}
+	return nil
+}
+
+// SchemaDN returns the DN of the schema naming context
+func (l *LdbTool) SchemaDN() (string, error) {
+	domainDN, err := l.DomainDN()
+	if err != nil {
+		return "", err
+	}
+	return "CN=Schema,CN=Configuration," + domainDN, nil
+}
+
+// ReplaceAttribute replaces all values of an attribute on the given DN.
+// Passing no values clears the attribute.
+func (l *LdbTool) ReplaceAttribute(dn, attribute string, values ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dn: %s\nchangetype: modify\nreplace: %s\n", dn, attribute)
+	for _, value := range values {
+		b.WriteString(ldifLine(attribute, value))
+	}
+	return l.Modify(b.String())
+}
+
+// AddAttributeValues adds values to a multi-valued attribute on the given DN
+func (l *LdbTool) AddAttributeValues(dn, attribute string, values ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dn: %s\nchangetype: modify\nadd: %s\n", dn, attribute)
+	for _, value := range values {
+		b.WriteString(ldifLine(attribute, value))
+	}
+	return l.Modify(b.String())
+}
+
+// DeleteAttributeValues removes specific values from a multi-valued attribute
+func (l *LdbTool) DeleteAttributeValues(dn, attribute string, values ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dn: %s\nchangetype: modify\ndelete: %s\n", dn, attribute)
+	for _, value := range values {
+		b.WriteString(ldifLine(attribute, value))
+	}
+	return l.Modify(b.String())
+}
+
+// AttributeInSchema reports whether an attribute is defined in the schema
+func (l *LdbTool) AttributeInSchema(attribute string) bool {
+	schemaDN, err := l.SchemaDN()
+	if err != nil {
+		return false
+	}
+	entries, err := l.SearchScope(schemaDN, "one",
+		fmt.Sprintf("(&(objectClass=attributeSchema)(lDAPDisplayName=%s))", EscapeFilter(attribute)), "dn")
+	return err == nil && len(entries) > 0
+}
+
+// SchemaIDGUID returns the schemaIDGUID of an attribute or class by lDAPDisplayName
+func (l *LdbTool) SchemaIDGUID(ldapDisplayName string) (string, error) {
+	schemaDN, err := l.SchemaDN()
+	if err != nil {
+		return "", err
+	}
+	entries, err := l.SearchScope(schemaDN, "one",
+		fmt.Sprintf("(lDAPDisplayName=%s)", EscapeFilter(ldapDisplayName)), "schemaIDGUID")
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 || entries[0].Get("schemaIDGUID") == "" {
+		return "", fmt.Errorf("%s is not defined in the schema", ldapDisplayName)
+	}
+	return strings.ToLower(entries[0].Get("schemaIDGUID")), nil
+}
+
+// ObjectSID returns the objectSid of the object at dn in S-1-5-... form
+func (l *LdbTool) ObjectSID(dn string) (string, error) {
+	entries, err := l.SearchScope(dn, "base", "(objectClass=*)", "objectSid")
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 || entries[0].Get("objectSid") == "" {
+		return "", fmt.Errorf("objectSid not found for %s", dn)
+	}
+	return entries[0].Get("objectSid"), nil
+}
+
+// UpdateDACL removes and adds explicit ACEs, written in SDDL, on an object's
+// security descriptor. ACEs already present are not added twice. New ACEs go
+// before the first inherited ACE to keep the DACL in canonical order.
+func (l *LdbTool) UpdateDACL(dn string, remove, add []string) error {
+	entries, err := l.SearchScope(dn, "base", "(objectClass=*)", "nTSecurityDescriptor")
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 || entries[0].Get("nTSecurityDescriptor") == "" {
+		return fmt.Errorf("security descriptor not found for %s", dn)
+	}
+	sddl := entries[0].Get("nTSecurityDescriptor")
+
+	updated, err := editDACL(sddl, remove, add)
+	if err != nil {
+		return fmt.Errorf("failed to update DACL on %s: %v", dn, err)
+	}
+	if updated == sddl {
+		return nil
+	}
+	return l.Modify(fmt.Sprintf("dn: %s\nchangetype: modify\nreplace: nTSecurityDescriptor\nnTSecurityDescriptor: %s\n", dn, updated))
+}
+
+// DomainDN returns the default naming context of the local domain
+func (l *LdbTool) DomainDN() (string, error) {
+	cmd, cmdErr := utils.SafeCommand("ldbsearch", "-H", l.url, "-s", "base", "-b", "", "defaultNamingContext")
+	if cmdErr != nil {
+		return "", fmt.Errorf("command sanitization failed: %v", cmdErr)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ldbsearch failed: %s", string(output))
+	}
+
+	for _, entry := range ParseLDIF(string(output)) {
+		if dn := entry.Get("defaultNamingContext"); dn != "" {
+			return dn, nil
+		}
+	}
+	return "", fmt.Errorf("defaultNamingContext not found")
+}
+
+// FindDN returns the DN of the single object matching the filter
+func (l *LdbTool) FindDN(filter string) (string, error) {
+	entries, err := l.Search("", filter, "dn")
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 || entries[0].DN == "" {
+		return "", fmt.Errorf("no object matches %s", filter)
+	}
+	return entries[0].DN, nil
+}
+
+// UserDN returns the DN of a user account by sAMAccountName
+func (l *LdbTool) UserDN(username string) (string, error) {
+	return l.FindDN(fmt.Sprintf("(&(objectClass=user)(!(objectClass=computer))(sAMAccountName=%s))", EscapeFilter(username)))
+}
+
+// GroupDN returns the DN of a group by sAMAccountName
+func (l *LdbTool) GroupDN(name string) (string, error) {
+	return l.FindDN(fmt.Sprintf("(&(objectClass=group)(sAMAccountName=%s))", EscapeFilter(name)))
+}
+
+// ComputerDN returns the DN of a computer account by name, with or without the trailing $
+func (l *LdbTool) ComputerDN(name string) (string, error) {
+	name = strings.TrimSuffix(name, "$") + "$"
+	return l.FindDN(fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s))", EscapeFilter(name)))
+}
+
+// EscapeFilter escapes special characters in an LDAP filter value
+func EscapeFilter(value string) string {
+	replacer := strings.NewReplacer(`\`, `\5c`, `*`, `\2a`, `(`, `\28`, `)`, `\29`, "\x00", `\00`)
+	return replacer.Replace(value)
+}
+
+// ParentDN returns the DN of an object's container
+func ParentDN(dn string) string {
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++ // skip the escaped character
+		case ',':
+			return strings.TrimSpace(dn[i+1:])
+		}
+	}
+	return ""
+}
+
+// ParseFileTime converts an AD FILETIME value (100ns intervals since 1601, as
+// used by lastLogonTimestamp) to a time. Zero and "never" values report false.
+func ParseFileTime(value string) (time.Time, bool) {
+	ticks, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || ticks <= 0 || ticks == 0x7FFFFFFFFFFFFFFF {
+		return time.Time{}, false
+	}
+	const epochDelta = 116444736000000000 // 1601-01-01 to 1970-01-01 in 100ns
+	return time.Unix(0, (ticks-epochDelta)*100).UTC(), true
+}
+
+// editDACL removes and adds ACEs in the DACL of an SDDL security descriptor
+func editDACL(sddl string, remove, add []string) (string, error) {
+	start := strings.Index(sddl, "D:")
+	if start < 0 {
+		return "", fmt.Errorf("security descriptor has no DACL")
+	}
+	end := len(sddl)
+	if idx := strings.Index(sddl[start:], "S:"); idx >= 0 {
+		end = start + idx
+	}
+	dacl := sddl[start+2 : end]
+
+	// Split the DACL into its flags and ACEs
+	flagsEnd := strings.Index(dacl, "(")
+	if flagsEnd < 0 {
+		flagsEnd = len(dacl)
+	}
+	flags := dacl[:flagsEnd]
+	var aces []string
+	for rest := dacl[flagsEnd:]; strings.HasPrefix(rest, "("); {
+		closing := strings.Index(rest, ")")
+		if closing < 0 {
+			return "", fmt.Errorf("malformed DACL")
+		}
+		aces = append(aces, rest[:closing+1])
+		rest = rest[closing+1:]
+	}
+
+	removed := map[string]bool{}
+	for _, ace := range remove {
+		removed[normalizeACE(ace)] = true
+	}
+	present := map[string]bool{}
+	var explicit, inherited []string
+	for _, ace := range aces {
+		if removed[normalizeACE(ace)] {
+			continue
+		}
+		present[normalizeACE(ace)] = true
+		aceFlags := strings.Split(strings.Trim(ace, "()"), ";")
+		if len(aceFlags) > 1 && strings.Contains(aceFlags[1], "ID") {
+			inherited = append(inherited, ace)
+		} else {
+			explicit = append(explicit, ace)
+		}
+	}
+	for _, ace := range add {
+		if !present[normalizeACE(ace)] {
+			explicit = append(explicit, ace)
+			present[normalizeACE(ace)] = true
+		}
+	}
+
+	return sddl[:start+2] + flags + strings.Join(explicit, "") + strings.Join(inherited, "") + sddl[end:], nil
+}
+
+// normalizeACE returns a comparable form of an SDDL ACE, since the flags and
+// rights may be written in any order and GUIDs in any case
+func normalizeACE(ace string) string {
+	fields := strings.Split(strings.ToUpper(strings.Trim(ace, "()")), ";")
+	for _, i := range []int{1, 2} {
+		if i >= len(fields) || strings.HasPrefix(fields[i], "0X") {
+			continue
+		}
+		var tokens []string
+		for j := 0; j+1 < len(fields[i]); j += 2 {
+			tokens = append(tokens, fields[i][j:j+2])
+		}
+		sort.Strings(tokens)
+		fields[i] = strings.Join(tokens, "")
+	}
+	return strings.Join(fields, ";")
+}
+
+// FormatFileTime converts a time to an AD FILETIME value
+func FormatFileTime(t time.Time) string {
+	const epochDelta = 116444736000000000
+	return strconv.FormatInt(t.UnixNano()/100+epochDelta, 10)
+}
+
+// ParseGeneralizedTime converts an LDAP GeneralizedTime value such as whenCreated
+func ParseGeneralizedTime(value string) (time.Time, bool) {
+	t, err := time.Parse("20060102150405.0Z", strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// ldifLine renders a single attribute line, base64-encoding unsafe values
+func ldifLine(attribute, value string) string {
+	if needsBase64(value) {
+		return fmt.Sprintf("%s:: %s\n", attribute, base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	return fmt.Sprintf("%s: %s\n", attribute, value)
+}
+
+func needsBase64(value string) bool {
+	if value == "" {
+		return false
+	}
+	if value[0] == ' ' || value[0] == ':' || value[0] == '<' || strings.HasSuffix(value, " ") {
+		return true
+	}
+	for _, ch := range value {
+		if ch == '\n' || ch == '\r' || ch == 0 || ch > 127 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLDIF parses LDIF output from ldbsearch or samba-tool into entries
+func ParseLDIF(output string) []LDIFEntry {
+	// Unfold continuation lines first
+	var lines []string
+	for _, raw := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(raw, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += raw[1:]
+			continue
+		}
+		lines = append(lines, raw)
+	}
+
+	var entries []LDIFEntry
+	var current *LDIFEntry
+	flush := func() {
+		if current != nil && (current.DN != "" || len(current.Attributes) > 0) {
+			entries = append(entries, *current)
+		}
+		current = nil
+	}
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
+		}
+		name := line[:idx]
+		value := line[idx+1:]
+		if strings.HasPrefix(value, ":") {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		} else {
+			value = strings.TrimSpace(value)
+		}
+
+		if current == nil {
+			current = &LDIFEntry{Attributes: make(map[string][]string)}
+		}
+		if strings.EqualFold(name, "dn") {
+			if current.DN != "" {
+				flush()
+				current = &LDIFEntry{Attributes: make(map[string][]string)}
+			}
+			current.DN = value
+			continue
+		}
+		current.Attributes[name] = append(current.Attributes[name], value)
+	}
+	flush()
+
+	return entries
+}
@@ -0,0 +1,90 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// NetTool provides an interface for executing Samba net commands
+type NetTool struct{}
+
+// NewNetTool creates a new NetTool instance
+func NewNetTool() *NetTool {
+	return &NetTool{}
+}
+
+// OfflineJoinOptions represents options for offline domain join provisioning
+type OfflineJoinOptions struct {
+	Realm         string
+	MachineName   string
+	DCName        string
+	AdminUser     string
+	AdminPassword string
+	Reuse         bool // Use an existing (pre-staged) computer account
+}
+
+// OfflineJoinProvision runs net offlinejoin provision and returns the base64
+// provisioning blob accepted by djoin /requestODJ
+func (n *NetTool) OfflineJoinProvision(options OfflineJoinOptions) (string, error) {
+	dir, err := os.MkdirTemp("", "vexa-odj-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	saveFile := filepath.Join(dir, "odj.txt")
+
+	args := []string{"offlinejoin", "provision",
+		"domain=" + options.Realm,
+		"machine_name=" + options.MachineName,
+		"savefile=" + saveFile,
+	}
+	if options.DCName != "" {
+		args = append(args, "dcname="+options.DCName)
+	}
+	if options.Reuse {
+		args = append(args, "reuse")
+	}
+	args = append(args, "-U", options.AdminUser)
+
+	cmd, cmdErr := utils.SafeCommand("net", args...)
+	if cmdErr != nil {
+		return "", fmt.Errorf("command sanitization failed: %v", cmdErr)
+	}
+	// Pass the password through the environment so it does not appear in the process list
+	cmd.Env = append(os.Environ(), "PASSWD="+options.AdminPassword)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to provision offline join: %s", strings.TrimSpace(string(output)))
+	}
+
+	data, err := os.ReadFile(saveFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read offline join data: %v", err)
+	}
+	blob := strings.TrimSpace(strings.TrimRight(decodeUTF16(data), "\x00"))
+	if blob == "" {
+		return "", fmt.Errorf("net offlinejoin produced no provisioning data")
+	}
+	return blob, nil
+}
+
+// decodeUTF16 converts UTF-16LE text (as written by djoin) to a string,
+// returning other input unchanged
+func decodeUTF16(data []byte) string {
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		data = data[2:]
+	} else if len(data) < 2 || data[1] != 0 {
+		return string(data)
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+	}
+	return string(utf16.Decode(units))
+}
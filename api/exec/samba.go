@@ -270,6 +270,12 @@ type GroupCreateOptions struct {
 	Description string
 }
 
+// ComputerCreateOptions represents options for computer account creation
+type ComputerCreateOptions struct {
+	OUPath      string
+	Description string
+}
+
 // DomainProvisionOptions represents options for domain provisioning
 type DomainProvisionOptions struct {
 	Domain        string
@@ -278,3 +284,46 @@ type DomainProvisionOptions struct {
 	DNSBackend    string
 	DNSForwarder  string
 }
+
+// GPOListAll lists all group policy objects in the domain
+func (s *SambaTool) GPOListAll() (string, error) {
+	return s.Run("gpo", "listall")
+}
+
+// NTACLSysvolReset resets the ACLs on SYSVOL to their defaults
+func (s *SambaTool) NTACLSysvolReset() (string, error) {
+	return s.Run("ntacl", "sysvolreset")
+}
+
+// NTACLSysvolCheck verifies the ACLs on SYSVOL match their expected values
+func (s *SambaTool) NTACLSysvolCheck() (string, error) {
+	return s.Run("ntacl", "sysvolcheck")
+}
+
+// ComputerCreate creates a computer account ahead of the machine joining the domain
+func (s *SambaTool) ComputerCreate(name string, options ComputerCreateOptions) (string, error) {
+	args := []string{"computer", "create", name}
+
+	if options.OUPath != "" {
+		args = append(args, "--computerou="+options.OUPath)
+	}
+	if options.Description != "" {
+		args = append(args, "--description="+options.Description)
+	}
+
+	return s.Run(args...)
+}
+
+// ComputerMove moves a computer account to another OU or container
+func (s *SambaTool) ComputerMove(name, ouPath string) (string, error) {
+	return s.Run("computer", "move", name, ouPath)
+}
+
+// OUCreate creates an organizational unit, e.g. "OU=Quarantine"
+func (s *SambaTool) OUCreate(ouPath, description string) (string, error) {
+	args := []string{"ou", "create", ouPath}
+	if description != "" {
+		args = append(args, "--description="+description)
+	}
+	return s.Run(args...)
+}
@@ -0,0 +1,120 @@
+package exec
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DNSRecord represents a record served by the Samba internal DNS server
+type DNSRecord struct {
+	Name string `json:"name"` // Fully qualified, without the trailing dot
+	Type string `json:"type"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+var (
+	// dnsNameLineRegex matches a name heading of samba-tool dns query output
+	dnsNameLineRegex = regexp.MustCompile(`^Name=([^,]*), Records=(\d+), Children=(\d+)`)
+
+	// dnsRecordLineRegex matches a record line of samba-tool dns query output
+	dnsRecordLineRegex = regexp.MustCompile(`^([A-Z]+): (.*?)(?: \((.*)\))?$`)
+
+	// dnsTTLRegex extracts the TTL from a record line's details
+	dnsTTLRegex = regexp.MustCompile(`ttl=(\d+)`)
+)
+
+// DNSZones lists the zones of the local DNS server
+func (s *SambaTool) DNSZones() ([]string, error) {
+	output, err := s.Run("dns", "zonelist", "localhost", "-P")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DNS zones: %s", strings.TrimSpace(output))
+	}
+
+	zones := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if found && strings.TrimSpace(key) == "pszZoneName" {
+			zones = append(zones, strings.TrimSpace(value))
+		}
+	}
+	return zones, nil
+}
+
+// DNSRecords lists the records of a zone below name ("@" for the zone
+// itself). Child names are descended into up to depth levels; names
+// starting with an underscore (service locators) and the AD application
+// partitions are skipped.
+func (s *SambaTool) DNSRecords(zone, name string, depth int) ([]DNSRecord, error) {
+	output, err := s.Run("dns", "query", "localhost", zone, name, "ALL", "-P")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query DNS records of %s in %s: %s", name, zone, strings.TrimSpace(output))
+	}
+
+	records, children := parseDNSQuery(output, zone, name)
+	if depth > 0 {
+		for _, child := range children {
+			childRecords, err := s.DNSRecords(zone, child, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, childRecords...)
+		}
+	}
+	return records, nil
+}
+
+// parseDNSQuery parses samba-tool dns query output for name in zone. It
+// returns the records and the child names that have records below them.
+func parseDNSQuery(output, zone, name string) ([]DNSRecord, []string) {
+	records := []DNSRecord{}
+	var children []string
+	current := ""
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		if match := dnsNameLineRegex.FindStringSubmatch(line); match != nil {
+			label := match[1]
+			if strings.HasPrefix(label, "_") || label == "DomainDnsZones" || label == "ForestDnsZones" {
+				current = ""
+				continue
+			}
+			relative := label
+			if name != "@" && label != "" {
+				relative = label + "." + name
+			} else if name != "@" {
+				relative = name
+			}
+			current = qualifyDNSName(relative, zone)
+			if n, _ := strconv.Atoi(match[3]); n > 0 && label != "" {
+				children = append(children, relative)
+			}
+			continue
+		}
+
+		match := dnsRecordLineRegex.FindStringSubmatch(line)
+		if match == nil || current == "" {
+			continue
+		}
+		record := DNSRecord{
+			Name: current,
+			Type: match[1],
+			Data: strings.TrimSuffix(strings.TrimSpace(match[2]), "."),
+		}
+		if ttl := dnsTTLRegex.FindStringSubmatch(match[3]); ttl != nil {
+			record.TTL, _ = strconv.Atoi(ttl[1])
+		}
+		records = append(records, record)
+	}
+	return records, children
+}
+
+// qualifyDNSName returns the fully qualified form of a name relative to zone
+func qualifyDNSName(name, zone string) string {
+	if name == "" || name == "@" {
+		return strings.ToLower(zone)
+	}
+	return strings.ToLower(name + "." + zone)
+}
@@ -0,0 +1,122 @@
+package gpo
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CLSIDs used by Group Policy Preferences drive maps
+const (
+	drivesCLSID = "{8FDDCC1A-0C3C-43cd-A6B4-71A6DF20DA8C}"
+	driveCLSID  = "{935D1B74-9CB8-4e3c-9914-7DD559B7A417}"
+)
+
+// Drives is the root of a User\Preferences\Drives\Drives.xml file
+type Drives struct {
+	XMLName xml.Name    `xml:"Drives"`
+	CLSID   string      `xml:"clsid,attr"`
+	Items   []DriveItem `xml:"Drive"`
+}
+
+// DriveItem is a single mapped drive preference item
+type DriveItem struct {
+	CLSID        string          `xml:"clsid,attr"`
+	Name         string          `xml:"name,attr"`
+	Status       string          `xml:"status,attr"`
+	Image        int             `xml:"image,attr"`
+	Changed      string          `xml:"changed,attr"`
+	UID          string          `xml:"uid,attr"`
+	BypassErrors int             `xml:"bypassErrors,attr,omitempty"`
+	Properties   DriveProperties `xml:"Properties"`
+}
+
+// DriveProperties holds the settings of a mapped drive
+type DriveProperties struct {
+	Action     string `xml:"action,attr"`
+	ThisDrive  string `xml:"thisDrive,attr"`
+	AllDrives  string `xml:"allDrives,attr"`
+	UserName   string `xml:"userName,attr"`
+	Path       string `xml:"path,attr"`
+	Label      string `xml:"label,attr"`
+	Persistent int    `xml:"persistent,attr"`
+	UseLetter  int    `xml:"useLetter,attr"`
+	Letter     string `xml:"letter,attr"`
+}
+
+// NewDrives returns an empty drive maps document
+func NewDrives() *Drives {
+	return &Drives{CLSID: drivesCLSID}
+}
+
+// ParseDrives decodes a Drives.xml file. An empty input yields an empty document.
+func ParseDrives(data []byte) (*Drives, error) {
+	if len(data) == 0 {
+		return NewDrives(), nil
+	}
+	var drives Drives
+	if err := xml.Unmarshal(data, &drives); err != nil {
+		return nil, fmt.Errorf("failed to parse Drives.xml: %v", err)
+	}
+	if drives.CLSID == "" {
+		drives.CLSID = drivesCLSID
+	}
+	return &drives, nil
+}
+
+// Bytes encodes the document as Drives.xml
+func (d *Drives) Bytes() ([]byte, error) {
+	body, err := xml.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n"), body...), nil
+}
+
+// SetDrive adds or updates the mapping for a drive letter
+func (d *Drives) SetDrive(letter, path, label string, persistent bool) {
+	letter = strings.ToUpper(strings.TrimSuffix(letter, ":"))
+	item := DriveItem{
+		CLSID:        driveCLSID,
+		Name:         letter + ":",
+		Status:       letter + ":",
+		Image:        2, // update
+		Changed:      time.Now().UTC().Format("2006-01-02 15:04:05"),
+		UID:          newPreferenceUID(),
+		BypassErrors: 1,
+		Properties: DriveProperties{
+			Action:    "U",
+			ThisDrive: "NOCHANGE",
+			AllDrives: "NOCHANGE",
+			Path:      path,
+			Label:     label,
+			UseLetter: 1,
+			Letter:    letter,
+		},
+	}
+	if persistent {
+		item.Properties.Persistent = 1
+	}
+
+	for i, existing := range d.Items {
+		if strings.EqualFold(existing.Properties.Letter, letter) {
+			item.UID = existing.UID
+			d.Items[i] = item
+			return
+		}
+	}
+	d.Items = append(d.Items, item)
+}
+
+// newPreferenceUID generates the braced GUID used to identify preference items
+func newPreferenceUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("{%08X-0000-0000-0000-000000000000}", time.Now().UnixNano()&0xFFFFFFFF)
+	}
+	b[6] = (b[6] & 0x0F) | 0x40
+	b[8] = (b[8] & 0x3F) | 0x80
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,53 @@
+package gpo
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	extensionGroupRegex = regexp.MustCompile(`\[[^\]]*\]`)
+	guidRegex           = regexp.MustCompile(`\{[0-9A-Fa-f-]+\}`)
+)
+
+// MergeExtensionNames merges client-side extension pairs into an existing
+// gPC*ExtensionNames value. Windows requires the list to be sorted by CSE GUID
+// with the tool GUIDs inside each group sorted as well.
+func MergeExtensionNames(existing, addition string) string {
+	tools := make(map[string]map[string]bool)
+	collect := func(value string) {
+		for _, group := range extensionGroupRegex.FindAllString(value, -1) {
+			guids := guidRegex.FindAllString(group, -1)
+			if len(guids) == 0 {
+				continue
+			}
+			cse := strings.ToUpper(guids[0])
+			if tools[cse] == nil {
+				tools[cse] = make(map[string]bool)
+			}
+			for _, tool := range guids[1:] {
+				tools[cse][strings.ToUpper(tool)] = true
+			}
+		}
+	}
+	collect(existing)
+	collect(addition)
+
+	cses := make([]string, 0, len(tools))
+	for cse := range tools {
+		cses = append(cses, cse)
+	}
+	sort.Strings(cses)
+
+	var b strings.Builder
+	for _, cse := range cses {
+		toolList := make([]string, 0, len(tools[cse]))
+		for tool := range tools[cse] {
+			toolList = append(toolList, tool)
+		}
+		sort.Strings(toolList)
+		b.WriteString("[" + cse + strings.Join(toolList, "") + "]")
+	}
+	return b.String()
+}
@@ -0,0 +1,241 @@
+package gpo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// RegType is a Windows registry value type
+type RegType uint32
+
+const (
+	RegSZ       RegType = 1
+	RegExpandSZ RegType = 2
+	RegBinary   RegType = 3
+	RegDWORD    RegType = 4
+	RegMultiSZ  RegType = 7
+	RegQWORD    RegType = 11
+)
+
+// registryPolSignature is the "PReg" header followed by format version 1
+var registryPolSignature = []byte{'P', 'R', 'e', 'g', 1, 0, 0, 0}
+
+// RegistryEntry is a single value in a Registry.pol file
+type RegistryEntry struct {
+	Key       string
+	ValueName string
+	Type      RegType
+	Data      []byte
+}
+
+// DWORDEntry creates a REG_DWORD entry
+func DWORDEntry(key, valueName string, value uint32) RegistryEntry {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, value)
+	return RegistryEntry{Key: key, ValueName: valueName, Type: RegDWORD, Data: data}
+}
+
+// StringEntry creates a REG_SZ entry
+func StringEntry(key, valueName, value string) RegistryEntry {
+	return RegistryEntry{Key: key, ValueName: valueName, Type: RegSZ, Data: encodeUTF16(value, true)}
+}
+
+// DWORD returns the entry value as a uint32 if it is a REG_DWORD
+func (e RegistryEntry) DWORD() (uint32, bool) {
+	if e.Type != RegDWORD || len(e.Data) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(e.Data), true
+}
+
+// String returns the entry value as a string if it is a REG_SZ or REG_EXPAND_SZ
+func (e RegistryEntry) String() (string, bool) {
+	if e.Type != RegSZ && e.Type != RegExpandSZ {
+		return "", false
+	}
+	return decodeUTF16(e.Data), true
+}
+
+// RegistryPol is an in-memory Registry.pol document
+type RegistryPol struct {
+	Entries []RegistryEntry
+}
+
+// ParseRegistryPol decodes a Registry.pol file. An empty input yields an empty document.
+func ParseRegistryPol(data []byte) (*RegistryPol, error) {
+	pol := &RegistryPol{}
+	if len(data) == 0 {
+		return pol, nil
+	}
+	if len(data) < len(registryPolSignature) || !bytes.Equal(data[:4], registryPolSignature[:4]) {
+		return nil, fmt.Errorf("invalid Registry.pol signature")
+	}
+	if binary.LittleEndian.Uint32(data[4:8]) != 1 {
+		return nil, fmt.Errorf("unsupported Registry.pol version %d", binary.LittleEndian.Uint32(data[4:8]))
+	}
+
+	r := &polReader{data: data, pos: len(registryPolSignature)}
+	for r.pos < len(r.data) {
+		var entry RegistryEntry
+		if err := r.expect('['); err != nil {
+			return nil, err
+		}
+		entry.Key = r.readString()
+		if err := r.expect(';'); err != nil {
+			return nil, err
+		}
+		entry.ValueName = r.readString()
+		if err := r.expect(';'); err != nil {
+			return nil, err
+		}
+		regType, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		entry.Type = RegType(regType)
+		if err := r.expect(';'); err != nil {
+			return nil, err
+		}
+		size, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.expect(';'); err != nil {
+			return nil, err
+		}
+		if r.pos+int(size) > len(r.data) {
+			return nil, fmt.Errorf("truncated Registry.pol data for %s\\%s", entry.Key, entry.ValueName)
+		}
+		entry.Data = append([]byte(nil), r.data[r.pos:r.pos+int(size)]...)
+		r.pos += int(size)
+		if err := r.expect(']'); err != nil {
+			return nil, err
+		}
+		pol.Entries = append(pol.Entries, entry)
+	}
+
+	return pol, nil
+}
+
+// Bytes encodes the document in Registry.pol format
+func (p *RegistryPol) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.Write(registryPolSignature)
+
+	delim := func(ch rune) {
+		buf.Write(encodeUTF16(string(ch), false))
+	}
+	for _, entry := range p.Entries {
+		delim('[')
+		buf.Write(encodeUTF16(entry.Key, true))
+		delim(';')
+		buf.Write(encodeUTF16(entry.ValueName, true))
+		delim(';')
+		binary.Write(&buf, binary.LittleEndian, uint32(entry.Type))
+		delim(';')
+		binary.Write(&buf, binary.LittleEndian, uint32(len(entry.Data)))
+		delim(';')
+		buf.Write(entry.Data)
+		delim(']')
+	}
+
+	return buf.Bytes()
+}
+
+// Get looks up a value by key and value name (case-insensitive)
+func (p *RegistryPol) Get(key, valueName string) (RegistryEntry, bool) {
+	for _, entry := range p.Entries {
+		if strings.EqualFold(entry.Key, key) && strings.EqualFold(entry.ValueName, valueName) {
+			return entry, true
+		}
+	}
+	return RegistryEntry{}, false
+}
+
+// Set adds or replaces a value
+func (p *RegistryPol) Set(entry RegistryEntry) {
+	for i, existing := range p.Entries {
+		if strings.EqualFold(existing.Key, entry.Key) && strings.EqualFold(existing.ValueName, entry.ValueName) {
+			p.Entries[i] = entry
+			return
+		}
+	}
+	p.Entries = append(p.Entries, entry)
+}
+
+// Delete removes a value if present
+func (p *RegistryPol) Delete(key, valueName string) {
+	kept := p.Entries[:0]
+	for _, entry := range p.Entries {
+		if strings.EqualFold(entry.Key, key) && strings.EqualFold(entry.ValueName, valueName) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	p.Entries = kept
+}
+
+// polReader walks the UTF-16LE body of a Registry.pol file
+type polReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *polReader) expect(ch rune) error {
+	if r.pos+2 > len(r.data) || rune(binary.LittleEndian.Uint16(r.data[r.pos:])) != ch {
+		return fmt.Errorf("malformed Registry.pol: expected %q at offset %d", ch, r.pos)
+	}
+	r.pos += 2
+	return nil
+}
+
+func (r *polReader) readString() string {
+	var units []uint16
+	for r.pos+2 <= len(r.data) {
+		unit := binary.LittleEndian.Uint16(r.data[r.pos:])
+		r.pos += 2
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
+
+func (r *polReader) readUint32() (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, fmt.Errorf("malformed Registry.pol: truncated at offset %d", r.pos)
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+// encodeUTF16 encodes a string as UTF-16LE, optionally NUL-terminated
+func encodeUTF16(s string, terminate bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if terminate {
+		units = append(units, 0)
+	}
+	out := make([]byte, len(units)*2)
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(out[i*2:], unit)
+	}
+	return out
+}
+
+// decodeUTF16 decodes UTF-16LE bytes, stopping at the first NUL
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,169 @@
+package gpo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"unicode/utf16"
+)
+
+// testdata/Registry.pol is a machine Registry.pol in the layout the Group
+// Policy editor writes: REG_DWORD, REG_SZ and REG_MULTI_SZ values plus
+// **del. and **delvals. markers
+
+func readRegistryPolSample(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/Registry.pol")
+	if err != nil {
+		t.Fatalf("reading sample: %v", err)
+	}
+	return data
+}
+
+func TestRegistryPolRoundTrip(t *testing.T) {
+	sample := readRegistryPolSample(t)
+	pol, err := ParseRegistryPol(sample)
+	if err != nil {
+		t.Fatalf("ParseRegistryPol: %v", err)
+	}
+	if len(pol.Entries) != 9 {
+		t.Fatalf("got %d entries, want 9", len(pol.Entries))
+	}
+	if got := pol.Bytes(); !bytes.Equal(got, sample) {
+		t.Fatalf("re-encoding changed the file:\ngot  % x\nwant % x", got, sample)
+	}
+}
+
+func TestRegistryPolValueTypes(t *testing.T) {
+	pol, err := ParseRegistryPol(readRegistryPolSample(t))
+	if err != nil {
+		t.Fatalf("ParseRegistryPol: %v", err)
+	}
+
+	days, ok := pol.Get(windowsUpdateKey, "deferfeatureupdatesperiodindays")
+	if value, isDWORD := days.DWORD(); !ok || !isDWORD || value != 60 {
+		t.Errorf("DeferFeatureUpdatesPeriodInDays = %+v", days)
+	}
+	if _, isString := days.String(); isString {
+		t.Error("a REG_DWORD read as a string")
+	}
+
+	timeout, ok := pol.Get(`Software\Policies\Microsoft\Windows\Control Panel\Desktop`, "ScreenSaveTimeOut")
+	if value, isString := timeout.String(); !ok || !isString || value != "900" {
+		t.Errorf("ScreenSaveTimeOut = %+v", timeout)
+	}
+	if _, isDWORD := timeout.DWORD(); isDWORD {
+		t.Error("a REG_SZ read as a DWORD")
+	}
+
+	hardened, ok := pol.Get(`Software\Policies\Microsoft\Windows\NetworkProvider\HardenedPaths`, `\\*\SYSVOL`)
+	if value, _ := hardened.String(); !ok || value != "RequireMutualAuthentication=1, RequireIntegrity=1" {
+		t.Errorf("hardened path = %q", value)
+	}
+
+	hosts, ok := pol.Get(`Software\Policies\Microsoft\Windows\WinRM\Service`, "TrustedHosts")
+	if !ok || hosts.Type != RegMultiSZ {
+		t.Fatalf("TrustedHosts = %+v", hosts)
+	}
+	if got := multiSZ(hosts.Data); len(got) != 2 || got[0] != "dc1.corp.example.com" || got[1] != "fs1.corp.example.com" {
+		t.Errorf("TrustedHosts values = %q", got)
+	}
+	if _, isString := hosts.String(); isString {
+		t.Error("a REG_MULTI_SZ read as a string")
+	}
+
+	for _, marker := range []struct{ key, name string }{
+		{windowsUpdateKey, "**del.PauseFeatureUpdatesStartTime"},
+		{`Software\Policies\Microsoft\Windows\System`, "**delvals."},
+	} {
+		entry, ok := pol.Get(marker.key, marker.name)
+		if value, _ := entry.String(); !ok || entry.Type != RegSZ || value != " " {
+			t.Errorf("%s marker = %+v", marker.name, entry)
+		}
+	}
+}
+
+func TestRegistryPolEditPreservesOtherEntries(t *testing.T) {
+	sample := readRegistryPolSample(t)
+	pol, err := ParseRegistryPol(sample)
+	if err != nil {
+		t.Fatalf("ParseRegistryPol: %v", err)
+	}
+
+	if err := (&UpdateDeferralTemplate{}).Apply(&Files{MachineRegistry: pol}, &UpdateDeferralSettings{FeatureUpdateDays: 90, QualityUpdateDays: 7}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	pol.Delete(`Software\Policies\Microsoft\Windows\Control Panel\Desktop`, "ScreenSaveTimeOut")
+
+	reparsed, err := ParseRegistryPol(pol.Bytes())
+	if err != nil {
+		t.Fatalf("ParseRegistryPol after edit: %v", err)
+	}
+	if days, _ := reparsed.Get(windowsUpdateKey, "DeferFeatureUpdatesPeriodInDays"); !bytes.Equal(days.Data, []byte{90, 0, 0, 0}) {
+		t.Errorf("DeferFeatureUpdatesPeriodInDays data = % x", days.Data)
+	}
+	if _, ok := reparsed.Get(`Software\Policies\Microsoft\Windows\Control Panel\Desktop`, "ScreenSaveTimeOut"); ok {
+		t.Error("deleted value is still present")
+	}
+
+	original, _ := ParseRegistryPol(sample)
+	for _, entry := range original.Entries {
+		if entry.Key == windowsUpdateKey && entry.ValueName != "**del.PauseFeatureUpdatesStartTime" {
+			continue
+		}
+		if entry.ValueName == "ScreenSaveTimeOut" {
+			continue
+		}
+		kept, ok := reparsed.Get(entry.Key, entry.ValueName)
+		if !ok || kept.Type != entry.Type || !bytes.Equal(kept.Data, entry.Data) {
+			t.Errorf("%s\\%s changed: %+v", entry.Key, entry.ValueName, kept)
+		}
+	}
+	if len(reparsed.Entries) != 10 {
+		t.Errorf("got %d entries, want 10", len(reparsed.Entries))
+	}
+}
+
+func TestParseRegistryPolRejectsMalformed(t *testing.T) {
+	sample := readRegistryPolSample(t)
+
+	cases := map[string][]byte{
+		"bad signature": append([]byte("PRex"), sample[4:]...),
+		"bad version":   append(append([]byte("PReg"), 2, 0, 0, 0), sample[8:]...),
+		"truncated":     sample[:len(sample)-10],
+		"missing close": sample[:len(sample)-2],
+	}
+	for name, data := range cases {
+		if _, err := ParseRegistryPol(data); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+
+	empty, err := ParseRegistryPol(nil)
+	if err != nil || len(empty.Entries) != 0 {
+		t.Errorf("ParseRegistryPol(nil) = %+v, %v", empty, err)
+	}
+	if got := empty.Bytes(); !bytes.Equal(got, registryPolSignature) {
+		t.Errorf("empty document encodes to % x", got)
+	}
+}
+
+// multiSZ splits REG_MULTI_SZ data into its strings
+func multiSZ(data []byte) []string {
+	var values []string
+	var units []uint16
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit != 0 {
+			units = append(units, unit)
+			continue
+		}
+		if len(units) == 0 {
+			break
+		}
+		values = append(values, string(utf16.Decode(units)))
+		units = nil
+	}
+	return values
+}
@@ -0,0 +1,163 @@
+package gpo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// Section names used in GptTmpl.inf
+const (
+	SectionUnicode        = "Unicode"
+	SectionVersion        = "Version"
+	SectionSystemAccess   = "System Access"
+	SectionRegistryValues = "Registry Values"
+)
+
+// infLine is a single key=value pair inside a section
+type infLine struct {
+	key   string
+	value string
+}
+
+// infSection is a named section of an INF file, kept in file order
+type infSection struct {
+	name  string
+	lines []infLine
+}
+
+// SecurityTemplate is an in-memory GptTmpl.inf security template
+type SecurityTemplate struct {
+	sections []*infSection
+}
+
+// NewSecurityTemplate returns a template with the mandatory header sections
+func NewSecurityTemplate() *SecurityTemplate {
+	t := &SecurityTemplate{}
+	t.Set(SectionUnicode, "Unicode", "yes")
+	t.Set(SectionVersion, "signature", `"$CHICAGO$"`)
+	t.Set(SectionVersion, "Revision", "1")
+	return t
+}
+
+// ParseSecurityTemplate decodes a GptTmpl.inf file (UTF-16LE with BOM, or plain text)
+func ParseSecurityTemplate(data []byte) *SecurityTemplate {
+	if len(data) == 0 {
+		return NewSecurityTemplate()
+	}
+
+	var text string
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) {
+		text = decodeUTF16Text(data[2:])
+	} else {
+		text = strings.TrimPrefix(string(data), "\ufeff")
+	}
+
+	t := &SecurityTemplate{}
+	var current *infSection
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = t.section(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"), true)
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		current.lines = append(current.lines, infLine{key: strings.TrimSpace(key), value: strings.TrimSpace(value)})
+	}
+
+	return t
+}
+
+// Bytes encodes the template as UTF-16LE with BOM and CRLF line endings
+func (t *SecurityTemplate) Bytes() []byte {
+	var b strings.Builder
+	for _, section := range t.sections {
+		b.WriteString("[" + section.name + "]\r\n")
+		for _, line := range section.lines {
+			b.WriteString(line.key + "=" + line.value + "\r\n")
+		}
+	}
+
+	out := []byte{0xFF, 0xFE}
+	return append(out, encodeUTF16(b.String(), false)...)
+}
+
+// Get returns the value of a key in a section
+func (t *SecurityTemplate) Get(section, key string) (string, bool) {
+	s := t.section(section, false)
+	if s == nil {
+		return "", false
+	}
+	for _, line := range s.lines {
+		if strings.EqualFold(line.key, key) {
+			return line.value, true
+		}
+	}
+	return "", false
+}
+
+// Set adds or replaces a key in a section, creating the section if needed
+func (t *SecurityTemplate) Set(section, key, value string) {
+	s := t.section(section, true)
+	for i, line := range s.lines {
+		if strings.EqualFold(line.key, key) {
+			s.lines[i].value = value
+			return
+		}
+	}
+	s.lines = append(s.lines, infLine{key: key, value: value})
+}
+
+// Delete removes a key from a section, dropping the section once it is empty
+func (t *SecurityTemplate) Delete(section, key string) {
+	s := t.section(section, false)
+	if s == nil {
+		return
+	}
+	kept := s.lines[:0]
+	for _, line := range s.lines {
+		if !strings.EqualFold(line.key, key) {
+			kept = append(kept, line)
+		}
+	}
+	s.lines = kept
+
+	if len(s.lines) == 0 && section != SectionUnicode && section != SectionVersion {
+		for i, existing := range t.sections {
+			if existing == s {
+				t.sections = append(t.sections[:i], t.sections[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (t *SecurityTemplate) section(name string, create bool) *infSection {
+	for _, s := range t.sections {
+		if strings.EqualFold(s.name, name) {
+			return s
+		}
+	}
+	if !create {
+		return nil
+	}
+	s := &infSection{name: name}
+	t.sections = append(t.sections, s)
+	return s
+}
+
+// decodeUTF16Text decodes UTF-16LE text without stopping at NUL
+func decodeUTF16Text(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
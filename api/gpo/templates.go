@@ -0,0 +1,394 @@
+package gpo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scope identifies which half of a GPO a template writes to
+type Scope string
+
+const (
+	ScopeMachine Scope = "machine"
+	ScopeUser    Scope = "user"
+)
+
+// Client-side extension pairs ([CSE GUID][tool GUID]) that must be listed in
+// gPCMachineExtensionNames / gPCUserExtensionNames for clients to apply a setting
+const (
+	ExtensionRegistryMachine = "[{35378EAC-683F-11D2-A89A-00C04FBBCFA2}{D02B1F72-3407-48AE-BA88-E8213C6761F1}]"
+	ExtensionRegistryUser    = "[{35378EAC-683F-11D2-A89A-00C04FBBCFA2}{D02B1F73-3407-48AE-BA88-E8213C6761F1}]"
+	ExtensionSecurity        = "[{827D319E-6EAC-11D2-A4EA-00C04F79F83A}{803E14A0-B4FB-11D0-A0D0-00A0C90F574B}]"
+	ExtensionDriveMaps       = "[{00000000-0000-0000-0000-000000000000}{2EA1A81B-48E5-45E9-8BB7-A6E3AC170006}][{5794DAFD-BE60-433F-88A2-1A31939AC01F}{2EA1A81B-48E5-45E9-8BB7-A6E3AC170006}]"
+)
+
+// Files holds the SYSVOL policy files that templates read and write
+type Files struct {
+	MachineRegistry  *RegistryPol
+	UserRegistry     *RegistryPol
+	SecurityTemplate *SecurityTemplate
+	Drives           *Drives
+}
+
+// TemplateInfo describes a curated policy template
+type TemplateInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Scope       Scope  `json:"scope"`
+	Extension   string `json:"-"`
+}
+
+// Template is a typed, high-value policy setting that can be rendered into
+// and read back from a GPO's SYSVOL files
+type Template interface {
+	Info() TemplateInfo
+	// NewSettings returns a pointer to the zero value of the template's settings type
+	NewSettings() interface{}
+	// Apply validates the settings and writes them into the policy files
+	Apply(files *Files, settings interface{}) error
+	// Read returns the current settings and whether the template is configured
+	Read(files *Files) (interface{}, bool)
+	// Remove deletes everything the template writes
+	Remove(files *Files)
+}
+
+// Templates returns all curated templates in display order
+func Templates() []Template {
+	return []Template{
+		&ScreenLockTemplate{},
+		&USBStorageTemplate{},
+		&DriveMappingTemplate{},
+		&UpdateDeferralTemplate{},
+		&WallpaperTemplate{},
+	}
+}
+
+// LookupTemplate finds a curated template by ID
+func LookupTemplate(id string) (Template, bool) {
+	for _, t := range Templates() {
+		if t.Info().ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Screen lock timeout
+
+const screenLockKey = `MACHINE\Software\Microsoft\Windows\CurrentVersion\Policies\System\InactivityTimeoutSecs`
+
+// ScreenLockSettings configures "Interactive logon: Machine inactivity limit"
+type ScreenLockSettings struct {
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// ScreenLockTemplate locks the workstation after a period of inactivity
+type ScreenLockTemplate struct{}
+
+func (t *ScreenLockTemplate) Info() TemplateInfo {
+	return TemplateInfo{
+		ID:          "screen-lock",
+		Name:        "Screen Lock Timeout",
+		Description: "Lock the workstation after a period of user inactivity",
+		Scope:       ScopeMachine,
+		Extension:   ExtensionSecurity,
+	}
+}
+
+func (t *ScreenLockTemplate) NewSettings() interface{} { return &ScreenLockSettings{} }
+
+func (t *ScreenLockTemplate) Apply(files *Files, settings interface{}) error {
+	s := settings.(*ScreenLockSettings)
+	// Windows accepts 1-599940 seconds for this policy
+	if s.TimeoutSeconds < 1 || s.TimeoutSeconds > 599940 {
+		return fmt.Errorf("timeout_seconds must be between 1 and 599940")
+	}
+	files.SecurityTemplate.Set(SectionRegistryValues, screenLockKey, fmt.Sprintf("%d,%d", RegDWORD, s.TimeoutSeconds))
+	return nil
+}
+
+func (t *ScreenLockTemplate) Read(files *Files) (interface{}, bool) {
+	value, ok := files.SecurityTemplate.Get(SectionRegistryValues, screenLockKey)
+	if !ok {
+		return nil, false
+	}
+	_, raw, _ := strings.Cut(value, ",")
+	timeout, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, false
+	}
+	return &ScreenLockSettings{TimeoutSeconds: timeout}, true
+}
+
+func (t *ScreenLockTemplate) Remove(files *Files) {
+	files.SecurityTemplate.Delete(SectionRegistryValues, screenLockKey)
+}
+
+// USB storage
+
+// Removable Disks device class under the removable storage access policies
+const usbStorageKey = `Software\Policies\Microsoft\Windows\RemovableStorageDevices\{53f5630d-b6bf-11d0-94f2-00a0c91efb8b}`
+
+// USBStorageSettings configures removable disk access
+type USBStorageSettings struct {
+	DenyRead  bool `json:"deny_read"`
+	DenyWrite bool `json:"deny_write"`
+}
+
+// USBStorageTemplate blocks reading from and/or writing to removable disks
+type USBStorageTemplate struct{}
+
+func (t *USBStorageTemplate) Info() TemplateInfo {
+	return TemplateInfo{
+		ID:          "usb-storage",
+		Name:        "Disable USB Storage",
+		Description: "Deny read and/or write access to removable disks",
+		Scope:       ScopeMachine,
+		Extension:   ExtensionRegistryMachine,
+	}
+}
+
+func (t *USBStorageTemplate) NewSettings() interface{} { return &USBStorageSettings{} }
+
+func (t *USBStorageTemplate) Apply(files *Files, settings interface{}) error {
+	s := settings.(*USBStorageSettings)
+	if !s.DenyRead && !s.DenyWrite {
+		return fmt.Errorf("at least one of deny_read or deny_write must be set")
+	}
+	files.MachineRegistry.Set(DWORDEntry(usbStorageKey, "Deny_Read", boolToDWORD(s.DenyRead)))
+	files.MachineRegistry.Set(DWORDEntry(usbStorageKey, "Deny_Write", boolToDWORD(s.DenyWrite)))
+	return nil
+}
+
+func (t *USBStorageTemplate) Read(files *Files) (interface{}, bool) {
+	read, readOK := files.MachineRegistry.Get(usbStorageKey, "Deny_Read")
+	write, writeOK := files.MachineRegistry.Get(usbStorageKey, "Deny_Write")
+	if !readOK && !writeOK {
+		return nil, false
+	}
+	readValue, _ := read.DWORD()
+	writeValue, _ := write.DWORD()
+	return &USBStorageSettings{DenyRead: readValue == 1, DenyWrite: writeValue == 1}, true
+}
+
+func (t *USBStorageTemplate) Remove(files *Files) {
+	files.MachineRegistry.Delete(usbStorageKey, "Deny_Read")
+	files.MachineRegistry.Delete(usbStorageKey, "Deny_Write")
+}
+
+// Drive mappings
+
+var driveLetterRegex = regexp.MustCompile(`^[A-Za-z]:?$`)
+
+// DriveMapping is a single network drive
+type DriveMapping struct {
+	Letter     string `json:"letter"`
+	Path       string `json:"path"`
+	Label      string `json:"label,omitempty"`
+	Persistent bool   `json:"persistent"`
+}
+
+// DriveMappingSettings configures the mapped drives for users
+type DriveMappingSettings struct {
+	Mappings []DriveMapping `json:"mappings"`
+}
+
+// DriveMappingTemplate maps network drives via Group Policy Preferences
+type DriveMappingTemplate struct{}
+
+func (t *DriveMappingTemplate) Info() TemplateInfo {
+	return TemplateInfo{
+		ID:          "drive-mappings",
+		Name:        "Drive Mappings",
+		Description: "Map network shares to drive letters at user logon",
+		Scope:       ScopeUser,
+		Extension:   ExtensionDriveMaps,
+	}
+}
+
+func (t *DriveMappingTemplate) NewSettings() interface{} { return &DriveMappingSettings{} }
+
+func (t *DriveMappingTemplate) Apply(files *Files, settings interface{}) error {
+	s := settings.(*DriveMappingSettings)
+	if len(s.Mappings) == 0 {
+		return fmt.Errorf("at least one mapping is required")
+	}
+	for _, m := range s.Mappings {
+		if !driveLetterRegex.MatchString(m.Letter) {
+			return fmt.Errorf("invalid drive letter: %s", m.Letter)
+		}
+		if !strings.HasPrefix(m.Path, `\\`) {
+			return fmt.Errorf("path must be a UNC path (\\\\server\\share): %s", m.Path)
+		}
+	}
+
+	files.Drives.Items = nil
+	for _, m := range s.Mappings {
+		files.Drives.SetDrive(m.Letter, m.Path, m.Label, m.Persistent)
+	}
+	return nil
+}
+
+func (t *DriveMappingTemplate) Read(files *Files) (interface{}, bool) {
+	if len(files.Drives.Items) == 0 {
+		return nil, false
+	}
+	settings := &DriveMappingSettings{}
+	for _, item := range files.Drives.Items {
+		settings.Mappings = append(settings.Mappings, DriveMapping{
+			Letter:     item.Properties.Letter,
+			Path:       item.Properties.Path,
+			Label:      item.Properties.Label,
+			Persistent: item.Properties.Persistent == 1,
+		})
+	}
+	return settings, true
+}
+
+func (t *DriveMappingTemplate) Remove(files *Files) {
+	files.Drives.Items = nil
+}
+
+// Windows Update deferral
+
+const windowsUpdateKey = `Software\Policies\Microsoft\Windows\WindowsUpdate`
+
+// UpdateDeferralSettings configures Windows Update for Business deferrals
+type UpdateDeferralSettings struct {
+	FeatureUpdateDays int `json:"feature_update_days"`
+	QualityUpdateDays int `json:"quality_update_days"`
+}
+
+// UpdateDeferralTemplate defers feature and quality updates
+type UpdateDeferralTemplate struct{}
+
+func (t *UpdateDeferralTemplate) Info() TemplateInfo {
+	return TemplateInfo{
+		ID:          "update-deferral",
+		Name:        "Windows Update Deferral",
+		Description: "Defer feature and quality updates by a number of days",
+		Scope:       ScopeMachine,
+		Extension:   ExtensionRegistryMachine,
+	}
+}
+
+func (t *UpdateDeferralTemplate) NewSettings() interface{} { return &UpdateDeferralSettings{} }
+
+func (t *UpdateDeferralTemplate) Apply(files *Files, settings interface{}) error {
+	s := settings.(*UpdateDeferralSettings)
+	if s.FeatureUpdateDays < 0 || s.FeatureUpdateDays > 365 {
+		return fmt.Errorf("feature_update_days must be between 0 and 365")
+	}
+	if s.QualityUpdateDays < 0 || s.QualityUpdateDays > 30 {
+		return fmt.Errorf("quality_update_days must be between 0 and 30")
+	}
+
+	reg := files.MachineRegistry
+	reg.Set(DWORDEntry(windowsUpdateKey, "DeferFeatureUpdates", boolToDWORD(s.FeatureUpdateDays > 0)))
+	reg.Set(DWORDEntry(windowsUpdateKey, "DeferFeatureUpdatesPeriodInDays", uint32(s.FeatureUpdateDays)))
+	reg.Set(DWORDEntry(windowsUpdateKey, "DeferQualityUpdates", boolToDWORD(s.QualityUpdateDays > 0)))
+	reg.Set(DWORDEntry(windowsUpdateKey, "DeferQualityUpdatesPeriodInDays", uint32(s.QualityUpdateDays)))
+	return nil
+}
+
+func (t *UpdateDeferralTemplate) Read(files *Files) (interface{}, bool) {
+	feature, featureOK := files.MachineRegistry.Get(windowsUpdateKey, "DeferFeatureUpdatesPeriodInDays")
+	quality, qualityOK := files.MachineRegistry.Get(windowsUpdateKey, "DeferQualityUpdatesPeriodInDays")
+	if !featureOK && !qualityOK {
+		return nil, false
+	}
+	featureDays, _ := feature.DWORD()
+	qualityDays, _ := quality.DWORD()
+	return &UpdateDeferralSettings{FeatureUpdateDays: int(featureDays), QualityUpdateDays: int(qualityDays)}, true
+}
+
+func (t *UpdateDeferralTemplate) Remove(files *Files) {
+	for _, name := range []string{"DeferFeatureUpdates", "DeferFeatureUpdatesPeriodInDays", "DeferQualityUpdates", "DeferQualityUpdatesPeriodInDays"} {
+		files.MachineRegistry.Delete(windowsUpdateKey, name)
+	}
+}
+
+// Desktop wallpaper
+
+const wallpaperKey = `Software\Microsoft\Windows\CurrentVersion\Policies\System`
+
+// wallpaperStyles maps style names to the WallpaperStyle policy values
+var wallpaperStyles = map[string]string{
+	"center":  "0",
+	"tile":    "1",
+	"stretch": "2",
+	"fit":     "3",
+	"fill":    "4",
+	"span":    "5",
+}
+
+// WallpaperSettings configures the enforced desktop wallpaper
+type WallpaperSettings struct {
+	Path  string `json:"path"`
+	Style string `json:"style"`
+}
+
+// WallpaperTemplate enforces a desktop wallpaper for users
+type WallpaperTemplate struct{}
+
+func (t *WallpaperTemplate) Info() TemplateInfo {
+	return TemplateInfo{
+		ID:          "desktop-wallpaper",
+		Name:        "Desktop Wallpaper",
+		Description: "Enforce a desktop wallpaper image from a network or local path",
+		Scope:       ScopeUser,
+		Extension:   ExtensionRegistryUser,
+	}
+}
+
+func (t *WallpaperTemplate) NewSettings() interface{} { return &WallpaperSettings{} }
+
+func (t *WallpaperTemplate) Apply(files *Files, settings interface{}) error {
+	s := settings.(*WallpaperSettings)
+	if strings.TrimSpace(s.Path) == "" {
+		return fmt.Errorf("path is required")
+	}
+	if s.Style == "" {
+		s.Style = "fill"
+	}
+	style, ok := wallpaperStyles[strings.ToLower(s.Style)]
+	if !ok {
+		return fmt.Errorf("invalid style: %s", s.Style)
+	}
+	files.UserRegistry.Set(StringEntry(wallpaperKey, "Wallpaper", s.Path))
+	files.UserRegistry.Set(StringEntry(wallpaperKey, "WallpaperStyle", style))
+	return nil
+}
+
+func (t *WallpaperTemplate) Read(files *Files) (interface{}, bool) {
+	entry, ok := files.UserRegistry.Get(wallpaperKey, "Wallpaper")
+	if !ok {
+		return nil, false
+	}
+	settings := &WallpaperSettings{}
+	settings.Path, _ = entry.String()
+	if styleEntry, ok := files.UserRegistry.Get(wallpaperKey, "WallpaperStyle"); ok {
+		value, _ := styleEntry.String()
+		for name, v := range wallpaperStyles {
+			if v == value {
+				settings.Style = name
+			}
+		}
+	}
+	return settings, true
+}
+
+func (t *WallpaperTemplate) Remove(files *Files) {
+	files.UserRegistry.Delete(wallpaperKey, "Wallpaper")
+	files.UserRegistry.Delete(wallpaperKey, "WallpaperStyle")
+}
+
+func boolToDWORD(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,207 @@
+package gpo
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/GptTmpl.inf is a Default Domain Policy style security template,
+// UTF-16LE with a BOM and "key = value" spacing as Windows writes it
+
+const sampleDrivesXML = `<?xml version="1.0" encoding="utf-8"?>
+<Drives clsid="{8FDDCC1A-0C3C-43cd-A6B4-71A6DF20DA8C}"><Drive clsid="{935D1B74-9CB8-4e3c-9914-7DD559B7A417}" name="S:" status="S:" image="2" changed="2024-03-05 14:12:09" uid="{5E2A3F6B-6B1D-4C43-9A0E-2B7C1D9F4E21}" bypassErrors="1"><Properties action="U" thisDrive="NOCHANGE" allDrives="NOCHANGE" userName="" path="\\fs1\shared" label="Shared" persistent="1" useLetter="1" letter="S"/></Drive><Drive clsid="{935D1B74-9CB8-4e3c-9914-7DD559B7A417}" name="H:" status="H:" image="2" changed="2024-03-05 14:12:40" uid="{0C8D1E57-3A2B-4F6D-8E1C-7B9A2D4F6E10}"><Properties action="U" thisDrive="NOCHANGE" allDrives="NOCHANGE" userName="" path="\\fs1\home\%USERNAME%" label="" persistent="0" useLetter="1" letter="H"/></Drive></Drives>`
+
+func TestSecurityTemplateRoundTrip(t *testing.T) {
+	sample, err := os.ReadFile("testdata/GptTmpl.inf")
+	if err != nil {
+		t.Fatalf("reading sample: %v", err)
+	}
+	tmpl := ParseSecurityTemplate(sample)
+
+	want := map[[2]string]string{
+		{SectionUnicode, "Unicode"}:                                                      "yes",
+		{SectionSystemAccess, "MinimumPasswordAge"}:                                      "1",
+		{SectionSystemAccess, "LockoutBadCount"}:                                         "0",
+		{SectionRegistryValues, `MACHINE\System\CurrentControlSet\Control\Lsa\NoLMHash`}: "4,1",
+		{SectionRegistryValues, screenLockKey}:                                           "4,900",
+		{SectionVersion, "signature"}:                                                    `"$CHICAGO$"`,
+	}
+	for key, value := range want {
+		if got, ok := tmpl.Get(key[0], key[1]); !ok || got != value {
+			t.Errorf("[%s] %s = %q, want %q", key[0], key[1], got, value)
+		}
+	}
+
+	encoded := tmpl.Bytes()
+	if !bytes.HasPrefix(encoded, []byte{0xFF, 0xFE}) {
+		t.Error("encoded template has no UTF-16LE BOM")
+	}
+	reparsed := ParseSecurityTemplate(encoded)
+	if !reflect.DeepEqual(reparsed, tmpl) {
+		t.Errorf("re-parsing changed the template:\n%s", decodeUTF16Text(encoded[2:]))
+	}
+	if again := reparsed.Bytes(); !bytes.Equal(again, encoded) {
+		t.Error("encoding is not stable across a round trip")
+	}
+	text := decodeUTF16Text(encoded[2:])
+	if !strings.HasPrefix(text, "[Unicode]\r\nUnicode=yes\r\n[System Access]\r\n") {
+		t.Errorf("section order or line endings changed:\n%s", text)
+	}
+}
+
+func TestSecurityTemplatePlainText(t *testing.T) {
+	tmpl := ParseSecurityTemplate([]byte("\ufeff[Version]\nsignature=\"$CHICAGO$\"\n; comment\n\n[System Access]\nMinimumPasswordLength = 12\n"))
+	if got, _ := tmpl.Get(SectionSystemAccess, "minimumpasswordlength"); got != "12" {
+		t.Errorf("MinimumPasswordLength = %q", got)
+	}
+
+	tmpl.Delete(SectionSystemAccess, "MinimumPasswordLength")
+	text := decodeUTF16Text(tmpl.Bytes()[2:])
+	if strings.Contains(text, "System Access") {
+		t.Errorf("empty section was kept:\n%s", text)
+	}
+	if text != "[Version]\r\nsignature=\"$CHICAGO$\"\r\n" {
+		t.Errorf("encoded template = %q", text)
+	}
+}
+
+func TestDrivesRoundTrip(t *testing.T) {
+	drives, err := ParseDrives([]byte(sampleDrivesXML))
+	if err != nil {
+		t.Fatalf("ParseDrives: %v", err)
+	}
+	if len(drives.Items) != 2 {
+		t.Fatalf("got %d drives, want 2", len(drives.Items))
+	}
+	shared := drives.Items[0]
+	if shared.UID != "{5E2A3F6B-6B1D-4C43-9A0E-2B7C1D9F4E21}" || shared.BypassErrors != 1 ||
+		shared.Properties.Path != `\\fs1\shared` || shared.Properties.Persistent != 1 || shared.Properties.Letter != "S" {
+		t.Errorf("S: = %+v", shared)
+	}
+
+	encoded, err := drives.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if !bytes.HasPrefix(encoded, []byte("<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n<Drives clsid=\""+drivesCLSID+"\">")) {
+		t.Errorf("unexpected header:\n%s", encoded)
+	}
+	reparsed, err := ParseDrives(encoded)
+	if err != nil {
+		t.Fatalf("ParseDrives after encoding: %v", err)
+	}
+	if !reflect.DeepEqual(reparsed, drives) {
+		t.Errorf("round trip changed the drives:\n%+v\n%+v", reparsed, drives)
+	}
+	if again, _ := reparsed.Bytes(); !bytes.Equal(again, encoded) {
+		t.Error("encoding is not stable across a round trip")
+	}
+	if !bytes.Contains(encoded, []byte(`path="\\fs1\home\%USERNAME%"`)) {
+		t.Errorf("environment variable in path was altered:\n%s", encoded)
+	}
+}
+
+func TestDrivesSetDriveKeepsUID(t *testing.T) {
+	drives, err := ParseDrives([]byte(sampleDrivesXML))
+	if err != nil {
+		t.Fatalf("ParseDrives: %v", err)
+	}
+	drives.SetDrive("s:", `\\fs2\shared`, "Shared", false)
+	drives.SetDrive("P", `\\fs1\projects`, "Projects", true)
+
+	if len(drives.Items) != 3 {
+		t.Fatalf("got %d drives, want 3", len(drives.Items))
+	}
+	if s := drives.Items[0]; s.UID != "{5E2A3F6B-6B1D-4C43-9A0E-2B7C1D9F4E21}" || s.Properties.Path != `\\fs2\shared` || s.Properties.Persistent != 0 {
+		t.Errorf("updated S: = %+v", s)
+	}
+	if p := drives.Items[2]; p.Name != "P:" || p.UID == "" || p.Properties.Persistent != 1 {
+		t.Errorf("added P: = %+v", p)
+	}
+}
+
+func TestTemplatesRoundTripThroughFiles(t *testing.T) {
+	settings := map[string]interface{}{
+		"screen-lock":       &ScreenLockSettings{TimeoutSeconds: 600},
+		"usb-storage":       &USBStorageSettings{DenyWrite: true},
+		"drive-mappings":    &DriveMappingSettings{Mappings: []DriveMapping{{Letter: "S", Path: `\\fs1\shared`, Label: "Shared", Persistent: true}}},
+		"update-deferral":   &UpdateDeferralSettings{FeatureUpdateDays: 60, QualityUpdateDays: 7},
+		"desktop-wallpaper": &WallpaperSettings{Path: `\\fs1\branding\wallpaper.jpg`, Style: "fit"},
+	}
+
+	machine, err := ParseRegistryPol(readRegistryPolSample(t))
+	if err != nil {
+		t.Fatalf("ParseRegistryPol: %v", err)
+	}
+	files := &Files{
+		MachineRegistry:  machine,
+		UserRegistry:     &RegistryPol{},
+		SecurityTemplate: NewSecurityTemplate(),
+		Drives:           NewDrives(),
+	}
+	for _, tmpl := range Templates() {
+		id := tmpl.Info().ID
+		if err := tmpl.Apply(files, settings[id]); err != nil {
+			t.Fatalf("%s: Apply: %v", id, err)
+		}
+	}
+
+	reloaded := encodeAndParse(t, files)
+	for _, tmpl := range Templates() {
+		id := tmpl.Info().ID
+		got, ok := tmpl.Read(reloaded)
+		if !ok {
+			t.Errorf("%s: not configured after a round trip", id)
+			continue
+		}
+		if !reflect.DeepEqual(got, settings[id]) {
+			t.Errorf("%s: read back %+v, want %+v", id, got, settings[id])
+		}
+	}
+
+	for _, tmpl := range Templates() {
+		tmpl.Remove(reloaded)
+	}
+	cleared := encodeAndParse(t, reloaded)
+	for _, tmpl := range Templates() {
+		if _, ok := tmpl.Read(cleared); ok {
+			t.Errorf("%s: still configured after Remove", tmpl.Info().ID)
+		}
+	}
+	// The sample's own deferral values are the template's and go with it
+	unrelated, _ := ParseRegistryPol(readRegistryPolSample(t))
+	(&UpdateDeferralTemplate{}).Remove(&Files{MachineRegistry: unrelated})
+	if !bytes.Equal(cleared.MachineRegistry.Bytes(), unrelated.Bytes()) {
+		t.Error("removing the templates changed unrelated machine policy")
+	}
+}
+
+// encodeAndParse writes the files out and reads them back as the service does
+func encodeAndParse(t *testing.T, files *Files) *Files {
+	t.Helper()
+	drives, err := files.Drives.Bytes()
+	if err != nil {
+		t.Fatalf("Drives.Bytes: %v", err)
+	}
+	machine, err := ParseRegistryPol(files.MachineRegistry.Bytes())
+	if err != nil {
+		t.Fatalf("parsing machine Registry.pol: %v", err)
+	}
+	user, err := ParseRegistryPol(files.UserRegistry.Bytes())
+	if err != nil {
+		t.Fatalf("parsing user Registry.pol: %v", err)
+	}
+	parsedDrives, err := ParseDrives(drives)
+	if err != nil {
+		t.Fatalf("parsing Drives.xml: %v", err)
+	}
+	return &Files{
+		MachineRegistry:  machine,
+		UserRegistry:     user,
+		SecurityTemplate: ParseSecurityTemplate(files.SecurityTemplate.Bytes()),
+		Drives:           parsedDrives,
+	}
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf16"
 
 	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
 	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
 )
 
 // ComputerHandler handles HTTP requests for computer operations
@@ -19,9 +25,12 @@ func NewComputerHandler() *ComputerHandler {
 	}
 }
 
-// ListComputers returns all computers/devices in the domain with connection status
+// ListComputers returns all computers/devices in the domain with connection status.
+// Reachability is served from cache unless ?refresh=true is given. ?tag= (repeated
+// or comma-separated) keeps computers carrying every listed tag and ?q= searches
+// names, asset tags, locations, owners and tags.
 func (h *ComputerHandler) ListComputers(c *gin.Context) {
-	computers, err := h.computerService.ListComputers()
+	computers, err := h.computerService.ListComputers(c.Query("refresh") == "true")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -29,6 +38,16 @@ func (h *ComputerHandler) ListComputers(c *gin.Context) {
 		return
 	}
 
+	var tags []string
+	for _, value := range c.QueryArray("tag") {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	computers = services.FilterComputers(computers, tags, c.Query("q"))
+
 	c.JSON(http.StatusOK, gin.H{
 		"computers": computers,
 		"count":     len(computers),
@@ -50,6 +69,66 @@ func (h *ComputerHandler) GetComputer(c *gin.Context) {
 	c.JSON(http.StatusOK, computer)
 }
 
+// GetComputerMetadata returns a computer's asset metadata and tags
+func (h *ComputerHandler) GetComputerMetadata(c *gin.Context) {
+	meta, err := h.computerService.GetMetadata(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, meta)
+}
+
+// UpdateComputerMetadata changes a computer's asset metadata and tags
+func (h *ComputerHandler) UpdateComputerMetadata(c *gin.Context) {
+	computerName := c.Param("id")
+
+	var req models.UpdateComputerMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	meta, warning, err := h.computerService.UpdateMetadata(computerName, req, c.GetString("username"))
+	if err != nil {
+		utils.LogComputerManagement(ctx, "computer_metadata_update", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	details := map[string]interface{}{
+		"asset_tag":         meta.AssetTag,
+		"location":          meta.Location,
+		"owner":             meta.Owner,
+		"tags":              meta.Tags,
+		"sync_overlay_tags": meta.SyncOverlayTags,
+		"overlay_tags":      meta.OverlayTags,
+	}
+	if warning != "" {
+		details["warning"] = warning
+	}
+	utils.LogComputerManagement(ctx, "computer_metadata_update", meta.ComputerName, true, details)
+
+	response := gin.H{
+		"message":  "Computer metadata updated successfully",
+		"metadata": meta,
+	}
+	if warning != "" {
+		response["warning"] = warning
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // GetMachineDetails returns detailed information about a specific machine
 func (h *ComputerHandler) GetMachineDetails(c *gin.Context) {
 	machineId := c.Param("id")
@@ -65,6 +144,82 @@ func (h *ComputerHandler) GetMachineDetails(c *gin.Context) {
 	c.JSON(http.StatusOK, details)
 }
 
+// PrestageComputer creates a computer account before the machine joins the domain
+func (h *ComputerHandler) PrestageComputer(c *gin.Context) {
+	var req models.PrestageComputerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	computer, err := h.computerService.PrestageComputer(req)
+	if err != nil {
+		utils.LogComputerManagement(ctx, "computer_prestage", req.Name, false, map[string]interface{}{
+			"ou_path":    req.OUPath,
+			"managed_by": req.ManagedBy,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogComputerManagement(ctx, "computer_prestage", computer.Name, true, map[string]interface{}{
+		"ou_path":    req.OUPath,
+		"managed_by": req.ManagedBy,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Computer account created successfully",
+		"computer": computer,
+	})
+}
+
+// GenerateOfflineJoin returns djoin offline join data for a pre-staged computer.
+// With ?format=file the data is returned as a UTF-16 file ready for djoin /loadfile.
+func (h *ComputerHandler) GenerateOfflineJoin(c *gin.Context) {
+	computerName := c.Param("id")
+
+	var req models.OfflineJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	data, err := h.computerService.ProvisionOfflineJoin(computerName, req)
+	if err != nil {
+		utils.LogComputerManagement(ctx, "computer_offline_join", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogComputerManagement(ctx, "computer_offline_join", data.ComputerName, true, nil)
+
+	if c.Query("format") == "file" {
+		c.Header("Cache-Control", "no-store")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", data.FileName))
+		c.Data(http.StatusOK, "text/plain; charset=utf-16le", encodeUTF16LE(data.Blob))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Offline join data generated successfully",
+		"offline_join": data,
+	})
+}
+
 // DeleteComputer removes a computer from the domain
 func (h *ComputerHandler) DeleteComputer(c *gin.Context) {
 	computerName := c.Param("id")
@@ -82,3 +237,190 @@ func (h *ComputerHandler) DeleteComputer(c *gin.Context) {
 		"name":    computerName,
 	})
 }
+
+// ListStaleComputers reports computers inactive in both AD and Headscale for
+// ?days= days, defaulting to the stale computer policy threshold
+func (h *ComputerHandler) ListStaleComputers(c *gin.Context) {
+	policy, err := h.computerService.GetStalePolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	days := policy.ThresholdDays
+	if value := c.Query("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "days must be a number",
+			})
+			return
+		}
+	}
+
+	computers, err := h.computerService.StaleComputers(days)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"computers": computers,
+		"count":     len(computers),
+		"days":      days,
+	})
+}
+
+// QuarantineStaleComputers disables the named computers and moves them to the
+// quarantine OU, where they are deleted once the grace period ends
+func (h *ComputerHandler) QuarantineStaleComputers(c *gin.Context) {
+	var req models.StaleComputerActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	// Quarantine records name who disabled each computer
+	if c.GetString("username") == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	results, err := h.computerService.QuarantineComputers(utils.GetAuditContext(c), req.Names)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Quarantine completed",
+		"results": results,
+	})
+}
+
+// ListQuarantinedComputers returns computers waiting for deletion in quarantine
+func (h *ComputerHandler) ListQuarantinedComputers(c *gin.Context) {
+	computers, err := h.computerService.ListQuarantined()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"computers": computers,
+		"count":     len(computers),
+	})
+}
+
+// PurgeQuarantinedComputers deletes quarantined computers whose grace period has ended
+func (h *ComputerHandler) PurgeQuarantinedComputers(c *gin.Context) {
+	results, err := h.computerService.PurgeQuarantined(utils.GetAuditContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Purge completed",
+		"results": results,
+	})
+}
+
+// RestoreComputer moves a quarantined computer back to its original container
+func (h *ComputerHandler) RestoreComputer(c *gin.Context) {
+	computerName := c.Param("id")
+
+	ctx := utils.GetAuditContext(c)
+	record, err := h.computerService.RestoreComputer(computerName)
+	if err != nil {
+		utils.LogComputerManagement(ctx, "computer_quarantine_restore", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogComputerManagement(ctx, "computer_quarantine_restore", record.Name, true, map[string]interface{}{
+		"restored_to": record.OriginalDN,
+		"enabled":     record.WasEnabled,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Computer restored successfully",
+		"name":    record.Name,
+	})
+}
+
+// GetStalePolicy returns the stale computer policy
+func (h *ComputerHandler) GetStalePolicy(c *gin.Context) {
+	policy, err := h.computerService.GetStalePolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateStalePolicy saves the stale computer policy
+func (h *ComputerHandler) UpdateStalePolicy(c *gin.Context) {
+	var policy models.StaleComputerPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.computerService.SaveStalePolicy(&policy); err != nil {
+		utils.LogDomainManagement(ctx, "stale_computer_policy_update", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "stale_computer_policy_update", true, map[string]interface{}{
+		"threshold_days": policy.ThresholdDays,
+		"grace_days":     policy.GraceDays,
+		"quarantine_ou":  policy.QuarantineOU,
+		"auto_purge":     policy.AutoPurge,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Stale computer policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+// encodeUTF16LE encodes text as UTF-16LE with a byte order mark, the format djoin reads
+func encodeUTF16LE(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	out := make([]byte, 2, 2+len(units)*2)
+	out[0], out[1] = 0xFF, 0xFE
+	for _, u := range units {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
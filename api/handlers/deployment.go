@@ -5,21 +5,29 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
 	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
 )
 
 // DeploymentHandler handles computer deployment operations
 type DeploymentHandler struct {
 	headscaleService *services.HeadscaleService
+	joinTokenService *services.JoinTokenService
+	computerService  *services.ComputerService
 }
 
 // NewDeploymentHandler creates a new DeploymentHandler instance
 func NewDeploymentHandler() *DeploymentHandler {
 	return &DeploymentHandler{
 		headscaleService: services.NewHeadscaleService(),
+		joinTokenService: services.NewJoinTokenService(),
+		computerService:  services.NewComputerService(),
 	}
 }
 
@@ -63,6 +71,44 @@ func (h *DeploymentHandler) GetDeploymentScripts(c *gin.Context) {
 				"Headscale server configured",
 			},
 		},
+		{
+			"id":          "prestaged",
+			"name":        "Pre-staged Domain Join",
+			"description": "Join using a computer account created in advance, optionally offline with djoin",
+			"icon":        "📋",
+			"enabled":     true,
+			"requirements": []string{
+				"Administrator privileges",
+				"Computer account pre-staged in Vexa",
+				"Network access to domain controller (not needed for offline join)",
+			},
+		},
+		{
+			"id":          "linux-debian",
+			"name":        "Linux Domain Join (Ubuntu/Debian)",
+			"description": "Install realmd/sssd, join the domain and configure sudo; optionally join the Tailnet",
+			"icon":        "🐧",
+			"platform":    "linux",
+			"enabled":     true,
+			"requirements": []string{
+				"Root privileges (sudo)",
+				"Host uses the domain controller for DNS",
+				"Headscale server configured (only when joining the Tailnet)",
+			},
+		},
+		{
+			"id":          "linux-rhel",
+			"name":        "Linux Domain Join (RHEL family)",
+			"description": "Install realmd/sssd, join the domain and configure sudo; optionally join the Tailnet",
+			"icon":        "🎩",
+			"platform":    "linux",
+			"enabled":     true,
+			"requirements": []string{
+				"Root privileges (sudo)",
+				"Host uses the domain controller for DNS",
+				"Headscale server configured (only when joining the Tailnet)",
+			},
+		},
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -71,13 +117,20 @@ func (h *DeploymentHandler) GetDeploymentScripts(c *gin.Context) {
 	})
 }
 
-// GenerateDeploymentCommand generates a PowerShell command for deployment
+// GenerateDeploymentCommand issues a signed one-time script link for a deployment.
+// Tailnet scripts get a single-use pre-auth key minted when the link is downloaded.
 func (h *DeploymentHandler) GenerateDeploymentCommand(c *gin.Context) {
 	var req struct {
 		ScriptType       string `json:"script_type" binding:"required"`
 		DomainName       string `json:"domain_name"`
 		DomainController string `json:"domain_controller"`
 		ComputerName     string `json:"computer_name,omitempty"`
+		JoinTailnet      bool   `json:"join_tailnet,omitempty"`       // Linux scripts only
+		SudoGroup        string `json:"sudo_group,omitempty"`         // Linux scripts only
+		ExpiresInMinutes int    `json:"expires_in_minutes,omitempty"` // Link lifetime, default 60
+		OfflineJoin      bool   `json:"offline_join,omitempty"`       // Pre-staged script only
+		AdminUser        string `json:"admin_user,omitempty"`         // Used once to generate offline join data
+		AdminPassword    string `json:"admin_password,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -87,117 +140,322 @@ func (h *DeploymentHandler) GenerateDeploymentCommand(c *gin.Context) {
 		return
 	}
 
+	scriptName, ok := deploymentScriptName(req.ScriptType)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid script type",
+		})
+		return
+	}
+
+	isLinux := strings.HasSuffix(scriptName, ".sh")
+	joinTailnet := isLinux && req.JoinTailnet
+	usesTailnet := scriptUsesTailnet(scriptName, joinTailnet)
+
+	if isLinux && !isValidSudoGroup(req.SudoGroup) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid sudo group name",
+		})
+		return
+	}
+	if req.ComputerName != "" && !services.IsValidComputerName(req.ComputerName) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid computer name",
+		})
+		return
+	}
+	if !h.checkPrestagedAccount(c, scriptName, req.ComputerName) {
+		return
+	}
+
 	// Check if Headscale is enabled for Tailscale options
 	headscaleEnabled := h.headscaleService.IsEnabled()
-	if (req.ScriptType == "tailscale-domain" || req.ScriptType == "tailnet-add") && !headscaleEnabled {
+	if usesTailnet && !headscaleEnabled {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Headscale is not enabled. Cannot use Tailscale deployment options.",
 		})
 		return
 	}
 
-	var command string
-	var scriptName string
-	var authKey string
+	ctx := utils.GetAuditContext(c)
 
-	// Get existing infrastructure pre-auth key for Tailscale options
-	if req.ScriptType == "tailscale-domain" || req.ScriptType == "tailnet-add" {
-		// Use the existing infrastructure key instead of creating a new one
-		existingKey, err := h.headscaleService.GetInfrastructureKey()
+	// Offline join data is generated now, while credentials are at hand, and
+	// embedded in the script when the link is downloaded
+	offlineBlob := ""
+	if req.OfflineJoin {
+		if scriptName != "domain-join-prestaged.bat" || req.AdminPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Offline join requires the pre-staged script and admin_password",
+			})
+			return
+		}
+		data, err := h.computerService.ProvisionOfflineJoin(req.ComputerName, models.OfflineJoinRequest{
+			AdminUser:     req.AdminUser,
+			AdminPassword: req.AdminPassword,
+		})
 		if err != nil {
+			utils.LogComputerManagement(ctx, "computer_offline_join", req.ComputerName, false, map[string]interface{}{
+				"error": err.Error(),
+			})
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		utils.LogComputerManagement(ctx, "computer_offline_join", req.ComputerName, true, nil)
+		offlineBlob = data.Blob
+	}
+
+	token, err := h.joinTokenService.Issue(models.JoinToken{
+		ComputerName: req.ComputerName,
+		ScriptName:   scriptName,
+		JoinTailnet:  usesTailnet,
+		SudoGroup:    req.SudoGroup,
+		OfflineJoin:  offlineBlob != "",
+		IssuedBy:     c.GetString("username"),
+	}, time.Duration(req.ExpiresInMinutes)*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if offlineBlob != "" {
+		if err := h.joinTokenService.SetOfflineJoinBlob(token.ID, offlineBlob); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to get infrastructure key: %v", err),
+				"error": err.Error(),
 			})
 			return
 		}
-		authKey = existingKey
 	}
 
-	switch req.ScriptType {
-	case "tailscale-domain":
-		scriptName = "domain-join-with-tailscale.bat"
-		command = scriptName
+	signedPath, err := h.joinTokenService.SignedPath(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	scriptURL := getBaseURL(c) + signedPath
 
-	case "domain-only":
-		scriptName = "domain-join-only.bat"
-		command = scriptName
+	utils.LogComputerManagement(ctx, "deployment_link_issue", req.ComputerName, true, map[string]interface{}{
+		"token_id":     token.ID,
+		"script":       scriptName,
+		"join_tailnet": usesTailnet,
+		"expires_at":   token.ExpiresAt,
+	})
 
-	case "tailnet-add":
-		scriptName = "tailnet-add.bat"
-		command = scriptName
+	command := scriptName
+	instructions := []string{
+		"1. Download the script using the 'Download Script' button (the link works once)",
+		"2. Right-click the downloaded .bat file",
+		"3. Select 'Run as Administrator'",
+		"4. Follow the on-screen prompts",
+	}
+	if isLinux {
+		command = fmt.Sprintf("curl -fsSLo %s '%s' && sudo bash %s", scriptName, scriptURL, scriptName)
+		instructions = []string{
+			"1. Run the command on the Linux host (the link works once)",
+			"2. Enter the domain administrator password when prompted",
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"command":      command,
+		"script_url":   scriptURL,
+		"instructions": instructions,
+		"token":        token,
+		"expires_at":   token.ExpiresAt,
+	})
+}
+
+// DownloadDeploymentScript serves a script through a signed one-time link.
+// The route is public; the link signature and single use are the authorization.
+func (h *DeploymentHandler) DownloadDeploymentScript(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	token, err := h.joinTokenService.Consume(c.Param("token"), c.Query("expires"), c.Query("sig"), c.ClientIP())
+	if err != nil {
+		utils.LogSecurityEvent(ctx, "deployment_link_rejected", "medium", false, map[string]interface{}{
+			"token_id": c.Param("token"),
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	default:
+	h.serveScript(c, token)
+}
+
+// ServeDeploymentScript serves a script directly to an authenticated administrator.
+// Options come from the query string: computer_name, and tailnet/sudo_group for Linux.
+func (h *DeploymentHandler) ServeDeploymentScript(c *gin.Context) {
+	scriptName := c.Param("script")
+	if !isDeploymentScript(scriptName) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Script not found",
+		})
+		return
+	}
+
+	isLinux := strings.HasSuffix(scriptName, ".sh")
+	joinTailnet := isLinux && c.Query("tailnet") == "1"
+	sudoGroup := c.Query("sudo_group")
+	computerName := c.Query("computer_name")
+	if isLinux && !isValidSudoGroup(sudoGroup) {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid script type",
+			"error": "Invalid sudo group name",
+		})
+		return
+	}
+	if computerName != "" && !services.IsValidComputerName(computerName) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid computer name",
 		})
 		return
 	}
+	if !h.checkPrestagedAccount(c, scriptName, computerName) {
+		return
+	}
 
-	response := gin.H{
-		"command":    command,
-		"script_url": fmt.Sprintf("%s/api/deployment/scripts/%s", getBaseURL(c), scriptName),
-		"instructions": []string{
-			"1. Download the script using the 'Download Script' button",
-			"2. Right-click the downloaded .bat file",
-			"3. Select 'Run as Administrator'",
-			"4. Follow the on-screen prompts",
-		},
+	token, err := h.joinTokenService.IssueConsumed(models.JoinToken{
+		ComputerName: computerName,
+		ScriptName:   scriptName,
+		JoinTailnet:  scriptUsesTailnet(scriptName, joinTailnet),
+		SudoGroup:    sudoGroup,
+		IssuedBy:     c.GetString("username"),
+	}, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	// Include auth key info for Tailscale options (for debugging/admin purposes)
-	if authKey != "" {
-		response["auth_key_generated"] = true
-		response["auth_key_preview"] = authKey[:20] + "..." // Show first 20 chars for verification
+	h.serveScript(c, token)
+}
+
+// ListJoinTokens returns issued deployment links and their pre-auth key state
+func (h *DeploymentHandler) ListJoinTokens(c *gin.Context) {
+	tokens, err := h.joinTokenService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"count":  len(tokens),
+	})
 }
 
-// ServeDeploymentScript serves the actual PowerShell script files
-func (h *DeploymentHandler) ServeDeploymentScript(c *gin.Context) {
-	scriptName := c.Param("script")
+// RevokeJoinToken invalidates a deployment link and expires its unused pre-auth key
+func (h *DeploymentHandler) RevokeJoinToken(c *gin.Context) {
+	id := c.Param("id")
 
-	// Validate script name for security
-	allowedScripts := []string{
-		"domain-join-with-tailscale.bat",
-		"domain-join-only.bat",
-		"tailnet-add.bat",
+	ctx := utils.GetAuditContext(c)
+	token, err := h.joinTokenService.Revoke(id)
+	if err != nil {
+		utils.LogComputerManagement(ctx, "deployment_link_revoke", "", false, map[string]interface{}{
+			"token_id": id,
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	isAllowed := false
-	for _, allowed := range allowedScripts {
-		if scriptName == allowed {
-			isAllowed = true
-			break
+	utils.LogComputerManagement(ctx, "deployment_link_revoke", token.ComputerName, true, map[string]interface{}{
+		"token_id": id,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Deployment link revoked successfully",
+		"token":   token,
+	})
+}
+
+// serveScript renders a consumed token's script, minting its pre-auth key if needed
+func (h *DeploymentHandler) serveScript(c *gin.Context, token *models.JoinToken) {
+	ctx := utils.GetAuditContext(c)
+
+	authKey := ""
+	if token.JoinTailnet {
+		key, err := h.joinTokenService.MintKey(token.ID)
+		if err != nil {
+			utils.LogComputerManagement(ctx, "deployment_script_download", token.ComputerName, false, map[string]interface{}{
+				"token_id": token.ID,
+				"error":    err.Error(),
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to create pre-auth key: %v", err),
+			})
+			return
 		}
+		authKey = key
 	}
 
-	if !isAllowed {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Script not found",
+	offlineBlob := ""
+	if token.OfflineJoin {
+		blob, err := h.joinTokenService.TakeOfflineJoinBlob(token.ID)
+		if err != nil {
+			h.joinTokenService.Fail(token.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		offlineBlob = blob
+	}
+
+	content, err := h.renderScript(c, token, authKey, offlineBlob)
+	if err != nil {
+		h.joinTokenService.Fail(token.ID, err)
+		utils.LogComputerManagement(ctx, "deployment_script_download", token.ComputerName, false, map[string]interface{}{
+			"token_id": token.ID,
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Get the script content
-	scriptPath := filepath.Join("scripts", "deployment", scriptName)
+	utils.LogComputerManagement(ctx, "deployment_script_download", token.ComputerName, true, map[string]interface{}{
+		"token_id":    token.ID,
+		"script":      token.ScriptName,
+		"key_created": authKey != "",
+	})
+
+	// Set appropriate headers
+	contentType := "text/plain"
+	if strings.HasSuffix(token.ScriptName, ".bat") {
+		contentType = "application/x-bat"
+	} else if strings.HasSuffix(token.ScriptName, ".sh") {
+		contentType = "application/x-sh"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", token.ScriptName))
+	c.String(http.StatusOK, content)
+}
+
+// renderScript fills in a deployment script's template variables
+func (h *DeploymentHandler) renderScript(c *gin.Context, token *models.JoinToken, authKey, offlineBlob string) (string, error) {
+	scriptPath := filepath.Join("scripts", "deployment", token.ScriptName)
 	scriptContent, err := os.ReadFile(scriptPath)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Script file not found",
-		})
-		return
+		return "", fmt.Errorf("script file not found")
 	}
 
-	// Replace template variables with actual values
-	// Get domain info
 	domainService := services.NewDomainService()
 	domainStatus, err := domainService.GetDomainStatus()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get domain status",
-		})
-		return
+		return "", fmt.Errorf("failed to get domain status")
 	}
 
 	// Resolve login server URL (full) used by tailscale up
@@ -207,16 +465,6 @@ func (h *DeploymentHandler) ServeDeploymentScript(c *gin.Context) {
 		loginServer = getBaseURL(c) + "/mesh"
 	}
 
-	// Get auth key if this is a Tailscale script
-	authKey := ""
-	if strings.Contains(scriptName, "tailscale") || strings.Contains(scriptName, "tailnet") {
-		// Try to get infrastructure key
-		existingKey, keyErr := h.headscaleService.GetInfrastructureKey()
-		if keyErr == nil {
-			authKey = existingKey
-		}
-	}
-
 	// Replace all template variables
 	processedContent := string(scriptContent)
 	processedContent = strings.ReplaceAll(processedContent, "{{LOGIN_SERVER}}", loginServer)
@@ -226,15 +474,131 @@ func (h *DeploymentHandler) ServeDeploymentScript(c *gin.Context) {
 	// DO NOT inject admin credentials - scripts should prompt for them
 	processedContent = strings.ReplaceAll(processedContent, "{{ADMIN_USER}}", "administrator@"+domainStatus.Realm)
 	processedContent = strings.ReplaceAll(processedContent, "{{ADMIN_PASSWORD}}", "PROMPT_FOR_PASSWORD")
+	processedContent = strings.ReplaceAll(processedContent, "{{COMPUTER_NAME}}", token.ComputerName)
+	if strings.Contains(processedContent, "{{ODJ_BLOB}}") {
+		offlineJoin := "no"
+		if offlineBlob != "" {
+			offlineJoin = "yes"
+		}
+		processedContent = strings.ReplaceAll(processedContent, "{{OFFLINE_JOIN}}", offlineJoin)
+		processedContent = strings.ReplaceAll(processedContent, "{{ODJ_BLOB}}", offlineBlob)
+	}
+	if strings.Contains(processedContent, "{{LAPS_ENABLED}}") {
+		lapsEnabled := "no"
+		ageDays, length, adminAccount := 30, 14, ""
+		if settings, enabled := services.NewLAPSService().ScriptSettings(); settings != nil {
+			if enabled {
+				lapsEnabled = "yes"
+			}
+			ageDays, length, adminAccount = settings.PasswordAgeDays, settings.PasswordLength, settings.AdminAccountName
+		}
+		processedContent = strings.ReplaceAll(processedContent, "{{LAPS_ENABLED}}", lapsEnabled)
+		processedContent = strings.ReplaceAll(processedContent, "{{LAPS_PASSWORD_AGE_DAYS}}", strconv.Itoa(ageDays))
+		processedContent = strings.ReplaceAll(processedContent, "{{LAPS_PASSWORD_LENGTH}}", strconv.Itoa(length))
+		processedContent = strings.ReplaceAll(processedContent, "{{LAPS_ADMIN_ACCOUNT}}", adminAccount)
+	}
+	if strings.Contains(processedContent, "{{INVENTORY_TOKEN}}") {
+		// Each script carries its own credential, bound to the computer that joins with it
+		inventoryEnabled, credential, interval := "no", "", 4
+		inventoryService := services.NewInventoryService()
+		if settings, err := inventoryService.GetSettings(); err == nil {
+			interval = settings.IntervalHours
+			if credential, err = inventoryService.IssueCredential(token.ComputerName, token.ID); err == nil {
+				inventoryEnabled = "yes"
+			} else {
+				utils.Warn("Inventory check-in disabled for join token %s: %v", token.ID, err)
+			}
+		}
+		processedContent = strings.ReplaceAll(processedContent, "{{VEXA_URL}}", getBaseURL(c))
+		processedContent = strings.ReplaceAll(processedContent, "{{INVENTORY_ENABLED}}", inventoryEnabled)
+		processedContent = strings.ReplaceAll(processedContent, "{{INVENTORY_TOKEN}}", credential)
+		processedContent = strings.ReplaceAll(processedContent, "{{INVENTORY_INTERVAL_HOURS}}", strconv.Itoa(interval))
+	}
+	if strings.HasSuffix(token.ScriptName, ".sh") {
+		joinValue := "no"
+		if token.JoinTailnet {
+			joinValue = "yes"
+		}
+		// sssd reads the directory's uidNumber/gidNumber when Vexa assigns POSIX IDs
+		idMapping := "True"
+		if services.NewPosixService().AutoAssignEnabled() {
+			idMapping = "False"
+		}
+		processedContent = strings.ReplaceAll(processedContent, "{{JOIN_TAILNET}}", joinValue)
+		processedContent = strings.ReplaceAll(processedContent, "{{SUDO_GROUP}}", token.SudoGroup)
+		processedContent = strings.ReplaceAll(processedContent, "{{ID_MAPPING}}", idMapping)
+	}
 
-	// Set appropriate headers
-	contentType := "text/plain"
-	if strings.HasSuffix(scriptName, ".bat") {
-		contentType = "application/x-bat"
+	return processedContent, nil
+}
+
+// deploymentScriptName maps a script type to its file under scripts/deployment
+func deploymentScriptName(scriptType string) (string, bool) {
+	switch scriptType {
+	case "tailscale-domain":
+		return "domain-join-with-tailscale.bat", true
+	case "domain-only":
+		return "domain-join-only.bat", true
+	case "tailnet-add":
+		return "tailnet-add.bat", true
+	case "prestaged":
+		return "domain-join-prestaged.bat", true
+	case "linux-debian":
+		return "linux-join-debian.sh", true
+	case "linux-rhel":
+		return "linux-join-rhel.sh", true
 	}
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", scriptName))
-	c.String(http.StatusOK, processedContent)
+	return "", false
+}
+
+// isDeploymentScript checks a file name against the known deployment scripts
+func isDeploymentScript(scriptName string) bool {
+	for _, scriptType := range []string{"tailscale-domain", "domain-only", "tailnet-add", "prestaged", "linux-debian", "linux-rhel"} {
+		if name, _ := deploymentScriptName(scriptType); name == scriptName {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptUsesTailnet reports whether a script connects the machine to the Tailnet
+func scriptUsesTailnet(scriptName string, joinTailnet bool) bool {
+	return strings.Contains(scriptName, "tailscale") || strings.Contains(scriptName, "tailnet") || joinTailnet
+}
+
+// checkPrestagedAccount ensures the pre-staged script targets an existing
+// computer account, writing an error response otherwise
+func (h *DeploymentHandler) checkPrestagedAccount(c *gin.Context, scriptName, computerName string) bool {
+	if scriptName != "domain-join-prestaged.bat" {
+		return true
+	}
+	if computerName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "computer_name is required for the pre-staged script",
+		})
+		return false
+	}
+	if !h.computerService.ComputerExists(computerName) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Computer %s has not been pre-staged", computerName),
+		})
+		return false
+	}
+	return true
+}
+
+// isValidSudoGroup checks a group name is safe to embed in a shell script and sudoers.
+// An empty name means no sudo rule.
+func isValidSudoGroup(name string) bool {
+	if len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ' ' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
 }
 
 // Helper function to get base URL
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// GPOHandler handles HTTP requests for group policy templates
+type GPOHandler struct {
+	gpoService *services.GPOService
+}
+
+// NewGPOHandler creates a new GPOHandler instance
+func NewGPOHandler() *GPOHandler {
+	return &GPOHandler{
+		gpoService: services.NewGPOService(),
+	}
+}
+
+// ListGPOs returns all group policy objects in the domain
+func (h *GPOHandler) ListGPOs(c *gin.Context) {
+	gpos, err := h.gpoService.ListGPOs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gpos":  gpos,
+		"count": len(gpos),
+	})
+}
+
+// ListTemplates returns the curated policy templates
+func (h *GPOHandler) ListTemplates(c *gin.Context) {
+	templates := h.gpoService.ListTemplates()
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+// GetGPOTemplates returns the curated template settings currently in a GPO
+func (h *GPOHandler) GetGPOTemplates(c *gin.Context) {
+	gpoID := c.Param("id")
+
+	states, err := h.gpoService.GetTemplateSettings(gpoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gpo":       gpoID,
+		"templates": states,
+	})
+}
+
+// ApplyGPOTemplate writes a curated template into a GPO
+func (h *GPOHandler) ApplyGPOTemplate(c *gin.Context) {
+	gpoID := c.Param("id")
+	templateID := c.Param("template")
+
+	var settings json.RawMessage
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.gpoService.ApplyTemplate(gpoID, templateID, settings); err != nil {
+		utils.LogDomainManagement(ctx, "gpo_template_apply", false, map[string]interface{}{
+			"gpo":      gpoID,
+			"template": templateID,
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "gpo_template_apply", true, map[string]interface{}{
+		"gpo":      gpoID,
+		"template": templateID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Policy template applied successfully",
+		"gpo":      gpoID,
+		"template": templateID,
+	})
+}
+
+// RemoveGPOTemplate removes a curated template's settings from a GPO
+func (h *GPOHandler) RemoveGPOTemplate(c *gin.Context) {
+	gpoID := c.Param("id")
+	templateID := c.Param("template")
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.gpoService.RemoveTemplate(gpoID, templateID); err != nil {
+		utils.LogDomainManagement(ctx, "gpo_template_remove", false, map[string]interface{}{
+			"gpo":      gpoID,
+			"template": templateID,
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "gpo_template_remove", true, map[string]interface{}{
+		"gpo":      gpoID,
+		"template": templateID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Policy template removed successfully",
+		"gpo":      gpoID,
+		"template": templateID,
+	})
+}
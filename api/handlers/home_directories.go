@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// HomeDirectoryHandler handles HTTP requests for the home directory policy
+type HomeDirectoryHandler struct {
+	homeService *services.HomeDirectoryService
+}
+
+// NewHomeDirectoryHandler creates a new HomeDirectoryHandler instance
+func NewHomeDirectoryHandler() *HomeDirectoryHandler {
+	return &HomeDirectoryHandler{
+		homeService: services.NewHomeDirectoryService(),
+	}
+}
+
+// GetPolicy returns the home directory and roaming profile policy
+func (h *HomeDirectoryHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.homeService.GetPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdatePolicy replaces the home directory and roaming profile policy
+func (h *HomeDirectoryHandler) UpdatePolicy(c *gin.Context) {
+	var policy models.HomeDirectoryPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.homeService.SavePolicy(&policy); err != nil {
+		utils.LogDomainManagement(ctx, "home_directory_policy_update", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "home_directory_policy_update", true, map[string]interface{}{
+		"enabled":       policy.Enabled,
+		"share":         policy.Share,
+		"profile_share": policy.ProfileShare,
+		"delete_action": policy.DeleteAction,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Home directory policy updated successfully",
+		"policy":  policy,
+	})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// maxInventoryReportSize bounds the body of a check-in request
+const maxInventoryReportSize = 2 << 20
+
+// InventoryHandler handles computer inventory check-ins
+type InventoryHandler struct {
+	inventoryService *services.InventoryService
+}
+
+// NewInventoryHandler creates a new InventoryHandler instance
+func NewInventoryHandler() *InventoryHandler {
+	return &InventoryHandler{
+		inventoryService: services.NewInventoryService(),
+	}
+}
+
+// CheckIn receives an inventory report from a computer's scheduled task,
+// authenticated with the credential issued to that computer
+func (h *InventoryHandler) CheckIn(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	credential := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !h.inventoryService.ValidateCredential(credential) {
+		utils.LogSecurityEvent(ctx, "inventory_checkin_denied", "medium", false, nil)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid check-in credential",
+		})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxInventoryReportSize)
+	var report models.InventoryReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	inventory, changes, err := h.inventoryService.CheckIn(report, credential, c.ClientIP())
+	if errors.Is(err, services.ErrInventoryHostnameMismatch) {
+		utils.LogSecurityEvent(ctx, "inventory_checkin_hostname_mismatch", "high", false, map[string]interface{}{
+			"hostname": report.Hostname,
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogSecurityEvent(ctx, "inventory_checkin_rejected", "low", false, map[string]interface{}{
+			"hostname": report.Hostname,
+			"error":    err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.Debug("Inventory check-in from %s (%d changes)", inventory.ComputerName, len(changes))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Inventory received",
+		"changes": len(changes),
+	})
+}
+
+// Agent serves the PowerShell check-in script installed by the domain-join scripts
+func (h *InventoryHandler) Agent(c *gin.Context) {
+	content, err := os.ReadFile(filepath.Join("scripts", "deployment", "vexa-checkin.ps1"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Check-in script not found",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=\"vexa-checkin.ps1\"")
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", content)
+}
+
+// GetComputerInventory returns a computer's latest inventory and its change history
+func (h *InventoryHandler) GetComputerInventory(c *gin.Context) {
+	inventory, history, err := h.inventoryService.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"inventory": inventory,
+		"history":   history,
+		"count":     len(history),
+	})
+}
+
+// GetSettings returns the inventory check-in settings
+func (h *InventoryHandler) GetSettings(c *gin.Context) {
+	settings, err := h.inventoryService.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings changes the check-in interval used by newly deployed computers
+func (h *InventoryHandler) UpdateSettings(c *gin.Context) {
+	var req struct {
+		IntervalHours int `json:"interval_hours" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.inventoryService.SetInterval(req.IntervalHours)
+	if err != nil {
+		utils.LogDomainManagement(ctx, "inventory_settings_update", false, map[string]interface{}{
+			"interval_hours": req.IntervalHours,
+			"error":          err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "inventory_settings_update", true, map[string]interface{}{
+		"interval_hours": settings.IntervalHours,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Inventory settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// IssueCredential issues a new check-in credential for an existing computer.
+// The computer keeps using its current credential until its check-in
+// configuration is updated with the new one.
+func (h *InventoryHandler) IssueCredential(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	computerName := c.Param("id")
+	credential, err := h.inventoryService.IssueComputerCredential(computerName)
+	if err != nil {
+		utils.LogComputerManagement(ctx, "inventory_credential_issue", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogComputerManagement(ctx, "inventory_credential_issue", computerName, true, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Check-in credential issued",
+		"credential": credential,
+	})
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// LAPSHandler handles HTTP requests for managed local administrator passwords
+type LAPSHandler struct {
+	lapsService *services.LAPSService
+}
+
+// NewLAPSHandler creates a new LAPSHandler instance
+func NewLAPSHandler() *LAPSHandler {
+	return &LAPSHandler{
+		lapsService: services.NewLAPSService(),
+	}
+}
+
+// GetSettings returns the LAPS settings
+func (h *LAPSHandler) GetSettings(c *gin.Context) {
+	settings, err := h.lapsService.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings saves the LAPS settings
+func (h *LAPSHandler) UpdateSettings(c *gin.Context) {
+	var req models.LAPSSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.authorizeAdministration(c); err != nil {
+		utils.LogSecurityEvent(ctx, "laps_settings_update_denied", "high", false, map[string]interface{}{
+			"reader_group": req.ReaderGroup,
+			"error":        err.Error(),
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	settings, err := h.lapsService.SaveSettings(req)
+	if err != nil {
+		utils.LogDomainManagement(ctx, "laps_settings_update", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "laps_settings_update", true, map[string]interface{}{
+		"enabled":           settings.Enabled,
+		"reader_group":      settings.ReaderGroup,
+		"password_age_days": settings.PasswordAgeDays,
+		"password_length":   settings.PasswordLength,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "LAPS settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// InstallSchema extends the schema with the LAPS attributes and grants the
+// directory permissions
+func (h *LAPSHandler) InstallSchema(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	if err := h.authorizeAdministration(c); err != nil {
+		utils.LogSecurityEvent(ctx, "laps_schema_install_denied", "high", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	settings, err := h.lapsService.InstallSchema()
+	if err != nil {
+		utils.LogDomainManagement(ctx, "laps_schema_install", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "laps_schema_install", true, map[string]interface{}{
+		"reader_group": settings.ReaderGroup,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "LAPS schema installed successfully",
+		"settings": settings,
+	})
+}
+
+// GetPassword returns a computer's local administrator password. The password
+// is only disclosed once the read has been written to the audit log.
+func (h *LAPSHandler) GetPassword(c *gin.Context) {
+	computerName := c.Param("id")
+	ctx := utils.GetAuditContext(c)
+
+	if err := h.authorize(c); err != nil {
+		utils.LogSecretAccess(ctx, "laps_password_read", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	password, err := h.lapsService.ReadPassword(computerName)
+	if err != nil {
+		utils.LogSecretAccess(ctx, "laps_password_read", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := utils.LogSecretAccess(ctx, "laps_password_read", password.ComputerName, true, map[string]interface{}{
+		"source":  password.Source,
+		"account": password.Account,
+	}); err != nil {
+		utils.Error("Refusing to disclose LAPS password for %s: %v", password.ComputerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Password not disclosed: the read could not be audited",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, password)
+}
+
+// RotatePassword expires a computer's local administrator password so the
+// computer sets a new one. The request is audited before anything changes.
+func (h *LAPSHandler) RotatePassword(c *gin.Context) {
+	computerName := c.Param("id")
+	ctx := utils.GetAuditContext(c)
+
+	if err := h.authorize(c); err != nil {
+		utils.LogSecretAccess(ctx, "laps_password_rotate", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := utils.LogSecretAccess(ctx, "laps_password_rotate_request", computerName, true, nil); err != nil {
+		utils.Error("Refusing to rotate LAPS password for %s: %v", computerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Password not rotated: the request could not be audited",
+		})
+		return
+	}
+
+	rotation, err := h.lapsService.RotatePassword(computerName)
+	if err != nil {
+		utils.LogSecretAccess(ctx, "laps_password_rotate", computerName, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogSecretAccess(ctx, "laps_password_rotate", rotation.ComputerName, true, map[string]interface{}{
+		"expires_at": rotation.ExpiresAt,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Password expired; the computer sets a new one at its next policy refresh",
+		"rotation": rotation,
+	})
+}
+
+// authorize checks the caller against the LAPS reader group. Passwords are
+// never handled for a caller the audit log cannot name.
+func (h *LAPSHandler) authorize(c *gin.Context) error {
+	if c.GetString("username") == "" {
+		return fmt.Errorf("the request has no authenticated user to audit")
+	}
+	// Only tokens that explicitly belong to a local administrator skip the group check
+	domainUser := true
+	if value, exists := c.Get("is_domain_user"); exists {
+		if isDomainUser, ok := value.(bool); ok {
+			domainUser = isDomainUser
+		}
+	}
+	return h.lapsService.AuthorizeReader(c.GetString("username"), domainUser)
+}
+
+// authorizeAdministration checks that the caller may change who can read
+// passwords: administrators, or members of the current reader group
+func (h *LAPSHandler) authorizeAdministration(c *gin.Context) error {
+	val, _ := c.Get("is_admin")
+	if isAdmin, _ := val.(bool); isAdmin {
+		return nil
+	}
+	if err := h.authorize(c); err != nil {
+		return fmt.Errorf("only administrators and members of the LAPS reader group may change LAPS settings: %v", err)
+	}
+	return nil
+}
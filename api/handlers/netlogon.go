@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// NetlogonHandler handles HTTP requests for logon scripts and SYSVOL health
+type NetlogonHandler struct {
+	netlogonService *services.NetlogonService
+}
+
+// NewNetlogonHandler creates a new NetlogonHandler instance
+func NewNetlogonHandler() *NetlogonHandler {
+	return &NetlogonHandler{
+		netlogonService: services.NewNetlogonService(),
+	}
+}
+
+// ListScripts returns all logon scripts in NETLOGON
+func (h *NetlogonHandler) ListScripts(c *gin.Context) {
+	scripts, err := h.netlogonService.ListScripts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scripts": scripts,
+		"count":   len(scripts),
+	})
+}
+
+// GetScript returns a logon script and its content
+func (h *NetlogonHandler) GetScript(c *gin.Context) {
+	script, content, err := h.netlogonService.GetScript(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"script":  script,
+		"content": string(content),
+	})
+}
+
+// UploadScript creates or replaces a logon script. Accepts JSON or a multipart "file" field.
+func (h *NetlogonHandler) UploadScript(c *gin.Context) {
+	var name string
+	var content []byte
+
+	if file, err := c.FormFile("file"); err == nil {
+		name = c.PostForm("name")
+		if name == "" {
+			name = file.Filename
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Failed to read uploaded file",
+			})
+			return
+		}
+		defer f.Close()
+		content, err = io.ReadAll(f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Failed to read uploaded file",
+			})
+			return
+		}
+	} else {
+		var req models.UploadLogonScriptRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request format",
+			})
+			return
+		}
+		name = req.Name
+		content = []byte(req.Content)
+	}
+
+	ctx := utils.GetAuditContext(c)
+	script, err := h.netlogonService.UploadScript(name, content)
+	if err != nil {
+		utils.LogDomainManagement(ctx, "logon_script_upload", false, map[string]interface{}{
+			"script": name,
+			"error":  err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "logon_script_upload", true, map[string]interface{}{
+		"script": script.Name,
+		"sha256": script.SHA256,
+		"size":   script.Size,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logon script uploaded successfully",
+		"script":  script,
+	})
+}
+
+// DeleteScript archives and removes a logon script
+func (h *NetlogonHandler) DeleteScript(c *gin.Context) {
+	name := c.Param("name")
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.netlogonService.DeleteScript(name); err != nil {
+		utils.LogDomainManagement(ctx, "logon_script_delete", false, map[string]interface{}{
+			"script": name,
+			"error":  err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "logon_script_delete", true, map[string]interface{}{
+		"script": name,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logon script deleted successfully",
+	})
+}
+
+// ListScriptVersions returns the archived revisions of a logon script
+func (h *NetlogonHandler) ListScriptVersions(c *gin.Context) {
+	versions, err := h.netlogonService.ListVersions(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": versions,
+		"count":    len(versions),
+	})
+}
+
+// RestoreScriptVersion restores an archived revision of a logon script
+func (h *NetlogonHandler) RestoreScriptVersion(c *gin.Context) {
+	name := c.Param("name")
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid version",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	script, err := h.netlogonService.RestoreVersion(name, version)
+	if err != nil {
+		utils.LogDomainManagement(ctx, "logon_script_restore", false, map[string]interface{}{
+			"script":  name,
+			"version": version,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "logon_script_restore", true, map[string]interface{}{
+		"script":  name,
+		"version": version,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logon script restored successfully",
+		"script":  script,
+	})
+}
+
+// AssignScript sets the logon script (scriptPath) for users and OUs
+func (h *NetlogonHandler) AssignScript(c *gin.Context) {
+	var req models.AssignLogonScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+	if len(req.Users) == 0 && len(req.OUs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one user or OU is required",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	updated, err := h.netlogonService.AssignScript(req)
+	for _, username := range req.Users {
+		utils.LogUserManagement(ctx, "logon_script_assign", username, err == nil, map[string]interface{}{
+			"script": req.Script,
+		})
+	}
+	details := map[string]interface{}{
+		"script":    req.Script,
+		"ous":       req.OUs,
+		"recursive": req.Recursive,
+		"updated":   updated,
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	utils.LogDomainManagement(ctx, "logon_script_assign", err == nil, details)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"updated": updated,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logon script assigned successfully",
+		"updated": updated,
+	})
+}
+
+// CheckSysvol reports SYSVOL ACL health via samba-tool ntacl sysvolcheck
+func (h *NetlogonHandler) CheckSysvol(c *gin.Context) {
+	c.JSON(http.StatusOK, h.netlogonService.CheckSysvol())
+}
+
+// ResetSysvol resets SYSVOL ACLs to their defaults
+func (h *NetlogonHandler) ResetSysvol(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	if err := h.netlogonService.ResetSysvol(); err != nil {
+		utils.LogDomainManagement(ctx, "sysvol_reset", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "sysvol_reset", true, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "SYSVOL ACLs reset successfully",
+	})
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// OIDCHandler serves the OpenID Connect provider Headscale uses for
+// interactive device login
+type OIDCHandler struct {
+	oidcService *services.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDCHandler instance
+func NewOIDCHandler() *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: services.NewOIDCService(),
+	}
+}
+
+// oidcLoginPage is the sign-in form shown during authorization. The
+// authorization request travels along as hidden fields.
+var oidcLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Vexa sign in</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f3f4f6; display: flex; justify-content: center; padding-top: 10vh; }
+form { background: #fff; padding: 2rem; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,.2); width: 20rem; }
+h1 { font-size: 1.25rem; margin: 0 0 1rem; }
+label { display: block; margin-top: .75rem; font-size: .875rem; }
+input[type=text], input[type=password] { width: 100%; box-sizing: border-box; padding: .5rem; margin-top: .25rem; }
+button { margin-top: 1.25rem; width: 100%; padding: .6rem; background: #2563eb; color: #fff; border: 0; border-radius: 4px; }
+.error { color: #b91c1c; font-size: .875rem; }
+</style>
+</head>
+<body>
+<form method="post">
+<h1>Sign in to the overlay network</h1>
+{{ if .Error }}<p class="error">{{ .Error }}</p>{{ end }}
+{{ if .Request }}{{ with .Request }}
+<input type="hidden" name="response_type" value="{{ .ResponseType }}">
+<input type="hidden" name="client_id" value="{{ .ClientID }}">
+<input type="hidden" name="redirect_uri" value="{{ .RedirectURI }}">
+<input type="hidden" name="scope" value="{{ .Scope }}">
+<input type="hidden" name="state" value="{{ .State }}">
+<input type="hidden" name="nonce" value="{{ .Nonce }}">
+<input type="hidden" name="code_challenge" value="{{ .CodeChallenge }}">
+<input type="hidden" name="code_challenge_method" value="{{ .CodeChallengeMethod }}">
+{{ end }}
+<label>Username<input type="text" name="username" value="{{ .Username }}" autocomplete="username" autofocus required></label>
+<label>Password<input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit">Sign in</button>
+{{ end }}
+</form>
+</body>
+</html>
+`))
+
+type oidcLoginData struct {
+	Request  *models.OIDCAuthorizeRequest
+	Username string
+	Error    string
+}
+
+// Discovery serves the OpenID configuration document
+func (h *OIDCHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidcService.Discovery(h.issuer(c)))
+}
+
+// JWKS serves the keys ID tokens are signed with
+func (h *OIDCHandler) JWKS(c *gin.Context) {
+	jwks, err := h.oidcService.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jwks)
+}
+
+// Authorize shows the sign-in form for an authorization request
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req models.OIDCAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.renderLogin(c, http.StatusBadRequest, oidcLoginData{Error: "Invalid authorization request"})
+		return
+	}
+
+	if err := h.oidcService.ValidateAuthorization(req); err != nil {
+		h.authorizationFailed(c, req, err)
+		return
+	}
+	h.renderLogin(c, http.StatusOK, oidcLoginData{Request: &req})
+}
+
+// AuthorizeSubmit checks the submitted credentials and redirects back to
+// the client with an authorization code
+func (h *OIDCHandler) AuthorizeSubmit(c *gin.Context) {
+	var req models.OIDCAuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.renderLogin(c, http.StatusBadRequest, oidcLoginData{Error: "Invalid authorization request"})
+		return
+	}
+	if err := h.oidcService.ValidateAuthorization(req); err != nil {
+		h.authorizationFailed(c, req, err)
+		return
+	}
+
+	username := strings.TrimSpace(c.PostForm("username"))
+	ctx := utils.GetAuditContext(c)
+	redirect, err := h.oidcService.Login(req, username, c.PostForm("password"))
+	if err != nil {
+		utils.LogAuthentication(ctx, "oidc_login", false, map[string]interface{}{
+			"username":  username,
+			"client_id": req.ClientID,
+			"error":     err.Error(),
+		})
+		h.renderLogin(c, http.StatusUnauthorized, oidcLoginData{Request: &req, Username: username, Error: err.Error()})
+		return
+	}
+
+	utils.LogAuthentication(ctx, "oidc_login", true, map[string]interface{}{
+		"username":  username,
+		"client_id": req.ClientID,
+	})
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Token redeems an authorization code
+func (h *OIDCHandler) Token(c *gin.Context) {
+	var req models.OIDCTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid_request",
+		})
+		return
+	}
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	token, err := h.oidcService.Exchange(h.issuer(c), req)
+	if err != nil {
+		var oidcErr *services.OIDCError
+		if errors.As(err, &oidcErr) {
+			status := http.StatusBadRequest
+			if oidcErr.Code == "invalid_client" {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, gin.H{
+				"error":             oidcErr.Code,
+				"error_description": oidcErr.Description,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":             "server_error",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// UserInfo returns the claims about the user an access token belongs to
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	accessToken := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	info, err := h.oidcService.UserInfo(accessToken)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid_token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// GetSettings returns the OIDC provider settings
+func (h *OIDCHandler) GetSettings(c *gin.Context) {
+	settings, err := h.oidcService.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings enables or disables Headscale's OIDC login
+func (h *OIDCHandler) UpdateSettings(c *gin.Context) {
+	var req models.UpdateOIDCSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.oidcService.UpdateSettings(req)
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_oidc_update", "oidc", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_oidc_update", "oidc", true, map[string]interface{}{
+		"enabled":       settings.Enabled,
+		"issuer":        settings.Issuer,
+		"rotate_secret": req.RotateSecret,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "OIDC settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// authorizationFailed reports an invalid authorization request: protocol
+// errors go back to the client, anything else is shown to the user since
+// the redirect URI cannot be trusted
+func (h *OIDCHandler) authorizationFailed(c *gin.Context, req models.OIDCAuthorizeRequest, err error) {
+	var oidcErr *services.OIDCError
+	if errors.As(err, &oidcErr) {
+		c.Redirect(http.StatusFound, h.oidcService.AuthorizationError(req, oidcErr))
+		return
+	}
+	h.renderLogin(c, http.StatusBadRequest, oidcLoginData{Error: err.Error()})
+}
+
+func (h *OIDCHandler) renderLogin(c *gin.Context, status int, data oidcLoginData) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := oidcLoginPage.Execute(c.Writer, data); err != nil {
+		utils.Error("Failed to render OIDC login page: %v", err)
+	}
+}
+
+func (h *OIDCHandler) issuer(c *gin.Context) string {
+	return h.oidcService.Issuer(getBaseURL(c))
+}
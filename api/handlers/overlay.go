@@ -2,27 +2,38 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/models"
 	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
 )
 
 // OverlayHandler handles HTTP requests for overlay networking
 type OverlayHandler struct {
-	overlayService *services.OverlayService
+	overlayService   *services.OverlayService
+	headscaleService *services.HeadscaleService
+	policyService    *services.OverlayPolicyService
+	dnsService       *services.OverlayDNSService
 }
 
 // NewOverlayHandler creates a new OverlayHandler
 func NewOverlayHandler() *OverlayHandler {
 	return &OverlayHandler{
-		overlayService: services.NewOverlayService(),
+		overlayService:   services.NewOverlayService(),
+		headscaleService: services.NewHeadscaleService(),
+		policyService:    services.NewOverlayPolicyService(),
+		dnsService:       services.NewOverlayDNSService(),
 	}
 }
 
 // SetupOverlay configures overlay networking
 func (h *OverlayHandler) SetupOverlay(c *gin.Context) {
 	var req struct {
-		FQDN string `json:"fqdn" binding:"required"`
+		FQDN       string `json:"fqdn" binding:"required"`
+		EnableOIDC bool   `json:"enable_oidc"` // Log devices in with directory credentials
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,7 +43,7 @@ func (h *OverlayHandler) SetupOverlay(c *gin.Context) {
 		return
 	}
 
-	if err := h.overlayService.SetupOverlay(req.FQDN); err != nil {
+	if err := h.overlayService.SetupOverlay(req.FQDN, req.EnableOIDC); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -107,3 +118,775 @@ func (h *OverlayHandler) AddMachine(c *gin.Context) {
 		"scripts": scripts,
 	})
 }
+
+// ListNodes returns all nodes registered with Headscale
+func (h *OverlayHandler) ListNodes(c *gin.Context) {
+	nodes, err := h.headscaleService.ListNodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"nodes": nodes,
+		"count": len(nodes),
+	})
+}
+
+// GetNode returns a single Headscale node
+func (h *OverlayHandler) GetNode(c *gin.Context) {
+	node, err := h.headscaleService.GetNode(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, node)
+}
+
+// RenameNode changes a node's given name
+func (h *OverlayHandler) RenameNode(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	node, err := h.headscaleService.RenameNode(c.Param("id"), req.Name)
+	h.respondNodeAction(c, "overlay_node_rename", node, err, "Node renamed successfully", map[string]interface{}{
+		"new_name": req.Name,
+	})
+}
+
+// ExpireNode expires a node's key so it has to log in again
+func (h *OverlayHandler) ExpireNode(c *gin.Context) {
+	node, err := h.headscaleService.ExpireNode(c.Param("id"))
+	h.respondNodeAction(c, "overlay_node_expire", node, err, "Node expired successfully", nil)
+}
+
+// DeleteNode removes a node from Headscale
+func (h *OverlayHandler) DeleteNode(c *gin.Context) {
+	node, err := h.headscaleService.DeleteNode(c.Param("id"))
+	h.respondNodeAction(c, "overlay_node_delete", node, err, "Node deleted successfully", nil)
+}
+
+// MoveNode assigns a node to another Headscale user
+func (h *OverlayHandler) MoveNode(c *gin.Context) {
+	var req struct {
+		User string `json:"user" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	node, err := h.headscaleService.MoveNode(c.Param("id"), req.User)
+	h.respondNodeAction(c, "overlay_node_move", node, err, "Node moved successfully", map[string]interface{}{
+		"new_user": req.User,
+	})
+}
+
+// SetNodeTags replaces a node's forced ACL tags
+func (h *OverlayHandler) SetNodeTags(c *gin.Context) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	node, tags, err := h.headscaleService.SetNodeTags(c.Param("id"), req.Tags)
+	h.respondNodeAction(c, "overlay_node_tags_set", node, err, "Node tags updated successfully", map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// ClearNodeTags removes all forced ACL tags from a node
+func (h *OverlayHandler) ClearNodeTags(c *gin.Context) {
+	node, _, err := h.headscaleService.SetNodeTags(c.Param("id"), nil)
+	h.respondNodeAction(c, "overlay_node_tags_clear", node, err, "Node tags cleared successfully", nil)
+}
+
+// GetNodeRoutes returns the routes a node advertises
+func (h *OverlayHandler) GetNodeRoutes(c *gin.Context) {
+	routes, err := h.headscaleService.NodeRoutes(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes": routes,
+		"count":  len(routes),
+	})
+}
+
+// respondNodeAction audits a node action and writes its response. The node
+// is the state before the action, or nil when it was never found.
+func (h *OverlayHandler) respondNodeAction(c *gin.Context, action string, node *headscale.Node, err error, message string, details map[string]interface{}) {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	nodeID := c.Param("id")
+	if node != nil {
+		details["node_name"] = node.GivenName
+		details["user"] = node.User
+		details["forced_tags"] = node.ForcedTags
+	}
+
+	ctx := utils.GetAuditContext(c)
+	if err != nil {
+		details["error"] = err.Error()
+		utils.LogOverlayManagement(ctx, action, "node:"+nodeID, false, details)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, action, "node:"+nodeID, true, details)
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+	})
+}
+
+// ListRoutes returns the routes advertised by all nodes with their approval state
+func (h *OverlayHandler) ListRoutes(c *gin.Context) {
+	routes, err := h.headscaleService.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes": routes,
+		"count":  len(routes),
+	})
+}
+
+// EnableRoute approves a route a node advertises
+func (h *OverlayHandler) EnableRoute(c *gin.Context) {
+	h.setRouteEnabled(c, true)
+}
+
+// DisableRoute withdraws the approval of a node's route
+func (h *OverlayHandler) DisableRoute(c *gin.Context) {
+	h.setRouteEnabled(c, false)
+}
+
+func (h *OverlayHandler) setRouteEnabled(c *gin.Context, enabled bool) {
+	var req struct {
+		Prefix string `json:"prefix" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	nodeID := c.Param("id")
+	action := "overlay_route_disable"
+	if enabled {
+		action = "overlay_route_enable"
+	}
+
+	ctx := utils.GetAuditContext(c)
+	route, err := h.headscaleService.SetRouteEnabled(nodeID, req.Prefix, enabled)
+	details := map[string]interface{}{
+		"prefix": req.Prefix,
+	}
+	if route != nil {
+		details["node_name"] = route.NodeName
+	}
+	if err != nil {
+		details["error"] = err.Error()
+		utils.LogOverlayManagement(ctx, action, "node:"+nodeID, false, details)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, action, "node:"+nodeID, true, details)
+	route.Enabled = enabled
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Route updated successfully",
+		"route":   route,
+	})
+}
+
+// SetExitNode allows or stops a node acting as an exit node by enabling or
+// disabling the default routes it advertises
+func (h *OverlayHandler) SetExitNode(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	nodeID := c.Param("id")
+	ctx := utils.GetAuditContext(c)
+	routes, err := h.headscaleService.SetExitNode(nodeID, *req.Enabled)
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_exit_node_set", "node:"+nodeID, false, map[string]interface{}{
+			"enabled": *req.Enabled,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_exit_node_set", "node:"+nodeID, true, map[string]interface{}{
+		"enabled": *req.Enabled,
+		"routes":  len(routes),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Exit node updated successfully",
+		"routes":  routes,
+	})
+}
+
+// GetPolicy returns the managed ACL policy and the groups generated for it
+func (h *OverlayHandler) GetPolicy(c *gin.Context) {
+	status, err := h.policyService.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdatePolicy validates the ACL policy with headscale and applies it
+func (h *OverlayHandler) UpdatePolicy(c *gin.Context) {
+	var req models.OverlayPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	status, err := h.policyService.SavePolicy(req, c.GetString("username"))
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_policy_update", "policy", false, map[string]interface{}{
+			"enabled": req.Enabled,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_policy_update", "policy", true, map[string]interface{}{
+		"enabled":       status.Policy.Enabled,
+		"synced_groups": status.Policy.SyncedGroups,
+		"rules":         len(status.Policy.ACLs),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Overlay policy applied successfully",
+		"policy":  status,
+	})
+}
+
+// CheckPolicy validates an ACL policy with headscale without applying it
+func (h *OverlayHandler) CheckPolicy(c *gin.Context) {
+	var req models.OverlayPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if err := h.policyService.CheckPolicy(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"valid": false,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid": true,
+	})
+}
+
+// SyncPolicyGroups regenerates the policy groups from directory membership now
+func (h *OverlayHandler) SyncPolicyGroups(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	changed, err := h.policyService.SyncGroups()
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_policy_group_sync", "policy", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_policy_group_sync", "policy", true, map[string]interface{}{
+		"changed": changed,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Policy groups synced",
+		"changed": changed,
+	})
+}
+
+// GetUserSettings returns the limits on personal pre-auth keys
+func (h *OverlayHandler) GetUserSettings(c *gin.Context) {
+	settings, err := h.headscaleService.GetUserSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateUserSettings changes the limits on personal pre-auth keys
+func (h *OverlayHandler) UpdateUserSettings(c *gin.Context) {
+	var req models.OverlayUserSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.headscaleService.SaveUserSettings(req)
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_user_settings_update", "settings", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_user_settings_update", "settings", true, map[string]interface{}{
+		"personal_key_limit":       settings.PersonalKeyLimit,
+		"personal_key_ttl_minutes": settings.PersonalKeyTTLMinutes,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Overlay user settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// SyncUsers creates a Headscale user for every directory user lacking one
+func (h *OverlayHandler) SyncUsers(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	created, err := h.headscaleService.SyncUsers()
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_user_sync", "users", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_user_sync", "users", true, map[string]interface{}{
+		"created": created,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Overlay users synced",
+		"created": created,
+	})
+}
+
+// ListKeys returns pre-auth keys with the nodes registered with each,
+// optionally limited to one Headscale user
+func (h *OverlayHandler) ListKeys(c *gin.Context) {
+	keys, err := h.headscaleService.ListKeys(c.Query("user"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys":  keys,
+		"count": len(keys),
+	})
+}
+
+// CreateKey creates a pre-auth key for a Headscale user
+func (h *OverlayHandler) CreateKey(c *gin.Context) {
+	var req models.CreateOverlayKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	details := map[string]interface{}{
+		"reusable":  req.Reusable,
+		"ephemeral": req.Ephemeral,
+		"acl_tags":  req.ACLTags,
+	}
+	key, err := h.headscaleService.CreateKey(req)
+	if err != nil {
+		details["error"] = err.Error()
+		utils.LogOverlayManagement(ctx, "overlay_key_create", "user:"+req.User, false, details)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	details["key_id"] = key.ID
+	details["expiration"] = key.Expiration
+	details["acl_tags"] = key.ACLTags
+	utils.LogOverlayManagement(ctx, "overlay_key_create", "user:"+req.User, true, details)
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Pre-auth key created; copy it now, it is not shown again",
+		"key":     key,
+	})
+}
+
+// ExpireKey expires a pre-auth key so it can no longer register nodes
+func (h *OverlayHandler) ExpireKey(c *gin.Context) {
+	keyID := c.Param("id")
+	ctx := utils.GetAuditContext(c)
+	details := map[string]interface{}{}
+
+	key, err := h.headscaleService.ExpireKey(keyID)
+	if key != nil {
+		details["user"] = key.User
+		details["reusable"] = key.Reusable
+	}
+	if err != nil {
+		details["error"] = err.Error()
+		utils.LogOverlayManagement(ctx, "overlay_key_expire", "key:"+keyID, false, details)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_key_expire", "key:"+keyID, true, details)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pre-auth key expired successfully",
+	})
+}
+
+// GetUserOverlay returns a user's overlay nodes and pre-auth keys
+func (h *OverlayHandler) GetUserOverlay(c *gin.Context) {
+	h.userOverlay(c, c.Param("id"))
+}
+
+// GetMyOverlay returns the authenticated user's overlay nodes and pre-auth keys
+func (h *OverlayHandler) GetMyOverlay(c *gin.Context) {
+	username, ok := domainUsername(c)
+	if !ok {
+		return
+	}
+	h.userOverlay(c, username)
+}
+
+func (h *OverlayHandler) userOverlay(c *gin.Context, username string) {
+	nodes, err := h.headscaleService.UserNodes(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	keys, err := h.headscaleService.UserKeys(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"overlay_user": services.OverlayUserName(username),
+		"nodes":        nodes,
+		"keys":         keys,
+	})
+}
+
+// CreateMyKey mints a short-lived single-use pre-auth key with which the
+// authenticated user enrolls one of their own devices
+func (h *OverlayHandler) CreateMyKey(c *gin.Context) {
+	username, ok := domainUsername(c)
+	if !ok {
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	key, err := h.headscaleService.CreatePersonalKey(username)
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_personal_key_create", "user:"+username, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_personal_key_create", "user:"+username, true, map[string]interface{}{
+		"overlay_user": key.OverlayUser,
+		"expires_at":   key.ExpiresAt,
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Pre-auth key created; it can enroll one device before it expires",
+		"key":     key,
+	})
+}
+
+// GetConfig returns the editable Headscale settings
+func (h *OverlayHandler) GetConfig(c *gin.Context) {
+	settings, err := h.headscaleService.GetConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateConfig changes Headscale settings and restarts Headscale
+func (h *OverlayHandler) UpdateConfig(c *gin.Context) {
+	var req models.UpdateHeadscaleSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.headscaleService.UpdateConfig(req)
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_config_update", "config", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_config_update", "config", true, map[string]interface{}{
+		"changes": req,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Headscale configuration updated successfully",
+		"settings": settings,
+	})
+}
+
+// GetDERPSettings returns the DERP relays overlay nodes are given
+func (h *OverlayHandler) GetDERPSettings(c *gin.Context) {
+	settings, err := h.headscaleService.GetDERPSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateDERPSettings replaces the DERP settings and restarts Headscale
+func (h *OverlayHandler) UpdateDERPSettings(c *gin.Context) {
+	var req models.DERPSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.headscaleService.UpdateDERPSettings(req)
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_derp_update", "derp", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	regionIDs := make([]int, 0, len(settings.Regions))
+	for _, region := range settings.Regions {
+		regionIDs = append(regionIDs, region.RegionID)
+	}
+	utils.LogOverlayManagement(ctx, "overlay_derp_update", "derp", true, map[string]interface{}{
+		"use_tailscale_map": settings.UseTailscaleMap,
+		"embedded":          settings.Embedded.Enabled,
+		"regions":           regionIDs,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "DERP settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// TestDERPRegion checks the reachability of a DERP region's nodes
+func (h *OverlayHandler) TestDERPRegion(c *gin.Context) {
+	regionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid region ID",
+		})
+		return
+	}
+
+	result, err := h.headscaleService.TestDERPRegion(regionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetDNSSync returns the Samba DNS sync settings and the records served
+func (h *OverlayHandler) GetDNSSync(c *gin.Context) {
+	status, err := h.dnsService.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateDNSSync saves the Samba DNS sync settings and syncs
+func (h *OverlayHandler) UpdateDNSSync(c *gin.Context) {
+	var req models.OverlayDNSSync
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	status, err := h.dnsService.SaveSettings(req, c.GetString("username"))
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_dns_update", "dns", false, map[string]interface{}{
+			"enabled": req.Enabled,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_dns_update", "dns", true, map[string]interface{}{
+		"enabled":          status.Settings.Enabled,
+		"zones":            status.Settings.Zones,
+		"records":          status.Settings.Records,
+		"interval_minutes": status.Settings.IntervalMinutes,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Overlay DNS sync updated successfully",
+		"dns":     status,
+	})
+}
+
+// SyncDNS re-reads the selected Samba DNS records now
+func (h *OverlayHandler) SyncDNS(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	changed, err := h.dnsService.Sync()
+	if err != nil {
+		utils.LogOverlayManagement(ctx, "overlay_dns_sync", "dns", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogOverlayManagement(ctx, "overlay_dns_sync", "dns", true, map[string]interface{}{
+		"changed": changed,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Overlay DNS records synced",
+		"changed": changed,
+	})
+}
+
+// ListDNSZones lists the Samba DNS zones that can be synced
+func (h *OverlayHandler) ListDNSZones(c *gin.Context) {
+	zones, err := h.dnsService.Zones()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"zones": zones,
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// PosixHandler handles HTTP requests for RFC2307 ID allocation
+type PosixHandler struct {
+	posixService *services.PosixService
+}
+
+// NewPosixHandler creates a new PosixHandler instance
+func NewPosixHandler() *PosixHandler {
+	return &PosixHandler{
+		posixService: services.NewPosixService(),
+	}
+}
+
+// GetSettings returns the UID/GID allocation settings
+func (h *PosixHandler) GetSettings(c *gin.Context) {
+	settings, err := h.posixService.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the UID/GID allocation settings
+func (h *PosixHandler) UpdateSettings(c *gin.Context) {
+	var settings models.PosixSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.posixService.SaveSettings(&settings); err != nil {
+		utils.LogDomainManagement(ctx, "posix_settings_update", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "posix_settings_update", true, map[string]interface{}{
+		"auto_assign": settings.AutoAssign,
+		"uid_min":     settings.UIDMin,
+		"uid_max":     settings.UIDMax,
+		"gid_min":     settings.GIDMin,
+		"gid_max":     settings.GIDMax,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "POSIX settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// Backfill assigns uidNumber/gidNumber to existing users and groups that lack them
+func (h *PosixHandler) Backfill(c *gin.Context) {
+	var req models.PosixBackfillRequest
+	// Body is optional; an empty body runs a real backfill
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request format",
+			})
+			return
+		}
+	}
+
+	ctx := utils.GetAuditContext(c)
+	result, err := h.posixService.Backfill(req.DryRun)
+	if err != nil {
+		utils.LogDomainManagement(ctx, "posix_backfill", false, map[string]interface{}{
+			"dry_run": req.DryRun,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "posix_backfill", len(result.Errors) == 0, map[string]interface{}{
+		"dry_run": req.DryRun,
+		"users":   len(result.Users),
+		"groups":  len(result.Groups),
+		"errors":  result.Errors,
+	})
+
+	c.JSON(http.StatusOK, result)
+}
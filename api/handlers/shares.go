@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// ShareHandler handles HTTP requests for SMB file shares
+type ShareHandler struct {
+	shareService *services.ShareService
+}
+
+// NewShareHandler creates a new ShareHandler instance
+func NewShareHandler() *ShareHandler {
+	return &ShareHandler{
+		shareService: services.NewShareService(),
+	}
+}
+
+// ListShares returns all shares defined on the server
+func (h *ShareHandler) ListShares(c *gin.Context) {
+	shares, err := h.shareService.ListShares()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shares": shares,
+		"count":  len(shares),
+	})
+}
+
+// GetShare returns a single share
+func (h *ShareHandler) GetShare(c *gin.Context) {
+	share, err := h.shareService.GetShare(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, share)
+}
+
+// CreateShare creates a new share
+func (h *ShareHandler) CreateShare(c *gin.Context) {
+	var req models.CreateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	share, err := h.shareService.CreateShare(req)
+	if err != nil {
+		utils.LogSystemManagement(ctx, "share_create", false, map[string]interface{}{
+			"share": req.Name,
+			"path":  req.Path,
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogSystemManagement(ctx, "share_create", true, map[string]interface{}{
+		"share":     share.Name,
+		"path":      share.Path,
+		"read_only": share.ReadOnly,
+		"guest_ok":  share.GuestOK,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Share created successfully",
+		"share":   share,
+	})
+}
+
+// UpdateShare modifies an existing share
+func (h *ShareHandler) UpdateShare(c *gin.Context) {
+	name := c.Param("name")
+
+	var req models.UpdateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	share, err := h.shareService.UpdateShare(name, req)
+	if err != nil {
+		utils.LogSystemManagement(ctx, "share_update", false, map[string]interface{}{
+			"share": name,
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogSystemManagement(ctx, "share_update", true, map[string]interface{}{
+		"share":      share.Name,
+		"path":       share.Path,
+		"browseable": share.Browseable,
+		"read_only":  share.ReadOnly,
+		"guest_ok":   share.GuestOK,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share updated successfully",
+		"share":   share,
+	})
+}
+
+// DeleteShare removes a share definition
+func (h *ShareHandler) DeleteShare(c *gin.Context) {
+	name := c.Param("name")
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.shareService.DeleteShare(name); err != nil {
+		utils.LogSystemManagement(ctx, "share_delete", false, map[string]interface{}{
+			"share": name,
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogSystemManagement(ctx, "share_delete", true, map[string]interface{}{
+		"share": name,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share deleted successfully",
+	})
+}
+
+// GetShareACL returns the group access list of a share
+func (h *ShareHandler) GetShareACL(c *gin.Context) {
+	acl, err := h.shareService.GetShareACL(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, acl)
+}
+
+// SetShareACL replaces the group access list of a share
+func (h *ShareHandler) SetShareACL(c *gin.Context) {
+	name := c.Param("name")
+
+	var req models.SetShareACLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	acl, err := h.shareService.SetShareACL(name, req)
+	if err != nil {
+		utils.LogSystemManagement(ctx, "share_acl_update", false, map[string]interface{}{
+			"share": name,
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogSystemManagement(ctx, "share_acl_update", true, map[string]interface{}{
+		"share":            name,
+		"entries":          req.Entries,
+		"apply_filesystem": req.ApplyFilesystem,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share permissions updated successfully",
+		"acl":     acl,
+	})
+}
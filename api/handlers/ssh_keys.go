@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/services"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// SSHKeyHandler handles HTTP requests for SSH public keys
+type SSHKeyHandler struct {
+	sshKeyService *services.SSHKeyService
+}
+
+// NewSSHKeyHandler creates a new SSHKeyHandler instance
+func NewSSHKeyHandler() *SSHKeyHandler {
+	return &SSHKeyHandler{
+		sshKeyService: services.NewSSHKeyService(),
+	}
+}
+
+// GetSettings returns the SSH key storage settings and an sshd_config example
+func (h *SSHKeyHandler) GetSettings(c *gin.Context) {
+	settings, err := h.sshKeyService.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":    settings,
+		"sshd_config": h.sshdConfigExample(c, settings.LookupToken),
+	})
+}
+
+// UpdateSettings changes the directory attribute used to store keys
+func (h *SSHKeyHandler) UpdateSettings(c *gin.Context) {
+	var req struct {
+		Attribute string `json:"attribute" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.sshKeyService.SetAttribute(req.Attribute)
+	if err != nil {
+		utils.LogDomainManagement(ctx, "ssh_key_settings_update", false, map[string]interface{}{
+			"attribute": req.Attribute,
+			"error":     err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "ssh_key_settings_update", true, map[string]interface{}{
+		"attribute": settings.Attribute,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "SSH key settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// RegenerateToken issues a new lookup token for the authorized-keys endpoint
+func (h *SSHKeyHandler) RegenerateToken(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	settings, err := h.sshKeyService.RegenerateLookupToken()
+	if err != nil {
+		utils.LogSecurityEvent(ctx, "ssh_lookup_token_regenerate", "medium", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogSecurityEvent(ctx, "ssh_lookup_token_regenerate", "medium", true, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Lookup token regenerated successfully",
+		"settings":    settings,
+		"sshd_config": h.sshdConfigExample(c, settings.LookupToken),
+	})
+}
+
+// InstallSchema extends the directory schema with the sshPublicKey attribute
+func (h *SSHKeyHandler) InstallSchema(c *gin.Context) {
+	ctx := utils.GetAuditContext(c)
+	if err := h.sshKeyService.InstallSchema(); err != nil {
+		utils.LogDomainManagement(ctx, "ssh_key_schema_install", false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogDomainManagement(ctx, "ssh_key_schema_install", true, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "SSH key schema extension installed successfully",
+	})
+}
+
+// ListMyKeys returns the authenticated user's SSH keys
+func (h *SSHKeyHandler) ListMyKeys(c *gin.Context) {
+	username, ok := domainUsername(c)
+	if !ok {
+		return
+	}
+	h.listKeys(c, username)
+}
+
+// AddMyKey adds an SSH key to the authenticated user's account
+func (h *SSHKeyHandler) AddMyKey(c *gin.Context) {
+	username, ok := domainUsername(c)
+	if !ok {
+		return
+	}
+	h.addKey(c, username)
+}
+
+// RemoveMyKey removes an SSH key from the authenticated user's account
+func (h *SSHKeyHandler) RemoveMyKey(c *gin.Context) {
+	username, ok := domainUsername(c)
+	if !ok {
+		return
+	}
+	h.removeKey(c, username)
+}
+
+// ListUserKeys returns a user's SSH keys
+func (h *SSHKeyHandler) ListUserKeys(c *gin.Context) {
+	h.listKeys(c, c.Param("id"))
+}
+
+// AddUserKey adds an SSH key to a user's account
+func (h *SSHKeyHandler) AddUserKey(c *gin.Context) {
+	h.addKey(c, c.Param("id"))
+}
+
+// RemoveUserKey removes an SSH key from a user's account
+func (h *SSHKeyHandler) RemoveUserKey(c *gin.Context) {
+	h.removeKey(c, c.Param("id"))
+}
+
+// AuthorizedKeys returns a user's keys as plain text for sshd's AuthorizedKeysCommand.
+// Servers authenticate with the lookup token rather than a user session.
+func (h *SSHKeyHandler) AuthorizedKeys(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !h.sshKeyService.ValidateLookupToken(token) {
+		ctx := utils.GetAuditContext(c)
+		utils.LogSecurityEvent(ctx, "ssh_authorized_keys_denied", "medium", false, map[string]interface{}{
+			"user": c.Param("username"),
+		})
+		c.String(http.StatusUnauthorized, "")
+		return
+	}
+
+	keys, err := h.sshKeyService.AuthorizedKeys(c.Param("username"))
+	if err != nil {
+		c.String(http.StatusNotFound, "")
+		return
+	}
+
+	c.String(http.StatusOK, keys)
+}
+
+func (h *SSHKeyHandler) listKeys(c *gin.Context, username string) {
+	keys, err := h.sshKeyService.ListKeys(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"username": username,
+		"keys":     keys,
+		"count":    len(keys),
+	})
+}
+
+func (h *SSHKeyHandler) addKey(c *gin.Context, username string) {
+	var req models.AddSSHKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := utils.GetAuditContext(c)
+	key, err := h.sshKeyService.AddKey(username, req)
+	if err != nil {
+		utils.LogUserManagement(ctx, "ssh_key_add", username, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogUserManagement(ctx, "ssh_key_add", username, true, map[string]interface{}{
+		"fingerprint": key.Fingerprint,
+		"type":        key.Type,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "SSH key added successfully",
+		"key":     key,
+	})
+}
+
+func (h *SSHKeyHandler) removeKey(c *gin.Context, username string) {
+	// Base64 fingerprints contain '+', which query decoding turns into spaces
+	fingerprint := strings.ReplaceAll(c.Query("fingerprint"), " ", "+")
+
+	ctx := utils.GetAuditContext(c)
+	if err := h.sshKeyService.RemoveKey(username, fingerprint); err != nil {
+		utils.LogUserManagement(ctx, "ssh_key_remove", username, false, map[string]interface{}{
+			"fingerprint": fingerprint,
+			"error":       err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogUserManagement(ctx, "ssh_key_remove", username, true, map[string]interface{}{
+		"fingerprint": fingerprint,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "SSH key removed successfully",
+	})
+}
+
+// sshdConfigExample renders the sshd_config lines for an AuthorizedKeysCommand lookup
+func (h *SSHKeyHandler) sshdConfigExample(c *gin.Context, token string) string {
+	return "AuthorizedKeysCommand /usr/bin/curl -sf -H \"Authorization: Bearer " + token + "\" " +
+		getBaseURL(c) + "/api/v1/ssh/authorized-keys/%u\n" +
+		"AuthorizedKeysCommandUser nobody\n"
+}
+
+// domainUsername returns the authenticated domain user's name, writing an error response otherwise
+func domainUsername(c *gin.Context) (string, bool) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No authentication claims"})
+		return "", false
+	}
+
+	jwtClaims := claims.(jwt.MapClaims)
+	if isDomainUser, ok := jwtClaims["is_domain_user"].(bool); ok && !isDomainUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This action is only available to domain accounts"})
+		return "", false
+	}
+	username, _ := jwtClaims["username"].(string)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No authentication claims"})
+		return "", false
+	}
+	return username, true
+}
@@ -188,6 +188,34 @@ func (h *UserHandler) ToggleMustChangePassword(c *gin.Context) {
 	})
 }
 
+// ProvisionHomeDirectory creates the home directory for an existing user
+func (h *UserHandler) ProvisionHomeDirectory(c *gin.Context) {
+	username := c.Param("id")
+
+	ctx := utils.GetAuditContext(c)
+	result, err := h.userService.ProvisionHomeDirectory(username)
+	if err != nil {
+		utils.LogUserManagement(ctx, "home_directory_provision", username, false, map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.LogUserManagement(ctx, "home_directory_provision", username, true, map[string]interface{}{
+		"home_directory": result.HomeDirectory,
+		"profile_path":   result.ProfilePath,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Home directory provisioned successfully",
+		"username":       username,
+		"home_directory": result,
+	})
+}
+
 // ChangePassword allows users to change their own password
 func (h *UserHandler) ChangePassword(c *gin.Context) {
 	utils.Info("ChangePassword endpoint called")
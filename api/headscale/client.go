@@ -0,0 +1,180 @@
+// Package headscale is a typed client for Headscale's REST API, covering the
+// users, nodes, pre-auth keys, routes and policy Vexa manages.
+package headscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to Headscale's API with an API key
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+
+	// refreshKey replaces an API key Headscale rejected, e.g. after it expired
+	refreshKey func(rejected string) (string, error)
+}
+
+// NewClient creates a client for the Headscale server at baseURL, e.g.
+// http://127.0.0.1:50443
+func NewClient(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// OnUnauthorized sets how a new API key is obtained when Headscale rejects
+// the current one, which is passed to refresh. The request is retried once
+// with the new key.
+func (c *Client) OnUnauthorized(refresh func(rejected string) (string, error)) {
+	c.refreshKey = refresh
+}
+
+// APIError is an error response from Headscale
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("headscale API returned %d", e.StatusCode)
+	}
+	return e.Message
+}
+
+// IsNotFound reports whether err is a Headscale "not found" response
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err means the API key was rejected
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// Health checks that Headscale is serving and its database is reachable
+func (c *Client) Health() error {
+	return c.do(http.MethodGet, "/health", nil, nil, nil)
+}
+
+// GetPolicy returns the policy Headscale enforces and when it was last set
+func (c *Client) GetPolicy() (string, string, error) {
+	var response struct {
+		Policy    string          `json:"policy"`
+		UpdatedAt json.RawMessage `json:"updatedAt"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/policy", nil, nil, &response); err != nil {
+		return "", "", err
+	}
+	return response.Policy, rawTimestamp(response.UpdatedAt), nil
+}
+
+// SetPolicy replaces the policy. Headscale validates it and applies it to
+// connected nodes without a restart. It requires the database policy mode.
+func (c *Client) SetPolicy(policy string) error {
+	body := map[string]string{"policy": policy}
+	return c.do(http.MethodPut, "/api/v1/policy", nil, body, nil)
+}
+
+// do sends a request and decodes the JSON response into out when given
+func (c *Client) do(method, path string, query url.Values, body, out interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+
+	status, data, err := c.send(method, endpoint, payload)
+	if err == nil && status == http.StatusUnauthorized && c.refreshKey != nil {
+		apiKey, refreshErr := c.refreshKey(c.apiKey)
+		if refreshErr != nil {
+			return fmt.Errorf("headscale rejected the API key and a new one could not be created: %v", refreshErr)
+		}
+		c.apiKey = apiKey
+		status, data, err = c.send(method, endpoint, payload)
+	}
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return decodeAPIError(status, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse headscale response: %v", err)
+	}
+	return nil
+}
+
+// send performs one request and returns the status code and body
+func (c *Client) send(method, endpoint string, payload []byte) (int, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to reach headscale: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read headscale response: %v", err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// decodeAPIError reads the gRPC gateway error body Headscale returns
+func decodeAPIError(status int, data []byte) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(data))
+	}
+	return &APIError{StatusCode: status, Message: body.Message}
+}
+
+// nodePath returns the API path of a node, or of one of its actions
+func nodePath(nodeID string, action ...string) string {
+	path := "/api/v1/node/" + url.PathEscape(nodeID)
+	for _, part := range action {
+		path += "/" + url.PathEscape(part)
+	}
+	return path
+}
@@ -0,0 +1,316 @@
+package headscale_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/headscale/headscaletest"
+)
+
+// newTestClient starts a test server and returns it with a client for it
+func newTestClient(t *testing.T) (*headscaletest.Server, *headscale.Client) {
+	t.Helper()
+	fake := headscaletest.NewServer("test-key")
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, headscale.NewClient(server.URL, "test-key")
+}
+
+// registerTestNode creates a user and a key and registers a node with it
+func registerTestNode(t *testing.T, fake *headscaletest.Server, client *headscale.Client, user, hostname string, routes ...string) *headscale.Node {
+	t.Helper()
+	owner, err := client.FindUser(user)
+	if err != nil {
+		if owner, err = client.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	key, err := client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{UserID: owner.ID})
+	if err != nil {
+		t.Fatalf("CreatePreAuthKey: %v", err)
+	}
+	node, err := fake.RegisterNode(key.Key, hostname, routes...)
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	return node
+}
+
+func TestHealth(t *testing.T) {
+	_, client := newTestClient(t)
+	if err := client.Health(); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	_, client := newTestClient(t)
+
+	created, err := client.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if created.ID == "" || created.Name != "alice" || created.CreatedAt == "" {
+		t.Errorf("created user = %+v", created)
+	}
+	if _, err := client.CreateUser("alice"); err == nil {
+		t.Error("creating a duplicate user succeeded")
+	}
+
+	users, err := client.ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != created.ID {
+		t.Errorf("users = %+v", users)
+	}
+
+	found, err := client.FindUser("alice")
+	if err != nil || found.ID != created.ID {
+		t.Errorf("FindUser = %+v, %v", found, err)
+	}
+	if _, err := client.FindUser("bob"); !headscale.IsNotFound(err) {
+		t.Errorf("FindUser of a missing user = %v, want not found", err)
+	}
+
+	if err := client.DeleteUser(created.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if err := client.DeleteUser(created.ID); !headscale.IsNotFound(err) {
+		t.Errorf("deleting a deleted user = %v, want not found", err)
+	}
+}
+
+func TestDeleteUserWithNodes(t *testing.T) {
+	fake, client := newTestClient(t)
+	node := registerTestNode(t, fake, client, "alice", "laptop")
+	user, _ := client.FindUser("alice")
+
+	if err := client.DeleteUser(user.ID); err == nil {
+		t.Fatal("deleting a user that owns nodes succeeded")
+	}
+	if err := client.DeleteNode(node.ID); err != nil {
+		t.Fatalf("DeleteNode: %v", err)
+	}
+	if err := client.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser after removing its node: %v", err)
+	}
+}
+
+func TestPreAuthKeys(t *testing.T) {
+	fake, client := newTestClient(t)
+	user, err := client.CreateUser("infrastructure")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	expiration := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	key, err := client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{
+		UserID:     user.ID,
+		Reusable:   true,
+		Expiration: expiration,
+		ACLTags:    []string{"tag:servers"},
+	})
+	if err != nil {
+		t.Fatalf("CreatePreAuthKey: %v", err)
+	}
+	if key.Key == "" || !key.Reusable || key.User != "infrastructure" {
+		t.Errorf("created key = %+v", key)
+	}
+	if got, err := time.Parse(time.RFC3339, key.Expiration); err != nil || !got.Equal(expiration) {
+		t.Errorf("expiration = %q, want %s", key.Expiration, expiration.UTC().Format(time.RFC3339))
+	}
+
+	registered, err := fake.RegisterNode(key.Key, "fileserver")
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	node, err := client.GetNode(registered.ID)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if node.PreAuthKeyID != key.ID {
+		t.Errorf("node registered with key %q, want %q", node.PreAuthKeyID, key.ID)
+	}
+	if len(node.ForcedTags) != 1 || node.ForcedTags[0] != "tag:servers" {
+		t.Errorf("node tags = %v, want the key's tags", node.ForcedTags)
+	}
+
+	keys, err := client.ListPreAuthKeys(user.ID)
+	if err != nil {
+		t.Fatalf("ListPreAuthKeys: %v", err)
+	}
+	if len(keys) != 1 || !keys[0].Used || len(keys[0].ACLTags) != 1 {
+		t.Errorf("keys = %+v", keys)
+	}
+
+	if err := client.ExpirePreAuthKey(user.ID, key.Key); err != nil {
+		t.Fatalf("ExpirePreAuthKey: %v", err)
+	}
+	if _, err := fake.RegisterNode(key.Key, "another"); err == nil {
+		t.Error("an expired key registered a node")
+	}
+	if err := client.ExpirePreAuthKey(user.ID, "unknown"); !headscale.IsNotFound(err) {
+		t.Errorf("expiring an unknown key = %v, want not found", err)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	fake, client := newTestClient(t)
+	registered := registerTestNode(t, fake, client, "alice", "Laptop")
+	if _, err := client.CreateUser("bob"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	nodes, err := client.ListNodes()
+	if err != nil {
+		t.Fatalf("ListNodes: %v", err)
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("got %d nodes, want 1", len(nodes))
+	}
+	node := nodes[0]
+	if node.ID != registered.ID || node.Name != "Laptop" || node.User != "alice" || node.RegisterMethod != "authkey" {
+		t.Errorf("node = %+v", node)
+	}
+	if node.IPv4() == "" || node.IPv6() == "" {
+		t.Errorf("node addresses = %v", node.IPAddresses)
+	}
+
+	if err := client.RenameNode(node.ID, "alice-laptop"); err != nil {
+		t.Fatalf("RenameNode: %v", err)
+	}
+	bob, _ := client.FindUser("bob")
+	if err := client.MoveNode(node.ID, bob.ID); err != nil {
+		t.Fatalf("MoveNode: %v", err)
+	}
+	if err := client.SetNodeTags(node.ID, []string{"tag:laptops", "tag:finance"}); err != nil {
+		t.Fatalf("SetNodeTags: %v", err)
+	}
+	if err := client.ExpireNode(node.ID); err != nil {
+		t.Fatalf("ExpireNode: %v", err)
+	}
+
+	updated, err := client.GetNode(node.ID)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if updated.GivenName != "alice-laptop" || updated.User != "bob" || updated.Expiry == "" {
+		t.Errorf("updated node = %+v", updated)
+	}
+	if len(updated.ForcedTags) != 2 {
+		t.Errorf("forced tags = %v", updated.ForcedTags)
+	}
+
+	if err := client.SetNodeTags(node.ID, nil); err != nil {
+		t.Fatalf("clearing tags: %v", err)
+	}
+	if cleared, _ := client.GetNode(node.ID); len(cleared.ForcedTags) != 0 {
+		t.Errorf("tags after clearing = %v", cleared.ForcedTags)
+	}
+
+	if err := client.DeleteNode(node.ID); err != nil {
+		t.Fatalf("DeleteNode: %v", err)
+	}
+	if _, err := client.GetNode(node.ID); err == nil {
+		t.Error("GetNode of a deleted node succeeded")
+	}
+	if err := client.RenameNode(node.ID, "gone"); !headscale.IsNotFound(err) {
+		t.Errorf("renaming a deleted node = %v, want not found", err)
+	}
+}
+
+func TestApproveRoutes(t *testing.T) {
+	fake, client := newTestClient(t)
+	node := registerTestNode(t, fake, client, "infrastructure", "router", "10.0.0.0/24", "0.0.0.0/0", "::/0")
+
+	if err := client.ApproveRoutes(node.ID, []string{"10.0.0.0/24", "0.0.0.0/0"}); err != nil {
+		t.Fatalf("ApproveRoutes: %v", err)
+	}
+	routes, err := client.ListRoutes()
+	if err != nil {
+		t.Fatalf("ListRoutes: %v", err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("got %d routes, want 3: %+v", len(routes), routes)
+	}
+	enabled := map[string]bool{}
+	for _, route := range routes {
+		if !route.Advertised || route.NodeID != node.ID {
+			t.Errorf("route = %+v", route)
+		}
+		enabled[route.Prefix] = route.Enabled
+		if route.Enabled != route.IsPrimary {
+			t.Errorf("route %s enabled %v but serving %v", route.Prefix, route.Enabled, route.IsPrimary)
+		}
+	}
+	if !enabled["10.0.0.0/24"] || !enabled["0.0.0.0/0"] || enabled["::/0"] {
+		t.Errorf("enabled routes = %v", enabled)
+	}
+
+	if err := client.ApproveRoutes(node.ID, nil); err != nil {
+		t.Fatalf("withdrawing routes: %v", err)
+	}
+	withdrawn, _ := client.GetNode(node.ID)
+	if len(withdrawn.ApprovedRoutes) != 0 || len(withdrawn.SubnetRoutes) != 0 {
+		t.Errorf("routes after withdrawing = %v / %v", withdrawn.ApprovedRoutes, withdrawn.SubnetRoutes)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	_, client := newTestClient(t)
+
+	if _, _, err := client.GetPolicy(); !headscale.IsNotFound(err) {
+		t.Errorf("GetPolicy before one is set = %v, want not found", err)
+	}
+
+	policy := `{"acls":[{"action":"accept","src":["*"],"dst":["*:*"]}]}`
+	if err := client.SetPolicy(policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	got, updatedAt, err := client.GetPolicy()
+	if err != nil {
+		t.Fatalf("GetPolicy: %v", err)
+	}
+	if got != policy || updatedAt == "" {
+		t.Errorf("GetPolicy = %q, %q", got, updatedAt)
+	}
+
+	if err := client.SetPolicy("{not json"); err == nil {
+		t.Error("an invalid policy was accepted")
+	}
+	if got, _, _ := client.GetPolicy(); got != policy {
+		t.Errorf("a rejected policy replaced the current one: %q", got)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	fake := headscaletest.NewServer("good-key")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := headscale.NewClient(server.URL, "stale-key")
+	if _, err := client.ListUsers(); !headscale.IsUnauthorized(err) {
+		t.Fatalf("ListUsers with a rejected key = %v, want unauthorized", err)
+	}
+
+	refreshed := 0
+	client.OnUnauthorized(func(rejected string) (string, error) {
+		if rejected != "stale-key" {
+			t.Errorf("refresh got rejected key %q, want stale-key", rejected)
+		}
+		refreshed++
+		return "good-key", nil
+	})
+	if _, err := client.ListUsers(); err != nil {
+		t.Fatalf("ListUsers after refreshing the key: %v", err)
+	}
+	if _, err := client.CreateUser("alice"); err != nil {
+		t.Fatalf("CreateUser with the refreshed key: %v", err)
+	}
+	if refreshed != 1 {
+		t.Errorf("key refreshed %d times, want 1", refreshed)
+	}
+}
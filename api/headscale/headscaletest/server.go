@@ -0,0 +1,528 @@
+// Package headscaletest provides an in-memory Headscale API server for tests
+// of code built on the headscale client.
+package headscaletest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/headscale"
+)
+
+// Server is an in-memory stand-in for Headscale's REST API. It serves the
+// endpoints headscale.Client uses with the same JSON shapes, so tests of the
+// client and of the services built on it can run it behind
+// httptest.NewServer instead of a Headscale install.
+type Server struct {
+	APIKey string // Required bearer token; empty accepts any
+
+	mu       sync.Mutex
+	nextID   uint64
+	users    []fakeUser
+	keys     []fakeKey
+	nodes    []fakeNode
+	policy   string
+	policyAt time.Time
+}
+
+type fakeUser struct {
+	ID        uint64
+	Name      string
+	CreatedAt time.Time
+}
+
+type fakeKey struct {
+	ID         uint64
+	UserID     uint64
+	Key        string
+	Reusable   bool
+	Ephemeral  bool
+	Used       bool
+	Expiration time.Time
+	CreatedAt  time.Time
+	ACLTags    []string
+}
+
+type fakeNode struct {
+	ID              uint64
+	Name            string
+	GivenName       string
+	UserID          uint64
+	IPAddresses     []string
+	CreatedAt       time.Time
+	LastSeen        time.Time
+	Expiry          time.Time
+	KeyID           uint64
+	ForcedTags      []string
+	ApprovedRoutes  []string
+	AvailableRoutes []string
+}
+
+// NewServer creates an empty server that accepts apiKey
+func NewServer(apiKey string) *Server {
+	return &Server{APIKey: apiKey}
+}
+
+// RegisterNode registers a node the way tailscale up --authkey would and
+// returns it. The node advertises the given routes.
+func (f *Server) RegisterNode(key, hostname string, routes ...string) (*headscale.Node, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.keys {
+		k := &f.keys[i]
+		if k.Key != key {
+			continue
+		}
+		if (k.Used && !k.Reusable) || time.Now().After(k.Expiration) {
+			return nil, fmt.Errorf("pre-auth key is expired or already used")
+		}
+		k.Used = true
+
+		id := f.newID()
+		now := time.Now().UTC()
+		node := fakeNode{
+			ID:              id,
+			Name:            hostname,
+			GivenName:       strings.ToLower(hostname),
+			UserID:          k.UserID,
+			IPAddresses:     []string{fmt.Sprintf("100.64.%d.%d", id/256, id%256), fmt.Sprintf("fd7a:115c:a1e0::%x", id)},
+			CreatedAt:       now,
+			LastSeen:        now,
+			KeyID:           k.ID,
+			ForcedTags:      append([]string{}, k.ACLTags...),
+			AvailableRoutes: routes,
+		}
+		f.nodes = append(f.nodes, node)
+		registered := f.toNode(node)
+		return &registered, nil
+	}
+	return nil, fmt.Errorf("pre-auth key not found")
+}
+
+// ServeHTTP implements http.Handler
+func (f *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		writeFakeJSON(w, http.StatusOK, map[string]string{"status": "pass"})
+		return
+	}
+	if f.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+f.APIKey {
+		writeFakeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1"), "/"), "/")
+	switch {
+	case parts[0] == "user":
+		f.serveUsers(w, r, parts[1:])
+	case parts[0] == "preauthkey":
+		f.servePreAuthKeys(w, r, parts[1:])
+	case parts[0] == "node":
+		f.serveNodes(w, r, parts[1:])
+	case parts[0] == "policy" && len(parts) == 1:
+		f.servePolicy(w, r)
+	default:
+		writeFakeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (f *Server) serveUsers(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		users := []map[string]interface{}{}
+		for _, user := range f.users {
+			users = append(users, renderFakeUser(user))
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		if req.Name == "" {
+			writeFakeError(w, http.StatusBadRequest, "user name is required")
+			return
+		}
+		if _, ok := f.userByName(req.Name); ok {
+			writeFakeError(w, http.StatusConflict, "user already exists")
+			return
+		}
+		user := fakeUser{ID: f.newID(), Name: req.Name, CreatedAt: time.Now().UTC()}
+		f.users = append(f.users, user)
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"user": renderFakeUser(user)})
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		id, _ := strconv.ParseUint(parts[0], 10, 64)
+		for i, user := range f.users {
+			if user.ID != id {
+				continue
+			}
+			for _, node := range f.nodes {
+				if node.UserID == id {
+					writeFakeError(w, http.StatusBadRequest, "user still has nodes")
+					return
+				}
+			}
+			f.users = append(f.users[:i], f.users[i+1:]...)
+			writeFakeJSON(w, http.StatusOK, map[string]interface{}{})
+			return
+		}
+		writeFakeError(w, http.StatusNotFound, "user not found")
+
+	default:
+		writeFakeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (f *Server) servePreAuthKeys(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		userID, _ := strconv.ParseUint(r.URL.Query().Get("user"), 10, 64)
+		if _, ok := f.userByID(userID); !ok {
+			writeFakeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		keys := []map[string]interface{}{}
+		for _, key := range f.keys {
+			if key.UserID == userID {
+				keys = append(keys, f.renderKey(key))
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"preAuthKeys": keys})
+
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req struct {
+			User       json.Number `json:"user"`
+			Reusable   bool        `json:"reusable"`
+			Ephemeral  bool        `json:"ephemeral"`
+			Expiration *time.Time  `json:"expiration"`
+			ACLTags    []string    `json:"aclTags"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		userID, _ := strconv.ParseUint(req.User.String(), 10, 64)
+		if _, ok := f.userByID(userID); !ok {
+			writeFakeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		now := time.Now().UTC()
+		key := fakeKey{
+			ID:         f.newID(),
+			UserID:     userID,
+			Key:        randomFakeKey(),
+			Reusable:   req.Reusable,
+			Ephemeral:  req.Ephemeral,
+			Expiration: now.Add(time.Hour),
+			CreatedAt:  now,
+			ACLTags:    req.ACLTags,
+		}
+		if req.Expiration != nil {
+			key.Expiration = req.Expiration.UTC()
+		}
+		f.keys = append(f.keys, key)
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"preAuthKey": f.renderKey(key)})
+
+	case len(parts) == 1 && parts[0] == "expire" && r.Method == http.MethodPost:
+		var req struct {
+			User json.Number `json:"user"`
+			Key  string      `json:"key"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		userID, _ := strconv.ParseUint(req.User.String(), 10, 64)
+		for i := range f.keys {
+			if f.keys[i].UserID == userID && f.keys[i].Key == req.Key {
+				f.keys[i].Expiration = time.Now().UTC()
+				writeFakeJSON(w, http.StatusOK, map[string]interface{}{})
+				return
+			}
+		}
+		writeFakeError(w, http.StatusNotFound, "pre-auth key not found")
+
+	default:
+		writeFakeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (f *Server) serveNodes(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 {
+		if r.Method != http.MethodGet {
+			writeFakeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		user := r.URL.Query().Get("user")
+		nodes := []map[string]interface{}{}
+		for _, node := range f.nodes {
+			owner, _ := f.userByID(node.UserID)
+			if user == "" || owner.Name == user {
+				nodes = append(nodes, f.renderNode(node))
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"nodes": nodes})
+		return
+	}
+
+	id, _ := strconv.ParseUint(parts[0], 10, 64)
+	index := -1
+	for i, node := range f.nodes {
+		if node.ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		writeFakeError(w, http.StatusNotFound, "node not found")
+		return
+	}
+	node := &f.nodes[index]
+
+	action := strings.Join(parts[1:], "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+	case action == "" && r.Method == http.MethodDelete:
+		f.nodes = append(f.nodes[:index], f.nodes[index+1:]...)
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{})
+		return
+	case action == "expire" && r.Method == http.MethodPost:
+		node.Expiry = time.Now().UTC()
+	case len(parts) == 3 && parts[1] == "rename" && r.Method == http.MethodPost:
+		node.GivenName = parts[2]
+	case action == "user" && r.Method == http.MethodPost:
+		var req struct {
+			User json.Number `json:"user"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		userID, _ := strconv.ParseUint(req.User.String(), 10, 64)
+		if _, ok := f.userByID(userID); !ok {
+			writeFakeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		node.UserID = userID
+	case action == "tags" && r.Method == http.MethodPost:
+		var req struct {
+			Tags []string `json:"tags"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		for _, tag := range req.Tags {
+			if !strings.HasPrefix(tag, "tag:") {
+				writeFakeError(w, http.StatusBadRequest, "invalid tag: "+tag)
+				return
+			}
+		}
+		node.ForcedTags = req.Tags
+	case action == "approve_routes" && r.Method == http.MethodPost:
+		var req struct {
+			Routes []string `json:"routes"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		node.ApprovedRoutes = req.Routes
+	default:
+		writeFakeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"node": f.renderNode(*node)})
+}
+
+func (f *Server) servePolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if f.policy == "" {
+			writeFakeError(w, http.StatusNotFound, "no policy set")
+			return
+		}
+	case http.MethodPut:
+		var req struct {
+			Policy string `json:"policy"`
+		}
+		if !readFakeJSON(w, r, &req) {
+			return
+		}
+		var document interface{}
+		if err := json.Unmarshal([]byte(req.Policy), &document); err != nil {
+			writeFakeError(w, http.StatusBadRequest, "invalid policy: "+err.Error())
+			return
+		}
+		f.policy = req.Policy
+		f.policyAt = time.Now().UTC()
+	default:
+		writeFakeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+		"policy":    f.policy,
+		"updatedAt": f.policyAt.Format(time.RFC3339),
+	})
+}
+
+func (f *Server) newID() uint64 {
+	f.nextID++
+	return f.nextID
+}
+
+func (f *Server) userByID(id uint64) (fakeUser, bool) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, true
+		}
+	}
+	return fakeUser{}, false
+}
+
+func (f *Server) userByName(name string) (fakeUser, bool) {
+	for _, user := range f.users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return fakeUser{}, false
+}
+
+func (f *Server) renderKey(key fakeKey) map[string]interface{} {
+	user, _ := f.userByID(key.UserID)
+	return map[string]interface{}{
+		"id":         strconv.FormatUint(key.ID, 10),
+		"user":       renderFakeUser(user),
+		"key":        key.Key,
+		"reusable":   key.Reusable,
+		"ephemeral":  key.Ephemeral,
+		"used":       key.Used,
+		"expiration": key.Expiration.Format(time.RFC3339),
+		"createdAt":  key.CreatedAt.Format(time.RFC3339),
+		"aclTags":    nonNil(key.ACLTags),
+	}
+}
+
+// renderNode encodes a node the way the API does
+func (f *Server) renderNode(node fakeNode) map[string]interface{} {
+	user, _ := f.userByID(node.UserID)
+	rendered := map[string]interface{}{
+		"id":              strconv.FormatUint(node.ID, 10),
+		"name":            node.Name,
+		"givenName":       node.GivenName,
+		"user":            renderFakeUser(user),
+		"ipAddresses":     node.IPAddresses,
+		"online":          true,
+		"lastSeen":        node.LastSeen.Format(time.RFC3339),
+		"createdAt":       node.CreatedAt.Format(time.RFC3339),
+		"registerMethod":  "REGISTER_METHOD_AUTH_KEY",
+		"forcedTags":      nonNil(node.ForcedTags),
+		"validTags":       []string{},
+		"invalidTags":     []string{},
+		"approvedRoutes":  nonNil(node.ApprovedRoutes),
+		"availableRoutes": nonNil(node.AvailableRoutes),
+		"subnetRoutes":    intersect(node.ApprovedRoutes, node.AvailableRoutes),
+	}
+	if !node.Expiry.IsZero() {
+		rendered["expiry"] = node.Expiry.Format(time.RFC3339)
+	}
+	for _, key := range f.keys {
+		if key.ID == node.KeyID {
+			rendered["preAuthKey"] = f.renderKey(key)
+		}
+	}
+	return rendered
+}
+
+// toNode returns a node as the client reports it
+func (f *Server) toNode(node fakeNode) headscale.Node {
+	user, _ := f.userByID(node.UserID)
+	registered := headscale.Node{
+		ID:              strconv.FormatUint(node.ID, 10),
+		Name:            node.Name,
+		GivenName:       node.GivenName,
+		User:            user.Name,
+		IPAddresses:     nonNil(node.IPAddresses),
+		Online:          true,
+		LastSeen:        node.LastSeen.Format(time.RFC3339),
+		CreatedAt:       node.CreatedAt.Format(time.RFC3339),
+		RegisterMethod:  "authkey",
+		PreAuthKeyID:    strconv.FormatUint(node.KeyID, 10),
+		ForcedTags:      nonNil(node.ForcedTags),
+		ValidTags:       []string{},
+		InvalidTags:     []string{},
+		ApprovedRoutes:  nonNil(node.ApprovedRoutes),
+		AvailableRoutes: nonNil(node.AvailableRoutes),
+		SubnetRoutes:    intersect(node.ApprovedRoutes, node.AvailableRoutes),
+	}
+	if !node.Expiry.IsZero() {
+		registered.Expiry = node.Expiry.Format(time.RFC3339)
+	}
+	return registered
+}
+
+func renderFakeUser(user fakeUser) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        strconv.FormatUint(user.ID, 10),
+		"name":      user.Name,
+		"createdAt": user.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func intersect(a, b []string) []string {
+	result := []string{}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				result = append(result, x)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func randomFakeKey() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func readFakeJSON(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeFakeError writes an error in the gRPC gateway's format
+func writeFakeError(w http.ResponseWriter, status int, message string) {
+	writeFakeJSON(w, status, map[string]interface{}{
+		"code":    status,
+		"message": message,
+		"details": []interface{}{},
+	})
+}
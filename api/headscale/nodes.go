@@ -0,0 +1,243 @@
+package headscale
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Node represents a Headscale node
+type Node struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`       // Hostname reported by the node
+	GivenName       string   `json:"given_name"` // Name used in MagicDNS
+	User            string   `json:"user"`
+	IPAddresses     []string `json:"ip_addresses"`
+	Online          bool     `json:"online"`
+	LastSeen        string   `json:"last_seen,omitempty"`
+	Expiry          string   `json:"expiry,omitempty"`
+	CreatedAt       string   `json:"created_at,omitempty"`
+	NodeKey         string   `json:"node_key,omitempty"`
+	RegisterMethod  string   `json:"register_method,omitempty"` // authkey, cli or oidc
+	PreAuthKeyID    string   `json:"pre_auth_key_id,omitempty"` // Key the node registered with
+	ForcedTags      []string `json:"forced_tags"`               // Tags set by the server
+	ValidTags       []string `json:"valid_tags"`                // Tags the node requested and the policy allows
+	InvalidTags     []string `json:"invalid_tags"`              // Tags the node requested and the policy rejects
+	ApprovedRoutes  []string `json:"approved_routes"`           // Prefixes an administrator approved
+	AvailableRoutes []string `json:"available_routes"`          // Prefixes the node advertises
+	SubnetRoutes    []string `json:"subnet_routes"`             // Approved prefixes the node currently serves
+}
+
+// IPv4 returns the node's overlay IPv4 address
+func (n Node) IPv4() string {
+	for _, address := range n.IPAddresses {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+			return address
+		}
+	}
+	return ""
+}
+
+// IPv6 returns the node's overlay IPv6 address
+func (n Node) IPv6() string {
+	for _, address := range n.IPAddresses {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+			return address
+		}
+	}
+	return ""
+}
+
+// Route represents a subnet route of a node and its approval state
+type Route struct {
+	NodeID     string `json:"node_id"`
+	NodeName   string `json:"node_name"`
+	Prefix     string `json:"prefix"`
+	Advertised bool   `json:"advertised"`
+	Enabled    bool   `json:"enabled"`    // Approved by an administrator
+	IsPrimary  bool   `json:"is_primary"` // Served by this node
+}
+
+// IsExitRoute reports whether the route is a default route, which makes its
+// node an exit node when enabled
+func (r Route) IsExitRoute() bool {
+	return r.Prefix == "0.0.0.0/0" || r.Prefix == "::/0"
+}
+
+// Routes returns the routes the node advertises or has approved
+func (n Node) Routes() []Route {
+	advertised := make(map[string]bool)
+	for _, prefix := range n.AvailableRoutes {
+		advertised[prefix] = true
+	}
+	approved := make(map[string]bool)
+	for _, prefix := range n.ApprovedRoutes {
+		approved[prefix] = true
+	}
+	serving := make(map[string]bool)
+	for _, prefix := range n.SubnetRoutes {
+		serving[prefix] = true
+	}
+
+	routes := []Route{}
+	seen := make(map[string]bool)
+	for _, prefix := range append(append([]string{}, n.AvailableRoutes...), n.ApprovedRoutes...) {
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		routes = append(routes, Route{
+			NodeID:     n.ID,
+			NodeName:   n.GivenName,
+			Prefix:     prefix,
+			Advertised: advertised[prefix],
+			Enabled:    approved[prefix],
+			IsPrimary:  serving[prefix],
+		})
+	}
+	return routes
+}
+
+// ListNodes lists all nodes
+func (c *Client) ListNodes() ([]Node, error) {
+	var response struct {
+		Nodes []rawNode `json:"nodes"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/node", nil, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes := make([]Node, 0, len(response.Nodes))
+	for _, r := range response.Nodes {
+		nodes = append(nodes, r.toNode())
+	}
+	return nodes, nil
+}
+
+// GetNode returns the node with the given ID
+func (c *Client) GetNode(nodeID string) (*Node, error) {
+	var response struct {
+		Node rawNode `json:"node"`
+	}
+	if err := c.do(http.MethodGet, nodePath(nodeID), nil, nil, &response); err != nil {
+		if IsNotFound(err) {
+			return nil, fmt.Errorf("node %s not found", nodeID)
+		}
+		return nil, fmt.Errorf("failed to get node: %w", err)
+	}
+	node := response.Node.toNode()
+	return &node, nil
+}
+
+// RenameNode changes the given name of a node
+func (c *Client) RenameNode(nodeID, name string) error {
+	if err := c.do(http.MethodPost, nodePath(nodeID, "rename", name), nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to rename node: %w", err)
+	}
+	return nil
+}
+
+// ExpireNode expires a node's key so it has to log in again
+func (c *Client) ExpireNode(nodeID string) error {
+	if err := c.do(http.MethodPost, nodePath(nodeID, "expire"), nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to expire node: %w", err)
+	}
+	return nil
+}
+
+// DeleteNode removes a node
+func (c *Client) DeleteNode(nodeID string) error {
+	if err := c.do(http.MethodDelete, nodePath(nodeID), nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete node: %w", err)
+	}
+	return nil
+}
+
+// MoveNode assigns a node to another user, given by user ID
+func (c *Client) MoveNode(nodeID, userID string) error {
+	body := map[string]string{"user": userID}
+	if err := c.do(http.MethodPost, nodePath(nodeID, "user"), nil, body, nil); err != nil {
+		return fmt.Errorf("failed to move node: %w", err)
+	}
+	return nil
+}
+
+// SetNodeTags replaces the forced ACL tags of a node. An empty list clears them.
+func (c *Client) SetNodeTags(nodeID string, tags []string) error {
+	body := map[string][]string{"tags": nonNil(tags)}
+	if err := c.do(http.MethodPost, nodePath(nodeID, "tags"), nil, body, nil); err != nil {
+		return fmt.Errorf("failed to set node tags: %w", err)
+	}
+	return nil
+}
+
+// ApproveRoutes replaces the set of routes approved for a node. An empty list
+// withdraws all approvals.
+func (c *Client) ApproveRoutes(nodeID string, prefixes []string) error {
+	body := map[string][]string{"routes": nonNil(prefixes)}
+	if err := c.do(http.MethodPost, nodePath(nodeID, "approve_routes"), nil, body, nil); err != nil {
+		return fmt.Errorf("failed to approve routes: %w", err)
+	}
+	return nil
+}
+
+// ListRoutes lists the routes of all nodes
+func (c *Client) ListRoutes() ([]Route, error) {
+	nodes, err := c.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	routes := []Route{}
+	for _, node := range nodes {
+		routes = append(routes, node.Routes()...)
+	}
+	return routes, nil
+}
+
+// rawNode mirrors the API's node JSON
+type rawNode struct {
+	ID              json.RawMessage `json:"id"`
+	Name            string          `json:"name"`
+	GivenName       string          `json:"givenName"`
+	User            json.RawMessage `json:"user"`
+	IPAddresses     []string        `json:"ipAddresses"`
+	Online          bool            `json:"online"`
+	LastSeen        json.RawMessage `json:"lastSeen"`
+	Expiry          json.RawMessage `json:"expiry"`
+	CreatedAt       json.RawMessage `json:"createdAt"`
+	NodeKey         string          `json:"nodeKey"`
+	RegisterMethod  json.RawMessage `json:"registerMethod"`
+	PreAuthKey      *rawPreAuthKey  `json:"preAuthKey"`
+	ForcedTags      []string        `json:"forcedTags"`
+	ValidTags       []string        `json:"validTags"`
+	InvalidTags     []string        `json:"invalidTags"`
+	ApprovedRoutes  []string        `json:"approvedRoutes"`
+	AvailableRoutes []string        `json:"availableRoutes"`
+	SubnetRoutes    []string        `json:"subnetRoutes"`
+}
+
+func (r rawNode) toNode() Node {
+	node := Node{
+		ID:              rawString(r.ID),
+		Name:            r.Name,
+		GivenName:       r.GivenName,
+		User:            rawString(r.User),
+		IPAddresses:     nonNil(r.IPAddresses),
+		Online:          r.Online,
+		LastSeen:        rawTimestamp(r.LastSeen),
+		Expiry:          rawTimestamp(r.Expiry),
+		CreatedAt:       rawTimestamp(r.CreatedAt),
+		NodeKey:         r.NodeKey,
+		RegisterMethod:  registerMethod(rawString(r.RegisterMethod)),
+		ForcedTags:      nonNil(r.ForcedTags),
+		ValidTags:       nonNil(r.ValidTags),
+		InvalidTags:     nonNil(r.InvalidTags),
+		ApprovedRoutes:  nonNil(r.ApprovedRoutes),
+		AvailableRoutes: nonNil(r.AvailableRoutes),
+		SubnetRoutes:    nonNil(r.SubnetRoutes),
+	}
+	if r.PreAuthKey != nil {
+		node.PreAuthKeyID = rawString(r.PreAuthKey.ID)
+	}
+	return node
+}
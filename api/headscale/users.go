@@ -0,0 +1,178 @@
+package headscale
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// User represents a Headscale user
+type User struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// PreAuthKey represents a pre-auth key
+type PreAuthKey struct {
+	User       string   `json:"user"`
+	ID         string   `json:"id"`
+	Key        string   `json:"key"`
+	Reusable   bool     `json:"reusable"`
+	Ephemeral  bool     `json:"ephemeral"`
+	Used       bool     `json:"used"`
+	Expiration string   `json:"expiration"`
+	CreatedAt  string   `json:"created_at"`
+	ACLTags    []string `json:"acl_tags"`
+}
+
+// CreatePreAuthKeyRequest describes a pre-auth key to create
+type CreatePreAuthKeyRequest struct {
+	UserID     string
+	Reusable   bool
+	Ephemeral  bool
+	Expiration time.Time // Zero means Headscale's default of one hour
+	ACLTags    []string  // Forced onto nodes registered with the key
+}
+
+// ListUsers lists all users
+func (c *Client) ListUsers() ([]User, error) {
+	var response struct {
+		Users []rawUser `json:"users"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/user", nil, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	users := make([]User, 0, len(response.Users))
+	for _, r := range response.Users {
+		users = append(users, r.toUser())
+	}
+	return users, nil
+}
+
+// FindUser returns the user with the given name
+func (c *Client) FindUser(name string) (*User, error) {
+	users, err := c.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Name == name {
+			return &user, nil
+		}
+	}
+	return nil, &APIError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("headscale user %s not found", name)}
+}
+
+// CreateUser creates a user
+func (c *Client) CreateUser(name string) (*User, error) {
+	var response struct {
+		User rawUser `json:"user"`
+	}
+	body := map[string]string{"name": name}
+	if err := c.do(http.MethodPost, "/api/v1/user", nil, body, &response); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	user := response.User.toUser()
+	return &user, nil
+}
+
+// DeleteUser removes a user. The user must not own any nodes.
+func (c *Client) DeleteUser(userID string) error {
+	if err := c.do(http.MethodDelete, "/api/v1/user/"+url.PathEscape(userID), nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// ListPreAuthKeys lists a user's pre-auth keys
+func (c *Client) ListPreAuthKeys(userID string) ([]PreAuthKey, error) {
+	var response struct {
+		PreAuthKeys []rawPreAuthKey `json:"preAuthKeys"`
+	}
+	query := url.Values{"user": {userID}}
+	if err := c.do(http.MethodGet, "/api/v1/preauthkey", query, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list pre-auth keys: %w", err)
+	}
+	keys := make([]PreAuthKey, 0, len(response.PreAuthKeys))
+	for _, r := range response.PreAuthKeys {
+		keys = append(keys, r.toPreAuthKey())
+	}
+	return keys, nil
+}
+
+// CreatePreAuthKey creates a pre-auth key
+func (c *Client) CreatePreAuthKey(req CreatePreAuthKeyRequest) (*PreAuthKey, error) {
+	body := map[string]interface{}{
+		"user":      req.UserID,
+		"reusable":  req.Reusable,
+		"ephemeral": req.Ephemeral,
+		"aclTags":   nonNil(req.ACLTags),
+	}
+	if !req.Expiration.IsZero() {
+		body["expiration"] = req.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	var response struct {
+		PreAuthKey rawPreAuthKey `json:"preAuthKey"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/preauthkey", nil, body, &response); err != nil {
+		return nil, fmt.Errorf("failed to create pre-auth key: %w", err)
+	}
+	key := response.PreAuthKey.toPreAuthKey()
+	return &key, nil
+}
+
+// ExpirePreAuthKey expires a pre-auth key so it can no longer register nodes
+func (c *Client) ExpirePreAuthKey(userID, key string) error {
+	body := map[string]string{"user": userID, "key": key}
+	if err := c.do(http.MethodPost, "/api/v1/preauthkey/expire", nil, body, nil); err != nil {
+		return fmt.Errorf("failed to expire pre-auth key: %w", err)
+	}
+	return nil
+}
+
+// rawUser mirrors the API's user JSON
+type rawUser struct {
+	ID        json.RawMessage `json:"id"`
+	Name      string          `json:"name"`
+	CreatedAt json.RawMessage `json:"createdAt"`
+}
+
+func (r rawUser) toUser() User {
+	return User{
+		ID:        rawString(r.ID),
+		Name:      r.Name,
+		CreatedAt: rawTimestamp(r.CreatedAt),
+	}
+}
+
+// rawPreAuthKey mirrors the API's pre-auth key JSON, whose user is a name
+// before Headscale 0.26 and a user object since
+type rawPreAuthKey struct {
+	User       json.RawMessage `json:"user"`
+	ID         json.RawMessage `json:"id"`
+	Key        string          `json:"key"`
+	Reusable   bool            `json:"reusable"`
+	Ephemeral  bool            `json:"ephemeral"`
+	Used       bool            `json:"used"`
+	Expiration json.RawMessage `json:"expiration"`
+	CreatedAt  json.RawMessage `json:"createdAt"`
+	ACLTags    []string        `json:"aclTags"`
+}
+
+func (r rawPreAuthKey) toPreAuthKey() PreAuthKey {
+	return PreAuthKey{
+		User:       rawString(r.User),
+		ID:         rawString(r.ID),
+		Key:        r.Key,
+		Reusable:   r.Reusable,
+		Ephemeral:  r.Ephemeral,
+		Used:       r.Used,
+		Expiration: rawTimestamp(r.Expiration),
+		CreatedAt:  rawTimestamp(r.CreatedAt),
+		ACLTags:    nonNil(r.ACLTags),
+	}
+}
@@ -0,0 +1,71 @@
+package headscale
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rawString flattens a JSON string, number, protobuf timestamp ({"seconds": n})
+// or named object ({"name": "..."}) into a string. Timestamps become RFC3339.
+func rawString(data json.RawMessage) string {
+	if len(data) == 0 || string(data) == "null" {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		return n.String()
+	}
+
+	var obj struct {
+		Seconds json.Number `json:"seconds"`
+		Name    string      `json:"name"`
+	}
+	if err := json.Unmarshal(data, &obj); err == nil {
+		if obj.Name != "" {
+			return obj.Name
+		}
+		if seconds, err := strconv.ParseInt(obj.Seconds.String(), 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	return string(data)
+}
+
+// rawTimestamp flattens a timestamp like rawString, leaving unset (zero or
+// epoch) timestamps empty
+func rawTimestamp(data json.RawMessage) string {
+	value := rawString(data)
+	if strings.HasPrefix(value, "0001-01-01") || strings.HasPrefix(value, "1970-01-01") {
+		return ""
+	}
+	return value
+}
+
+// registerMethod names a RegisterMethod enum given as a number or a proto name
+func registerMethod(value string) string {
+	switch strings.TrimPrefix(strings.ToUpper(value), "REGISTER_METHOD_") {
+	case "1", "AUTH_KEY":
+		return "authkey"
+	case "2", "CLI":
+		return "cli"
+	case "3", "OIDC":
+		return "oidc"
+	}
+	return ""
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
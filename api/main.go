@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/griffinwebnet/vexa/api/handlers"
 	"github.com/griffinwebnet/vexa/api/middleware"
+	"github.com/griffinwebnet/vexa/api/services"
 	"github.com/griffinwebnet/vexa/api/utils"
 )
 
@@ -34,6 +35,21 @@ func main() {
 	domainHandler := handlers.NewDomainHandler()
 	computerHandler := handlers.NewComputerHandler()
 	overlayHandler := handlers.NewOverlayHandler()
+	sshKeyHandler := handlers.NewSSHKeyHandler()
+	deploymentHandler := handlers.NewDeploymentHandler()
+	lapsHandler := handlers.NewLAPSHandler()
+	inventoryHandler := handlers.NewInventoryHandler()
+	oidcHandler := handlers.NewOIDCHandler()
+
+	// Background jobs: reachability probing so listings answer from cache,
+	// deletion of quarantined computers once their grace period ends,
+	// keeping overlay policy groups in step with directory membership, and
+	// pushing selected Samba DNS records to overlay nodes
+	computerService := services.NewComputerService()
+	computerService.StartReachabilityMonitor()
+	computerService.StartQuarantinePurge()
+	services.NewOverlayPolicyService().StartGroupSync()
+	services.NewOverlayDNSService().StartSync()
 
 	router := gin.Default()
 
@@ -67,6 +83,23 @@ func main() {
 		public.GET("/updates/check", handlers.CheckForUpdates)
 		public.POST("/updates/upgrade", handlers.PerformUpgrade)
 		public.GET("/domain/status", domainHandler.DomainStatus)
+
+		// sshd AuthorizedKeysCommand lookup (authenticated with the lookup token)
+		public.GET("/ssh/authorized-keys/:username", sshKeyHandler.AuthorizedKeys)
+		// Signed one-time deployment script links
+		public.GET("/deployment/download/:token", deploymentHandler.DownloadDeploymentScript)
+		// Computer inventory check-ins (authenticated with each computer's check-in credential)
+		public.POST("/inventory/checkin", inventoryHandler.CheckIn)
+		public.GET("/inventory/agent.ps1", inventoryHandler.Agent)
+
+		// OpenID Connect provider for Headscale's interactive device login
+		public.GET("/oidc/.well-known/openid-configuration", oidcHandler.Discovery)
+		public.GET("/oidc/jwks", oidcHandler.JWKS)
+		public.GET("/oidc/authorize", oidcHandler.Authorize)
+		public.POST("/oidc/authorize", oidcHandler.AuthorizeSubmit)
+		public.POST("/oidc/token", oidcHandler.Token)
+		public.GET("/oidc/userinfo", oidcHandler.UserInfo)
+		public.POST("/oidc/userinfo", oidcHandler.UserInfo)
 	}
 
 	// Protected routes (require authentication)
@@ -89,10 +122,20 @@ func main() {
 		protected.POST("/users/:id/disable", userHandler.DisableUser)
 		protected.POST("/users/:id/enable", userHandler.EnableUser)
 		protected.POST("/users/:id/toggle-must-change-password", userHandler.ToggleMustChangePassword)
+		protected.POST("/users/:id/home-directory", userHandler.ProvisionHomeDirectory)
+		protected.GET("/users/:id/ssh-keys", sshKeyHandler.ListUserKeys)
+		protected.POST("/users/:id/ssh-keys", sshKeyHandler.AddUserKey)
+		protected.DELETE("/users/:id/ssh-keys", sshKeyHandler.RemoveUserKey)
+		protected.GET("/users/:id/overlay", overlayHandler.GetUserOverlay)
 
 		// Self-service endpoints
 		protected.POST("/users/change-password", userHandler.ChangePassword)
 		protected.POST("/users/update-profile", userHandler.UpdateProfile)
+		protected.GET("/profile/ssh-keys", sshKeyHandler.ListMyKeys)
+		protected.POST("/profile/ssh-keys", sshKeyHandler.AddMyKey)
+		protected.DELETE("/profile/ssh-keys", sshKeyHandler.RemoveMyKey)
+		protected.GET("/profile/overlay", overlayHandler.GetMyOverlay)
+		protected.POST("/profile/overlay/keys", overlayHandler.CreateMyKey)
 
 		// Group management
 		protected.GET("/groups", groupHandler.ListGroups)
@@ -105,7 +148,20 @@ func main() {
 
 		// Computer/Device management
 		protected.GET("/computers", computerHandler.ListComputers)
+		protected.POST("/computers", computerHandler.PrestageComputer)
+		protected.GET("/computers/stale", computerHandler.ListStaleComputers)
+		protected.POST("/computers/stale/quarantine", computerHandler.QuarantineStaleComputers)
+		protected.POST("/computers/stale/purge", computerHandler.PurgeQuarantinedComputers)
+		protected.GET("/computers/quarantine", computerHandler.ListQuarantinedComputers)
 		protected.GET("/computers/:id", computerHandler.GetComputer)
+		protected.POST("/computers/:id/restore", computerHandler.RestoreComputer)
+		protected.GET("/computers/:id/inventory", inventoryHandler.GetComputerInventory)
+		protected.POST("/computers/:id/inventory/credential", inventoryHandler.IssueCredential)
+		protected.GET("/computers/:id/metadata", computerHandler.GetComputerMetadata)
+		protected.PUT("/computers/:id/metadata", computerHandler.UpdateComputerMetadata)
+		protected.GET("/computers/:id/laps", lapsHandler.GetPassword)
+		protected.POST("/computers/:id/laps/rotate", lapsHandler.RotatePassword)
+		protected.POST("/computers/:id/offline-join", computerHandler.GenerateOfflineJoin)
 		protected.GET("/machines/:id", computerHandler.GetMachineDetails)
 		protected.DELETE("/computers/:id", computerHandler.DeleteComputer)
 
@@ -127,11 +183,72 @@ func main() {
 		protected.POST("/domain/ous", handlers.CreateOU)
 		protected.DELETE("/domain/ous/:path", handlers.DeleteOU)
 
+		// Group Policy templates
+		gpoHandler := handlers.NewGPOHandler()
+		protected.GET("/domain/gpos", gpoHandler.ListGPOs)
+		protected.GET("/domain/gpo-templates", gpoHandler.ListTemplates)
+		protected.GET("/domain/gpos/:id/templates", gpoHandler.GetGPOTemplates)
+		protected.PUT("/domain/gpos/:id/templates/:template", gpoHandler.ApplyGPOTemplate)
+		protected.DELETE("/domain/gpos/:id/templates/:template", gpoHandler.RemoveGPOTemplate)
+
+		// Logon scripts (NETLOGON) and SYSVOL
+		netlogonHandler := handlers.NewNetlogonHandler()
+		protected.GET("/netlogon/scripts", netlogonHandler.ListScripts)
+		protected.POST("/netlogon/scripts", netlogonHandler.UploadScript)
+		protected.GET("/netlogon/scripts/:name", netlogonHandler.GetScript)
+		protected.DELETE("/netlogon/scripts/:name", netlogonHandler.DeleteScript)
+		protected.GET("/netlogon/scripts/:name/versions", netlogonHandler.ListScriptVersions)
+		protected.POST("/netlogon/scripts/:name/versions/:version/restore", netlogonHandler.RestoreScriptVersion)
+		protected.PUT("/netlogon/assignments", netlogonHandler.AssignScript)
+		protected.GET("/netlogon/sysvol-check", netlogonHandler.CheckSysvol)
+		protected.POST("/netlogon/sysvol-reset", netlogonHandler.ResetSysvol)
+
+		// File shares
+		shareHandler := handlers.NewShareHandler()
+		protected.GET("/shares", shareHandler.ListShares)
+		protected.POST("/shares", shareHandler.CreateShare)
+		protected.GET("/shares/:name", shareHandler.GetShare)
+		protected.PUT("/shares/:name", shareHandler.UpdateShare)
+		protected.DELETE("/shares/:name", shareHandler.DeleteShare)
+		protected.GET("/shares/:name/acl", shareHandler.GetShareACL)
+		protected.PUT("/shares/:name/acl", shareHandler.SetShareACL)
+
+		// Home directories and roaming profiles
+		homeDirectoryHandler := handlers.NewHomeDirectoryHandler()
+		protected.GET("/domain/home-directories", homeDirectoryHandler.GetPolicy)
+		protected.PUT("/domain/home-directories", homeDirectoryHandler.UpdatePolicy)
+
+		// Local administrator passwords (LAPS)
+		protected.GET("/domain/laps", lapsHandler.GetSettings)
+		protected.PUT("/domain/laps", lapsHandler.UpdateSettings)
+		protected.POST("/domain/laps/schema", lapsHandler.InstallSchema)
+
+		// Computer inventory check-ins
+		protected.GET("/domain/inventory", inventoryHandler.GetSettings)
+		protected.PUT("/domain/inventory", inventoryHandler.UpdateSettings)
+
+		// Stale computer cleanup
+		protected.GET("/domain/stale-computers", computerHandler.GetStalePolicy)
+		protected.PUT("/domain/stale-computers", computerHandler.UpdateStalePolicy)
+
+		// RFC2307 POSIX attributes
+		posixHandler := handlers.NewPosixHandler()
+		protected.GET("/domain/posix", posixHandler.GetSettings)
+		protected.PUT("/domain/posix", posixHandler.UpdateSettings)
+		protected.POST("/domain/posix/backfill", posixHandler.Backfill)
+
+		// SSH public keys
+		protected.GET("/domain/ssh-keys", sshKeyHandler.GetSettings)
+		protected.PUT("/domain/ssh-keys", sshKeyHandler.UpdateSettings)
+		protected.POST("/domain/ssh-keys/schema", sshKeyHandler.InstallSchema)
+		protected.POST("/domain/ssh-keys/token", sshKeyHandler.RegenerateToken)
+
 		// Computer deployment
-		deploymentHandler := handlers.NewDeploymentHandler()
 		protected.GET("/deployment/scripts", deploymentHandler.GetDeploymentScripts)
 		protected.POST("/deployment/generate", deploymentHandler.GenerateDeploymentCommand)
 		protected.GET("/deployment/scripts/:script", deploymentHandler.ServeDeploymentScript)
+		protected.GET("/deployment/tokens", deploymentHandler.ListJoinTokens)
+		protected.DELETE("/deployment/tokens/:id", deploymentHandler.RevokeJoinToken)
 
 		// Logs and auditing
 		protected.GET("/audit/logs", handlers.GetAuditLogs)
@@ -143,6 +260,40 @@ func main() {
 		protected.GET("/system/overlay-status", overlayHandler.GetOverlayStatus)
 		protected.POST("/system/setup-overlay", overlayHandler.SetupOverlay)
 		protected.POST("/system/test-fqdn", overlayHandler.TestFQDN)
+		protected.GET("/overlay/nodes", overlayHandler.ListNodes)
+		protected.GET("/overlay/nodes/:id", overlayHandler.GetNode)
+		protected.DELETE("/overlay/nodes/:id", overlayHandler.DeleteNode)
+		protected.POST("/overlay/nodes/:id/rename", overlayHandler.RenameNode)
+		protected.POST("/overlay/nodes/:id/expire", overlayHandler.ExpireNode)
+		protected.POST("/overlay/nodes/:id/move", overlayHandler.MoveNode)
+		protected.PUT("/overlay/nodes/:id/tags", overlayHandler.SetNodeTags)
+		protected.DELETE("/overlay/nodes/:id/tags", overlayHandler.ClearNodeTags)
+		protected.GET("/overlay/nodes/:id/routes", overlayHandler.GetNodeRoutes)
+		protected.POST("/overlay/nodes/:id/routes/enable", overlayHandler.EnableRoute)
+		protected.POST("/overlay/nodes/:id/routes/disable", overlayHandler.DisableRoute)
+		protected.PUT("/overlay/nodes/:id/exit-node", overlayHandler.SetExitNode)
+		protected.GET("/overlay/routes", overlayHandler.ListRoutes)
+		protected.GET("/overlay/policy", overlayHandler.GetPolicy)
+		protected.PUT("/overlay/policy", overlayHandler.UpdatePolicy)
+		protected.POST("/overlay/policy/check", overlayHandler.CheckPolicy)
+		protected.POST("/overlay/policy/sync", overlayHandler.SyncPolicyGroups)
+		protected.GET("/overlay/users/settings", overlayHandler.GetUserSettings)
+		protected.PUT("/overlay/users/settings", overlayHandler.UpdateUserSettings)
+		protected.POST("/overlay/users/sync", overlayHandler.SyncUsers)
+		protected.GET("/overlay/keys", overlayHandler.ListKeys)
+		protected.POST("/overlay/keys", overlayHandler.CreateKey)
+		protected.POST("/overlay/keys/:id/expire", overlayHandler.ExpireKey)
+		protected.GET("/overlay/oidc", oidcHandler.GetSettings)
+		protected.PUT("/overlay/oidc", oidcHandler.UpdateSettings)
+		protected.GET("/overlay/config", overlayHandler.GetConfig)
+		protected.PUT("/overlay/config", overlayHandler.UpdateConfig)
+		protected.GET("/overlay/derp", overlayHandler.GetDERPSettings)
+		protected.PUT("/overlay/derp", overlayHandler.UpdateDERPSettings)
+		protected.POST("/overlay/derp/regions/:id/test", overlayHandler.TestDERPRegion)
+		protected.GET("/overlay/dns", overlayHandler.GetDNSSync)
+		protected.PUT("/overlay/dns", overlayHandler.UpdateDNSSync)
+		protected.POST("/overlay/dns/sync", overlayHandler.SyncDNS)
+		protected.GET("/overlay/dns/zones", overlayHandler.ListDNSZones)
 	}
 
 	// Start server
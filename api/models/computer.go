@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Computer represents a domain computer/device
 type Computer struct {
 	Name            string `json:"name"`
@@ -11,4 +13,92 @@ type Computer struct {
 	IPAddress       string `json:"ip_address,omitempty"`
 	OverlayIP       string `json:"overlay_ip,omitempty"`
 	OverlayURL      string `json:"overlay_url,omitempty"`
+
+	Reachability *Reachability     `json:"reachability,omitempty"` // Last cached probe result
+	Inventory    *InventorySummary `json:"inventory,omitempty"`    // From the latest inventory check-in
+	Metadata     *ComputerMetadata `json:"metadata,omitempty"`     // Asset tag, location, owner, notes and tags
+}
+
+// Reachability is the result of probing a computer over ICMP and TCP
+type Reachability struct {
+	Address   string    `json:"address,omitempty"` // Address that was probed
+	Reachable bool      `json:"reachable"`
+	ICMP      bool      `json:"icmp"`
+	OpenPorts []int     `json:"open_ports"` // Responding ports among 445, 3389 and 22
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ComputerDetails is the unified view of a machine: its directory account
+// merged with its Headscale node, matched by name
+type ComputerDetails struct {
+	Name                   string                 `json:"name"`
+	InDirectory            bool                   `json:"in_directory"`
+	DN                     string                 `json:"dn,omitempty"`
+	OU                     string                 `json:"ou,omitempty"` // DN of the containing OU or container
+	SID                    string                 `json:"sid,omitempty"`
+	GUID                   string                 `json:"guid,omitempty"`
+	DNSHostName            string                 `json:"dns_hostname,omitempty"`
+	Description            string                 `json:"description,omitempty"`
+	OperatingSystem        string                 `json:"operating_system,omitempty"`
+	OperatingSystemVersion string                 `json:"operating_system_version,omitempty"`
+	Enabled                bool                   `json:"enabled"`
+	LastLogon              *time.Time             `json:"last_logon,omitempty"` // lastLogonTimestamp, replicated within ~14 days
+	WhenCreated            *time.Time             `json:"when_created,omitempty"`
+	ServicePrincipalNames  []string               `json:"service_principal_names"`
+	ManagedBy              string                 `json:"managed_by,omitempty"` // DN of the managing user or group
+	Overlay                map[string]interface{} `json:"overlay,omitempty"`    // Headscale node details
+	Inventory              *ComputerInventory     `json:"inventory,omitempty"`  // Latest inventory check-in
+	Metadata               *ComputerMetadata      `json:"metadata,omitempty"`
+}
+
+// PrestageComputerRequest represents the request to create a computer account before the machine joins
+type PrestageComputerRequest struct {
+	Name        string `json:"name" binding:"required"`
+	OUPath      string `json:"ou_path"`
+	Description string `json:"description"`
+	ManagedBy   string `json:"managed_by"` // User or group recorded as responsible; grants no rights
+}
+
+// OfflineJoinRequest represents the request to generate offline domain join data.
+// The credentials are used once to reset the account password and are not stored.
+type OfflineJoinRequest struct {
+	AdminUser     string `json:"admin_user"`
+	AdminPassword string `json:"admin_password" binding:"required"`
+}
+
+// OfflineJoinData represents djoin-compatible provisioning data for a pre-staged computer
+type OfflineJoinData struct {
+	ComputerName string `json:"computer_name"`
+	Blob         string `json:"blob"` // Base64 provisioning data for djoin /requestODJ
+	FileName     string `json:"file_name"`
+	Command      string `json:"command"`
+}
+
+// ComputerMetadata is Vexa-side asset information about a computer. It is keyed
+// by the account's objectGUID so it survives renames.
+type ComputerMetadata struct {
+	ObjectGUID      string    `json:"object_guid"`
+	SID             string    `json:"sid"`
+	ComputerName    string    `json:"computer_name"` // Name when last updated
+	AssetTag        string    `json:"asset_tag,omitempty"`
+	Location        string    `json:"location,omitempty"`
+	Owner           string    `json:"owner,omitempty"`
+	Notes           string    `json:"notes,omitempty"`
+	Tags            []string  `json:"tags"`
+	SyncOverlayTags bool      `json:"sync_overlay_tags"`      // Mirror tags to the Headscale node as ACL tags
+	OverlayTags     []string  `json:"overlay_tags,omitempty"` // ACL tags last applied to the node
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+	UpdatedBy       string    `json:"updated_by,omitempty"`
+}
+
+// UpdateComputerMetadataRequest represents a change to a computer's metadata.
+// Fields left out are not changed.
+type UpdateComputerMetadataRequest struct {
+	AssetTag        *string   `json:"asset_tag"`
+	Location        *string   `json:"location"`
+	Owner           *string   `json:"owner"`
+	Notes           *string   `json:"notes"`
+	Tags            *[]string `json:"tags"`
+	SyncOverlayTags *bool     `json:"sync_overlay_tags"`
 }
@@ -0,0 +1,60 @@
+package models
+
+// DERPSettings selects the DERP relays overlay nodes use: Tailscale's public
+// map, Headscale's embedded relay and custom regions, in any combination
+type DERPSettings struct {
+	UseTailscaleMap bool                 `json:"use_tailscale_map"`
+	Embedded        EmbeddedDERPSettings `json:"embedded"`
+	Regions         []DERPRegion         `json:"regions"` // Custom regions
+}
+
+// EmbeddedDERPSettings configures Headscale's embedded DERP relay, which is
+// served on the Headscale server URL and requires it to use HTTPS
+type EmbeddedDERPSettings struct {
+	Enabled        bool   `json:"enabled"`
+	RegionID       int    `json:"region_id"`
+	RegionCode     string `json:"region_code"`
+	RegionName     string `json:"region_name"`
+	STUNListenAddr string `json:"stun_listen_addr"` // e.g. 0.0.0.0:3478
+	IPv4           string `json:"ipv4,omitempty"`   // Public address, when not resolvable from the server URL
+	IPv6           string `json:"ipv6,omitempty"`
+	VerifyClients  bool   `json:"verify_clients"` // Only relay for nodes of this tailnet
+}
+
+// DERPRegion is a custom DERP region
+type DERPRegion struct {
+	RegionID   int        `json:"region_id"`
+	RegionCode string     `json:"region_code"`
+	RegionName string     `json:"region_name"`
+	Nodes      []DERPNode `json:"nodes"`
+}
+
+// DERPNode is a relay server of a DERP region
+type DERPNode struct {
+	Name     string `json:"name"`
+	HostName string `json:"hostname"`
+	IPv4     string `json:"ipv4,omitempty"`
+	IPv6     string `json:"ipv6,omitempty"`
+	STUNPort int    `json:"stun_port,omitempty"` // 0 means 3478, -1 disables STUN
+	DERPPort int    `json:"derp_port,omitempty"` // 0 means 443
+	STUNOnly bool   `json:"stun_only,omitempty"`
+}
+
+// DERPRegionTest reports the reachability of a region's nodes
+type DERPRegionTest struct {
+	RegionID int            `json:"region_id"`
+	Healthy  bool           `json:"healthy"` // At least one node relays and answers STUN
+	Nodes    []DERPNodeTest `json:"nodes"`
+}
+
+// DERPNodeTest reports the reachability of one DERP node
+type DERPNodeTest struct {
+	Name          string `json:"name"`
+	HostName      string `json:"hostname"`
+	DERPReachable bool   `json:"derp_reachable"`
+	DERPLatencyMs int64  `json:"derp_latency_ms,omitempty"`
+	DERPError     string `json:"derp_error,omitempty"`
+	STUNReachable bool   `json:"stun_reachable"`
+	STUNLatencyMs int64  `json:"stun_latency_ms,omitempty"`
+	STUNError     string `json:"stun_error,omitempty"`
+}
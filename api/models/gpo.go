@@ -0,0 +1,20 @@
+package models
+
+// GPO represents a group policy object
+type GPO struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DN         string `json:"dn"`
+	SysvolPath string `json:"sysvol_path"`
+	Version    int    `json:"version"`
+}
+
+// GPOTemplateState represents a curated template and its settings in a GPO
+type GPOTemplateState struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Scope       string      `json:"scope"`
+	Configured  bool        `json:"configured"`
+	Settings    interface{} `json:"settings,omitempty"`
+}
@@ -5,17 +5,20 @@ type Group struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Members     []string `json:"members"`
+	GIDNumber   int      `json:"gid_number,omitempty"`
 }
 
 // CreateGroupRequest represents the request to create a new group
 type CreateGroupRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	GIDNumber   *int   `json:"gid_number,omitempty"`
 }
 
 // UpdateGroupRequest represents the request to update an existing group
 type UpdateGroupRequest struct {
 	Description *string `json:"description,omitempty"`
+	GIDNumber   *int    `json:"gid_number,omitempty"`
 }
 
 // AddGroupMembersRequest represents the request to add members to a group
@@ -0,0 +1,44 @@
+package models
+
+// HeadscaleSettings are the Headscale config settings editable through the
+// API. Sections managed elsewhere (policy, OIDC) are not included.
+type HeadscaleSettings struct {
+	ServerURL                      string              `json:"server_url"`
+	ListenAddr                     string              `json:"listen_addr"`
+	PrefixV4                       string              `json:"prefix_v4"`
+	PrefixV6                       string              `json:"prefix_v6"`
+	Allocation                     string              `json:"allocation"` // sequential or random
+	LogLevel                       string              `json:"log_level"`
+	MagicDNS                       bool                `json:"magic_dns"`
+	BaseDomain                     string              `json:"base_domain"`
+	OverrideLocalDNS               bool                `json:"override_local_dns"`
+	Nameservers                    []string            `json:"nameservers"`       // Global resolvers
+	SplitNameservers               map[string][]string `json:"split_nameservers"` // Domain to resolvers
+	SearchDomains                  []string            `json:"search_domains"`
+	DERPURLs                       []string            `json:"derp_urls"`
+	DERPAutoUpdate                 bool                `json:"derp_auto_update"`
+	DERPUpdateFrequency            string              `json:"derp_update_frequency"` // e.g. 24h
+	EphemeralNodeInactivityTimeout string              `json:"ephemeral_node_inactivity_timeout"`
+	RandomizeClientPort            bool                `json:"randomize_client_port"`
+}
+
+// UpdateHeadscaleSettingsRequest changes the given Headscale settings
+type UpdateHeadscaleSettingsRequest struct {
+	ServerURL                      *string              `json:"server_url,omitempty"`
+	ListenAddr                     *string              `json:"listen_addr,omitempty"`
+	PrefixV4                       *string              `json:"prefix_v4,omitempty"`
+	PrefixV6                       *string              `json:"prefix_v6,omitempty"`
+	Allocation                     *string              `json:"allocation,omitempty"`
+	LogLevel                       *string              `json:"log_level,omitempty"`
+	MagicDNS                       *bool                `json:"magic_dns,omitempty"`
+	BaseDomain                     *string              `json:"base_domain,omitempty"`
+	OverrideLocalDNS               *bool                `json:"override_local_dns,omitempty"`
+	Nameservers                    *[]string            `json:"nameservers,omitempty"`
+	SplitNameservers               *map[string][]string `json:"split_nameservers,omitempty"`
+	SearchDomains                  *[]string            `json:"search_domains,omitempty"`
+	DERPURLs                       *[]string            `json:"derp_urls,omitempty"`
+	DERPAutoUpdate                 *bool                `json:"derp_auto_update,omitempty"`
+	DERPUpdateFrequency            *string              `json:"derp_update_frequency,omitempty"`
+	EphemeralNodeInactivityTimeout *string              `json:"ephemeral_node_inactivity_timeout,omitempty"`
+	RandomizeClientPort            *bool                `json:"randomize_client_port,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// HomeDirectoryPolicy controls how home directories and roaming profiles are provisioned
+type HomeDirectoryPolicy struct {
+	Enabled      bool   `json:"enabled"`       // Create home directories for new users by default
+	Share        string `json:"share"`         // smb.conf share that holds home directories
+	HomeDrive    string `json:"home_drive"`    // Drive letter mapped to the home directory, e.g. "H:"
+	ProfileShare string `json:"profile_share"` // Optional share for roaming profiles
+	Server       string `json:"server"`        // Server name used in UNC paths; defaults to the host name
+	DeleteAction string `json:"delete_action"` // "archive", "remove" or "keep"
+	ArchivePath  string `json:"archive_path"`  // Where archived home directories are written
+}
+
+// HomeDirectoryResult describes the directory attributes set on an account
+type HomeDirectoryResult struct {
+	HomeDirectory string `json:"home_directory"`
+	HomeDrive     string `json:"home_drive"`
+	ProfilePath   string `json:"profile_path,omitempty"`
+	LocalPath     string `json:"local_path"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// InventoryReport is the inventory a computer's check-in task posts
+type InventoryReport struct {
+	Hostname     string            `json:"hostname" binding:"required"`
+	OSName       string            `json:"os_name"`
+	OSVersion    string            `json:"os_version"`
+	OSBuild      string            `json:"os_build"` // Including the update build revision, e.g. 22631.4317
+	Updates      []InstalledUpdate `json:"updates"`
+	Disks        []DiskUsage       `json:"disks"`
+	LoggedOnUser string            `json:"logged_on_user"`
+	SerialNumber string            `json:"serial_number"`
+	Manufacturer string            `json:"manufacturer"`
+	Model        string            `json:"model"`
+}
+
+// InstalledUpdate represents an installed operating system update
+type InstalledUpdate struct {
+	ID          string `json:"id"` // e.g. KB5031455
+	Description string `json:"description,omitempty"`
+	InstalledOn string `json:"installed_on,omitempty"` // YYYY-MM-DD
+}
+
+// DiskUsage represents a fixed disk volume
+type DiskUsage struct {
+	Name       string `json:"name"` // Drive letter or mount point
+	FileSystem string `json:"file_system,omitempty"`
+	SizeBytes  uint64 `json:"size_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
+
+// ComputerInventory is the latest inventory received from a computer
+type ComputerInventory struct {
+	ComputerName string `json:"computer_name"`
+	InventoryReport
+	ReceivedAt    time.Time `json:"received_at"`
+	SourceAddress string    `json:"source_address"`
+}
+
+// InventorySummary is the part of a computer's inventory shown in listings
+type InventorySummary struct {
+	OSBuild      string    `json:"os_build,omitempty"`
+	LoggedOnUser string    `json:"logged_on_user,omitempty"`
+	SerialNumber string    `json:"serial_number,omitempty"`
+	LowestFree   *float64  `json:"lowest_free_percent,omitempty"` // Free space on the fullest disk
+	LastCheckIn  time.Time `json:"last_check_in"`
+}
+
+// InventoryChange records a difference between two consecutive check-ins
+type InventoryChange struct {
+	ChangedAt time.Time `json:"changed_at"`
+	Field     string    `json:"field"` // e.g. os_build, logged_on_user, update_installed, disk_added
+	Old       string    `json:"old,omitempty"`
+	New       string    `json:"new,omitempty"`
+}
+
+// InventorySettings controls how computers check in their inventory
+type InventorySettings struct {
+	IntervalHours int `json:"interval_hours"` // How often the scheduled task runs
+}
+
+// InventoryCredential is a check-in credential issued for one computer
+type InventoryCredential struct {
+	ComputerName string    `json:"computer_name"`
+	Credential   string    `json:"credential"` // Shown once; only its hash is stored
+	ExpiresAt    time.Time `json:"expires_at"` // Unless the computer checks in with it before then
+}
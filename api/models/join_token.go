@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// JoinToken tracks a one-time deployment script link and the pre-auth key minted for it
+type JoinToken struct {
+	ID               string     `json:"id"`
+	ComputerName     string     `json:"computer_name,omitempty"`
+	ScriptName       string     `json:"script_name"`
+	JoinTailnet      bool       `json:"join_tailnet"`
+	SudoGroup        string     `json:"sudo_group,omitempty"`
+	OfflineJoin      bool       `json:"offline_join"` // Script carries djoin data for a pre-staged account
+	Status           string     `json:"status"`       // pending, consumed, registered, expired, revoked, failed
+	IssuedBy         string     `json:"issued_by"`
+	IssuedAt         time.Time  `json:"issued_at"`
+	ExpiresAt        time.Time  `json:"expires_at"` // Link expiry
+	ConsumedAt       *time.Time `json:"consumed_at,omitempty"`
+	ConsumedFrom     string     `json:"consumed_from,omitempty"`
+	PreAuthKeyID     string     `json:"preauth_key_id,omitempty"`
+	PreAuthKeyPrefix string     `json:"preauth_key_prefix,omitempty"`
+	PreAuthKeyExpiry *time.Time `json:"preauth_key_expiry,omitempty"`
+	MachineTag       string     `json:"machine_tag,omitempty"`
+	Error            string     `json:"error,omitempty"`
+}
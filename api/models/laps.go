@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// LAPSSettings controls local administrator password management for Windows computers
+type LAPSSettings struct {
+	Enabled          bool   `json:"enabled"`                    // Domain-join scripts turn on Windows LAPS
+	ReaderGroup      string `json:"reader_group"`               // Only members can read and rotate passwords
+	PasswordAgeDays  int    `json:"password_age_days"`          // Days before a computer rotates its password
+	PasswordLength   int    `json:"password_length"`            // Length of generated passwords
+	AdminAccountName string `json:"admin_account_name"`         // Managed local account; empty for the built-in Administrator
+	ReaderGroupSID   string `json:"reader_group_sid,omitempty"` // Group the directory ACLs currently grant access to
+	SchemaInstalled  bool   `json:"schema_installed"`           // Whether the LAPS attributes exist in the schema
+}
+
+// LAPSPassword represents a computer's managed local administrator password
+type LAPSPassword struct {
+	ComputerName string     `json:"computer_name"`
+	Account      string     `json:"account,omitempty"` // Only reported by Windows LAPS
+	Password     string     `json:"password"`
+	Source       string     `json:"source"` // windows-laps or legacy-laps
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// LAPSRotation represents a scheduled password rotation
+type LAPSRotation struct {
+	ComputerName string    `json:"computer_name"`
+	ExpiresAt    time.Time `json:"expires_at"` // The computer rotates at its next policy cycle after this time
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// LogonScript represents a script stored in the NETLOGON share
+type LogonScript struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	SHA256     string    `json:"sha256"`
+	Versions   int       `json:"versions"`
+}
+
+// LogonScriptVersion represents an archived revision of a logon script
+type LogonScriptVersion struct {
+	Version    int       `json:"version"`
+	Size       int64     `json:"size"`
+	ArchivedAt time.Time `json:"archived_at"`
+	SHA256     string    `json:"sha256"`
+}
+
+// UploadLogonScriptRequest represents the request to upload a logon script
+type UploadLogonScriptRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Content string `json:"content" binding:"required"`
+}
+
+// AssignLogonScriptRequest represents the request to set scriptPath on users and OUs.
+// An empty Script clears the assignment.
+type AssignLogonScriptRequest struct {
+	Script    string   `json:"script"`
+	Users     []string `json:"users"`
+	OUs       []string `json:"ous"`
+	Recursive bool     `json:"recursive"`
+}
+
+// SysvolCheckResult represents the outcome of samba-tool ntacl sysvolcheck
+type SysvolCheckResult struct {
+	Healthy bool   `json:"healthy"`
+	Output  string `json:"output"`
+}
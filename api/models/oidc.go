@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// OIDCSettings configures the OpenID Connect provider Headscale uses to log
+// in personal devices with directory credentials
+type OIDCSettings struct {
+	Enabled      bool      `json:"enabled"`
+	Issuer       string    `json:"issuer"` // e.g. https://vexa.example.com/api/v1/oidc
+	ClientID     string    `json:"client_id"`
+	RedirectURIs []string  `json:"redirect_uris"` // Headscale's /oidc/callback
+	UpdatedAt    time.Time `json:"updated_at,omitempty"`
+}
+
+// UpdateOIDCSettingsRequest enables or disables Headscale's OIDC login
+type UpdateOIDCSettingsRequest struct {
+	Enabled      *bool   `json:"enabled,omitempty"`
+	Issuer       *string `json:"issuer,omitempty"`
+	RotateSecret bool    `json:"rotate_secret,omitempty"`
+}
+
+// OIDCTokenResponse is the token endpoint's response
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// OIDCUserInfo holds the claims released about a signed-in user
+type OIDCUserInfo struct {
+	Subject           string   `json:"sub"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     bool     `json:"email_verified"`
+	Groups            []string `json:"groups"`
+}
+
+// OIDCAuthorizeRequest holds the parameters of an authorization request
+type OIDCAuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// OIDCTokenRequest holds the parameters of a token request. The client
+// credentials may also arrive through HTTP basic authentication.
+type OIDCTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// OverlayDNSSync selects the Samba DNS records pushed to overlay nodes as
+// Headscale extra records
+type OverlayDNSSync struct {
+	Enabled         bool      `json:"enabled"`
+	Zones           []string  `json:"zones"`            // Zones synced as a whole
+	Records         []string  `json:"records"`          // Individual names, e.g. intranet.corp.example.com
+	IntervalMinutes int       `json:"interval_minutes"` // How often records are re-read
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+	UpdatedBy       string    `json:"updated_by,omitempty"`
+}
+
+// OverlayDNSRecord is an extra record served to overlay nodes
+type OverlayDNSRecord struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // A or AAAA
+	Value    string `json:"value"`
+	Source   string `json:"source,omitempty"`    // Samba record value before rewriting
+	MeshNode string `json:"mesh_node,omitempty"` // Node whose overlay address replaced the source
+	Static   bool   `json:"static,omitempty"`    // Part of the Headscale config rather than synced
+}
+
+// OverlayDNSStatus reports the sync settings and the records last applied
+type OverlayDNSStatus struct {
+	Settings  OverlayDNSSync     `json:"settings"`
+	Records   []OverlayDNSRecord `json:"records"`
+	SyncedAt  *time.Time         `json:"synced_at,omitempty"`
+	LastError string             `json:"last_error,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// OverlayPreAuthKey is a Headscale pre-auth key with the nodes registered
+// with it. Key values are masked except in the response that creates them.
+type OverlayPreAuthKey struct {
+	ID         string           `json:"id"`
+	Key        string           `json:"key"`
+	User       string           `json:"user"`
+	Reusable   bool             `json:"reusable"`
+	Ephemeral  bool             `json:"ephemeral"` // Nodes are removed once they go offline
+	Used       bool             `json:"used"`
+	Expired    bool             `json:"expired"`
+	Expiration string           `json:"expiration,omitempty"`
+	CreatedAt  string           `json:"created_at,omitempty"`
+	ACLTags    []string         `json:"acl_tags"` // Forced onto nodes registered with the key
+	Nodes      []OverlayKeyNode `json:"nodes"`
+}
+
+// OverlayKeyNode is a node registered with a pre-auth key
+type OverlayKeyNode struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	GivenName string `json:"given_name"`
+	User      string `json:"user"`
+	Online    bool   `json:"online"`
+}
+
+// CreateOverlayKeyRequest describes a pre-auth key to create
+type CreateOverlayKeyRequest struct {
+	User      string     `json:"user" binding:"required"` // Headscale user, e.g. infrastructure
+	Reusable  bool       `json:"reusable"`
+	Ephemeral bool       `json:"ephemeral"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // One hour from now when empty
+	ACLTags   []string   `json:"acl_tags"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// OverlayPolicy is the Vexa-managed part of the Headscale ACL policy. The
+// groups section is generated from directory group membership.
+type OverlayPolicy struct {
+	Enabled      bool                `json:"enabled"`
+	SyncedGroups []string            `json:"synced_groups"` // Directory groups mirrored as group:<name>
+	TagOwners    map[string][]string `json:"tag_owners"`
+	Hosts        map[string]string   `json:"hosts"`
+	ACLs         []OverlayACLRule    `json:"acls"`
+	UpdatedAt    time.Time           `json:"updated_at,omitempty"`
+	UpdatedBy    string              `json:"updated_by,omitempty"`
+}
+
+// OverlayACLRule is a single rule of the Headscale ACL policy
+type OverlayACLRule struct {
+	Action       string   `json:"action"`          // Always "accept"
+	Protocol     string   `json:"proto,omitempty"` // e.g. tcp, udp, icmp; all when empty
+	Sources      []string `json:"src"`             // e.g. group:finance, tag:computer-ws01, *
+	Destinations []string `json:"dst"`             // host:ports, e.g. tag:fileserver:445
+}
+
+// OverlayPolicyStatus reports the managed policy and the groups last applied
+type OverlayPolicyStatus struct {
+	Policy       OverlayPolicy       `json:"policy"`
+	Groups       map[string][]string `json:"groups"`        // Generated groups section as last applied
+	GroupSources map[string]string   `json:"group_sources"` // Policy group to directory group
+	AppliedAt    *time.Time          `json:"applied_at,omitempty"`
+	LastError    string              `json:"last_error,omitempty"` // Error of the last automatic group sync
+}
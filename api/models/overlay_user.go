@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OverlayUserSettings limits the pre-auth keys users mint for their own devices
+type OverlayUserSettings struct {
+	PersonalKeyLimit      int `json:"personal_key_limit"`       // Unused, unexpired keys a user may hold at once
+	PersonalKeyTTLMinutes int `json:"personal_key_ttl_minutes"` // How long a personal key stays valid
+}
+
+// PersonalPreAuthKey is a single-use key a user enrolls one of their own devices with
+type PersonalPreAuthKey struct {
+	Key         string    `json:"key"`
+	OverlayUser string    `json:"overlay_user"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	LoginServer string    `json:"login_server,omitempty"`
+	Command     string    `json:"command,omitempty"` // tailscale up command for the device
+}
@@ -0,0 +1,40 @@
+package models
+
+// PosixSettings controls RFC2307 ID allocation for users and groups
+type PosixSettings struct {
+	AutoAssign   bool   `json:"auto_assign"` // Assign IDs when users and groups are created
+	UIDMin       int    `json:"uid_min"`
+	UIDMax       int    `json:"uid_max"`
+	GIDMin       int    `json:"gid_min"`
+	GIDMax       int    `json:"gid_max"`
+	DefaultShell string `json:"default_shell"`
+	HomeTemplate string `json:"home_template"` // %u is replaced with the username
+}
+
+// PosixAttributes holds optional RFC2307 attributes on create and update requests
+type PosixAttributes struct {
+	UIDNumber         *int    `json:"uid_number,omitempty"`
+	GIDNumber         *int    `json:"gid_number,omitempty"`
+	LoginShell        *string `json:"login_shell,omitempty"`
+	UnixHomeDirectory *string `json:"unix_home_directory,omitempty"`
+}
+
+// PosixBackfillRequest represents the request to assign missing IDs to existing accounts
+type PosixBackfillRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// PosixBackfillResult reports what a backfill assigned
+type PosixBackfillResult struct {
+	DryRun bool              `json:"dry_run"`
+	Users  []PosixAssignment `json:"users"`
+	Groups []PosixAssignment `json:"groups"`
+	Errors []string          `json:"errors"`
+}
+
+// PosixAssignment records the IDs given to a single account
+type PosixAssignment struct {
+	Name      string `json:"name"`
+	UIDNumber int    `json:"uid_number,omitempty"`
+	GIDNumber int    `json:"gid_number"`
+}
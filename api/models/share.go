@@ -0,0 +1,55 @@
+package models
+
+// Share represents an SMB file share defined in smb.conf
+type Share struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Comment    string   `json:"comment"`
+	Browseable bool     `json:"browseable"`
+	ReadOnly   bool     `json:"read_only"`
+	GuestOK    bool     `json:"guest_ok"`
+	ValidUsers []string `json:"valid_users"`
+	ReadList   []string `json:"read_list"`
+	WriteList  []string `json:"write_list"`
+	System     bool     `json:"system"` // Managed by Samba (netlogon, sysvol); read-only through the API
+}
+
+// CreateShareRequest represents the request to create a new share
+type CreateShareRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Path       string `json:"path" binding:"required"`
+	Comment    string `json:"comment"`
+	Browseable *bool  `json:"browseable,omitempty"`
+	ReadOnly   bool   `json:"read_only"`
+	GuestOK    bool   `json:"guest_ok"`
+	CreatePath bool   `json:"create_path"`
+}
+
+// UpdateShareRequest represents the request to update an existing share
+type UpdateShareRequest struct {
+	Path       *string `json:"path,omitempty"`
+	Comment    *string `json:"comment,omitempty"`
+	Browseable *bool   `json:"browseable,omitempty"`
+	ReadOnly   *bool   `json:"read_only,omitempty"`
+	GuestOK    *bool   `json:"guest_ok,omitempty"`
+}
+
+// ShareAccessEntry grants an AD group access to a share
+type ShareAccessEntry struct {
+	Group  string `json:"group" binding:"required"`
+	Access string `json:"access" binding:"required"` // "read" or "full"
+}
+
+// SetShareACLRequest represents the request to replace a share's access list.
+// ApplyFilesystem also writes matching POSIX ACLs to the share path.
+type SetShareACLRequest struct {
+	Entries         []ShareAccessEntry `json:"entries"`
+	ApplyFilesystem bool               `json:"apply_filesystem"`
+}
+
+// ShareACL represents a share's access list and the ACL on its path
+type ShareACL struct {
+	Share      string             `json:"share"`
+	Entries    []ShareAccessEntry `json:"entries"`
+	Filesystem []string           `json:"filesystem"`
+}
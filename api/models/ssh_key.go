@@ -0,0 +1,23 @@
+package models
+
+// SSHKey represents an SSH public key stored on a user account
+type SSHKey struct {
+	Type        string `json:"type"`
+	Comment     string `json:"comment"`
+	Fingerprint string `json:"fingerprint"` // SHA256 fingerprint, as printed by ssh-keygen -l
+	PublicKey   string `json:"public_key"`
+}
+
+// AddSSHKeyRequest represents the request to add an SSH public key.
+// When Fingerprint is set it must match the parsed key.
+type AddSSHKeyRequest struct {
+	PublicKey   string `json:"public_key" binding:"required"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SSHKeySettings controls where SSH keys are stored and how servers look them up
+type SSHKeySettings struct {
+	Attribute     string `json:"attribute"`      // Directory attribute holding the keys
+	LookupToken   string `json:"lookup_token"`   // Bearer token for the authorized-keys endpoint
+	SchemaPresent bool   `json:"schema_present"` // Whether the attribute exists in the schema
+}
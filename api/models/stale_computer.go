@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// StaleComputerPolicy controls how stale computer accounts are detected and cleaned up
+type StaleComputerPolicy struct {
+	ThresholdDays int    `json:"threshold_days"` // Inactive for this many days counts as stale
+	GraceDays     int    `json:"grace_days"`     // Days a quarantined account is kept before deletion
+	QuarantineOU  string `json:"quarantine_ou"`  // Relative to the domain, e.g. OU=Quarantine
+	AutoPurge     bool   `json:"auto_purge"`     // Delete accounts automatically once the grace period ends
+}
+
+// StaleComputer represents a computer account with no recent directory or overlay activity
+type StaleComputer struct {
+	Name            string     `json:"name"`
+	DN              string     `json:"dn"`
+	OperatingSystem string     `json:"operating_system,omitempty"`
+	Enabled         bool       `json:"enabled"`
+	LastLogon       *time.Time `json:"last_logon,omitempty"` // lastLogonTimestamp
+	LastSeen        *time.Time `json:"last_seen,omitempty"`  // Headscale node lastSeen
+	WhenCreated     *time.Time `json:"when_created,omitempty"`
+	InactiveDays    int        `json:"inactive_days"`
+	Quarantined     bool       `json:"quarantined"`
+	DeleteAfter     *time.Time `json:"delete_after,omitempty"`
+}
+
+// QuarantinedComputer records a disabled computer moved to the quarantine OU
+type QuarantinedComputer struct {
+	Name          string    `json:"name"`
+	OriginalDN    string    `json:"original_dn"`
+	WasEnabled    bool      `json:"was_enabled"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+	QuarantinedBy string    `json:"quarantined_by"`
+	DeleteAfter   time.Time `json:"delete_after"`
+}
+
+// StaleComputerActionRequest represents a bulk action on computer accounts
+type StaleComputerActionRequest struct {
+	Names []string `json:"names" binding:"required"`
+}
+
+// ComputerActionResult represents the outcome of a bulk action for one computer
+type ComputerActionResult struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
@@ -8,6 +8,16 @@ type User struct {
 	Enabled     bool     `json:"enabled"`
 	Groups      []string `json:"groups"`
 	Description string   `json:"description"`
+	LogonScript string   `json:"logon_script,omitempty"`
+
+	HomeDirectory string `json:"home_directory,omitempty"`
+	HomeDrive     string `json:"home_drive,omitempty"`
+	ProfilePath   string `json:"profile_path,omitempty"`
+
+	UIDNumber         int    `json:"uid_number,omitempty"`
+	GIDNumber         int    `json:"gid_number,omitempty"`
+	LoginShell        string `json:"login_shell,omitempty"`
+	UnixHomeDirectory string `json:"unix_home_directory,omitempty"`
 }
 
 // CreateUserRequest represents the request to create a new user
@@ -20,6 +30,11 @@ type CreateUserRequest struct {
 	Group              string `json:"group"`
 	OUPath             string `json:"ou_path"`
 	MustChangePassword bool   `json:"must_change_password"`
+
+	// Overrides the home directory policy's default when set
+	CreateHomeDirectory *bool `json:"create_home_directory,omitempty"`
+
+	PosixAttributes
 }
 
 // UpdateUserRequest represents the request to update an existing user
@@ -31,4 +46,10 @@ type UpdateUserRequest struct {
 	Group       *string   `json:"group,omitempty"` // Deprecated: use Groups instead
 	Groups      *[]string `json:"groups,omitempty"` // Array of groups to assign
 	OUPath      *string   `json:"ou_path,omitempty"`
+
+	HomeDirectory *string `json:"home_directory,omitempty"`
+	HomeDrive     *string `json:"home_drive,omitempty"`
+	ProfilePath   *string `json:"profile_path,omitempty"`
+
+	PosixAttributes
 }
@@ -0,0 +1,192 @@
+@echo off
+setlocal enabledelayedexpansion
+
+:: ========================================
+:: Vexa Pre-staged Domain Join
+:: ========================================
+:: This script joins the domain using a computer account created in advance.
+:: When offline join data is embedded it uses djoin and needs no connection
+:: to the domain controller; otherwise it joins online and takes over the
+:: pre-staged account.
+
+:: INJECTED VALUES - These will be replaced by the API
+set DOMAIN_NAME={{DOMAIN_NAME}}
+set DOMAIN_REALM={{DOMAIN_REALM}}
+set COMPUTER_NAME={{COMPUTER_NAME}}
+set OFFLINE_JOIN={{OFFLINE_JOIN}}
+set LAPS_ENABLED={{LAPS_ENABLED}}
+set LAPS_PASSWORD_AGE_DAYS={{LAPS_PASSWORD_AGE_DAYS}}
+set LAPS_PASSWORD_LENGTH={{LAPS_PASSWORD_LENGTH}}
+set LAPS_ADMIN_ACCOUNT={{LAPS_ADMIN_ACCOUNT}}
+set VEXA_URL={{VEXA_URL}}
+set INVENTORY_ENABLED={{INVENTORY_ENABLED}}
+set INVENTORY_TOKEN={{INVENTORY_TOKEN}}
+set INVENTORY_INTERVAL_HOURS={{INVENTORY_INTERVAL_HOURS}}
+
+:: Check for admin privileges and elevate if needed
+net session >nul 2>&1
+if %errorLevel% neq 0 (
+    echo This script requires Administrator privileges.
+    echo Elevating with UAC prompt...
+    powershell -Command "Start-Process '%~f0' -Verb RunAs"
+    exit /b 0
+)
+
+echo ========================================
+echo Vexa Pre-staged Domain Join
+echo ========================================
+echo.
+
+:: Get current hostname
+set currentHostname=%COMPUTERNAME%
+echo Current hostname: %currentHostname%
+echo Computer account: %COMPUTER_NAME%
+echo Target domain: %DOMAIN_REALM%
+echo.
+
+if /i "%OFFLINE_JOIN%"=="yes" goto offlinejoin
+
+:: Test Domain Resolution
+echo ========================================
+echo Testing Domain Resolution
+echo ========================================
+echo.
+
+echo Flushing DNS cache...
+ipconfig /flushdns >nul
+
+echo Testing domain resolution for %DOMAIN_REALM%...
+nslookup %DOMAIN_REALM% >nul 2>&1
+if %errorLevel% neq 0 (
+    echo ERROR: Domain resolution failed for %DOMAIN_REALM%
+    echo Please check your network configuration.
+    pause
+    exit /b 1
+)
+
+echo Domain resolution successful.
+echo.
+
+:: Join Domain
+echo ========================================
+echo Joining Domain
+echo ========================================
+echo.
+
+echo Joining domain %DOMAIN_REALM% as %COMPUTER_NAME%...
+echo You will be prompted for credentials allowed to manage the computer account.
+set /p adminUser="Enter domain username (e.g., administrator): "
+set /p adminPassword="Enter domain password: "
+
+if /i "%currentHostname%"=="%COMPUTER_NAME%" (
+    powershell -Command "$cred = New-Object System.Management.Automation.PSCredential('%adminUser%', (ConvertTo-SecureString '%adminPassword%' -AsPlainText -Force)); Add-Computer -DomainName '%DOMAIN_REALM%' -Credential $cred -Force"
+) else (
+    powershell -Command "$cred = New-Object System.Management.Automation.PSCredential('%adminUser%', (ConvertTo-SecureString '%adminPassword%' -AsPlainText -Force)); Add-Computer -DomainName '%DOMAIN_REALM%' -NewName '%COMPUTER_NAME%' -Credential $cred -Force"
+)
+if %errorLevel% neq 0 (
+    echo ERROR: Failed to join domain.
+    echo Please check credentials and network connectivity.
+    pause
+    exit /b 1
+)
+
+echo Successfully joined domain %DOMAIN_REALM%.
+echo.
+goto success
+
+:offlinejoin
+:: Offline Domain Join
+echo ========================================
+echo Applying Offline Join Data
+echo ========================================
+echo.
+
+set ODJ_FILE=%TEMP%\vexa-odj.txt
+
+:: The provisioning data is stored on the last line of this script
+powershell -Command "$line = Select-String -Path '%~f0' -Pattern '^::ODJ:(.+)$' | Select-Object -First 1; if (-not $line) { exit 1 }; [IO.File]::WriteAllText('%ODJ_FILE%', $line.Matches[0].Groups[1].Value.Trim(), [Text.Encoding]::Unicode)"
+if %errorLevel% neq 0 (
+    echo ERROR: Offline join data is missing from this script.
+    pause
+    exit /b 1
+)
+
+djoin /requestODJ /loadfile "%ODJ_FILE%" /windowspath "%SystemRoot%" /localos
+set djoinResult=%errorLevel%
+del /f /q "%ODJ_FILE%" >nul 2>&1
+if %djoinResult% neq 0 (
+    echo ERROR: djoin failed to apply the offline join data.
+    echo The data may already have been used or the account was re-provisioned.
+    pause
+    exit /b 1
+)
+
+echo Offline join data applied. The computer will be %COMPUTER_NAME% in %DOMAIN_REALM%.
+echo It completes the join the next time it can reach the domain controller.
+echo.
+
+:success
+:: Enable Windows LAPS so the local administrator password is rotated and
+:: stored in the directory. Values are written as local configuration, which
+:: any LAPS group policy overrides.
+set LAPS_KEY=HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\LAPS\Config
+if /i "%LAPS_ENABLED%"=="yes" (
+    echo ========================================
+    echo Enabling Windows LAPS
+    echo ========================================
+    echo.
+    reg add "%LAPS_KEY%" /v BackupDirectory /t REG_DWORD /d 2 /f >nul
+    reg add "%LAPS_KEY%" /v PasswordAgeDays /t REG_DWORD /d %LAPS_PASSWORD_AGE_DAYS% /f >nul
+    reg add "%LAPS_KEY%" /v PasswordLength /t REG_DWORD /d %LAPS_PASSWORD_LENGTH% /f >nul
+    reg add "%LAPS_KEY%" /v PasswordComplexity /t REG_DWORD /d 4 /f >nul
+    reg add "%LAPS_KEY%" /v ADPasswordEncryptionEnabled /t REG_DWORD /d 0 /f >nul
+    if not "%LAPS_ADMIN_ACCOUNT%"=="" (
+        reg add "%LAPS_KEY%" /v AdministratorAccountName /t REG_SZ /d "%LAPS_ADMIN_ACCOUNT%" /f >nul
+    )
+    echo The local administrator password will be managed by LAPS after the reboot.
+    echo.
+)
+
+:: Register the inventory check-in task, which reports this computer's
+:: hardware, updates and logged-on user to Vexa
+if /i not "%INVENTORY_ENABLED%"=="yes" goto skipinventory
+echo ========================================
+echo Registering Inventory Check-in
+echo ========================================
+echo.
+set VEXA_DIR=%ProgramData%\Vexa
+if not exist "%VEXA_DIR%" mkdir "%VEXA_DIR%"
+:: Only SYSTEM and administrators may read the check-in credential
+icacls "%VEXA_DIR%" /inheritance:r /grant:r "*S-1-5-18:(OI)(CI)F" "*S-1-5-32-544:(OI)(CI)F" >nul
+powershell -Command "[Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12; Invoke-WebRequest -UseBasicParsing -Uri '%VEXA_URL%/api/v1/inventory/agent.ps1' -OutFile '%VEXA_DIR%\vexa-checkin.ps1'"
+if %errorLevel% neq 0 (
+    echo WARNING: Failed to download the inventory check-in script.
+    echo.
+    goto skipinventory
+)
+> "%VEXA_DIR%\checkin.json" echo {"server":"%VEXA_URL%","token":"%INVENTORY_TOKEN%"}
+schtasks /create /tn "Vexa Inventory Check-in" /ru SYSTEM /sc hourly /mo %INVENTORY_INTERVAL_HOURS% /tr "powershell.exe -NoProfile -ExecutionPolicy Bypass -File \"%VEXA_DIR%\vexa-checkin.ps1\"" /f >nul
+if %errorLevel% neq 0 (
+    echo WARNING: Failed to register the inventory check-in task.
+) else (
+    echo Inventory check-in registered every %INVENTORY_INTERVAL_HOURS% hours.
+)
+echo.
+:skipinventory
+
+:: Success message
+echo ========================================
+echo SUCCESS!
+echo ========================================
+echo.
+echo The computer has been joined to domain %DOMAIN_NAME%.
+echo The system will now reboot to complete the setup.
+echo.
+pause
+
+echo Rebooting in 5 seconds...
+timeout /t 5 /nobreak >nul
+shutdown /r /f /t 0
+exit /b 0
+
+::ODJ:{{ODJ_BLOB}}
@@ -15,6 +15,14 @@ set DOMAIN_NAME={{DOMAIN_NAME}}
 set DOMAIN_REALM={{DOMAIN_REALM}}
 set LOGIN_SERVER={{LOGIN_SERVER}}
 set AUTH_KEY={{AUTH_KEY}}
+set LAPS_ENABLED={{LAPS_ENABLED}}
+set LAPS_PASSWORD_AGE_DAYS={{LAPS_PASSWORD_AGE_DAYS}}
+set LAPS_PASSWORD_LENGTH={{LAPS_PASSWORD_LENGTH}}
+set LAPS_ADMIN_ACCOUNT={{LAPS_ADMIN_ACCOUNT}}
+set VEXA_URL={{VEXA_URL}}
+set INVENTORY_ENABLED={{INVENTORY_ENABLED}}
+set INVENTORY_TOKEN={{INVENTORY_TOKEN}}
+set INVENTORY_INTERVAL_HOURS={{INVENTORY_INTERVAL_HOURS}}
 
 :: Check for admin privileges and elevate if needed
 net session >nul 2>&1
@@ -141,6 +149,54 @@ if exist "%TAILSCALE_INSTALLER%" (
     del /f /q "%TAILSCALE_INSTALLER%" >nul 2>&1
 )
 
+:: Enable Windows LAPS so the local administrator password is rotated and
+:: stored in the directory. Values are written as local configuration, which
+:: any LAPS group policy overrides.
+set LAPS_KEY=HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\LAPS\Config
+if /i "%LAPS_ENABLED%"=="yes" (
+    echo ========================================
+    echo Enabling Windows LAPS
+    echo ========================================
+    echo.
+    reg add "%LAPS_KEY%" /v BackupDirectory /t REG_DWORD /d 2 /f >nul
+    reg add "%LAPS_KEY%" /v PasswordAgeDays /t REG_DWORD /d %LAPS_PASSWORD_AGE_DAYS% /f >nul
+    reg add "%LAPS_KEY%" /v PasswordLength /t REG_DWORD /d %LAPS_PASSWORD_LENGTH% /f >nul
+    reg add "%LAPS_KEY%" /v PasswordComplexity /t REG_DWORD /d 4 /f >nul
+    reg add "%LAPS_KEY%" /v ADPasswordEncryptionEnabled /t REG_DWORD /d 0 /f >nul
+    if not "%LAPS_ADMIN_ACCOUNT%"=="" (
+        reg add "%LAPS_KEY%" /v AdministratorAccountName /t REG_SZ /d "%LAPS_ADMIN_ACCOUNT%" /f >nul
+    )
+    echo The local administrator password will be managed by LAPS after the reboot.
+    echo.
+)
+
+:: Register the inventory check-in task, which reports this computer's
+:: hardware, updates and logged-on user to Vexa
+if /i not "%INVENTORY_ENABLED%"=="yes" goto skipinventory
+echo ========================================
+echo Registering Inventory Check-in
+echo ========================================
+echo.
+set VEXA_DIR=%ProgramData%\Vexa
+if not exist "%VEXA_DIR%" mkdir "%VEXA_DIR%"
+:: Only SYSTEM and administrators may read the check-in credential
+icacls "%VEXA_DIR%" /inheritance:r /grant:r "*S-1-5-18:(OI)(CI)F" "*S-1-5-32-544:(OI)(CI)F" >nul
+powershell -Command "[Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12; Invoke-WebRequest -UseBasicParsing -Uri '%VEXA_URL%/api/v1/inventory/agent.ps1' -OutFile '%VEXA_DIR%\vexa-checkin.ps1'"
+if %errorLevel% neq 0 (
+    echo WARNING: Failed to download the inventory check-in script.
+    echo.
+    goto skipinventory
+)
+> "%VEXA_DIR%\checkin.json" echo {"server":"%VEXA_URL%","token":"%INVENTORY_TOKEN%"}
+schtasks /create /tn "Vexa Inventory Check-in" /ru SYSTEM /sc hourly /mo %INVENTORY_INTERVAL_HOURS% /tr "powershell.exe -NoProfile -ExecutionPolicy Bypass -File \"%VEXA_DIR%\vexa-checkin.ps1\"" /f >nul
+if %errorLevel% neq 0 (
+    echo WARNING: Failed to register the inventory check-in task.
+) else (
+    echo Inventory check-in registered every %INVENTORY_INTERVAL_HOURS% hours.
+)
+echo.
+:skipinventory
+
 :: Success message
 echo ========================================
 echo SUCCESS!
@@ -0,0 +1,121 @@
+#!/bin/bash
+# ========================================
+# Vexa Linux Domain Join (RHEL/Rocky/Alma/Fedora)
+# ========================================
+# This script will:
+# 1. Install realmd, sssd and adcli
+# 2. Optionally install Tailscale and connect to the Tailnet
+# 3. Join the domain
+# 4. Configure sssd, home directories and sudo for a domain group
+
+# INJECTED VALUES - These will be replaced by the API
+DOMAIN_NAME='{{DOMAIN_NAME}}'
+DOMAIN_REALM='{{DOMAIN_REALM}}'
+LOGIN_SERVER='{{LOGIN_SERVER}}'
+AUTH_KEY='{{AUTH_KEY}}'
+JOIN_TAILNET='{{JOIN_TAILNET}}'
+SUDO_GROUP='{{SUDO_GROUP}}'
+ID_MAPPING='{{ID_MAPPING}}'
+
+# Account used to join; override with ADMIN_USER=someone sudo -E bash ...
+ADMIN_USER="${ADMIN_USER:-Administrator}"
+
+set -e
+
+if [ "$(id -u)" -ne 0 ]; then
+    echo "This script requires root privileges. Re-run with sudo."
+    exit 1
+fi
+
+echo "========================================"
+echo "Vexa Linux Domain Join (RHEL/Rocky/Alma/Fedora)"
+echo "========================================"
+echo "Domain: $DOMAIN_NAME ($DOMAIN_REALM)"
+echo "Hostname: $(hostname -s)"
+echo
+
+# Step 1: Install packages
+echo "========================================"
+echo "Step 1: Installing packages"
+echo "========================================"
+PKG=dnf
+command -v dnf >/dev/null 2>&1 || PKG=yum
+$PKG install -y realmd sssd sssd-tools adcli oddjob oddjob-mkhomedir \
+    samba-common-tools krb5-workstation authselect curl
+echo "Packages installed."
+echo
+
+# Step 2: Connect to Tailnet (optional)
+if [ "$JOIN_TAILNET" = "yes" ]; then
+    echo "========================================"
+    echo "Step 2: Connecting to Tailnet"
+    echo "========================================"
+    if ! command -v tailscale >/dev/null 2>&1; then
+        curl -fsSL https://tailscale.com/install.sh | sh
+    fi
+    systemctl enable --now tailscaled
+    tailscale up --authkey="$AUTH_KEY" --login-server="$LOGIN_SERVER" \
+        --hostname="$(hostname -s)" --accept-routes --accept-dns=false
+    echo "Tailnet connection successful."
+    sleep 5
+    echo
+else
+    echo "Step 2: Skipping Tailnet (not requested)"
+    echo
+fi
+
+# Step 3: Join the domain
+echo "========================================"
+echo "Step 3: Joining Domain"
+echo "========================================"
+if ! realm discover "$DOMAIN_REALM" >/dev/null 2>&1; then
+    echo "ERROR: Cannot discover $DOMAIN_REALM."
+    echo "Make sure this host uses the domain controller for DNS."
+    exit 1
+fi
+
+if realm list | grep -qi "^$DOMAIN_REALM"; then
+    echo "Already joined to $DOMAIN_REALM."
+else
+    echo "Joining $DOMAIN_REALM as $ADMIN_USER (you will be prompted for the password)..."
+    realm join --verbose -U "$ADMIN_USER" "$DOMAIN_REALM"
+fi
+echo
+
+# Step 4: Configure sssd, home directories and sudo
+echo "========================================"
+echo "Step 4: Configuring sssd and sudo"
+echo "========================================"
+SSSD_CONF=/etc/sssd/sssd.conf
+sed -i 's/^use_fully_qualified_names.*/use_fully_qualified_names = False/' "$SSSD_CONF"
+sed -i 's|^fallback_homedir.*|fallback_homedir = /home/%u|' "$SSSD_CONF"
+if grep -q '^ldap_id_mapping' "$SSSD_CONF"; then
+    sed -i "s/^ldap_id_mapping.*/ldap_id_mapping = $ID_MAPPING/" "$SSSD_CONF"
+else
+    sed -i "/^\[domain\//a ldap_id_mapping = $ID_MAPPING" "$SSSD_CONF"
+fi
+chmod 600 "$SSSD_CONF"
+systemctl restart sssd
+
+authselect select sssd with-mkhomedir --force
+systemctl enable --now oddjobd
+
+if [ -n "$SUDO_GROUP" ]; then
+    SUDOERS_FILE=/etc/sudoers.d/vexa-domain-sudo
+    ESCAPED_GROUP=$(printf '%s' "$SUDO_GROUP" | tr '[:upper:]' '[:lower:]' | sed 's/ /\\ /g')
+    echo "%$ESCAPED_GROUP ALL=(ALL:ALL) ALL" > "$SUDOERS_FILE.tmp"
+    chmod 440 "$SUDOERS_FILE.tmp"
+    if visudo -cf "$SUDOERS_FILE.tmp" >/dev/null; then
+        mv "$SUDOERS_FILE.tmp" "$SUDOERS_FILE"
+        echo "Granted sudo to domain group: $SUDO_GROUP"
+    else
+        rm -f "$SUDOERS_FILE.tmp"
+        echo "WARNING: Invalid sudoers entry for $SUDO_GROUP, skipping."
+    fi
+fi
+echo
+
+echo "========================================"
+echo "Domain join complete!"
+echo "========================================"
+echo "Verify with: id ${ADMIN_USER,,}"
@@ -0,0 +1,66 @@
+# ========================================
+# Vexa Inventory Check-in
+# ========================================
+# Reports this computer's inventory to Vexa. The domain-join scripts install
+# it with its configuration under %ProgramData%\Vexa and run it as SYSTEM
+# from the "Vexa Inventory Check-in" scheduled task.
+
+param(
+    [string]$ConfigPath = "$env:ProgramData\Vexa\checkin.json"
+)
+
+$ErrorActionPreference = 'Stop'
+[Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12
+
+$config = Get-Content -Raw -Path $ConfigPath | ConvertFrom-Json
+
+$os = Get-CimInstance Win32_OperatingSystem
+$system = Get-CimInstance Win32_ComputerSystem
+$bios = Get-CimInstance Win32_BIOS
+
+# The update build revision is only in the registry
+$build = "$($os.BuildNumber)"
+$ubr = (Get-ItemProperty 'HKLM:\SOFTWARE\Microsoft\Windows NT\CurrentVersion' -ErrorAction SilentlyContinue).UBR
+if ($ubr) {
+    $build = "$build.$ubr"
+}
+
+$updates = @(Get-HotFix | Where-Object { $_.HotFixID } | ForEach-Object {
+    $installedOn = ''
+    if ($_.InstalledOn) {
+        $installedOn = $_.InstalledOn.ToString('yyyy-MM-dd')
+    }
+    @{
+        id           = $_.HotFixID
+        description  = "$($_.Description)"
+        installed_on = $installedOn
+    }
+})
+
+$disks = @(Get-CimInstance Win32_LogicalDisk -Filter 'DriveType=3' | ForEach-Object {
+    @{
+        name        = $_.DeviceID
+        file_system = "$($_.FileSystem)"
+        size_bytes  = [uint64]$_.Size
+        free_bytes  = [uint64]$_.FreeSpace
+    }
+})
+
+$report = @{
+    hostname       = $env:COMPUTERNAME
+    os_name        = "$($os.Caption)"
+    os_version     = "$($os.Version)"
+    os_build       = $build
+    updates        = $updates
+    disks          = $disks
+    logged_on_user = "$($system.UserName)"
+    serial_number  = "$($bios.SerialNumber)".Trim()
+    manufacturer   = "$($system.Manufacturer)"
+    model          = "$($system.Model)"
+}
+
+Invoke-RestMethod -Method Post -Uri "$($config.server)/api/v1/inventory/checkin" `
+    -Headers @{ Authorization = "Bearer $($config.token)" } `
+    -ContentType 'application/json' `
+    -Body ($report | ConvertTo-Json -Depth 4) `
+    -UseBasicParsing | Out-Null
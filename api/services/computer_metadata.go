@@ -0,0 +1,401 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sambaExec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+)
+
+// computerMetadataPath stores computer metadata keyed by objectGUID
+const computerMetadataPath = "/var/lib/vexa/computer-metadata.json"
+
+const (
+	maxMetadataTags     = 32
+	maxMetadataNotes    = 4096
+	maxMetadataAssetTag = 64
+	maxMetadataField    = 128
+)
+
+// metadataTagRegex matches a free-form computer tag
+var metadataTagRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]{0,63}$`)
+
+// metadataMutex serializes read-modify-write cycles of the metadata store
+var metadataMutex sync.Mutex
+
+// computerIdentity is the part of a computer account metadata is keyed by
+type computerIdentity struct {
+	Name       string
+	ObjectGUID string
+	SID        string
+}
+
+// key returns the store key, falling back to the SID for directories
+// that do not return the GUID
+func (i computerIdentity) key() string {
+	if i.ObjectGUID != "" {
+		return strings.ToLower(i.ObjectGUID)
+	}
+	return i.SID
+}
+
+// GetMetadata returns a computer's metadata. Computers without stored metadata
+// get an empty record.
+func (s *ComputerService) GetMetadata(computerName string) (*models.ComputerMetadata, error) {
+	identity, err := s.computerIdentity(computerName)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataMutex.Lock()
+	defer metadataMutex.Unlock()
+
+	records, err := loadComputerMetadata()
+	if err != nil {
+		return nil, err
+	}
+	meta := records[identity.key()]
+	meta.ObjectGUID = identity.ObjectGUID
+	meta.SID = identity.SID
+	meta.ComputerName = identity.Name
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	return &meta, nil
+}
+
+// UpdateMetadata changes a computer's metadata and, when overlay tag sync is
+// enabled or was just turned off, updates the ACL tags of its Headscale node.
+// The metadata is saved even when the overlay update fails, which is reported
+// as a warning.
+func (s *ComputerService) UpdateMetadata(computerName string, req models.UpdateComputerMetadataRequest, updatedBy string) (*models.ComputerMetadata, string, error) {
+	identity, err := s.computerIdentity(computerName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	metadataMutex.Lock()
+	defer metadataMutex.Unlock()
+
+	records, err := loadComputerMetadata()
+	if err != nil {
+		return nil, "", err
+	}
+	meta := records[identity.key()]
+	wasSyncing := meta.SyncOverlayTags
+
+	if req.AssetTag != nil {
+		if meta.AssetTag, err = metadataField("asset tag", *req.AssetTag, maxMetadataAssetTag); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.Location != nil {
+		if meta.Location, err = metadataField("location", *req.Location, maxMetadataField); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.Owner != nil {
+		if meta.Owner, err = metadataField("owner", *req.Owner, maxMetadataField); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.Notes != nil {
+		if len(*req.Notes) > maxMetadataNotes {
+			return nil, "", fmt.Errorf("notes must be at most %d characters", maxMetadataNotes)
+		}
+		meta.Notes = strings.TrimSpace(*req.Notes)
+	}
+	if req.Tags != nil {
+		if meta.Tags, err = normalizeMetadataTags(*req.Tags); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.SyncOverlayTags != nil {
+		meta.SyncOverlayTags = *req.SyncOverlayTags
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+
+	meta.ObjectGUID = identity.ObjectGUID
+	meta.SID = identity.SID
+	meta.ComputerName = identity.Name
+	meta.UpdatedAt = time.Now().UTC()
+	meta.UpdatedBy = updatedBy
+
+	warning := ""
+	if meta.SyncOverlayTags || wasSyncing {
+		if err := s.syncOverlayTags(&meta); err != nil {
+			warning = fmt.Sprintf("Overlay tags not updated: %v", err)
+		}
+	}
+
+	records[identity.key()] = meta
+	if err := saveComputerMetadata(records); err != nil {
+		return nil, "", err
+	}
+	return &meta, warning, nil
+}
+
+// syncOverlayTags replaces the ACL tags previously mirrored onto the
+// computer's Headscale node with its current tags. Tags the node got from
+// elsewhere, such as its pre-auth key, are kept.
+func (s *ComputerService) syncOverlayTags(meta *models.ComputerMetadata) error {
+	node := s.findNode(meta.ComputerName)
+	if node == nil {
+		if meta.SyncOverlayTags {
+			return fmt.Errorf("no overlay node found for %s", meta.ComputerName)
+		}
+		meta.OverlayTags = nil
+		return nil
+	}
+
+	previous := make(map[string]bool)
+	for _, tag := range meta.OverlayTags {
+		previous[tag] = true
+	}
+
+	var desired []string
+	if meta.SyncOverlayTags {
+		desired = OverlayTagsFor(meta.Tags)
+	}
+
+	seen := make(map[string]bool)
+	var forced []string
+	for _, tag := range node.ForcedTags {
+		if !previous[tag] && !seen[tag] {
+			seen[tag] = true
+			forced = append(forced, tag)
+		}
+	}
+	for _, tag := range desired {
+		if !seen[tag] {
+			seen[tag] = true
+			forced = append(forced, tag)
+		}
+	}
+
+	client, err := headscaleClient()
+	if err != nil {
+		return err
+	}
+	if err := client.SetNodeTags(node.ID, forced); err != nil {
+		return err
+	}
+	meta.OverlayTags = desired
+	return nil
+}
+
+// OverlayTagsFor maps computer tags to Headscale ACL tags, e.g. "Front Desk"
+// becomes "tag:front-desk". Tags that would impersonate a per-computer tag
+// are left out.
+func OverlayTagsFor(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		name := aclTagName(tag)
+		if name == "" || strings.HasPrefix(name, "computer-") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, "tag:"+name)
+	}
+	return result
+}
+
+// FilterComputers returns the computers carrying all of the given tags whose
+// name, asset tag, location, owner or tags contain the query. Matching is
+// case-insensitive; empty filters match everything.
+func FilterComputers(computers []models.Computer, tags []string, query string) []models.Computer {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if len(tags) == 0 && query == "" {
+		return computers
+	}
+
+	filtered := make([]models.Computer, 0, len(computers))
+	for _, computer := range computers {
+		var meta models.ComputerMetadata
+		if computer.Metadata != nil {
+			meta = *computer.Metadata
+		}
+		if !hasAllTags(meta.Tags, tags) {
+			continue
+		}
+		if query != "" {
+			fields := append([]string{computer.Name, meta.AssetTag, meta.Location, meta.Owner}, meta.Tags...)
+			matched := false
+			for _, field := range fields {
+				if strings.Contains(strings.ToLower(field), query) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		filtered = append(filtered, computer)
+	}
+	return filtered
+}
+
+func hasAllTags(have, want []string) bool {
+	for _, tag := range want {
+		found := false
+		for _, candidate := range have {
+			if strings.EqualFold(candidate, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataIndex returns stored metadata keyed by lowercase computer name,
+// resolving the current names with a single directory search
+func (s *ComputerService) metadataIndex() map[string]models.ComputerMetadata {
+	metadataMutex.Lock()
+	records, err := loadComputerMetadata()
+	metadataMutex.Unlock()
+	if err != nil || len(records) == 0 {
+		return nil
+	}
+
+	entries, err := s.ldbTool.Search("", "(objectClass=computer)", "sAMAccountName", "objectGUID", "objectSid")
+	if err != nil {
+		return nil
+	}
+
+	index := make(map[string]models.ComputerMetadata)
+	for _, entry := range entries {
+		identity := identityFromEntry(entry)
+		if meta, ok := records[identity.key()]; ok {
+			meta.ComputerName = identity.Name
+			index[strings.ToLower(identity.Name)] = meta
+		}
+	}
+	return index
+}
+
+// computerIdentity looks up the GUID and SID of a computer account
+func (s *ComputerService) computerIdentity(computerName string) (computerIdentity, error) {
+	name := strings.TrimSuffix(computerName, "$")
+	if !IsValidComputerName(name) {
+		return computerIdentity{}, fmt.Errorf("invalid computer name")
+	}
+	entries, err := s.ldbTool.Search("",
+		fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s))", sambaExec.EscapeFilter(name+"$")),
+		"sAMAccountName", "objectGUID", "objectSid")
+	if err != nil {
+		return computerIdentity{}, fmt.Errorf("failed to look up computer %s: %v", name, err)
+	}
+	if len(entries) == 0 {
+		return computerIdentity{}, fmt.Errorf("computer %s not found", name)
+	}
+	identity := identityFromEntry(entries[0])
+	if identity.key() == "" {
+		return computerIdentity{}, fmt.Errorf("computer %s has no GUID or SID", name)
+	}
+	return identity, nil
+}
+
+func identityFromEntry(entry sambaExec.LDIFEntry) computerIdentity {
+	return computerIdentity{
+		Name:       strings.TrimSuffix(entry.Get("sAMAccountName"), "$"),
+		ObjectGUID: entry.Get("objectGUID"),
+		SID:        entry.Get("objectSid"),
+	}
+}
+
+// metadataField trims a single-line metadata value and checks its length
+func metadataField(label, value string, limit int) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > limit {
+		return "", fmt.Errorf("%s must be at most %d characters", label, limit)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("%s must be a single line", label)
+	}
+	return value, nil
+}
+
+// normalizeMetadataTags validates tags and drops case-insensitive duplicates
+func normalizeMetadataTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !metadataTagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use letters, digits, spaces, dots, hyphens and underscores", tag)
+		}
+		if seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxMetadataTags {
+		return nil, fmt.Errorf("a computer can have at most %d tags", maxMetadataTags)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i]) < strings.ToLower(result[j])
+	})
+	return result, nil
+}
+
+// removeComputerMetadata drops the metadata of a deleted computer account
+func removeComputerMetadata(identity computerIdentity) error {
+	metadataMutex.Lock()
+	defer metadataMutex.Unlock()
+
+	records, err := loadComputerMetadata()
+	if err != nil {
+		return err
+	}
+	if _, ok := records[identity.key()]; !ok {
+		return nil
+	}
+	delete(records, identity.key())
+	return saveComputerMetadata(records)
+}
+
+func loadComputerMetadata() (map[string]models.ComputerMetadata, error) {
+	records := map[string]models.ComputerMetadata{}
+	data, err := os.ReadFile(computerMetadataPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("failed to read computer metadata: %v", err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse computer metadata: %v", err)
+	}
+	return records, nil
+}
+
+func saveComputerMetadata(records map[string]models.ComputerMetadata) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(computerMetadataPath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return os.WriteFile(computerMetadataPath, data, 0600)
+}
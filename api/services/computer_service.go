@@ -3,17 +3,30 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/griffinwebnet/vexa/api/config"
 	sambaExec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/headscale"
 	"github.com/griffinwebnet/vexa/api/models"
 	"github.com/griffinwebnet/vexa/api/utils"
 )
 
+// computerNameRegex matches a NetBIOS computer name: up to 15 letters, digits and hyphens
+var computerNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,14}$`)
+
 // ComputerService handles computer-related business logic
 type ComputerService struct {
 	sambaTool *sambaExec.SambaTool
+	ldbTool   *sambaExec.LdbTool
+	netTool   *sambaExec.NetTool
 	config    *config.Config
 }
 
@@ -21,97 +34,115 @@ type ComputerService struct {
 func NewComputerService() *ComputerService {
 	return &ComputerService{
 		sambaTool: sambaExec.NewSambaTool(),
+		ldbTool:   sambaExec.NewLdbTool(),
+		netTool:   sambaExec.NewNetTool(),
 		config:    config.LoadConfig(),
 	}
 }
 
-// ListComputers returns all computers/devices in the domain with connection status
-func (s *ComputerService) ListComputers() ([]models.Computer, error) {
+// IsValidComputerName reports whether a name is usable as a NetBIOS computer name
+func IsValidComputerName(name string) bool {
+	return computerNameRegex.MatchString(name)
+}
+
+// ListComputers returns all computers/devices in the domain with connection status.
+// Local reachability comes from the probe cache; with refresh set the computers
+// are probed again before answering.
+func (s *ComputerService) ListComputers(refresh bool) ([]models.Computer, error) {
 
 	// Get domain computers from Samba
-	output, err := s.sambaTool.Run("computer", "list")
+	computerNames, err := s.domainComputerNames()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list computers: %s", output)
+		return nil, err
 	}
-
-	computerNames := strings.Split(strings.TrimSpace(output), "\n")
 	domainComputers := make(map[string]bool) // Track which computers are domain-joined
-
-	// Build list of domain computers
 	for _, name := range computerNames {
-		if name != "" {
-			cleanName := strings.TrimSuffix(name, "$")
-			domainComputers[cleanName] = true
-		}
+		domainComputers[name] = true
 	}
 
 	// Get Tailscale nodes if Headscale is enabled
-	var tailscaleNodes map[string]map[string]interface{}
+	var tailscaleNodes map[string]headscale.Node
 	if s.isHeadscaleEnabled() {
 		tailscaleNodes = s.getTailscaleNodes()
 	}
 
+	dcCleanName := strings.TrimSuffix(s.getDomainControllerHostname(), "$")
+
+	// Overlay URLs share the domain name, so look it up once
+	overlaySuffix := ""
+	domainStatus, _ := NewDomainService().GetDomainStatus()
+	if domainStatus != nil && domainStatus.Domain != "" && domainStatus.Domain != "PROVISIONED" {
+		overlaySuffix = "." + domainStatus.Domain + ".mesh"
+	}
+
+	reachabilityService := NewReachabilityService()
+	targets := computerTargets(computerNames)
+	if refresh {
+		reachabilityService.Refresh(targets)
+	} else {
+		reachabilityService.ProbeMissing(targets)
+	}
+	reachability := reachabilityService.Get(computerNames)
+	inventory := NewInventoryService().Summaries()
+	metadata := s.metadataIndex()
+
 	computers := make([]models.Computer, 0)
 
 	// Process domain computers
-	for _, name := range computerNames {
-		if name == "" {
-			continue
-		}
-
-		cleanName := strings.TrimSuffix(name, "$")
+	for _, cleanName := range computerNames {
 		computer := models.Computer{
 			Name:           cleanName,
-			DNSName:        name,
+			DNSName:        cleanName + "$",
 			Online:         false,
 			ConnectionType: "offline",
 		}
 
 		// Check local connectivity
-		if s.pingComputer(cleanName) {
-			computer.Online = true
-			computer.ConnectionType = "local"
-			if ip := s.getComputerIP(cleanName); ip != "" {
-				computer.IPAddress = ip
+		if result, ok := reachability[cleanName]; ok {
+			result := result
+			computer.Reachability = &result
+			if result.Reachable {
+				computer.Online = true
+				computer.ConnectionType = "local"
+				computer.IPAddress = result.Address
 			}
 		}
+		if summary, ok := inventory[strings.ToLower(cleanName)]; ok {
+			summary := summary
+			computer.Inventory = &summary
+		}
+		if meta, ok := metadata[strings.ToLower(cleanName)]; ok {
+			meta := meta
+			computer.Metadata = &meta
+		}
 
 		// Check Tailscale connectivity
 		if tailscaleNodes != nil {
 			// Try exact match first
 			if node, exists := tailscaleNodes[cleanName]; exists {
 				// Found in Tailscale - get overlay IP and URL
-				if ip := s.extractIPFromNode(node); ip != "" {
+				if ip := node.IPv4(); ip != "" {
 					computer.OverlayIP = ip
 					computer.Online = true
 					computer.ConnectionType = "overlay"
-
-					// Generate overlay URL
-					domainService := NewDomainService()
-					domainStatus, _ := domainService.GetDomainStatus()
-					if domainStatus != nil && domainStatus.Domain != "" && domainStatus.Domain != "PROVISIONED" {
-						computer.OverlayURL = fmt.Sprintf("%s.%s.mesh", cleanName, domainStatus.Domain)
+					if overlaySuffix != "" {
+						computer.OverlayURL = cleanName + overlaySuffix
 					}
 				}
 			} else {
 				// Try to find a Tailscale node that might be the same machine
 				// Check if this is the domain controller and look for server names
-				dcHostname := s.getDomainControllerHostname()
-				if cleanName == strings.TrimSuffix(dcHostname, "$") {
+				if cleanName == dcCleanName {
 					// This is the DC, look for server names from configuration
 					serverNames := s.config.GetAllServerNames()
 					for _, serverName := range serverNames {
 						if node, exists := tailscaleNodes[serverName]; exists {
-							if ip := s.extractIPFromNode(node); ip != "" {
+							if ip := node.IPv4(); ip != "" {
 								computer.OverlayIP = ip
 								computer.Online = true
 								computer.ConnectionType = "overlay"
-
-								// Generate overlay URL
-								domainService := NewDomainService()
-								domainStatus, _ := domainService.GetDomainStatus()
-								if domainStatus != nil && domainStatus.Domain != "" && domainStatus.Domain != "PROVISIONED" {
-									computer.OverlayURL = fmt.Sprintf("%s.%s.mesh", cleanName, domainStatus.Domain)
+								if overlaySuffix != "" {
+									computer.OverlayURL = cleanName + overlaySuffix
 								}
 								break
 							}
@@ -126,9 +157,6 @@ func (s *ComputerService) ListComputers() ([]models.Computer, error) {
 
 	// Add Tailscale-only nodes (not domain-joined) and the server itself
 	if tailscaleNodes != nil {
-		dcHostname := s.getDomainControllerHostname()
-		dcCleanName := strings.TrimSuffix(dcHostname, "$")
-
 		for nodeName, node := range tailscaleNodes {
 			// Skip if already in domain computers list
 			if domainComputers[nodeName] {
@@ -146,15 +174,12 @@ func (s *ComputerService) ListComputers() ([]models.Computer, error) {
 				ConnectionType: "overlay",
 			}
 
-			if ip := s.extractIPFromNode(node); ip != "" {
+			if ip := node.IPv4(); ip != "" {
 				computer.OverlayIP = ip
 			}
 
-			// Generate overlay URL
-			domainService := NewDomainService()
-			domainStatus, _ := domainService.GetDomainStatus()
-			if domainStatus != nil && domainStatus.Domain != "" && domainStatus.Domain != "PROVISIONED" {
-				computer.OverlayURL = fmt.Sprintf("%s.%s.mesh", nodeName, domainStatus.Domain)
+			if overlaySuffix != "" {
+				computer.OverlayURL = nodeName + overlaySuffix
 			}
 
 			// Add special indicator for the server
@@ -169,129 +194,201 @@ func (s *ComputerService) ListComputers() ([]models.Computer, error) {
 	return computers, nil
 }
 
-// GetComputer returns details for a specific computer
-func (s *ComputerService) GetComputer(computerName string) (*models.Computer, error) {
-	// TODO: Get detailed computer info from Samba
-	computer := &models.Computer{
-		Name: computerName,
-	}
-	return computer, nil
+// StartReachabilityMonitor probes all domain computers in the background on the configured interval
+func (s *ComputerService) StartReachabilityMonitor() {
+	NewReachabilityService().StartMonitor(s.config.ReachabilityInterval, func() map[string]string {
+		names, err := s.domainComputerNames()
+		if err != nil {
+			utils.Debug("Reachability monitor could not list computers: %v", err)
+			return nil
+		}
+		return computerTargets(names)
+	})
 }
 
-// GetMachineDetails returns detailed information about a machine from Headscale
-func (s *ComputerService) GetMachineDetails(machineId string) (map[string]interface{}, error) {
-	fmt.Printf("DEBUG: Looking for machine: %s\n", machineId)
-
-	// Query Headscale for machine details
-	cmd, cmdErr := utils.SafeCommand("headscale", "nodes", "list", "--output", "json")
-	if cmdErr != nil {
-		return nil, fmt.Errorf("command sanitization failed: %v", cmdErr)
-	}
-	output, err := cmd.Output()
+// domainComputerNames returns the names of all computer accounts, without the trailing $
+func (s *ComputerService) domainComputerNames() ([]string, error) {
+	output, err := s.sambaTool.Run("computer", "list")
 	if err != nil {
-		return nil, fmt.Errorf("failed to query headscale: %v", err)
+		return nil, fmt.Errorf("failed to list computers: %s", output)
 	}
 
-	// Parse JSON to find the specific machine
-	var nodes []map[string]interface{}
-	if err := json.Unmarshal(output, &nodes); err != nil {
-		return nil, fmt.Errorf("failed to parse headscale output: %v", err)
+	names := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if name := strings.TrimSuffix(strings.TrimSpace(line), "$"); name != "" {
+			names = append(names, name)
+		}
 	}
+	return names, nil
+}
 
-	fmt.Printf("DEBUG: Found %d nodes in Headscale\n", len(nodes))
-
-	// Find the machine by ID or name
-	for i, node := range nodes {
-		nodeName := "unknown"
-		nodeID := "unknown"
+// computerTargets maps computer names to the address probed for them; names
+// are resolved through DNS at probe time
+func computerTargets(names []string) map[string]string {
+	targets := make(map[string]string, len(names))
+	for _, name := range names {
+		targets[name] = name
+	}
+	return targets
+}
 
-		if name, ok := node["name"].(string); ok {
-			nodeName = name
-		}
-		if id, ok := node["id"].(float64); ok {
-			nodeID = fmt.Sprintf("%.0f", id)
-		}
+// computerDetailAttributes are the directory attributes read for the machine view
+var computerDetailAttributes = []string{
+	"sAMAccountName", "objectSid", "objectGUID", "dNSHostName", "description",
+	"operatingSystem", "operatingSystemVersion", "userAccountControl",
+	"lastLogonTimestamp", "whenCreated", "servicePrincipalName", "managedBy",
+}
 
-		fmt.Printf("DEBUG: Node %d: ID=%s, Name=%s\n", i, nodeID, nodeName)
+// GetComputer returns the unified machine view for a computer: its directory
+// account merged with its Headscale node. Either half may be missing, e.g. for
+// Tailnet-only devices or computers that never joined the overlay.
+func (s *ComputerService) GetComputer(computerName string) (*models.ComputerDetails, error) {
+	name := strings.TrimSuffix(computerName, "$")
+	details := &models.ComputerDetails{
+		Name:                  name,
+		ServicePrincipalNames: []string{},
+	}
 
-		// Check by ID (convert float64 to string)
-		if nodeID, ok := node["id"].(float64); ok {
-			if fmt.Sprintf("%.0f", nodeID) == machineId {
-				fmt.Printf("DEBUG: Found machine by ID match\n")
-				return s.formatMachineDetails(node)
-			}
-		}
+	entries, err := s.ldbTool.Search("",
+		fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s))", sambaExec.EscapeFilter(name+"$")),
+		computerDetailAttributes...)
+	if err != nil {
+		utils.Warn("Failed to read computer %s from the directory: %v", name, err)
+	}
+	if len(entries) > 0 {
+		applyComputerEntry(details, entries[0])
+	}
 
-		// Check by name (exact match)
-		if nodeName, ok := node["name"].(string); ok && nodeName == machineId {
-			fmt.Printf("DEBUG: Found machine by exact name match\n")
-			return s.formatMachineDetails(node)
+	if node := s.findNode(name); node != nil {
+		if overlay, err := s.formatMachineDetails(node); err == nil {
+			details.Overlay = overlay
 		}
+	}
 
-		// Check by name with $ suffix (for domain computers)
-		if nodeName, ok := node["name"].(string); ok && nodeName == machineId+"$" {
-			fmt.Printf("DEBUG: Found machine by name with $ suffix match\n")
-			return s.formatMachineDetails(node)
+	if !details.InDirectory && details.Overlay == nil {
+		return nil, fmt.Errorf("computer %s not found", name)
+	}
+	if inventory, _, err := NewInventoryService().Get(details.Name); err == nil {
+		details.Inventory = inventory
+	}
+	if details.InDirectory {
+		if meta, err := s.GetMetadata(details.Name); err == nil {
+			details.Metadata = meta
 		}
+	}
+	return details, nil
+}
 
-		// Check by name without $ suffix
-		if nodeName, ok := node["name"].(string); ok && strings.TrimSuffix(nodeName, "$") == machineId {
-			fmt.Printf("DEBUG: Found machine by name without $ suffix match\n")
-			return s.formatMachineDetails(node)
-		}
+// applyComputerEntry fills the directory half of the machine view
+func applyComputerEntry(details *models.ComputerDetails, entry sambaExec.LDIFEntry) {
+	details.InDirectory = true
+	details.Name = strings.TrimSuffix(entry.Get("sAMAccountName"), "$")
+	details.DN = entry.DN
+	details.OU = sambaExec.ParentDN(entry.DN)
+	details.SID = entry.Get("objectSid")
+	details.GUID = entry.Get("objectGUID")
+	details.DNSHostName = entry.Get("dNSHostName")
+	details.Description = entry.Get("description")
+	details.OperatingSystem = entry.Get("operatingSystem")
+	details.OperatingSystemVersion = entry.Get("operatingSystemVersion")
+	details.ManagedBy = entry.Get("managedBy")
+	if spns := entry.GetAll("servicePrincipalName"); spns != nil {
+		details.ServicePrincipalNames = spns
+	}
+
+	// ACCOUNTDISABLE is bit 0x2 of userAccountControl
+	uac, _ := strconv.Atoi(entry.Get("userAccountControl"))
+	details.Enabled = uac&0x2 == 0
+
+	if t, ok := sambaExec.ParseFileTime(entry.Get("lastLogonTimestamp")); ok {
+		details.LastLogon = &t
+	}
+	if t, ok := sambaExec.ParseGeneralizedTime(entry.Get("whenCreated")); ok {
+		details.WhenCreated = &t
 	}
+}
 
-	return nil, fmt.Errorf("machine not found")
+// GetMachineDetails returns detailed information about a machine from Headscale,
+// looked up by node ID or by name
+func (s *ComputerService) GetMachineDetails(machineId string) (map[string]interface{}, error) {
+	node := s.findNode(machineId)
+	if node == nil {
+		return nil, fmt.Errorf("machine not found")
+	}
+	return s.formatMachineDetails(node)
 }
 
-// formatMachineDetails formats Headscale node data into our machine details format
-func (s *ComputerService) formatMachineDetails(node map[string]interface{}) (map[string]interface{}, error) {
-	// Extract basic info
-	id := fmt.Sprintf("%.0f", node["id"].(float64))
-	name := node["name"].(string)
-
-	// Get IP addresses
-	var ipv4, ipv6 string
-	if addrs, ok := node["ip_addresses"].([]interface{}); ok {
-		for _, addr := range addrs {
-			if addrStr, ok := addr.(string); ok {
-				if strings.Contains(addrStr, ":") {
-					ipv6 = addrStr
-				} else {
-					ipv4 = addrStr
-				}
+// findNode returns the Headscale node whose ID matches, or whose name matches
+// case-insensitively with or without the trailing $ of a computer account
+func (s *ComputerService) findNode(machineId string) *headscale.Node {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil
+	}
+	nodes, err := client.ListNodes()
+	if err != nil {
+		return nil
+	}
+
+	want := strings.TrimSuffix(machineId, "$")
+	for i := range nodes {
+		if nodes[i].ID == machineId {
+			return &nodes[i]
+		}
+	}
+	for i := range nodes {
+		for _, name := range []string{nodes[i].GivenName, nodes[i].Name} {
+			if strings.EqualFold(strings.TrimSuffix(name, "$"), want) {
+				return &nodes[i]
 			}
 		}
 	}
+	return nil
+}
+
+// formatMachineDetails formats Headscale node data into our machine details format
+func (s *ComputerService) formatMachineDetails(node *headscale.Node) (map[string]interface{}, error) {
+	id := node.ID
+	name := node.Name
 
-	// Get timestamps
 	created := "Unknown"
-	if createdAt, ok := node["createdAt"].(string); ok {
-		created = createdAt
+	if node.CreatedAt != "" {
+		created = node.CreatedAt
 	}
 
 	lastSeen := "Unknown"
-	if lastSeenTime, ok := node["lastSeen"].(string); ok {
-		lastSeen = lastSeenTime
+	if node.LastSeen != "" {
+		lastSeen = node.LastSeen
 	}
 
-	// Get key info
 	keyExpiry := "Never"
-	if expiry, ok := node["expiry"].(string); ok && expiry != "" {
-		keyExpiry = expiry
+	if node.Expiry != "" {
+		keyExpiry = node.Expiry
 	}
 
 	nodeKey := "Unknown"
-	if key, ok := node["nodeKey"].(string); ok {
-		nodeKey = key
+	if node.NodeKey != "" {
+		nodeKey = node.NodeKey
 	}
 
-	// Determine status
 	status := "offline"
-	if lastSeen != "Unknown" && lastSeen != "" {
+	if node.Online {
 		status = "online"
 	}
 
+	// Route approval state
+	routes := node.Routes()
+	exitNode := false
+	pendingRoutes := 0
+	for _, route := range routes {
+		if route.IsExitRoute() && route.Enabled {
+			exitNode = true
+		}
+		if route.Advertised && !route.Enabled {
+			pendingRoutes++
+		}
+	}
+
 	return map[string]interface{}{
 		"id":            id,
 		"name":          name,
@@ -301,140 +398,568 @@ func (s *ComputerService) formatMachineDetails(node map[string]interface{}) (map
 		"lastSeen":      lastSeen,
 		"keyExpiry":     keyExpiry,
 		"nodeKey":       nodeKey,
-		"tailscaleIPv4": ipv4,
-		"tailscaleIPv6": ipv6,
+		"tailscaleIPv4": node.IPv4(),
+		"tailscaleIPv6": node.IPv6(),
 		"shortDomain":   name,
 		"status":        status,
 		"managedBy":     "infrastructure",
+		"routes":        routes,
+		"exitNode":      exitNode,
+		"pendingRoutes": pendingRoutes,
+	}, nil
+}
+
+// PrestageComputer creates a computer account before the machine joins, so it
+// lands in the chosen OU. managedBy only records who is responsible for the
+// computer; it grants no rights, so joining still needs an account allowed to
+// reset the computer's password.
+func (s *ComputerService) PrestageComputer(req models.PrestageComputerRequest) (*models.Computer, error) {
+	name := strings.TrimSuffix(req.Name, "$")
+	if !IsValidComputerName(name) {
+		return nil, fmt.Errorf("invalid computer name: %s", req.Name)
+	}
+	if s.ComputerExists(name) {
+		return nil, fmt.Errorf("computer %s already exists", name)
+	}
+
+	// Resolve managedBy first so a bad value does not leave a half-configured account
+	var managedByDN string
+	if req.ManagedBy != "" {
+		dn, err := s.ldbTool.UserDN(req.ManagedBy)
+		if err != nil {
+			dn, err = s.ldbTool.GroupDN(req.ManagedBy)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("managedBy %s is not a user or group", req.ManagedBy)
+		}
+		managedByDN = dn
+	}
+
+	output, err := s.sambaTool.ComputerCreate(name, sambaExec.ComputerCreateOptions{
+		OUPath:      req.OUPath,
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create computer: %s", output)
+	}
+
+	if managedByDN != "" {
+		dn, err := s.ldbTool.ComputerDN(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.ldbTool.ReplaceAttribute(dn, "managedBy", managedByDN); err != nil {
+			return nil, fmt.Errorf("computer created but failed to set managedBy: %v", err)
+		}
+	}
+
+	utils.Info("Pre-staged computer account %s", name)
+	return &models.Computer{
+		Name:           name,
+		DNSName:        name + "$",
+		ConnectionType: "offline",
+	}, nil
+}
+
+// ComputerExists reports whether a computer account exists
+func (s *ComputerService) ComputerExists(computerName string) bool {
+	_, err := s.ldbTool.ComputerDN(computerName)
+	return err == nil
+}
+
+// ProvisionOfflineJoin generates djoin-style offline join data for a pre-staged
+// computer account. Generating it resets the account's machine password, so
+// earlier data for the same computer stops working.
+func (s *ComputerService) ProvisionOfflineJoin(computerName string, req models.OfflineJoinRequest) (*models.OfflineJoinData, error) {
+	name := strings.TrimSuffix(computerName, "$")
+	if !s.ComputerExists(name) {
+		return nil, fmt.Errorf("computer %s not found; pre-stage the account first", name)
+	}
+
+	domainStatus, err := NewDomainService().GetDomainStatus()
+	if err != nil || domainStatus.Realm == "" {
+		return nil, fmt.Errorf("failed to get domain realm")
+	}
+
+	adminUser := req.AdminUser
+	if adminUser == "" {
+		adminUser = "Administrator"
+	}
+	dcName, _ := os.Hostname()
+
+	blob, err := s.netTool.OfflineJoinProvision(sambaExec.OfflineJoinOptions{
+		Realm:         domainStatus.Realm,
+		MachineName:   name,
+		DCName:        dcName,
+		AdminUser:     adminUser,
+		AdminPassword: req.AdminPassword,
+		Reuse:         true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := strings.ToLower(name) + "-odj.txt"
+	return &models.OfflineJoinData{
+		ComputerName: name,
+		Blob:         blob,
+		FileName:     fileName,
+		Command:      fmt.Sprintf("djoin /requestODJ /loadfile %s /windowspath %%SystemRoot%% /localos", fileName),
 	}, nil
 }
 
 // DeleteComputer removes a computer from the domain
 func (s *ComputerService) DeleteComputer(computerName string) error {
+	// Metadata is keyed by the account's GUID, which is gone after the delete
+	identity, identityErr := s.computerIdentity(computerName)
+
 	output, err := s.sambaTool.Run("computer", "delete", computerName)
 	if err != nil {
 		return fmt.Errorf("failed to delete computer: %s", output)
 	}
+	if identityErr == nil {
+		if err := removeComputerMetadata(identity); err != nil {
+			utils.Warn("Failed to remove metadata of %s: %v", computerName, err)
+		}
+	}
+	if err := NewInventoryService().Remove(computerName); err != nil {
+		utils.Warn("Failed to remove inventory of %s: %v", computerName, err)
+	}
 	return nil
 }
 
-// Helper functions
+const (
+	staleComputerPolicyPath = "/etc/vexa/stale-computers.json"
+	quarantineStatePath     = "/var/lib/vexa/computer-quarantine.json"
+)
 
-func (s *ComputerService) isHeadscaleEnabled() bool {
-	cmd, err := utils.SafeCommand("systemctl", "is-active", "headscale")
+var (
+	quarantineMutex     sync.Mutex
+	quarantinePurgeOnce sync.Once
+)
+
+// GetStalePolicy returns the stale computer policy, with defaults when none is saved
+func (s *ComputerService) GetStalePolicy() (*models.StaleComputerPolicy, error) {
+	policy := &models.StaleComputerPolicy{
+		ThresholdDays: 90,
+		GraceDays:     30,
+		QuarantineOU:  "OU=Quarantine",
+	}
+
+	data, err := os.ReadFile(staleComputerPolicyPath)
 	if err != nil {
-		return false
+		if os.IsNotExist(err) {
+			return policy, nil
+		}
+		return nil, fmt.Errorf("failed to read stale computer policy: %v", err)
 	}
-	return cmd.Run() == nil
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse stale computer policy: %v", err)
+	}
+	return policy, nil
 }
 
-func (s *ComputerService) pingComputer(hostname string) bool {
-	cmd, err := utils.SafeCommand("ping", "-c", "1", "-W", "1", hostname)
+// SaveStalePolicy validates and stores the stale computer policy
+func (s *ComputerService) SaveStalePolicy(policy *models.StaleComputerPolicy) error {
+	if policy.ThresholdDays < 1 {
+		return fmt.Errorf("threshold must be at least 1 day")
+	}
+	if policy.GraceDays < 0 {
+		return fmt.Errorf("grace period cannot be negative")
+	}
+	policy.QuarantineOU = strings.TrimSpace(policy.QuarantineOU)
+	if !strings.HasPrefix(strings.ToUpper(policy.QuarantineOU), "OU=") {
+		return fmt.Errorf("quarantine OU must start with OU=")
+	}
+
+	data, err := json.MarshalIndent(policy, "", "  ")
 	if err != nil {
-		return false
+		return err
 	}
-	return cmd.Run() == nil
+	if err := os.MkdirAll(filepath.Dir(staleComputerPolicyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return os.WriteFile(staleComputerPolicyPath, data, 0600)
 }
 
-func (s *ComputerService) getComputerIP(hostname string) string {
-	// First try to get the actual network IP using ip command
-	cmd, cmdErr := utils.SafeCommand("ip", "route", "get", "1.1.1.1")
-	if cmdErr != nil {
-		return ""
+// StaleComputers returns computer accounts whose lastLogonTimestamp and Headscale
+// lastSeen are both older than the given number of days. Accounts that never
+// logged on count from whenCreated. Domain controllers are never reported.
+func (s *ComputerService) StaleComputers(days int) ([]models.StaleComputer, error) {
+	if days < 1 {
+		return nil, fmt.Errorf("days must be at least 1")
 	}
-	output, err := cmd.Output()
-	if err == nil {
-		// Parse output like "1.1.1.1 via 192.168.1.1 dev eth0 src 192.168.1.100"
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "src ") {
-				parts := strings.Fields(line)
-				for i, part := range parts {
-					if part == "src" && i+1 < len(parts) {
-						ip := parts[i+1]
-						// Validate it's a real IP (not 127.x.x.x)
-						if !strings.HasPrefix(ip, "127.") && !strings.HasPrefix(ip, "100.64.") {
-							return ip
-						}
-					}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	entries, err := s.ldbTool.Search("", "(objectClass=computer)",
+		"sAMAccountName", "operatingSystem", "userAccountControl", "lastLogonTimestamp", "whenCreated")
+	if err != nil {
+		return nil, err
+	}
+
+	// Node names are hostnames, usually lowercase, so match case-insensitively
+	nodes := map[string]headscale.Node{}
+	if s.isHeadscaleEnabled() {
+		for name, node := range s.getTailscaleNodes() {
+			nodes[strings.ToLower(name)] = node
+		}
+	}
+
+	quarantined, err := s.loadQuarantine()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]models.StaleComputer, 0)
+	for _, entry := range entries {
+		uac, _ := strconv.Atoi(entry.Get("userAccountControl"))
+		if uac&0x2000 != 0 { // SERVER_TRUST_ACCOUNT: a domain controller
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Get("sAMAccountName"), "$")
+		computer := models.StaleComputer{
+			Name:            name,
+			DN:              entry.DN,
+			OperatingSystem: entry.Get("operatingSystem"),
+			Enabled:         uac&0x2 == 0,
+		}
+
+		// The most recent activity from either source decides staleness
+		lastActive := time.Time{}
+		if t, ok := sambaExec.ParseFileTime(entry.Get("lastLogonTimestamp")); ok {
+			computer.LastLogon = &t
+			lastActive = t
+		}
+		if t, ok := sambaExec.ParseGeneralizedTime(entry.Get("whenCreated")); ok {
+			computer.WhenCreated = &t
+			if computer.LastLogon == nil {
+				lastActive = t
+			}
+		}
+		if node, ok := nodes[strings.ToLower(name)]; ok {
+			if t, err := time.Parse(time.RFC3339Nano, node.LastSeen); err == nil {
+				computer.LastSeen = &t
+				if t.After(lastActive) {
+					lastActive = t
 				}
 			}
 		}
+
+		if lastActive.IsZero() || lastActive.After(cutoff) {
+			continue
+		}
+		computer.InactiveDays = int(time.Since(lastActive).Hours() / 24)
+		if record, ok := quarantined[strings.ToLower(name)]; ok {
+			deleteAfter := record.DeleteAfter
+			computer.Quarantined = true
+			computer.DeleteAfter = &deleteAfter
+		}
+		stale = append(stale, computer)
 	}
 
-	// Fallback to hostname resolution
-	cmd, cmdErr = utils.SafeCommand("host", hostname)
-	if cmdErr != nil {
-		return ""
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].InactiveDays > stale[j].InactiveDays
+	})
+	return stale, nil
+}
+
+// QuarantineComputers disables each computer account and moves it to the
+// quarantine OU, scheduling its deletion after the grace period
+func (s *ComputerService) QuarantineComputers(ctx utils.AuditContext, names []string) ([]models.ComputerActionResult, error) {
+	policy, err := s.GetStalePolicy()
+	if err != nil {
+		return nil, err
 	}
-	output, err = cmd.Output()
+	if err := s.ensureQuarantineOU(policy.QuarantineOU); err != nil {
+		return nil, err
+	}
+
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+
+	records, err := s.loadQuarantine()
 	if err != nil {
-		return ""
+		return nil, err
 	}
 
-	// Parse "hostname has address X.X.X.X"
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "has address") {
-			parts := strings.Fields(line)
-			if len(parts) >= 4 {
-				ip := parts[3]
-				// Skip loopback and Tailscale IPs
-				if !strings.HasPrefix(ip, "127.") && !strings.HasPrefix(ip, "100.64.") {
-					return ip
-				}
-			}
+	results := make([]models.ComputerActionResult, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSuffix(name, "$")
+		record, err := s.quarantineComputer(name, policy)
+		if err == nil {
+			record.QuarantinedBy = ctx.User
+			records[strings.ToLower(name)] = *record
+			err = s.saveQuarantine(records)
 		}
+
+		result := models.ComputerActionResult{Name: name, Success: err == nil}
+		details := map[string]interface{}{"quarantine_ou": policy.QuarantineOU}
+		if err != nil {
+			result.Error = err.Error()
+			details["error"] = err.Error()
+		} else {
+			details["original_dn"] = record.OriginalDN
+			details["delete_after"] = record.DeleteAfter
+		}
+		utils.LogComputerManagement(ctx, "computer_quarantine", name, err == nil, details)
+		results = append(results, result)
 	}
-	return ""
+	return results, nil
 }
 
-func (s *ComputerService) getHeadscaleIP(hostname string) string {
-	// Query Headscale for this node
-	cmd, cmdErr := utils.SafeCommand("headscale", "nodes", "list", "--output", "json")
-	if cmdErr != nil {
-		return ""
+// quarantineComputer disables one account and moves it to the quarantine OU
+func (s *ComputerService) quarantineComputer(name string, policy *models.StaleComputerPolicy) (*models.QuarantinedComputer, error) {
+	entries, err := s.ldbTool.Search("",
+		fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s))", sambaExec.EscapeFilter(name+"$")),
+		"userAccountControl")
+	if err != nil {
+		return nil, err
 	}
-	output, err := cmd.Output()
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("computer %s not found", name)
+	}
+	dn := entries[0].DN
+	uac, _ := strconv.Atoi(entries[0].Get("userAccountControl"))
+	if uac&0x2000 != 0 {
+		return nil, fmt.Errorf("%s is a domain controller", name)
+	}
+
+	quarantineDN, err := s.quarantineDN(policy.QuarantineOU)
 	if err != nil {
-		return ""
+		return nil, err
+	}
+	if strings.EqualFold(sambaExec.ParentDN(dn), quarantineDN) {
+		return nil, fmt.Errorf("computer %s is already quarantined", name)
 	}
 
-	// Parse JSON to find node by hostname and return its IP
-	var nodes []map[string]interface{}
-	if err := json.Unmarshal(output, &nodes); err != nil {
-		return ""
+	if uac&0x2 == 0 {
+		if err := s.ldbTool.ReplaceAttribute(dn, "userAccountControl", strconv.Itoa(uac|0x2)); err != nil {
+			return nil, fmt.Errorf("failed to disable computer: %v", err)
+		}
+	}
+	if output, err := s.sambaTool.ComputerMove(name, quarantineDN); err != nil {
+		return nil, fmt.Errorf("computer disabled but failed to move it: %s", output)
 	}
 
-	for _, node := range nodes {
-		if nodeHostname, ok := node["name"].(string); ok {
-			// Check if hostname matches (with or without $ suffix)
-			if nodeHostname == hostname || nodeHostname == hostname+"$" ||
-				strings.TrimSuffix(nodeHostname, "$") == hostname {
-
-				// Try to get IP from ip_addresses array (Headscale uses underscore)
-				if ipAddresses, ok := node["ip_addresses"].([]interface{}); ok {
-					for _, addr := range ipAddresses {
-						if addrStr, ok := addr.(string); ok {
-							// Return first IPv4 address (not IPv6)
-							if !strings.Contains(addrStr, ":") {
-								return addrStr
-							}
-						}
-					}
-				}
+	now := time.Now().UTC()
+	return &models.QuarantinedComputer{
+		Name:          name,
+		OriginalDN:    dn,
+		WasEnabled:    uac&0x2 == 0,
+		QuarantinedAt: now,
+		DeleteAfter:   now.AddDate(0, 0, policy.GraceDays),
+	}, nil
+}
+
+// ListQuarantined returns computers waiting in quarantine
+func (s *ComputerService) ListQuarantined() ([]models.QuarantinedComputer, error) {
+	records, err := s.loadQuarantine()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]models.QuarantinedComputer, 0, len(records))
+	for _, record := range records {
+		list = append(list, record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DeleteAfter.Before(list[j].DeleteAfter)
+	})
+	return list, nil
+}
+
+// RestoreComputer moves a quarantined computer back to its original container
+// and re-enables it if it was enabled before
+func (s *ComputerService) RestoreComputer(computerName string) (*models.QuarantinedComputer, error) {
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+
+	records, err := s.loadQuarantine()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(computerName, "$")
+	record, ok := records[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("computer %s is not quarantined", name)
+	}
+
+	if output, err := s.sambaTool.ComputerMove(record.Name, sambaExec.ParentDN(record.OriginalDN)); err != nil {
+		return nil, fmt.Errorf("failed to move computer back: %s", output)
+	}
+	if record.WasEnabled {
+		dn, err := s.ldbTool.ComputerDN(record.Name)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := s.ldbTool.SearchScope(dn, "base", "(objectClass=computer)", "userAccountControl")
+		if err != nil || len(entries) == 0 {
+			return nil, fmt.Errorf("failed to read computer %s", record.Name)
+		}
+		uac, _ := strconv.Atoi(entries[0].Get("userAccountControl"))
+		if err := s.ldbTool.ReplaceAttribute(dn, "userAccountControl", strconv.Itoa(uac&^0x2)); err != nil {
+			return nil, fmt.Errorf("computer moved back but failed to enable it: %v", err)
+		}
+	}
+
+	delete(records, strings.ToLower(name))
+	if err := s.saveQuarantine(records); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// PurgeQuarantined deletes quarantined computers whose grace period has ended.
+// Accounts that were moved out of quarantine or re-enabled by hand are released
+// instead of deleted.
+func (s *ComputerService) PurgeQuarantined(ctx utils.AuditContext) ([]models.ComputerActionResult, error) {
+	policy, err := s.GetStalePolicy()
+	if err != nil {
+		return nil, err
+	}
+	quarantineDN, err := s.quarantineDN(policy.QuarantineOU)
+	if err != nil {
+		return nil, err
+	}
+
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+
+	records, err := s.loadQuarantine()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := make([]models.ComputerActionResult, 0)
+	for key, record := range records {
+		if now.Before(record.DeleteAfter) {
+			continue
+		}
+
+		entries, err := s.ldbTool.Search("",
+			fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s))", sambaExec.EscapeFilter(record.Name+"$")),
+			"userAccountControl")
+		if err == nil && len(entries) == 0 {
+			// Already gone
+			delete(records, key)
+			continue
+		}
+		if err == nil {
+			uac, _ := strconv.Atoi(entries[0].Get("userAccountControl"))
+			if !strings.EqualFold(sambaExec.ParentDN(entries[0].DN), quarantineDN) || uac&0x2 == 0 {
+				utils.LogComputerManagement(ctx, "computer_quarantine_release", record.Name, true, map[string]interface{}{
+					"reason": "moved out of quarantine or re-enabled",
+				})
+				delete(records, key)
+				continue
+			}
+			err = s.DeleteComputer(record.Name)
+		}
+
+		result := models.ComputerActionResult{Name: record.Name, Success: err == nil}
+		details := map[string]interface{}{
+			"original_dn":    record.OriginalDN,
+			"quarantined_at": record.QuarantinedAt,
+		}
+		if err != nil {
+			result.Error = err.Error()
+			details["error"] = err.Error()
+		} else {
+			delete(records, key)
+		}
+		utils.LogComputerManagement(ctx, "computer_stale_delete", record.Name, err == nil, details)
+		results = append(results, result)
+	}
 
-				// Fallback to direct IP fields
-				if ipv4, ok := node["ipv4"].(string); ok && ipv4 != "" {
-					return ipv4
+	if err := s.saveQuarantine(records); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StartQuarantinePurge deletes expired quarantined computers hourly when the
+// policy enables automatic purging
+func (s *ComputerService) StartQuarantinePurge() {
+	quarantinePurgeOnce.Do(func() {
+		go func() {
+			ctx := utils.AuditContext{User: "system"}
+			for {
+				time.Sleep(time.Hour)
+				policy, err := s.GetStalePolicy()
+				if err != nil || !policy.AutoPurge {
+					continue
 				}
-				if ip, ok := node["ip"].(string); ok && ip != "" {
-					return ip
+				if _, err := s.PurgeQuarantined(ctx); err != nil {
+					utils.Warn("Automatic quarantine purge failed: %v", err)
 				}
 			}
+		}()
+	})
+}
+
+// ensureQuarantineOU creates the quarantine OU if it does not exist
+func (s *ComputerService) ensureQuarantineOU(ouPath string) error {
+	dn, err := s.quarantineDN(ouPath)
+	if err != nil {
+		return err
+	}
+	if entries, err := s.ldbTool.SearchScope(dn, "base", "(objectClass=*)", "dn"); err == nil && len(entries) > 0 {
+		return nil
+	}
+	if output, err := s.sambaTool.OUCreate(ouPath, "Stale computer accounts awaiting deletion"); err != nil {
+		return fmt.Errorf("failed to create quarantine OU: %s", output)
+	}
+	return nil
+}
+
+// quarantineDN returns the full DN of the quarantine OU
+func (s *ComputerService) quarantineDN(ouPath string) (string, error) {
+	domainDN, err := s.ldbTool.DomainDN()
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(strings.ToLower(ouPath), strings.ToLower(domainDN)) {
+		return ouPath, nil
+	}
+	return ouPath + "," + domainDN, nil
+}
+
+// loadQuarantine reads quarantine records keyed by lowercase computer name
+func (s *ComputerService) loadQuarantine() (map[string]models.QuarantinedComputer, error) {
+	records := map[string]models.QuarantinedComputer{}
+	data, err := os.ReadFile(quarantineStatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
 		}
+		return nil, fmt.Errorf("failed to read quarantine records: %v", err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine records: %v", err)
+	}
+	return records, nil
+}
+
+func (s *ComputerService) saveQuarantine(records map[string]models.QuarantinedComputer) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(quarantineStatePath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return os.WriteFile(quarantineStatePath, data, 0600)
+}
+
+// Helper functions
+
+func (s *ComputerService) isHeadscaleEnabled() bool {
+	cmd, err := utils.SafeCommand("systemctl", "is-active", "headscale")
+	if err != nil {
+		return false
 	}
-	return ""
+	return cmd.Run() == nil
 }
 
 func (s *ComputerService) getDomainControllerHostname() string {
@@ -451,42 +976,19 @@ func (s *ComputerService) getDomainControllerHostname() string {
 }
 
 // getTailscaleNodes returns a map of node names to their data from Headscale
-func (s *ComputerService) getTailscaleNodes() map[string]map[string]interface{} {
-	cmd, cmdErr := utils.SafeCommand("headscale", "nodes", "list", "--output", "json")
-	if cmdErr != nil {
-		return nil
-	}
-	output, err := cmd.Output()
+func (s *ComputerService) getTailscaleNodes() map[string]headscale.Node {
+	client, err := headscaleClient()
 	if err != nil {
 		return nil
 	}
-
-	var nodes []map[string]interface{}
-	if err := json.Unmarshal(output, &nodes); err != nil {
+	nodes, err := client.ListNodes()
+	if err != nil {
 		return nil
 	}
 
-	nodeMap := make(map[string]map[string]interface{})
+	nodeMap := make(map[string]headscale.Node)
 	for _, node := range nodes {
-		if nodeName, ok := node["name"].(string); ok {
-			cleanName := strings.TrimSuffix(nodeName, "$")
-			nodeMap[cleanName] = node
-		}
+		nodeMap[strings.TrimSuffix(node.Name, "$")] = node
 	}
 	return nodeMap
 }
-
-// extractIPFromNode extracts the first IPv4 address from a Headscale node
-func (s *ComputerService) extractIPFromNode(node map[string]interface{}) string {
-	if ipAddresses, ok := node["ip_addresses"].([]interface{}); ok {
-		for _, addr := range ipAddresses {
-			if addrStr, ok := addr.(string); ok {
-				// Return first IPv4 address (not IPv6)
-				if !strings.Contains(addrStr, ":") {
-					return addrStr
-				}
-			}
-		}
-	}
-	return ""
-}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/gpo"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// SysvolRoot is the local path of the SYSVOL share
+const SysvolRoot = "/var/lib/samba/sysvol"
+
+// GPOService handles group policy template business logic
+type GPOService struct {
+	sambaTool *exec.SambaTool
+	ldbTool   *exec.LdbTool
+}
+
+// NewGPOService creates a new GPOService instance
+func NewGPOService() *GPOService {
+	return &GPOService{
+		sambaTool: exec.NewSambaTool(),
+		ldbTool:   exec.NewLdbTool(),
+	}
+}
+
+// ListGPOs returns all group policy objects in the domain
+func (s *GPOService) ListGPOs() ([]models.GPO, error) {
+	output, err := s.sambaTool.GPOListAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GPOs: %s", output)
+	}
+	return parseGPOList(output), nil
+}
+
+// GetGPO finds a GPO by GUID or display name
+func (s *GPOService) GetGPO(id string) (*models.GPO, error) {
+	gpos, err := s.ListGPOs()
+	if err != nil {
+		return nil, err
+	}
+
+	guid := strings.Trim(id, "{}")
+	for _, g := range gpos {
+		if strings.EqualFold(strings.Trim(g.ID, "{}"), guid) || strings.EqualFold(g.Name, id) {
+			gpoCopy := g
+			return &gpoCopy, nil
+		}
+	}
+	return nil, fmt.Errorf("GPO not found: %s", id)
+}
+
+// ListTemplates returns the curated policy templates
+func (s *GPOService) ListTemplates() []gpo.TemplateInfo {
+	templates := gpo.Templates()
+	infos := make([]gpo.TemplateInfo, 0, len(templates))
+	for _, t := range templates {
+		infos = append(infos, t.Info())
+	}
+	return infos
+}
+
+// GetTemplateSettings reads every curated template back from a GPO
+func (s *GPOService) GetTemplateSettings(gpoID string) ([]models.GPOTemplateState, error) {
+	g, err := s.GetGPO(gpoID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := loadPolicyFiles(g.SysvolPath)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]models.GPOTemplateState, 0)
+	for _, t := range gpo.Templates() {
+		info := t.Info()
+		settings, configured := t.Read(files)
+		states = append(states, models.GPOTemplateState{
+			ID:          info.ID,
+			Name:        info.Name,
+			Description: info.Description,
+			Scope:       string(info.Scope),
+			Configured:  configured,
+			Settings:    settings,
+		})
+	}
+	return states, nil
+}
+
+// ApplyTemplate renders a template with the given settings into a GPO
+func (s *GPOService) ApplyTemplate(gpoID, templateID string, rawSettings json.RawMessage) error {
+	t, ok := gpo.LookupTemplate(templateID)
+	if !ok {
+		return fmt.Errorf("unknown template: %s", templateID)
+	}
+
+	settings := t.NewSettings()
+	if err := json.Unmarshal(rawSettings, settings); err != nil {
+		return fmt.Errorf("invalid settings for template %s: %v", templateID, err)
+	}
+
+	return s.updatePolicyFiles(gpoID, t, func(files *gpo.Files) error {
+		return t.Apply(files, settings)
+	})
+}
+
+// RemoveTemplate removes a template's settings from a GPO
+func (s *GPOService) RemoveTemplate(gpoID, templateID string) error {
+	t, ok := gpo.LookupTemplate(templateID)
+	if !ok {
+		return fmt.Errorf("unknown template: %s", templateID)
+	}
+
+	return s.updatePolicyFiles(gpoID, t, func(files *gpo.Files) error {
+		t.Remove(files)
+		return nil
+	})
+}
+
+// updatePolicyFiles loads a GPO's files, applies a change, writes back whatever
+// changed and bumps the GPO version so clients pick the change up
+func (s *GPOService) updatePolicyFiles(gpoID string, t gpo.Template, change func(files *gpo.Files) error) error {
+	g, err := s.GetGPO(gpoID)
+	if err != nil {
+		return err
+	}
+
+	files, err := loadPolicyFiles(g.SysvolPath)
+	if err != nil {
+		return err
+	}
+	before, err := encodePolicyFiles(files)
+	if err != nil {
+		return err
+	}
+
+	if err := change(files); err != nil {
+		return err
+	}
+	after, err := encodePolicyFiles(files)
+	if err != nil {
+		return err
+	}
+
+	machineChanged, userChanged := false, false
+	for path, data := range after {
+		if bytes.Equal(before[path], data) {
+			continue
+		}
+		fullPath := resolvePolicyPath(g.SysvolPath, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fmt.Errorf("failed to create policy directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		utils.Info("Wrote GPO file %s for %s", fullPath, g.Name)
+
+		if strings.HasPrefix(path, "Machine") {
+			machineChanged = true
+		} else {
+			userChanged = true
+		}
+	}
+
+	if !machineChanged && !userChanged {
+		return nil
+	}
+
+	if err := s.bumpVersion(g, machineChanged, userChanged); err != nil {
+		return err
+	}
+
+	info := t.Info()
+	extensionAttr := "gPCMachineExtensionNames"
+	if info.Scope == gpo.ScopeUser {
+		extensionAttr = "gPCUserExtensionNames"
+	}
+	if err := s.addExtension(g.DN, extensionAttr, info.Extension); err != nil {
+		return err
+	}
+
+	if output, err := s.sambaTool.NTACLSysvolReset(); err != nil {
+		utils.Warn("Failed to reset SYSVOL ACLs after GPO update: %s", output)
+	}
+
+	return nil
+}
+
+// bumpVersion increments the machine and/or user version in GPT.INI and on the GPO object
+func (s *GPOService) bumpVersion(g *models.GPO, machine, user bool) error {
+	gptPath := resolvePolicyPath(g.SysvolPath, "GPT.INI")
+	content, err := os.ReadFile(gptPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read GPT.INI: %v", err)
+	}
+
+	version := g.Version
+	versionRegex := regexp.MustCompile(`(?mi)^Version=(\d+)`)
+	if m := versionRegex.FindStringSubmatch(string(content)); len(m) > 1 {
+		version, _ = strconv.Atoi(m[1])
+	}
+
+	// Low word is the machine version, high word is the user version
+	machineVersion := version & 0xFFFF
+	userVersion := version >> 16
+	if machine {
+		machineVersion++
+	}
+	if user {
+		userVersion++
+	}
+	version = userVersion<<16 | machineVersion
+
+	var updated string
+	if versionRegex.Match(content) {
+		updated = versionRegex.ReplaceAllString(string(content), fmt.Sprintf("Version=%d", version))
+	} else {
+		updated = fmt.Sprintf("[General]\r\nVersion=%d\r\ndisplayName=%s\r\n", version, g.Name)
+	}
+	if err := os.WriteFile(gptPath, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("failed to write GPT.INI: %v", err)
+	}
+
+	if err := s.ldbTool.ReplaceAttribute(g.DN, "versionNumber", strconv.Itoa(version)); err != nil {
+		return fmt.Errorf("failed to update GPO version: %v", err)
+	}
+
+	g.Version = version
+	return nil
+}
+
+// addExtension registers a client-side extension on the GPO object
+func (s *GPOService) addExtension(dn, attribute, extension string) error {
+	entries, err := s.ldbTool.Search(dn, "(objectClass=groupPolicyContainer)", attribute)
+	if err != nil {
+		return err
+	}
+
+	existing := ""
+	if len(entries) > 0 {
+		existing = entries[0].Get(attribute)
+	}
+	merged := gpo.MergeExtensionNames(existing, extension)
+	if merged == existing {
+		return nil
+	}
+
+	if err := s.ldbTool.ReplaceAttribute(dn, attribute, merged); err != nil {
+		return fmt.Errorf("failed to update %s: %v", attribute, err)
+	}
+	return nil
+}
+
+// Policy file locations relative to the GPO directory
+const (
+	machineRegistryPath  = "Machine/Registry.pol"
+	userRegistryPath     = "User/Registry.pol"
+	securityTemplatePath = "Machine/Microsoft/Windows NT/SecEdit/GptTmpl.inf"
+	drivesPath           = "User/Preferences/Drives/Drives.xml"
+)
+
+// loadPolicyFiles reads the policy files templates operate on, treating missing files as empty
+func loadPolicyFiles(dir string) (*gpo.Files, error) {
+	read := func(path string) ([]byte, error) {
+		data, err := os.ReadFile(resolvePolicyPath(dir, path))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		return data, nil
+	}
+
+	files := &gpo.Files{}
+
+	data, err := read(machineRegistryPath)
+	if err != nil {
+		return nil, err
+	}
+	if files.MachineRegistry, err = gpo.ParseRegistryPol(data); err != nil {
+		return nil, fmt.Errorf("machine Registry.pol: %v", err)
+	}
+
+	if data, err = read(userRegistryPath); err != nil {
+		return nil, err
+	}
+	if files.UserRegistry, err = gpo.ParseRegistryPol(data); err != nil {
+		return nil, fmt.Errorf("user Registry.pol: %v", err)
+	}
+
+	if data, err = read(securityTemplatePath); err != nil {
+		return nil, err
+	}
+	files.SecurityTemplate = gpo.ParseSecurityTemplate(data)
+
+	if data, err = read(drivesPath); err != nil {
+		return nil, err
+	}
+	if files.Drives, err = gpo.ParseDrives(data); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// encodePolicyFiles renders the policy files keyed by relative path
+func encodePolicyFiles(files *gpo.Files) (map[string][]byte, error) {
+	drives, err := files.Drives.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Drives.xml: %v", err)
+	}
+	return map[string][]byte{
+		machineRegistryPath:  files.MachineRegistry.Bytes(),
+		userRegistryPath:     files.UserRegistry.Bytes(),
+		securityTemplatePath: files.SecurityTemplate.Bytes(),
+		drivesPath:           drives,
+	}, nil
+}
+
+// resolvePolicyPath joins a relative path onto the GPO directory, matching
+// existing directory entries case-insensitively (SYSVOL often uses MACHINE/USER)
+func resolvePolicyPath(dir, relative string) string {
+	current := dir
+	for _, part := range strings.Split(relative, "/") {
+		next := filepath.Join(current, part)
+		if entries, err := os.ReadDir(current); err == nil {
+			for _, entry := range entries {
+				if strings.EqualFold(entry.Name(), part) {
+					next = filepath.Join(current, entry.Name())
+					break
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// parseGPOList parses the output of samba-tool gpo listall
+func parseGPOList(output string) []models.GPO {
+	var gpos []models.GPO
+	var current *models.GPO
+
+	for _, raw := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(raw, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "GPO":
+			if current != nil {
+				gpos = append(gpos, *current)
+			}
+			current = &models.GPO{ID: value}
+		case "display name":
+			if current != nil {
+				current.Name = value
+			}
+		case "path":
+			if current != nil {
+				current.SysvolPath = sysvolLocalPath(value)
+			}
+		case "dn":
+			if current != nil {
+				current.DN = value
+			}
+		case "version":
+			if current != nil {
+				current.Version, _ = strconv.Atoi(value)
+			}
+		}
+	}
+	if current != nil {
+		gpos = append(gpos, *current)
+	}
+
+	return gpos
+}
+
+// sysvolLocalPath converts \\realm\sysvol\realm\Policies\{GUID} to its local path
+func sysvolLocalPath(uncPath string) string {
+	parts := strings.Split(strings.TrimLeft(uncPath, `\`), `\`)
+	for i, part := range parts {
+		if strings.EqualFold(part, "sysvol") {
+			return filepath.Join(append([]string{SysvolRoot}, parts[i+1:]...)...)
+		}
+	}
+	return uncPath
+}
@@ -5,17 +5,20 @@ import (
 
 	"github.com/griffinwebnet/vexa/api/exec"
 	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
 )
 
 // GroupService handles group-related business logic
 type GroupService struct {
-	sambaTool *exec.SambaTool
+	sambaTool    *exec.SambaTool
+	posixService *PosixService
 }
 
 // NewGroupService creates a new GroupService instance
 func NewGroupService() *GroupService {
 	return &GroupService{
-		sambaTool: exec.NewSambaTool(),
+		sambaTool:    exec.NewSambaTool(),
+		posixService: NewPosixService(),
 	}
 }
 
@@ -50,6 +53,13 @@ func (s *GroupService) CreateGroup(req models.CreateGroupRequest) error {
 		return fmt.Errorf("failed to create group: %s", output)
 	}
 
+	// Assign a gidNumber when auto-assignment is on or one was supplied
+	if req.GIDNumber != nil || s.posixService.AutoAssignEnabled() {
+		if _, err := s.posixService.AssignGroup(req.Name, req.GIDNumber); err != nil {
+			utils.Warn("Failed to assign gidNumber for group %s: %v", req.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -63,8 +73,9 @@ func (s *GroupService) GetGroup(groupName string) (*models.Group, error) {
 	members := s.sambaTool.ParseGroupMembers(output)
 
 	group := &models.Group{
-		Name:    groupName,
-		Members: members,
+		Name:      groupName,
+		Members:   members,
+		GIDNumber: s.posixService.GroupGID(groupName),
 	}
 
 	return group, nil
@@ -82,6 +93,13 @@ func (s *GroupService) UpdateGroup(groupName string, req models.UpdateGroupReque
 		}
 	}
 
+	// Update gidNumber if provided
+	if req.GIDNumber != nil {
+		if err := s.posixService.UpdateGroup(groupName, *req.GIDNumber); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -91,6 +109,7 @@ func (s *GroupService) DeleteGroup(groupName string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete group: %s", output)
 	}
+	TriggerOverlayPolicySync()
 	return nil
 }
 
@@ -100,6 +119,7 @@ func (s *GroupService) AddGroupMembers(groupName string, req models.AddGroupMemb
 	if err != nil {
 		return fmt.Errorf("failed to add members to group: %s", output)
 	}
+	TriggerOverlayPolicySync()
 	return nil
 }
 
@@ -109,5 +129,6 @@ func (s *GroupService) RemoveGroupMembers(groupName string, req models.RemoveGro
 	if err != nil {
 		return fmt.Errorf("failed to remove members from group: %s", output)
 	}
+	TriggerOverlayPolicySync()
 	return nil
 }
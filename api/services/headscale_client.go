@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	vexaexec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const (
+	// headscaleAPIKeyPath holds the API key Vexa generates during setup
+	headscaleAPIKeyPath = "/etc/vexa/headscale-api-key"
+
+	// headscaleAPIKeyExpiration is how long generated API keys are valid
+	headscaleAPIKeyExpiration = "87600h"
+
+	// headscaleAPIKeyRotationWindow is how long after replacing a rejected
+	// API key Vexa refuses to replace it again, so repeated failures don't
+	// pile up keys
+	headscaleAPIKeyRotationWindow = 5 * time.Minute
+)
+
+var (
+	headscaleAPIKeyMutex sync.Mutex
+
+	// headscaleAPIKeyRotatedAt is when a rejected API key was last replaced
+	headscaleAPIKeyRotatedAt time.Time
+)
+
+// headscaleClient returns a client for the local Headscale API. Tests replace
+// it with one for a headscaletest.Server.
+var headscaleClient = localHeadscaleClient
+
+// localHeadscaleClient returns a client for the Headscale API on this server.
+// An API key is generated when none was stored yet, e.g. on installs set up
+// before Vexa used the API, and when Headscale rejects the stored one.
+func localHeadscaleClient() (*headscale.Client, error) {
+	baseURL, err := headscaleAPIURL()
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := ensureHeadscaleAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	client := headscale.NewClient(baseURL, apiKey)
+	client.OnUnauthorized(rotateHeadscaleAPIKey)
+	return client, nil
+}
+
+// headscaleAPIURL returns the local address of Headscale's API, which is
+// served on its listen address
+func headscaleAPIURL() (string, error) {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return "", err
+	}
+	host, port, err := net.SplitHostPort(config.ListenAddr)
+	if err != nil {
+		return "", fmt.Errorf("invalid headscale listen_addr %q", config.ListenAddr)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// ensureHeadscaleAPIKey returns the stored API key, creating and storing one
+// with the headscale CLI when there is none
+func ensureHeadscaleAPIKey() (string, error) {
+	headscaleAPIKeyMutex.Lock()
+	defer headscaleAPIKeyMutex.Unlock()
+
+	key, err := readHeadscaleAPIKey()
+	if err != nil || key != "" {
+		return key, err
+	}
+	return replaceHeadscaleAPIKey("")
+}
+
+// rotateHeadscaleAPIKey replaces an API key Headscale rejected. When another
+// client already replaced it, the stored key is returned instead. A rejected
+// key is replaced at most once per headscaleAPIKeyRotationWindow.
+func rotateHeadscaleAPIKey(rejected string) (string, error) {
+	headscaleAPIKeyMutex.Lock()
+	defer headscaleAPIKeyMutex.Unlock()
+
+	key, err := readHeadscaleAPIKey()
+	if err != nil {
+		return "", err
+	}
+	if key != "" && key != rejected {
+		return key, nil
+	}
+	if next := headscaleAPIKeyRotatedAt.Add(headscaleAPIKeyRotationWindow); time.Now().Before(next) {
+		return "", fmt.Errorf("headscale rejected the API key created at %s; not creating another before %s",
+			headscaleAPIKeyRotatedAt.Format(time.RFC3339), next.Format(time.RFC3339))
+	}
+
+	key, err = replaceHeadscaleAPIKey(key)
+	if err != nil {
+		return "", err
+	}
+	headscaleAPIKeyRotatedAt = time.Now()
+	utils.Warn("Headscale rejected the stored API key; replaced it with a new one")
+	return key, nil
+}
+
+// resetHeadscaleAPIKey replaces the stored API key regardless of whether
+// Headscale accepts it, as setup does for a freshly configured server
+func resetHeadscaleAPIKey() (string, error) {
+	headscaleAPIKeyMutex.Lock()
+	defer headscaleAPIKeyMutex.Unlock()
+
+	key, err := readHeadscaleAPIKey()
+	if err != nil {
+		return "", err
+	}
+	return replaceHeadscaleAPIKey(key)
+}
+
+// replaceHeadscaleAPIKey creates an API key, expires the previous one and
+// stores the new one. Callers hold headscaleAPIKeyMutex.
+func replaceHeadscaleAPIKey(previous string) (string, error) {
+	tool := vexaexec.NewHeadscaleTool()
+	key, err := tool.CreateAPIKey(headscaleAPIKeyExpiration)
+	if err != nil {
+		return "", err
+	}
+
+	// A rejected key has usually expired or been removed already, so failing
+	// to expire it does not stop the new key from being stored
+	if previous != "" {
+		if prefix := headscaleAPIKeyPrefix(previous); prefix == "" {
+			utils.Warn("Cannot expire the previous headscale API key: unrecognised key format")
+		} else if err := tool.ExpireAPIKey(prefix); err != nil {
+			utils.Warn("Failed to expire the previous headscale API key %s: %v", prefix, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(headscaleAPIKeyPath), 0700); err != nil {
+		return "", fmt.Errorf("failed to create settings directory: %v", err)
+	}
+	if err := os.WriteFile(headscaleAPIKeyPath, []byte(key+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to save headscale API key: %v", err)
+	}
+	return key, nil
+}
+
+// readHeadscaleAPIKey returns the stored API key, or "" when none is stored
+func readHeadscaleAPIKey() (string, error) {
+	data, err := os.ReadFile(headscaleAPIKeyPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read headscale API key: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// headscaleAPIKeyPrefix returns the prefix headscale identifies an API key
+// by, which is the part before the dot
+func headscaleAPIKeyPrefix(key string) string {
+	prefix, _, found := strings.Cut(key, ".")
+	if !found {
+		return ""
+	}
+	return prefix
+}
+
+// waitForHeadscaleAPI waits for Headscale's API to answer after a restart
+func waitForHeadscaleAPI() error {
+	client, err := headscaleClient()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 15; i++ {
+		if err = client.Health(); err == nil {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("headscale API did not come back after restart: %v", err)
+}
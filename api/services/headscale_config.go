@@ -0,0 +1,686 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	headscaleConfigFile = "/etc/headscale/config.yaml"
+	// headscalePendingConfigFile holds a candidate config while it is tested
+	headscalePendingConfigFile = "/etc/headscale/config.pending.yaml"
+
+	// minEphemeralInactivityTimeout is the shortest timeout Headscale accepts
+	minEphemeralInactivityTimeout = 65 * time.Second
+)
+
+var (
+	// headscaleConfigMutex serializes read-modify-write cycles of the config
+	headscaleConfigMutex sync.Mutex
+
+	// dnsNameRegex matches a DNS domain name
+	dnsNameRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+	// headscaleV4Range and headscaleV6Range bound the prefixes Headscale
+	// allocates node addresses from
+	_, headscaleV4Range, _ = net.ParseCIDR("100.64.0.0/10")
+	_, headscaleV6Range, _ = net.ParseCIDR("fd7a:115c:a1e0::/48")
+)
+
+// headscaleConfig is the part of Headscale's config.yaml Vexa manages. Keys
+// not listed here are left untouched when the config is rewritten.
+type headscaleConfig struct {
+	ServerURL         string `yaml:"server_url"`
+	ListenAddr        string `yaml:"listen_addr"`
+	MetricsListenAddr string `yaml:"metrics_listen_addr"`
+	GRPCListenAddr    string `yaml:"grpc_listen_addr"`
+	GRPCAllowInsecure bool   `yaml:"grpc_allow_insecure"`
+
+	Noise struct {
+		PrivateKeyPath string `yaml:"private_key_path"`
+	} `yaml:"noise"`
+
+	Prefixes struct {
+		V4         string `yaml:"v4"`
+		V6         string `yaml:"v6"`
+		Allocation string `yaml:"allocation"`
+	} `yaml:"prefixes"`
+
+	DERP headscaleDERPConfig `yaml:"derp"`
+
+	DisableCheckUpdates            bool   `yaml:"disable_check_updates"`
+	EphemeralNodeInactivityTimeout string `yaml:"ephemeral_node_inactivity_timeout"`
+
+	Database struct {
+		Type  string `yaml:"type"`
+		Debug bool   `yaml:"debug"`
+		Gorm  struct {
+			PrepareStmt           bool `yaml:"prepare_stmt"`
+			ParameterizedQueries  bool `yaml:"parameterized_queries"`
+			SkipErrRecordNotFound bool `yaml:"skip_err_record_not_found"`
+			SlowThreshold         int  `yaml:"slow_threshold"`
+		} `yaml:"gorm"`
+		SQLite struct {
+			Path              string `yaml:"path"`
+			WriteAheadLog     bool   `yaml:"write_ahead_log"`
+			WALAutocheckpoint int    `yaml:"wal_autocheckpoint"`
+		} `yaml:"sqlite"`
+	} `yaml:"database"`
+
+	Log struct {
+		Format string `yaml:"format"`
+		Level  string `yaml:"level"`
+	} `yaml:"log"`
+
+	Policy struct {
+		Mode string `yaml:"mode"`
+		Path string `yaml:"path"`
+	} `yaml:"policy"`
+
+	DNS headscaleDNSConfig `yaml:"dns"`
+
+	UnixSocket           string `yaml:"unix_socket"`
+	UnixSocketPermission string `yaml:"unix_socket_permission"`
+
+	Logtail struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"logtail"`
+
+	RandomizeClientPort bool `yaml:"randomize_client_port"`
+
+	OIDC *headscaleOIDCBlock `yaml:"oidc,omitempty"`
+}
+
+// headscaleDERPConfig is the derp section of Headscale's config
+type headscaleDERPConfig struct {
+	Server            headscaleDERPServer `yaml:"server"`
+	URLs              []string            `yaml:"urls"`
+	Paths             []string            `yaml:"paths"` // DERP map files
+	AutoUpdateEnabled bool                `yaml:"auto_update_enabled"`
+	UpdateFrequency   string              `yaml:"update_frequency"`
+}
+
+// headscaleDERPServer configures Headscale's embedded DERP relay, which is
+// served on server_url, and its STUN listener
+type headscaleDERPServer struct {
+	Enabled                            bool   `yaml:"enabled"`
+	RegionID                           int    `yaml:"region_id,omitempty"`
+	RegionCode                         string `yaml:"region_code,omitempty"`
+	RegionName                         string `yaml:"region_name,omitempty"`
+	VerifyClients                      bool   `yaml:"verify_clients,omitempty"`
+	STUNListenAddr                     string `yaml:"stun_listen_addr,omitempty"`
+	PrivateKeyPath                     string `yaml:"private_key_path,omitempty"`
+	AutomaticallyAddEmbeddedDERPRegion bool   `yaml:"automatically_add_embedded_derp_region,omitempty"`
+	IPv4                               string `yaml:"ipv4,omitempty"`
+	IPv6                               string `yaml:"ipv6,omitempty"`
+}
+
+// headscaleDNSConfig is the dns section of Headscale's config
+type headscaleDNSConfig struct {
+	MagicDNS         bool   `yaml:"magic_dns"`
+	BaseDomain       string `yaml:"base_domain"`
+	OverrideLocalDNS bool   `yaml:"override_local_dns"`
+	Nameservers      struct {
+		Global []string            `yaml:"global"`
+		Split  map[string][]string `yaml:"split"`
+	} `yaml:"nameservers"`
+	SearchDomains    []string               `yaml:"search_domains"`
+	ExtraRecords     []headscaleExtraRecord `yaml:"extra_records,omitempty"`
+	ExtraRecordsPath string                 `yaml:"extra_records_path,omitempty"` // JSON file Headscale watches, used instead of extra_records
+}
+
+// headscaleExtraRecord is a DNS record Headscale serves to nodes
+type headscaleExtraRecord struct {
+	Name  string `yaml:"name" json:"name"`
+	Type  string `yaml:"type" json:"type"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// defaultHeadscaleConfig returns the config Vexa sets Headscale up with
+func defaultHeadscaleConfig(fqdn, netbiosDomain, realm, serverHostname string) *headscaleConfig {
+	config := &headscaleConfig{
+		ServerURL:                      "http://" + fqdn + ":50443",
+		ListenAddr:                     "0.0.0.0:50443",
+		MetricsListenAddr:              "127.0.0.1:9090",
+		GRPCListenAddr:                 "127.0.0.1:50444",
+		GRPCAllowInsecure:              true,
+		EphemeralNodeInactivityTimeout: "30m",
+		UnixSocket:                     "/var/run/headscale/headscale.sock",
+		UnixSocketPermission:           "0770",
+	}
+	config.Noise.PrivateKeyPath = "/var/lib/headscale/noise_private.key"
+
+	config.Prefixes.V4 = "100.64.0.0/10"
+	config.Prefixes.V6 = "fd7a:115c:a1e0::/48"
+	config.Prefixes.Allocation = "sequential"
+
+	config.DERP.URLs = []string{"https://controlplane.tailscale.com/derpmap/default"}
+	config.DERP.AutoUpdateEnabled = true
+	config.DERP.UpdateFrequency = "24h"
+
+	config.Database.Type = "sqlite"
+	config.Database.Gorm.PrepareStmt = true
+	config.Database.Gorm.ParameterizedQueries = true
+	config.Database.Gorm.SkipErrRecordNotFound = true
+	config.Database.Gorm.SlowThreshold = 1000
+	config.Database.SQLite.Path = "/var/lib/headscale/db.sqlite"
+	config.Database.SQLite.WriteAheadLog = true
+	config.Database.SQLite.WALAutocheckpoint = 1000
+
+	config.Log.Format = "text"
+	config.Log.Level = "info"
+
+	// The policy is set through the API, which needs it kept in the database
+	config.Policy.Mode = "database"
+
+	// The DC answers for the realm on the overlay at the first node address
+	config.DNS.MagicDNS = true
+	config.DNS.BaseDomain = netbiosDomain + ".mesh"
+	config.DNS.OverrideLocalDNS = true
+	config.DNS.Nameservers.Global = []string{"1.1.1.1", "8.8.8.8"}
+	config.DNS.Nameservers.Split = map[string][]string{realm: {"100.64.0.1"}}
+	config.DNS.SearchDomains = []string{realm, netbiosDomain + ".mesh", netbiosDomain}
+	config.DNS.ExtraRecords = []headscaleExtraRecord{
+		{Name: realm, Type: "A", Value: "100.64.0.1"},
+		{Name: netbiosDomain, Type: "A", Value: "100.64.0.1"},
+		{Name: serverHostname + "." + realm, Type: "A", Value: "100.64.0.1"},
+	}
+	return config
+}
+
+// GetConfig returns the editable Headscale settings
+func (s *HeadscaleService) GetConfig() (*models.HeadscaleSettings, error) {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return nil, err
+	}
+	return headscaleSettings(config), nil
+}
+
+// UpdateConfig validates and applies changes to the Headscale settings
+func (s *HeadscaleService) UpdateConfig(req models.UpdateHeadscaleSettingsRequest) (*models.HeadscaleSettings, error) {
+	config, err := s.applyHeadscaleConfig(func(config *headscaleConfig) error {
+		return applyHeadscaleSettings(config, req)
+	}, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return headscaleSettings(config), nil
+}
+
+// applyHeadscaleConfig applies edit to Headscale's config. The new config is
+// tested by headscale before it replaces the current one, and Headscale is
+// restarted to load it, also when only files the config refers to changed.
+// If Headscale fails to restart, the previous config is restored, restore
+// is called to put back those files, and Headscale is restarted again.
+func (s *HeadscaleService) applyHeadscaleConfig(edit func(config *headscaleConfig) error, filesChanged bool, restore func()) (*headscaleConfig, error) {
+	headscaleConfigMutex.Lock()
+	defer headscaleConfigMutex.Unlock()
+
+	previous, err := os.ReadFile(headscaleConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read headscale config: %v", err)
+	}
+
+	var updated *headscaleConfig
+	data, changed, err := renderHeadscaleConfig(previous, func(config *headscaleConfig) error {
+		if err := edit(config); err != nil {
+			return err
+		}
+		updated = config
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !changed && !filesChanged {
+		return updated, nil
+	}
+
+	if err := os.WriteFile(headscalePendingConfigFile, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write headscale config: %v", err)
+	}
+	if output, err := s.headscaleTool.TestConfig(headscalePendingConfigFile); err != nil {
+		os.Remove(headscalePendingConfigFile)
+		return nil, fmt.Errorf("headscale rejected the config: %s", strings.TrimSpace(output))
+	}
+	if err := os.Rename(headscalePendingConfigFile, headscaleConfigFile); err != nil {
+		return nil, fmt.Errorf("failed to install headscale config: %v", err)
+	}
+
+	if err := restartHeadscale(); err != nil {
+		utils.Error("Headscale failed to restart with the new config, restoring the previous one: %v", err)
+		if writeErr := os.WriteFile(headscaleConfigFile, previous, 0644); writeErr != nil {
+			return nil, fmt.Errorf("%v; restoring the previous config failed: %v", err, writeErr)
+		}
+		if restore != nil {
+			restore()
+		}
+		if restartErr := restartHeadscale(); restartErr != nil {
+			return nil, fmt.Errorf("%v; restarting with the previous config failed: %v", err, restartErr)
+		}
+		return nil, fmt.Errorf("%v; the previous config was restored", err)
+	}
+	return updated, nil
+}
+
+// loadHeadscaleConfig reads Headscale's config
+func loadHeadscaleConfig() (*headscaleConfig, error) {
+	data, err := os.ReadFile(headscaleConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read headscale config: %v", err)
+	}
+	config := &headscaleConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse headscale config: %v", err)
+	}
+	return config, nil
+}
+
+// updateHeadscaleConfig applies edit to Headscale's config and writes it
+// back when something changed. A missing config is created from scratch.
+// Headscale has to be restarted to pick up the change.
+func updateHeadscaleConfig(edit func(config *headscaleConfig) error) error {
+	headscaleConfigMutex.Lock()
+	defer headscaleConfigMutex.Unlock()
+
+	current, err := os.ReadFile(headscaleConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read headscale config: %v", err)
+	}
+	data, changed, err := renderHeadscaleConfig(current, edit)
+	if err != nil || !changed {
+		return err
+	}
+	if err := os.WriteFile(headscaleConfigFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write headscale config: %v", err)
+	}
+	return nil
+}
+
+// renderHeadscaleConfig applies edit to the config in current and returns
+// the resulting document. Only keys whose value edit changed are rewritten,
+// so unknown keys, comments and settings Vexa leaves alone survive. Empty
+// current yields a complete config.
+func renderHeadscaleConfig(current []byte, edit func(config *headscaleConfig) error) ([]byte, bool, error) {
+	before := &headscaleConfig{}
+	after := &headscaleConfig{}
+	var doc yaml.Node
+	if len(bytes.TrimSpace(current)) > 0 {
+		if err := yaml.Unmarshal(current, &doc); err != nil {
+			return nil, false, fmt.Errorf("failed to parse headscale config: %v", err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return nil, false, fmt.Errorf("unexpected headscale config layout")
+		}
+		if err := doc.Decode(before); err != nil {
+			return nil, false, fmt.Errorf("failed to parse headscale config: %v", err)
+		}
+		if err := doc.Decode(after); err != nil {
+			return nil, false, fmt.Errorf("failed to parse headscale config: %v", err)
+		}
+	}
+
+	if err := edit(after); err != nil {
+		return nil, false, err
+	}
+
+	var beforeNode, afterNode yaml.Node
+	if err := beforeNode.Encode(before); err != nil {
+		return nil, false, err
+	}
+	if err := afterNode.Encode(after); err != nil {
+		return nil, false, err
+	}
+
+	changed := true
+	if len(doc.Content) == 0 {
+		afterNode.HeadComment = "Vexa Mesh Configuration"
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&afterNode}}
+	} else {
+		changed = mergeYAMLChanges(doc.Content[0], &beforeNode, &afterNode)
+	}
+	if !changed {
+		return current, false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, false, fmt.Errorf("failed to encode headscale config: %v", err)
+	}
+	encoder.Close()
+	return buf.Bytes(), true, nil
+}
+
+// mergeYAMLChanges copies into target the keys whose value differs between
+// the before and after mappings, recursing into nested mappings, and removes
+// keys after dropped. It reports whether target changed.
+func mergeYAMLChanges(target, before, after *yaml.Node) bool {
+	changed := false
+	for i := 0; i+1 < len(after.Content); i += 2 {
+		key, value := after.Content[i].Value, after.Content[i+1]
+		old := yamlMapValue(before, key)
+		if old != nil && yamlEqual(old, value) {
+			continue
+		}
+		existing := yamlMapValue(target, key)
+		if old != nil && existing != nil && old.Kind == yaml.MappingNode &&
+			value.Kind == yaml.MappingNode && existing.Kind == yaml.MappingNode {
+			changed = mergeYAMLChanges(existing, old, value) || changed
+			continue
+		}
+		setYAMLValue(target, key, value)
+		changed = true
+	}
+	for i := 0; i+1 < len(before.Content); i += 2 {
+		key := before.Content[i].Value
+		if yamlMapValue(after, key) == nil && removeYAMLKey(target, key) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// yamlEqual reports whether two nodes encode the same value
+func yamlEqual(a, b *yaml.Node) bool {
+	left, errA := yaml.Marshal(a)
+	right, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(left, right)
+}
+
+// yamlMapValue returns the value node of key in a mapping node
+func yamlMapValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setYAMLValue sets key in a mapping node, keeping the comments of a value
+// it replaces
+func setYAMLValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			old := mapping.Content[i+1]
+			value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// removeYAMLKey removes key from a mapping node and reports whether it was present
+func removeYAMLKey(mapping *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// restartHeadscale restarts the Headscale service so it reloads its config
+func restartHeadscale() error {
+	cmd, err := utils.SafeCommand("systemctl", "restart", "headscale")
+	if err != nil {
+		return fmt.Errorf("command sanitization failed: %v", err)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restart headscale: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// headscaleSettings returns the editable view of a config
+func headscaleSettings(config *headscaleConfig) *models.HeadscaleSettings {
+	settings := &models.HeadscaleSettings{
+		ServerURL:                      config.ServerURL,
+		ListenAddr:                     config.ListenAddr,
+		PrefixV4:                       config.Prefixes.V4,
+		PrefixV6:                       config.Prefixes.V6,
+		Allocation:                     config.Prefixes.Allocation,
+		LogLevel:                       config.Log.Level,
+		MagicDNS:                       config.DNS.MagicDNS,
+		BaseDomain:                     config.DNS.BaseDomain,
+		OverrideLocalDNS:               config.DNS.OverrideLocalDNS,
+		Nameservers:                    nonNilStrings(config.DNS.Nameservers.Global),
+		SplitNameservers:               config.DNS.Nameservers.Split,
+		SearchDomains:                  nonNilStrings(config.DNS.SearchDomains),
+		DERPURLs:                       nonNilStrings(config.DERP.URLs),
+		DERPAutoUpdate:                 config.DERP.AutoUpdateEnabled,
+		DERPUpdateFrequency:            config.DERP.UpdateFrequency,
+		EphemeralNodeInactivityTimeout: config.EphemeralNodeInactivityTimeout,
+		RandomizeClientPort:            config.RandomizeClientPort,
+	}
+	if settings.SplitNameservers == nil {
+		settings.SplitNameservers = map[string][]string{}
+	}
+	return settings
+}
+
+// applyHeadscaleSettings validates the requested changes and applies them
+// to config
+func applyHeadscaleSettings(config *headscaleConfig, req models.UpdateHeadscaleSettingsRequest) error {
+	if req.ServerURL != nil {
+		serverURL := strings.TrimRight(strings.TrimSpace(*req.ServerURL), "/")
+		parsed, err := url.Parse(serverURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			parsed.RawQuery != "" || parsed.Fragment != "" {
+			return fmt.Errorf("server_url must be an http or https URL")
+		}
+		config.ServerURL = serverURL
+	}
+	if req.ListenAddr != nil {
+		if err := validateListenAddr(*req.ListenAddr); err != nil {
+			return err
+		}
+		config.ListenAddr = strings.TrimSpace(*req.ListenAddr)
+	}
+	if req.PrefixV4 != nil {
+		prefix, err := overlayPrefix(*req.PrefixV4, headscaleV4Range)
+		if err != nil {
+			return err
+		}
+		config.Prefixes.V4 = prefix
+	}
+	if req.PrefixV6 != nil {
+		prefix, err := overlayPrefix(*req.PrefixV6, headscaleV6Range)
+		if err != nil {
+			return err
+		}
+		config.Prefixes.V6 = prefix
+	}
+	if config.Prefixes.V4 == "" && config.Prefixes.V6 == "" {
+		return fmt.Errorf("at least one of prefix_v4 and prefix_v6 is required")
+	}
+	if req.Allocation != nil {
+		if *req.Allocation != "sequential" && *req.Allocation != "random" {
+			return fmt.Errorf("allocation must be sequential or random")
+		}
+		config.Prefixes.Allocation = *req.Allocation
+	}
+	if req.LogLevel != nil {
+		switch *req.LogLevel {
+		case "trace", "debug", "info", "warn", "error", "fatal", "panic":
+			config.Log.Level = *req.LogLevel
+		default:
+			return fmt.Errorf("log_level must be one of trace, debug, info, warn, error, fatal or panic")
+		}
+	}
+
+	if req.MagicDNS != nil {
+		config.DNS.MagicDNS = *req.MagicDNS
+	}
+	if req.BaseDomain != nil {
+		config.DNS.BaseDomain = strings.ToLower(strings.TrimSpace(*req.BaseDomain))
+	}
+	if config.DNS.BaseDomain != "" && !dnsNameRegex.MatchString(config.DNS.BaseDomain) {
+		return fmt.Errorf("invalid base_domain %q", config.DNS.BaseDomain)
+	}
+	if config.DNS.MagicDNS && config.DNS.BaseDomain == "" {
+		return fmt.Errorf("base_domain is required when MagicDNS is enabled")
+	}
+	if parsed, err := url.Parse(config.ServerURL); err == nil && config.DNS.BaseDomain != "" {
+		host := strings.ToLower(parsed.Hostname())
+		if host == config.DNS.BaseDomain || strings.HasSuffix(host, "."+config.DNS.BaseDomain) {
+			return fmt.Errorf("base_domain must not contain the server_url host %s", host)
+		}
+	}
+	if req.OverrideLocalDNS != nil {
+		config.DNS.OverrideLocalDNS = *req.OverrideLocalDNS
+	}
+	if req.Nameservers != nil {
+		nameservers, err := normalizeNameservers(*req.Nameservers, true)
+		if err != nil {
+			return err
+		}
+		config.DNS.Nameservers.Global = nameservers
+	}
+	if config.DNS.OverrideLocalDNS && len(config.DNS.Nameservers.Global) == 0 {
+		return fmt.Errorf("at least one nameserver is required when override_local_dns is enabled")
+	}
+	if req.SplitNameservers != nil {
+		split := make(map[string][]string, len(*req.SplitNameservers))
+		for domain, resolvers := range *req.SplitNameservers {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			if !dnsNameRegex.MatchString(domain) {
+				return fmt.Errorf("invalid split DNS domain %q", domain)
+			}
+			normalized, err := normalizeNameservers(resolvers, false)
+			if err != nil {
+				return err
+			}
+			if len(normalized) == 0 {
+				return fmt.Errorf("split DNS domain %s needs at least one nameserver", domain)
+			}
+			split[domain] = normalized
+		}
+		config.DNS.Nameservers.Split = split
+	}
+	if req.SearchDomains != nil {
+		domains := make([]string, 0, len(*req.SearchDomains))
+		for _, domain := range *req.SearchDomains {
+			domain = strings.TrimSpace(domain)
+			if !dnsNameRegex.MatchString(domain) {
+				return fmt.Errorf("invalid search domain %q", domain)
+			}
+			domains = append(domains, domain)
+		}
+		config.DNS.SearchDomains = domains
+	}
+
+	if req.DERPURLs != nil {
+		urls := make([]string, 0, len(*req.DERPURLs))
+		for _, raw := range *req.DERPURLs {
+			raw = strings.TrimSpace(raw)
+			parsed, err := url.Parse(raw)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("invalid DERP map URL %q", raw)
+			}
+			urls = append(urls, raw)
+		}
+		config.DERP.URLs = urls
+	}
+	if len(config.DERP.URLs) == 0 && len(config.DERP.Paths) == 0 && !config.DERP.Server.Enabled {
+		return fmt.Errorf("at least one DERP map URL is required without custom regions or the embedded DERP server")
+	}
+	if req.DERPAutoUpdate != nil {
+		config.DERP.AutoUpdateEnabled = *req.DERPAutoUpdate
+	}
+	if req.DERPUpdateFrequency != nil {
+		frequency, err := time.ParseDuration(*req.DERPUpdateFrequency)
+		if err != nil || frequency < time.Minute {
+			return fmt.Errorf("derp_update_frequency must be a duration of at least 1m")
+		}
+		config.DERP.UpdateFrequency = *req.DERPUpdateFrequency
+	}
+	if req.EphemeralNodeInactivityTimeout != nil {
+		timeout, err := time.ParseDuration(*req.EphemeralNodeInactivityTimeout)
+		if err != nil || timeout < minEphemeralInactivityTimeout {
+			return fmt.Errorf("ephemeral_node_inactivity_timeout must be a duration of at least %s", minEphemeralInactivityTimeout)
+		}
+		config.EphemeralNodeInactivityTimeout = *req.EphemeralNodeInactivityTimeout
+	}
+	if req.RandomizeClientPort != nil {
+		config.RandomizeClientPort = *req.RandomizeClientPort
+	}
+	return nil
+}
+
+// validateListenAddr checks a host:port listen address
+func validateListenAddr(addr string) error {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		return fmt.Errorf("listen_addr must be host:port")
+	}
+	if host != "" && net.ParseIP(host) == nil {
+		return fmt.Errorf("listen_addr host must be an IP address")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("listen_addr port must be between 1 and 65535")
+	}
+	return nil
+}
+
+// overlayPrefix normalizes a node address prefix, which has to lie within
+// the range Tailscale clients accept
+func overlayPrefix(value string, within *net.IPNet) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	ip, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid prefix %q", value)
+	}
+	rangeOnes, _ := within.Mask.Size()
+	ones, _ := network.Mask.Size()
+	if !within.Contains(ip) || ones < rangeOnes {
+		return "", fmt.Errorf("prefix %s must lie within %s", value, within)
+	}
+	return network.String(), nil
+}
+
+// normalizeNameservers checks a list of resolvers. Global resolvers may also
+// be DNS-over-HTTPS URLs.
+func normalizeNameservers(values []string, allowDoH bool) ([]string, error) {
+	nameservers := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if ip := net.ParseIP(value); ip != nil {
+			nameservers = append(nameservers, ip.String())
+			continue
+		}
+		if parsed, err := url.Parse(value); allowDoH && err == nil && parsed.Scheme == "https" && parsed.Host != "" {
+			nameservers = append(nameservers, value)
+			continue
+		}
+		return nil, fmt.Errorf("invalid nameserver %q", value)
+	}
+	return nameservers, nil
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
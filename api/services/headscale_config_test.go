@@ -0,0 +1,175 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sampleHeadscaleConfig is an edited config.yaml with keys Vexa does not
+// manage at the top level and inside the sections it does
+const sampleHeadscaleConfig = `# Vexa Mesh Configuration
+server_url: https://mesh.example.com
+listen_addr: 0.0.0.0:8080
+tls_cert_path: /etc/ssl/vexa.crt # Added by hand
+
+# Logging
+log:
+  format: text
+  # Raise while debugging
+  level: info # Keep at info in production
+dns:
+  magic_dns: true
+  base_domain: example.mesh
+  use_username_in_magic_dns: true
+  extra_records:
+    - name: fs1.example.mesh
+      type: A
+      value: 100.64.0.5
+oidc:
+  issuer: https://login.example.com
+  client_id: vexa
+  allowed_groups:
+    - mesh-users
+  expiry: 180d
+`
+
+func TestRenderHeadscaleConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(config *headscaleConfig)
+		changed bool
+		want    []string // Lines that must be in the result
+		missing []string // Text that must not be
+	}{
+		{
+			name:    "no change",
+			edit:    func(config *headscaleConfig) {},
+			changed: false,
+		},
+		{
+			name: "unknown top-level keys",
+			edit: func(config *headscaleConfig) {
+				config.ServerURL = "https://vpn.example.com"
+			},
+			changed: true,
+			want: []string{
+				"server_url: https://vpn.example.com",
+				"tls_cert_path: /etc/ssl/vexa.crt # Added by hand",
+			},
+			missing: []string{"mesh.example.com"},
+		},
+		{
+			name: "unknown keys under dns",
+			edit: func(config *headscaleConfig) {
+				config.DNS.BaseDomain = "corp.mesh"
+			},
+			changed: true,
+			want: []string{
+				"  base_domain: corp.mesh",
+				"  use_username_in_magic_dns: true",
+				"    - name: fs1.example.mesh",
+			},
+		},
+		{
+			name: "unknown keys under oidc",
+			edit: func(config *headscaleConfig) {
+				config.OIDC.Issuer = "https://sso.example.com"
+				config.OIDC.Scope = []string{"openid", "profile"}
+			},
+			changed: true,
+			want: []string{
+				"  issuer: https://sso.example.com",
+				"  allowed_groups:",
+				"    - mesh-users",
+				"  expiry: 180d",
+				"    - openid",
+			},
+		},
+		{
+			name: "comments",
+			edit: func(config *headscaleConfig) {
+				config.Log.Level = "debug"
+			},
+			changed: true,
+			want: []string{
+				"# Vexa Mesh Configuration",
+				"# Logging",
+				"  # Raise while debugging",
+				"  level: debug # Keep at info in production",
+			},
+		},
+		{
+			name: "key removal",
+			edit: func(config *headscaleConfig) {
+				config.OIDC = nil
+				config.DNS.ExtraRecords = nil
+			},
+			changed: true,
+			want: []string{
+				"tls_cert_path: /etc/ssl/vexa.crt # Added by hand",
+				"  use_username_in_magic_dns: true",
+			},
+			missing: []string{"oidc:", "allowed_groups", "extra_records", "fs1.example.mesh"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, changed, err := renderHeadscaleConfig([]byte(sampleHeadscaleConfig), func(config *headscaleConfig) error {
+				tt.edit(config)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("renderHeadscaleConfig: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if !changed && string(data) != sampleHeadscaleConfig {
+				t.Errorf("unchanged config was rewritten:\n%s", data)
+			}
+
+			lines := map[string]bool{}
+			for _, line := range strings.Split(string(data), "\n") {
+				lines[line] = true
+			}
+			for _, line := range tt.want {
+				if !lines[line] {
+					t.Errorf("missing line %q in:\n%s", line, data)
+				}
+			}
+			for _, text := range tt.missing {
+				if strings.Contains(string(data), text) {
+					t.Errorf("%q was kept in:\n%s", text, data)
+				}
+			}
+
+			var parsed headscaleConfig
+			if err := yaml.Unmarshal(data, &parsed); err != nil {
+				t.Errorf("result does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestRenderHeadscaleConfigFromScratch(t *testing.T) {
+	data, changed, err := renderHeadscaleConfig(nil, func(config *headscaleConfig) error {
+		*config = *defaultHeadscaleConfig("corp.example.com", "CORP", "CORP.EXAMPLE.COM", "dc1")
+		return nil
+	})
+	if err != nil || !changed {
+		t.Fatalf("renderHeadscaleConfig = %v, %v", changed, err)
+	}
+	if !strings.HasPrefix(string(data), "# Vexa Mesh Configuration\n") {
+		t.Errorf("new config has no header:\n%s", data)
+	}
+	var parsed headscaleConfig
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("result does not parse: %v", err)
+	}
+	if parsed.ServerURL == "" || parsed.DNS.BaseDomain == "" {
+		t.Errorf("defaults were not written: %+v", parsed)
+	}
+}
@@ -0,0 +1,518 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/models"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// headscaleDERPMapPath holds the custom DERP regions
+	headscaleDERPMapPath = "/etc/headscale/derp.yaml"
+
+	// tailscaleDERPMapURL is Tailscale's public DERP map
+	tailscaleDERPMapURL = "https://controlplane.tailscale.com/derpmap/default"
+
+	defaultSTUNPort = 3478
+	defaultDERPPort = 443
+
+	derpTestTimeout = 5 * time.Second
+)
+
+var (
+	// derpRegionCodeRegex matches a DERP region code
+	derpRegionCodeRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+	// derpNodeNameRegex matches a DERP node name, e.g. 900a
+	derpNodeNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,31}$`)
+)
+
+// derpMapFile is a DERP map file as Headscale loads it from derp.paths
+type derpMapFile struct {
+	Regions map[int]derpMapRegion `yaml:"regions"`
+}
+
+type derpMapRegion struct {
+	RegionID   int           `yaml:"regionid"`
+	RegionCode string        `yaml:"regioncode"`
+	RegionName string        `yaml:"regionname"`
+	Nodes      []derpMapNode `yaml:"nodes"`
+}
+
+type derpMapNode struct {
+	Name     string `yaml:"name"`
+	RegionID int    `yaml:"regionid"`
+	HostName string `yaml:"hostname"`
+	IPv4     string `yaml:"ipv4,omitempty"`
+	IPv6     string `yaml:"ipv6,omitempty"`
+	STUNPort int    `yaml:"stunport,omitempty"`
+	STUNOnly bool   `yaml:"stunonly,omitempty"`
+	DERPPort int    `yaml:"derpport,omitempty"`
+}
+
+// GetDERPSettings returns the DERP relays overlay nodes are given
+func (s *HeadscaleService) GetDERPSettings() (*models.DERPSettings, error) {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return nil, err
+	}
+	regions, err := loadDERPRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	server := config.DERP.Server
+	return &models.DERPSettings{
+		UseTailscaleMap: containsString(config.DERP.URLs, tailscaleDERPMapURL),
+		Embedded: models.EmbeddedDERPSettings{
+			Enabled:        server.Enabled,
+			RegionID:       server.RegionID,
+			RegionCode:     server.RegionCode,
+			RegionName:     server.RegionName,
+			STUNListenAddr: server.STUNListenAddr,
+			IPv4:           server.IPv4,
+			IPv6:           server.IPv6,
+			VerifyClients:  server.VerifyClients,
+		},
+		Regions: regions,
+	}, nil
+}
+
+// UpdateDERPSettings validates the DERP settings, writes the custom regions
+// to Headscale's DERP map file and restarts Headscale
+func (s *HeadscaleService) UpdateDERPSettings(settings models.DERPSettings) (*models.DERPSettings, error) {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeDERPSettings(&settings, config.ServerURL); err != nil {
+		return nil, err
+	}
+
+	previous, readErr := os.ReadFile(headscaleDERPMapPath)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, fmt.Errorf("failed to read DERP map: %v", readErr)
+	}
+	var data []byte
+	if len(settings.Regions) > 0 {
+		if data, err = renderDERPMap(settings.Regions); err != nil {
+			return nil, err
+		}
+	}
+	filesChanged := !bytes.Equal(previous, data)
+	if filesChanged && data == nil {
+		os.Remove(headscaleDERPMapPath)
+	} else if filesChanged {
+		if err := os.WriteFile(headscaleDERPMapPath, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write DERP map: %v", err)
+		}
+	}
+	restore := func() {
+		if os.IsNotExist(readErr) {
+			os.Remove(headscaleDERPMapPath)
+		} else {
+			os.WriteFile(headscaleDERPMapPath, previous, 0644)
+		}
+	}
+
+	_, err = s.applyHeadscaleConfig(func(config *headscaleConfig) error {
+		config.DERP.URLs = withoutPrefixes(config.DERP.URLs, tailscaleDERPMapURL)
+		if settings.UseTailscaleMap {
+			config.DERP.URLs = append([]string{tailscaleDERPMapURL}, config.DERP.URLs...)
+		}
+		config.DERP.Paths = withoutPrefixes(config.DERP.Paths, headscaleDERPMapPath)
+		if len(settings.Regions) > 0 {
+			config.DERP.Paths = append(config.DERP.Paths, headscaleDERPMapPath)
+		}
+
+		embedded := settings.Embedded
+		config.DERP.Server = headscaleDERPServer{Enabled: embedded.Enabled}
+		if embedded.Enabled {
+			config.DERP.Server = headscaleDERPServer{
+				Enabled:                            true,
+				RegionID:                           embedded.RegionID,
+				RegionCode:                         embedded.RegionCode,
+				RegionName:                         embedded.RegionName,
+				VerifyClients:                      embedded.VerifyClients,
+				STUNListenAddr:                     embedded.STUNListenAddr,
+				PrivateKeyPath:                     "/var/lib/headscale/derp_server_private.key",
+				AutomaticallyAddEmbeddedDERPRegion: true,
+				IPv4:                               embedded.IPv4,
+				IPv6:                               embedded.IPv6,
+			}
+		}
+
+		if len(config.DERP.URLs) == 0 && len(config.DERP.Paths) == 0 && !config.DERP.Server.Enabled {
+			return fmt.Errorf("overlay nodes need at least one DERP region: use Tailscale's map, enable the embedded relay or add a region")
+		}
+		return nil
+	}, filesChanged, restore)
+	if err != nil {
+		if filesChanged {
+			restore()
+		}
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// TestDERPRegion checks that the nodes of a region relay traffic and answer
+// STUN requests. The embedded relay is tested through the server URL.
+func (s *HeadscaleService) TestDERPRegion(regionID int) (*models.DERPRegionTest, error) {
+	settings, err := s.GetDERPSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	var region *models.DERPRegion
+	if settings.Embedded.Enabled && settings.Embedded.RegionID == regionID {
+		region, err = embeddedDERPRegion(settings.Embedded, s.GetLoginServerFull())
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range settings.Regions {
+		if settings.Regions[i].RegionID == regionID {
+			region = &settings.Regions[i]
+		}
+	}
+	if region == nil {
+		return nil, fmt.Errorf("DERP region %d is not configured", regionID)
+	}
+
+	result := &models.DERPRegionTest{RegionID: regionID, Nodes: []models.DERPNodeTest{}}
+	for _, node := range region.Nodes {
+		test := testDERPNode(node)
+		derpOK := node.STUNOnly || test.DERPReachable
+		stunOK := node.STUNPort < 0 || test.STUNReachable
+		if derpOK && stunOK {
+			result.Healthy = true
+		}
+		result.Nodes = append(result.Nodes, test)
+	}
+	return result, nil
+}
+
+// normalizeDERPSettings validates the settings and fills in defaults for the
+// embedded relay
+func normalizeDERPSettings(settings *models.DERPSettings, serverURL string) error {
+	embedded := &settings.Embedded
+	if embedded.Enabled {
+		if parsed, err := url.Parse(serverURL); err != nil || parsed.Scheme != "https" {
+			return fmt.Errorf("the embedded DERP relay needs Headscale's server_url to use https, as clients only reach DERP over TLS")
+		}
+		if embedded.RegionID == 0 {
+			embedded.RegionID = 999
+		}
+		if embedded.RegionCode == "" {
+			embedded.RegionCode = "vexa"
+		}
+		if embedded.RegionName == "" {
+			embedded.RegionName = "Vexa Embedded DERP"
+		}
+		if embedded.STUNListenAddr == "" {
+			embedded.STUNListenAddr = "0.0.0.0:" + strconv.Itoa(defaultSTUNPort)
+		}
+		if err := checkDERPRegionHeader(embedded.RegionID, embedded.RegionCode, embedded.RegionName); err != nil {
+			return err
+		}
+		if err := validateListenAddr(embedded.STUNListenAddr); err != nil {
+			return fmt.Errorf("stun_listen_addr: %v", err)
+		}
+		if err := checkDERPAddresses(embedded.IPv4, embedded.IPv6); err != nil {
+			return err
+		}
+	} else {
+		*embedded = models.EmbeddedDERPSettings{}
+	}
+
+	if settings.Regions == nil {
+		settings.Regions = []models.DERPRegion{}
+	}
+	seen := make(map[int]bool)
+	for i := range settings.Regions {
+		region := &settings.Regions[i]
+		region.RegionCode = strings.ToLower(strings.TrimSpace(region.RegionCode))
+		region.RegionName = strings.TrimSpace(region.RegionName)
+		if err := checkDERPRegionHeader(region.RegionID, region.RegionCode, region.RegionName); err != nil {
+			return err
+		}
+		if seen[region.RegionID] || (embedded.Enabled && region.RegionID == embedded.RegionID) {
+			return fmt.Errorf("DERP region ID %d is used twice", region.RegionID)
+		}
+		seen[region.RegionID] = true
+
+		if len(region.Nodes) == 0 {
+			return fmt.Errorf("DERP region %d needs at least one node", region.RegionID)
+		}
+		names := make(map[string]bool)
+		for j := range region.Nodes {
+			node := &region.Nodes[j]
+			node.HostName = strings.ToLower(strings.TrimSpace(node.HostName))
+			if !derpNodeNameRegex.MatchString(node.Name) || names[node.Name] {
+				return fmt.Errorf("DERP region %d: node names must be unique letters, digits and hyphens", region.RegionID)
+			}
+			names[node.Name] = true
+			if !dnsNameRegex.MatchString(node.HostName) {
+				return fmt.Errorf("DERP node %s: invalid hostname %q", node.Name, node.HostName)
+			}
+			if err := checkDERPAddresses(node.IPv4, node.IPv6); err != nil {
+				return fmt.Errorf("DERP node %s: %v", node.Name, err)
+			}
+			if node.STUNPort < -1 || node.STUNPort > 65535 {
+				return fmt.Errorf("DERP node %s: stun_port must be -1 (disabled), 0 (default) or a port", node.Name)
+			}
+			if node.DERPPort < 0 || node.DERPPort > 65535 {
+				return fmt.Errorf("DERP node %s: invalid derp_port", node.Name)
+			}
+			if node.STUNOnly && node.STUNPort < 0 {
+				return fmt.Errorf("DERP node %s: a STUN-only node needs STUN enabled", node.Name)
+			}
+		}
+	}
+
+	if !settings.UseTailscaleMap && !embedded.Enabled && len(settings.Regions) == 0 {
+		return fmt.Errorf("overlay nodes need at least one DERP region: use Tailscale's map, enable the embedded relay or add a region")
+	}
+	return nil
+}
+
+func checkDERPRegionHeader(id int, code, name string) error {
+	if id < 1 || id > 999 {
+		return fmt.Errorf("DERP region ID %d must be between 1 and 999", id)
+	}
+	if !derpRegionCodeRegex.MatchString(code) {
+		return fmt.Errorf("DERP region %d: region code must be lowercase letters, digits and hyphens", id)
+	}
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("DERP region %d: region name must be 1 to 64 characters", id)
+	}
+	return nil
+}
+
+func checkDERPAddresses(ipv4, ipv6 string) error {
+	if ipv4 != "" {
+		if ip := net.ParseIP(ipv4); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid IPv4 address %q", ipv4)
+		}
+	}
+	if ipv6 != "" {
+		if ip := net.ParseIP(ipv6); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid IPv6 address %q", ipv6)
+		}
+	}
+	return nil
+}
+
+// embeddedDERPRegion describes the embedded relay as a region with a single
+// node reached through the server URL
+func embeddedDERPRegion(embedded models.EmbeddedDERPSettings, serverURL string) (*models.DERPRegion, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("invalid headscale server URL %q", serverURL)
+	}
+	node := models.DERPNode{
+		Name:     fmt.Sprintf("%da", embedded.RegionID),
+		HostName: parsed.Hostname(),
+		IPv4:     embedded.IPv4,
+		IPv6:     embedded.IPv6,
+	}
+	if port, err := strconv.Atoi(parsed.Port()); err == nil {
+		node.DERPPort = port
+	}
+	if _, port, err := net.SplitHostPort(embedded.STUNListenAddr); err == nil {
+		node.STUNPort, _ = strconv.Atoi(port)
+	}
+	return &models.DERPRegion{
+		RegionID:   embedded.RegionID,
+		RegionCode: embedded.RegionCode,
+		RegionName: embedded.RegionName,
+		Nodes:      []models.DERPNode{node},
+	}, nil
+}
+
+// testDERPNode probes a node's DERP endpoint over HTTPS and sends it a STUN
+// binding request
+func testDERPNode(node models.DERPNode) models.DERPNodeTest {
+	test := models.DERPNodeTest{Name: node.Name, HostName: node.HostName}
+	dialHost := node.HostName
+	if node.IPv4 != "" {
+		dialHost = node.IPv4
+	} else if node.IPv6 != "" {
+		dialHost = node.IPv6
+	}
+
+	if !node.STUNOnly {
+		port := node.DERPPort
+		if port == 0 {
+			port = defaultDERPPort
+		}
+		latency, err := probeDERP(node.HostName, net.JoinHostPort(dialHost, strconv.Itoa(port)))
+		if err != nil {
+			test.DERPError = err.Error()
+		} else {
+			test.DERPReachable = true
+			test.DERPLatencyMs = latency.Milliseconds()
+		}
+	}
+
+	if node.STUNPort >= 0 {
+		port := node.STUNPort
+		if port == 0 {
+			port = defaultSTUNPort
+		}
+		latency, err := probeSTUN(net.JoinHostPort(dialHost, strconv.Itoa(port)))
+		if err != nil {
+			test.STUNError = err.Error()
+		} else {
+			test.STUNReachable = true
+			test.STUNLatencyMs = latency.Milliseconds()
+		}
+	}
+	return test
+}
+
+// probeDERP requests a DERP server's probe endpoint, connecting to addr
+// while verifying the certificate for hostname
+func probeDERP(hostname, addr string) (time.Duration, error) {
+	dialer := &net.Dialer{Timeout: derpTestTimeout}
+	client := &http.Client{
+		Timeout: derpTestTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig: &tls.Config{ServerName: hostname},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	start := time.Now()
+	resp, err := client.Get("https://" + hostname + "/derp/probe")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("DERP probe returned %s", resp.Status)
+	}
+	return time.Since(start), nil
+}
+
+// probeSTUN sends a STUN binding request to addr and waits for the response
+func probeSTUN(addr string) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", addr, derpTestTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// Binding request: type, zero length, magic cookie, transaction ID
+	request := make([]byte, 20)
+	request[1] = 0x01
+	copy(request[4:8], []byte{0x21, 0x12, 0xa4, 0x42})
+	if _, err := rand.Read(request[8:20]); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(derpTestTimeout))
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, 1500)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return 0, fmt.Errorf("no STUN response: %v", err)
+		}
+		// Binding success response with our transaction ID
+		if n >= 20 && response[0] == 0x01 && response[1] == 0x01 && bytes.Equal(response[8:20], request[8:20]) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// loadDERPRegions reads the custom regions from Headscale's DERP map file
+func loadDERPRegions() ([]models.DERPRegion, error) {
+	regions := []models.DERPRegion{}
+	data, err := os.ReadFile(headscaleDERPMapPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return regions, nil
+		}
+		return nil, fmt.Errorf("failed to read DERP map: %v", err)
+	}
+
+	var file derpMapFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse DERP map: %v", err)
+	}
+	for id, region := range file.Regions {
+		converted := models.DERPRegion{
+			RegionID:   id,
+			RegionCode: region.RegionCode,
+			RegionName: region.RegionName,
+			Nodes:      []models.DERPNode{},
+		}
+		for _, node := range region.Nodes {
+			converted.Nodes = append(converted.Nodes, models.DERPNode{
+				Name:     node.Name,
+				HostName: node.HostName,
+				IPv4:     node.IPv4,
+				IPv6:     node.IPv6,
+				STUNPort: node.STUNPort,
+				DERPPort: node.DERPPort,
+				STUNOnly: node.STUNOnly,
+			})
+		}
+		regions = append(regions, converted)
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].RegionID < regions[j].RegionID })
+	return regions, nil
+}
+
+// renderDERPMap renders the custom regions in the format Headscale loads
+func renderDERPMap(regions []models.DERPRegion) ([]byte, error) {
+	file := derpMapFile{Regions: make(map[int]derpMapRegion, len(regions))}
+	for _, region := range regions {
+		converted := derpMapRegion{
+			RegionID:   region.RegionID,
+			RegionCode: region.RegionCode,
+			RegionName: region.RegionName,
+		}
+		for _, node := range region.Nodes {
+			converted.Nodes = append(converted.Nodes, derpMapNode{
+				Name:     node.Name,
+				RegionID: region.RegionID,
+				HostName: node.HostName,
+				IPv4:     node.IPv4,
+				IPv6:     node.IPv6,
+				STUNPort: node.STUNPort,
+				STUNOnly: node.STUNOnly,
+				DERPPort: node.DERPPort,
+			})
+		}
+		file.Regions[region.RegionID] = converted
+	}
+
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode DERP map: %v", err)
+	}
+	return append([]byte("# Managed by Vexa\n"), data...), nil
+}
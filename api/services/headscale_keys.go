@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/models"
+)
+
+const (
+	// defaultPreAuthKeyTTL is how long a key stays valid when no expiry is given
+	defaultPreAuthKeyTTL = time.Hour
+
+	// maxPreAuthKeyTTL is the longest lifetime an administrator may give a key
+	maxPreAuthKeyTTL = 365 * 24 * time.Hour
+)
+
+// ListKeys returns the pre-auth keys of a Headscale user, or of all users
+// when user is empty, with the nodes registered with each key
+func (s *HeadscaleService) ListKeys(user string) ([]models.OverlayPreAuthKey, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []headscale.User
+	if user != "" {
+		owner, err := client.FindUser(user)
+		if err != nil {
+			return nil, err
+		}
+		users = []headscale.User{*owner}
+	} else if users, err = client.ListUsers(); err != nil {
+		return nil, err
+	}
+
+	nodes, err := client.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodesByKey := make(map[string][]models.OverlayKeyNode)
+	for _, node := range nodes {
+		if node.PreAuthKeyID == "" {
+			continue
+		}
+		nodesByKey[node.PreAuthKeyID] = append(nodesByKey[node.PreAuthKeyID], models.OverlayKeyNode{
+			ID:        node.ID,
+			Name:      node.Name,
+			GivenName: node.GivenName,
+			User:      node.User,
+			Online:    node.Online,
+		})
+	}
+
+	now := time.Now()
+	result := []models.OverlayPreAuthKey{}
+	for _, owner := range users {
+		keys, err := client.ListPreAuthKeys(owner.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			overlayKey := overlayPreAuthKey(key, owner.Name, now)
+			overlayKey.Key = maskKey(key.Key)
+			if registered, ok := nodesByKey[key.ID]; ok {
+				overlayKey.Nodes = registered
+			}
+			result = append(result, overlayKey)
+		}
+	}
+	return result, nil
+}
+
+// CreateKey creates a pre-auth key. The returned key holds the full key
+// value, which is not shown again.
+func (s *HeadscaleService) CreateKey(req models.CreateOverlayKeyRequest) (*models.OverlayPreAuthKey, error) {
+	tags, err := normalizeACLTags(req.ACLTags)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultPreAuthKeyTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+	if expiresAt.Sub(now) > maxPreAuthKeyTTL {
+		return nil, fmt.Errorf("expiry must be within one year")
+	}
+
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	owner, err := client.FindUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	key, err := client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{
+		UserID:     owner.ID,
+		Reusable:   req.Reusable,
+		Ephemeral:  req.Ephemeral,
+		Expiration: expiresAt,
+		ACLTags:    tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	overlayKey := overlayPreAuthKey(*key, owner.Name, now)
+	return &overlayKey, nil
+}
+
+// ExpireKey expires the pre-auth key with the given ID so it can no longer
+// register nodes. Nodes already registered with it stay registered.
+func (s *HeadscaleService) ExpireKey(keyID string) (*models.OverlayPreAuthKey, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	users, err := client.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, owner := range users {
+		keys, err := client.ListPreAuthKeys(owner.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if key.ID != keyID {
+				continue
+			}
+			overlayKey := overlayPreAuthKey(key, owner.Name, now)
+			overlayKey.Key = maskKey(key.Key)
+			if overlayKey.Expired {
+				return &overlayKey, fmt.Errorf("pre-auth key %s has already expired", keyID)
+			}
+			if err := client.ExpirePreAuthKey(owner.ID, key.Key); err != nil {
+				return &overlayKey, err
+			}
+			return &overlayKey, nil
+		}
+	}
+	return nil, fmt.Errorf("pre-auth key %s not found", keyID)
+}
+
+// overlayPreAuthKey converts a Headscale pre-auth key, noting whether it has
+// expired at now
+func overlayPreAuthKey(key headscale.PreAuthKey, user string, now time.Time) models.OverlayPreAuthKey {
+	overlayKey := models.OverlayPreAuthKey{
+		ID:         key.ID,
+		Key:        key.Key,
+		User:       user,
+		Reusable:   key.Reusable,
+		Ephemeral:  key.Ephemeral,
+		Used:       key.Used,
+		Expiration: key.Expiration,
+		CreatedAt:  key.CreatedAt,
+		ACLTags:    key.ACLTags,
+		Nodes:      []models.OverlayKeyNode{},
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, key.Expiration); err == nil && !expiresAt.After(now) {
+		overlayKey.Expired = true
+	}
+	return overlayKey
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/griffinwebnet/vexa/api/headscale"
+)
+
+var (
+	// nodeIDRegex matches a Headscale node ID
+	nodeIDRegex = regexp.MustCompile(`^[0-9]{1,19}$`)
+
+	// nodeNameRegex matches a node's given name, which is a DNS label
+	nodeNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+	// headscaleUserRegex matches a Headscale user name
+	headscaleUserRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+	// aclTagRegex matches a single Headscale ACL tag
+	aclTagRegex = regexp.MustCompile(`^tag:[a-z0-9-]+$`)
+)
+
+// ListNodes returns all nodes registered with Headscale
+func (s *HeadscaleService) ListNodes() ([]headscale.Node, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.ListNodes()
+}
+
+// GetNode returns a node by ID
+func (s *HeadscaleService) GetNode(nodeID string) (*headscale.Node, error) {
+	if !nodeIDRegex.MatchString(nodeID) {
+		return nil, fmt.Errorf("invalid node ID")
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetNode(nodeID)
+}
+
+// RenameNode changes a node's given name and returns the node as it was
+// before the change
+func (s *HeadscaleService) RenameNode(nodeID, name string) (*headscale.Node, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !nodeNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("invalid node name: use up to 63 lowercase letters, digits and hyphens")
+	}
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return node, err
+	}
+	return node, client.RenameNode(node.ID, name)
+}
+
+// ExpireNode expires a node's key, forcing it to log in again
+func (s *HeadscaleService) ExpireNode(nodeID string) (*headscale.Node, error) {
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return node, err
+	}
+	return node, client.ExpireNode(node.ID)
+}
+
+// DeleteNode removes a node from Headscale
+func (s *HeadscaleService) DeleteNode(nodeID string) (*headscale.Node, error) {
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return node, err
+	}
+	return node, client.DeleteNode(node.ID)
+}
+
+// MoveNode assigns a node to another Headscale user
+func (s *HeadscaleService) MoveNode(nodeID, user string) (*headscale.Node, error) {
+	if !headscaleUserRegex.MatchString(user) {
+		return nil, fmt.Errorf("invalid user name")
+	}
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if node.User == user {
+		return nil, fmt.Errorf("node already belongs to %s", user)
+	}
+	target, err := s.findUser(user)
+	if err != nil {
+		return node, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return node, err
+	}
+	return node, client.MoveNode(node.ID, target.ID)
+}
+
+// findUser returns the Headscale user with the given name
+func (s *HeadscaleService) findUser(name string) (*headscale.User, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.FindUser(name)
+}
+
+// SetNodeTags replaces a node's forced ACL tags. An empty list clears them.
+func (s *HeadscaleService) SetNodeTags(nodeID string, tags []string) (*headscale.Node, []string, error) {
+	normalized, err := normalizeACLTags(tags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return node, normalized, err
+	}
+	return node, normalized, client.SetNodeTags(node.ID, normalized)
+}
+
+// normalizeACLTags lowercases tags, adds the tag: prefix where missing and
+// drops duplicates
+func normalizeACLTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !strings.HasPrefix(tag, "tag:") {
+			tag = "tag:" + tag
+		}
+		if !aclTagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use tag: followed by lowercase letters, digits and hyphens", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// NodeRoutes returns the routes a node advertises
+func (s *HeadscaleService) NodeRoutes(nodeID string) ([]headscale.Route, error) {
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	return node.Routes(), nil
+}
+
+// ListRoutes returns the routes advertised by all nodes
+func (s *HeadscaleService) ListRoutes() ([]headscale.Route, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.ListRoutes()
+}
+
+// SetRouteEnabled approves or withdraws one route of a node and returns the
+// route as it was before the change
+func (s *HeadscaleService) SetRouteEnabled(nodeID, prefix string, enabled bool) (*headscale.Route, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid route prefix %q", prefix)
+	}
+	prefix = network.String()
+
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range node.Routes() {
+		if route.Prefix != prefix {
+			continue
+		}
+		if enabled && !route.Advertised {
+			return &route, fmt.Errorf("route %s is no longer advertised by %s", route.Prefix, node.GivenName)
+		}
+		approved := withoutPrefixes(node.ApprovedRoutes, prefix)
+		if enabled {
+			approved = append(approved, prefix)
+		}
+		client, err := headscaleClient()
+		if err != nil {
+			return &route, err
+		}
+		return &route, client.ApproveRoutes(node.ID, approved)
+	}
+	return nil, fmt.Errorf("%s does not advertise route %s", node.GivenName, prefix)
+}
+
+// SetExitNode approves or withdraws the default routes a node advertises,
+// which makes it usable as an exit node. It returns the node's exit routes.
+func (s *HeadscaleService) SetExitNode(nodeID string, enabled bool) ([]headscale.Route, error) {
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var exitRoutes []headscale.Route
+	var exitPrefixes []string
+	for _, route := range node.Routes() {
+		if route.IsExitRoute() {
+			exitPrefixes = append(exitPrefixes, route.Prefix)
+			if route.Advertised {
+				route.Enabled = enabled
+				exitRoutes = append(exitRoutes, route)
+			}
+		}
+	}
+	if enabled && len(exitRoutes) == 0 {
+		return nil, fmt.Errorf("node does not advertise itself as an exit node; run tailscale up --advertise-exit-node on it first")
+	}
+
+	approved := withoutPrefixes(node.ApprovedRoutes, exitPrefixes...)
+	if enabled {
+		for _, route := range exitRoutes {
+			approved = append(approved, route.Prefix)
+		}
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.ApproveRoutes(node.ID, approved); err != nil {
+		return nil, err
+	}
+	return exitRoutes, nil
+}
+
+// withoutPrefixes returns prefixes minus the given ones
+func withoutPrefixes(prefixes []string, remove ...string) []string {
+	result := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		keep := true
+		for _, r := range remove {
+			if prefix == r {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, prefix)
+		}
+	}
+	return result
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/headscale/headscaletest"
+	"github.com/griffinwebnet/vexa/api/models"
+)
+
+// useFakeHeadscale points the services at a fake Headscale API for the
+// duration of a test
+func useFakeHeadscale(t *testing.T) (*headscaletest.Server, *headscale.Client) {
+	t.Helper()
+	fake := headscaletest.NewServer("test-key")
+	server := httptest.NewServer(fake)
+	client := headscale.NewClient(server.URL, "test-key")
+
+	previous := headscaleClient
+	headscaleClient = func() (*headscale.Client, error) {
+		return client, nil
+	}
+	t.Cleanup(func() {
+		headscaleClient = previous
+		server.Close()
+	})
+	return fake, client
+}
+
+// useDirectoryUsers makes usernames the directory's users for the duration
+// of a test
+func useDirectoryUsers(t *testing.T, usernames ...string) {
+	t.Helper()
+	previous := directoryUsernames
+	directoryUsernames = func() ([]string, error) {
+		return usernames, nil
+	}
+	t.Cleanup(func() {
+		directoryUsernames = previous
+	})
+}
+
+// registerFakeNode registers a node under user, creating the user when needed
+func registerFakeNode(t *testing.T, fake *headscaletest.Server, client *headscale.Client, user, hostname string, routes ...string) *headscale.Node {
+	t.Helper()
+	owner, err := client.FindUser(user)
+	if err != nil {
+		if owner, err = client.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	key, err := client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{UserID: owner.ID})
+	if err != nil {
+		t.Fatalf("CreatePreAuthKey: %v", err)
+	}
+	node, err := fake.RegisterNode(key.Key, hostname, routes...)
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	return node
+}
+
+func TestListAndGetNodes(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	s := NewHeadscaleService()
+	laptop := registerFakeNode(t, fake, client, "alice", "laptop")
+	registerFakeNode(t, fake, client, infrastructureUser, "ws01")
+
+	nodes, err := s.ListNodes()
+	if err != nil {
+		t.Fatalf("ListNodes: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(nodes))
+	}
+
+	node, err := s.GetNode(laptop.ID)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if node.User != "alice" || node.Name != "laptop" {
+		t.Errorf("node = %+v", node)
+	}
+	if _, err := s.GetNode("1; rm -rf /"); err == nil || !strings.Contains(err.Error(), "invalid node ID") {
+		t.Errorf("GetNode with a malformed ID = %v", err)
+	}
+	if _, err := s.GetNode("999"); err == nil {
+		t.Error("GetNode of an unknown node succeeded")
+	}
+}
+
+func TestRenameNode(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	s := NewHeadscaleService()
+	node := registerFakeNode(t, fake, client, "alice", "laptop")
+
+	before, err := s.RenameNode(node.ID, "  Alice-Laptop ")
+	if err != nil {
+		t.Fatalf("RenameNode: %v", err)
+	}
+	if before.GivenName != "laptop" {
+		t.Errorf("RenameNode returned %q, want the name before the change", before.GivenName)
+	}
+	if renamed, _ := s.GetNode(node.ID); renamed.GivenName != "alice-laptop" {
+		t.Errorf("given name = %q, want alice-laptop", renamed.GivenName)
+	}
+
+	for _, name := range []string{"", "has space", "-leading", "under_score", strings.Repeat("a", 64)} {
+		if _, err := s.RenameNode(node.ID, name); err == nil {
+			t.Errorf("RenameNode(%q) succeeded", name)
+		}
+	}
+}
+
+func TestMoveNode(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	s := NewHeadscaleService()
+	node := registerFakeNode(t, fake, client, "alice", "laptop")
+	if _, err := client.CreateUser("bob"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if _, err := s.MoveNode(node.ID, "bob"); err != nil {
+		t.Fatalf("MoveNode: %v", err)
+	}
+	if moved, _ := s.GetNode(node.ID); moved.User != "bob" {
+		t.Errorf("node belongs to %q, want bob", moved.User)
+	}
+
+	if _, err := s.MoveNode(node.ID, "bob"); err == nil {
+		t.Error("moving a node to its own user succeeded")
+	}
+	if _, err := s.MoveNode(node.ID, "carol"); err == nil {
+		t.Error("moving a node to an unknown user succeeded")
+	}
+	if _, err := s.MoveNode(node.ID, "bad user"); err == nil {
+		t.Error("moving a node to a malformed user name succeeded")
+	}
+}
+
+func TestSetNodeTags(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	s := NewHeadscaleService()
+	node := registerFakeNode(t, fake, client, infrastructureUser, "fs01")
+
+	_, tags, err := s.SetNodeTags(node.ID, []string{"FileServer", "tag:fileserver", " tag:finance "})
+	if err != nil {
+		t.Fatalf("SetNodeTags: %v", err)
+	}
+	want := []string{"tag:fileserver", "tag:finance"}
+	if strings.Join(tags, ",") != strings.Join(want, ",") {
+		t.Errorf("normalized tags = %v, want %v", tags, want)
+	}
+	if tagged, _ := s.GetNode(node.ID); strings.Join(tagged.ForcedTags, ",") != strings.Join(want, ",") {
+		t.Errorf("forced tags = %v, want %v", tagged.ForcedTags, want)
+	}
+
+	if _, _, err := s.SetNodeTags(node.ID, []string{"tag:bad tag"}); err == nil {
+		t.Error("an invalid tag was accepted")
+	}
+	if _, _, err := s.SetNodeTags(node.ID, nil); err != nil {
+		t.Fatalf("clearing tags: %v", err)
+	}
+	if cleared, _ := s.GetNode(node.ID); len(cleared.ForcedTags) != 0 {
+		t.Errorf("tags after clearing = %v", cleared.ForcedTags)
+	}
+}
+
+func TestSetRouteEnabled(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	s := NewHeadscaleService()
+	node := registerFakeNode(t, fake, client, infrastructureUser, "router", "10.0.0.0/24", "10.1.0.0/24")
+
+	// The prefix is normalized to the network address
+	if _, err := s.SetRouteEnabled(node.ID, "10.0.0.1/24", true); err != nil {
+		t.Fatalf("enabling a route: %v", err)
+	}
+	if _, err := s.SetRouteEnabled(node.ID, "10.1.0.0/24", true); err != nil {
+		t.Fatalf("enabling a second route: %v", err)
+	}
+	routes, err := s.NodeRoutes(node.ID)
+	if err != nil {
+		t.Fatalf("NodeRoutes: %v", err)
+	}
+	for _, route := range routes {
+		if !route.Enabled {
+			t.Errorf("route %s is not enabled", route.Prefix)
+		}
+	}
+
+	if _, err := s.SetRouteEnabled(node.ID, "10.0.0.0/24", false); err != nil {
+		t.Fatalf("disabling a route: %v", err)
+	}
+	approved, _ := s.GetNode(node.ID)
+	if strings.Join(approved.ApprovedRoutes, ",") != "10.1.0.0/24" {
+		t.Errorf("approved routes = %v, want only 10.1.0.0/24", approved.ApprovedRoutes)
+	}
+
+	if _, err := s.SetRouteEnabled(node.ID, "192.168.0.0/24", true); err == nil {
+		t.Error("enabling a route the node does not advertise succeeded")
+	}
+	if _, err := s.SetRouteEnabled(node.ID, "not-a-prefix", true); err == nil {
+		t.Error("enabling a malformed prefix succeeded")
+	}
+}
+
+func TestSetExitNode(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	s := NewHeadscaleService()
+	exit := registerFakeNode(t, fake, client, infrastructureUser, "gateway", "10.0.0.0/24", "0.0.0.0/0", "::/0")
+	plain := registerFakeNode(t, fake, client, infrastructureUser, "ws01")
+
+	if _, err := s.SetRouteEnabled(exit.ID, "10.0.0.0/24", true); err != nil {
+		t.Fatalf("enabling a subnet route: %v", err)
+	}
+	routes, err := s.SetExitNode(exit.ID, true)
+	if err != nil {
+		t.Fatalf("SetExitNode: %v", err)
+	}
+	if len(routes) != 2 {
+		t.Errorf("got %d exit routes, want 2", len(routes))
+	}
+	node, _ := s.GetNode(exit.ID)
+	if len(node.ApprovedRoutes) != 3 {
+		t.Errorf("approved routes = %v, want the subnet and both exit routes", node.ApprovedRoutes)
+	}
+
+	if _, err := s.SetExitNode(exit.ID, false); err != nil {
+		t.Fatalf("disabling the exit node: %v", err)
+	}
+	node, _ = s.GetNode(exit.ID)
+	if strings.Join(node.ApprovedRoutes, ",") != "10.0.0.0/24" {
+		t.Errorf("approved routes = %v, want only the subnet route", node.ApprovedRoutes)
+	}
+
+	if _, err := s.SetExitNode(plain.ID, true); err == nil {
+		t.Error("a node that does not advertise exit routes became an exit node")
+	}
+}
+
+func TestUserNodesAndRemoveUser(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	useDirectoryUsers(t, "Alice.Smith", "bob", "Carol", "Infrastructure")
+	s := NewHeadscaleService()
+	registerFakeNode(t, fake, client, "alice-smith", "laptop")
+	registerFakeNode(t, fake, client, "alice-smith", "phone")
+	registerFakeNode(t, fake, client, "bob", "desktop")
+
+	nodes, err := s.UserNodes("Alice.Smith")
+	if err != nil {
+		t.Fatalf("UserNodes: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("got %d nodes for alice-smith, want 2", len(nodes))
+	}
+
+	keys, err := s.UserKeys("Alice.Smith")
+	if err != nil {
+		t.Fatalf("UserKeys: %v", err)
+	}
+	if len(keys) != 2 || !strings.HasSuffix(keys[0].Key, "********") {
+		t.Errorf("keys = %+v, want two masked keys", keys)
+	}
+
+	removed, err := s.RemoveUser("Alice.Smith")
+	if err != nil {
+		t.Fatalf("RemoveUser: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("removed %d nodes, want 2", len(removed))
+	}
+	if _, err := client.FindUser("alice-smith"); !headscale.IsNotFound(err) {
+		t.Errorf("alice-smith still exists: %v", err)
+	}
+	remaining, _ := s.ListNodes()
+	if len(remaining) != 1 || remaining[0].User != "bob" {
+		t.Errorf("remaining nodes = %+v, want bob's desktop", remaining)
+	}
+
+	if removed, err := s.RemoveUser("Carol"); err != nil || len(removed) != 0 {
+		t.Errorf("removing a user without an overlay user = %v, %v", removed, err)
+	}
+	if _, err := s.UserNodes("Infrastructure"); err == nil {
+		t.Error("a directory user mapped onto the infrastructure user")
+	}
+}
+
+func TestRemoveUserRefusesSharedOverlayUser(t *testing.T) {
+	fake, client := useFakeHeadscale(t)
+	useDirectoryUsers(t, "j.smith", "j_smith", "bob")
+	s := NewHeadscaleService()
+	registerFakeNode(t, fake, client, "j-smith", "laptop")
+	registerFakeNode(t, fake, client, "bob", "desktop")
+
+	for _, username := range []string{"j.smith", "j_smith"} {
+		if removed, err := s.RemoveUser(username); err == nil || len(removed) != 0 {
+			t.Errorf("RemoveUser(%s) = %v, %v; want a refusal", username, removed, err)
+		}
+		if _, err := s.UserNodes(username); err == nil {
+			t.Errorf("UserNodes(%s) listed the shared overlay user's devices", username)
+		}
+	}
+	if _, err := client.FindUser("j-smith"); err != nil {
+		t.Errorf("j-smith was deleted: %v", err)
+	}
+	if nodes, _ := s.ListNodes(); len(nodes) != 2 {
+		t.Errorf("got %d nodes, want both kept", len(nodes))
+	}
+
+	// Once one of them is gone from the directory the name is unambiguous
+	useDirectoryUsers(t, "j_smith", "bob")
+	removed, err := s.RemoveUser("j_smith")
+	if err != nil || len(removed) != 1 || removed[0].Name != "laptop" {
+		t.Errorf("RemoveUser(j_smith) = %v, %v", removed, err)
+	}
+	if nodes, _ := s.ListNodes(); len(nodes) != 1 || nodes[0].User != "bob" {
+		t.Errorf("remaining nodes = %+v, want bob's desktop", nodes)
+	}
+}
+
+func TestOverlayUserOwners(t *testing.T) {
+	owners := overlayUserOwners([]string{"j.smith", "j_smith", "J Smith", "j-smith", "alice", "Bob"})
+	if got := owners["j-smith"]; len(got) != 4 {
+		t.Errorf("j-smith owners = %v, want all four spellings", got)
+	}
+	if got := owners["alice"]; len(got) != 1 {
+		t.Errorf("alice owners = %v", got)
+	}
+	if got := owners["bob"]; len(got) != 1 || got[0] != "Bob" {
+		t.Errorf("bob owners = %v", got)
+	}
+}
+
+func TestSetLivePolicy(t *testing.T) {
+	_, client := useFakeHeadscale(t)
+
+	policy := models.OverlayPolicy{
+		Enabled:   true,
+		TagOwners: map[string][]string{"tag:fileserver": {"group:it"}},
+		ACLs: []models.OverlayACLRule{
+			{Action: "accept", Sources: []string{"group:finance"}, Destinations: []string{"tag:fileserver:445"}},
+		},
+	}
+	groups := map[string][]string{
+		"group:finance": {"alice-smith@"},
+		"group:it":      {"bob@"},
+	}
+	data, err := json.MarshalIndent(renderOverlayPolicy(policy, groups), "", "  ")
+	if err != nil {
+		t.Fatalf("marshal policy: %v", err)
+	}
+	if err := setLivePolicy(data); err != nil {
+		t.Fatalf("setLivePolicy: %v", err)
+	}
+
+	live, _, err := client.GetPolicy()
+	if err != nil {
+		t.Fatalf("GetPolicy: %v", err)
+	}
+	var applied headscalePolicy
+	if err := json.Unmarshal([]byte(live), &applied); err != nil {
+		t.Fatalf("live policy is not JSON: %v", err)
+	}
+	if strings.Join(applied.Groups["group:finance"], ",") != "alice-smith@" {
+		t.Errorf("finance group = %v", applied.Groups["group:finance"])
+	}
+	if len(applied.ACLs) != 1 || applied.ACLs[0].Destinations[0] != "tag:fileserver:445" {
+		t.Errorf("acls = %+v", applied.ACLs)
+	}
+
+	err = setLivePolicy([]byte("{not json"))
+	if err == nil || !strings.Contains(err.Error(), "policy rejected by headscale") {
+		t.Errorf("setLivePolicy with an invalid document = %v", err)
+	}
+	if unchanged, _, _ := client.GetPolicy(); unchanged != live {
+		t.Error("a rejected policy replaced the live one")
+	}
+}
@@ -1,12 +1,13 @@
 package services
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	vexaexec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/headscale"
 	"github.com/griffinwebnet/vexa/api/utils"
 )
 
@@ -24,110 +25,124 @@ func NewHeadscaleService() *HeadscaleService {
 
 // GetStatus returns the current Headscale status
 func (s *HeadscaleService) GetStatus() (map[string]interface{}, error) {
-
-	// Check if Headscale is enabled
-	if !s.headscaleTool.IsEnabled() {
+	client, err := headscaleClient()
+	if err == nil {
+		err = client.Health()
+	}
+	if err != nil {
 		return map[string]interface{}{
 			"enabled": false,
 			"status":  "not_available",
 		}, nil
 	}
 
-	// Get actual status
-	status, err := s.headscaleTool.GetStatus()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get headscale status: %v", err)
-	}
-
-	users, err := s.headscaleTool.ListUsers()
+	users, err := client.ListUsers()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list headscale users: %v", err)
 	}
 
 	return map[string]interface{}{
-		"enabled":       true,
-		"status":        "running",
-		"status_output": status,
-		"users_output":  users,
+		"enabled": true,
+		"status":  "running",
+		"users":   users,
 	}, nil
 }
 
 // CreatePreAuthKey creates a new pre-auth key for deployment
-func (s *HeadscaleService) CreatePreAuthKey(user string, reusable bool, ephemeral bool) (*vexaexec.PreAuthKey, error) {
-
-	// Create actual pre-auth key
-	key, err := s.headscaleTool.CreatePreAuthKey(user, reusable, ephemeral)
+func (s *HeadscaleService) CreatePreAuthKey(user string, reusable bool, ephemeral bool) (*headscale.PreAuthKey, error) {
+	client, err := headscaleClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create pre-auth key: %v", err)
+		return nil, err
 	}
-
-	return key, nil
-}
-
-// GetInfrastructureKey returns the existing infrastructure pre-auth key
-func (s *HeadscaleService) GetInfrastructureKey() (string, error) {
-	// Get the infrastructure user ID first
-	userID, err := s.getInfrastructureUserID()
+	owner, err := client.FindUser(user)
 	if err != nil {
-		return "", fmt.Errorf("failed to get infrastructure user ID: %v", err)
+		return nil, err
 	}
+	return client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{
+		UserID:    owner.ID,
+		Reusable:  reusable,
+		Ephemeral: ephemeral,
+	})
+}
 
-	// List all pre-auth keys for the infrastructure user using the user ID
-	cmd, cmdErr := utils.SafeCommand("headscale", "preauthkeys", "list", "-u", fmt.Sprintf("%d", userID), "-c", "/etc/headscale/config.yaml", "-o", "json")
-	if cmdErr != nil {
-		return "", fmt.Errorf("command sanitization failed: %v", cmdErr)
+// CreateMachineKey creates a single-use pre-auth key for one computer on the
+// infrastructure user. The key expires after ttl and tags the node with the computer name.
+func (s *HeadscaleService) CreateMachineKey(computerName string, ttl time.Duration) (*headscale.PreAuthKey, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
 	}
-	output, err := cmd.Output()
+	user, err := client.FindUser(infrastructureUser)
 	if err != nil {
-		return "", fmt.Errorf("failed to list pre-auth keys: %v", err)
+		return nil, fmt.Errorf("failed to get infrastructure user: %v", err)
 	}
 
-	// Parse JSON to find a reusable key
-	var keys []map[string]interface{}
-	if err := json.Unmarshal(output, &keys); err != nil {
-		return "", fmt.Errorf("failed to parse pre-auth keys: %v", err)
+	var tags []string
+	if tag := MachineTag(computerName); tag != "" {
+		tags = append(tags, tag)
 	}
 
-	// Find the first reusable key
-	for _, key := range keys {
-		if reusable, ok := key["reusable"].(bool); ok && reusable {
-			// Reusable keys don't expire, so just return the key string
-			if keyStr, ok := key["key"].(string); ok && keyStr != "" {
-				return keyStr, nil
-			}
-		}
-	}
+	return client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{
+		UserID:     user.ID,
+		Expiration: time.Now().Add(ttl),
+		ACLTags:    tags,
+	})
+}
 
-	return "", fmt.Errorf("no reusable infrastructure key found - the Headscale setup may have failed")
+// ListInfrastructureKeys returns all pre-auth keys issued to the infrastructure user
+func (s *HeadscaleService) ListInfrastructureKeys() ([]headscale.PreAuthKey, error) {
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	user, err := client.FindUser(infrastructureUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get infrastructure user: %v", err)
+	}
+	return client.ListPreAuthKeys(user.ID)
 }
 
-// getInfrastructureUserID gets the numeric ID of the infrastructure user
-func (s *HeadscaleService) getInfrastructureUserID() (int, error) {
-	cmd, cmdErr := utils.SafeCommand("headscale", "users", "list", "-c", "/etc/headscale/config.yaml", "-o", "json")
-	if cmdErr != nil {
-		return 0, fmt.Errorf("command sanitization failed: %v", cmdErr)
+// ExpireInfrastructureKey expires a pre-auth key issued to the infrastructure user
+func (s *HeadscaleService) ExpireInfrastructureKey(key string) error {
+	client, err := headscaleClient()
+	if err != nil {
+		return err
 	}
-	output, err := cmd.Output()
+	user, err := client.FindUser(infrastructureUser)
 	if err != nil {
-		return 0, fmt.Errorf("failed to list users: %v", err)
+		return fmt.Errorf("failed to get infrastructure user: %v", err)
 	}
+	return client.ExpirePreAuthKey(user.ID, key)
+}
 
-	// Parse users
-	var users []map[string]interface{}
-	if err := json.Unmarshal(output, &users); err != nil {
-		return 0, fmt.Errorf("failed to parse users: %v", err)
+// MachineTag returns the ACL tag applied to a computer's node, e.g. "tag:computer-ws01".
+// Returns an empty string when the name has no usable characters.
+func MachineTag(computerName string) string {
+	name := aclTagName(computerName)
+	if name == "" {
+		return ""
 	}
+	return "tag:computer-" + name
+}
 
-	// Find infrastructure user and get its ID
-	for _, user := range users {
-		if name, ok := user["name"].(string); ok && name == "infrastructure" {
-			if id, ok := user["id"].(float64); ok {
-				return int(id), nil
-			}
+// OverlayUserName returns the Headscale user name of a directory user, which
+// is how the user appears in policy groups
+func OverlayUserName(username string) string {
+	return aclTagName(username)
+}
+
+// aclTagName reduces a value to the characters Headscale accepts in a tag name
+func aclTagName(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == '_' || r == '.' || r == ' ':
+			b.WriteRune('-')
 		}
 	}
-
-	return 0, fmt.Errorf("infrastructure user not found")
+	return strings.Trim(b.String(), "-")
 }
 
 // IsEnabled checks if Headscale is available and configured
@@ -155,19 +170,9 @@ func (s *HeadscaleService) GetLoginServerBase() string {
 		return trimMeshAndSlash(url)
 	}
 
-	// Fallback: parse headscale config
-	content, err := os.ReadFile("/etc/headscale/config.yaml")
-	if err == nil {
-		lines := strings.Split(string(content), "\n")
-		for _, raw := range lines {
-			line := strings.TrimSpace(raw)
-			if strings.HasPrefix(line, "server_url:") {
-				val := strings.TrimSpace(strings.TrimPrefix(line, "server_url:"))
-				// remove optional quotes
-				val = strings.Trim(val, "\"'")
-				return trimMeshAndSlash(val)
-			}
-		}
+	// Fallback: headscale config
+	if config, err := loadHeadscaleConfig(); err == nil && config.ServerURL != "" {
+		return trimMeshAndSlash(config.ServerURL)
 	}
 
 	return ""
@@ -183,17 +188,8 @@ func (s *HeadscaleService) GetLoginServerFull() string {
 		return url
 	}
 
-	content, err := os.ReadFile("/etc/headscale/config.yaml")
-	if err == nil {
-		lines := strings.Split(string(content), "\n")
-		for _, raw := range lines {
-			line := strings.TrimSpace(raw)
-			if strings.HasPrefix(line, "server_url:") {
-				val := strings.TrimSpace(strings.TrimPrefix(line, "server_url:"))
-				val = strings.Trim(val, "\"'")
-				return val
-			}
-		}
+	if config, err := loadHeadscaleConfig(); err == nil {
+		return config.ServerURL
 	}
 
 	return ""
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	vexaexec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const overlayUserSettingsPath = "/etc/vexa/overlay-users.json"
+
+// infrastructureUser owns the nodes of domain computers
+const infrastructureUser = "infrastructure"
+
+// directoryUsernames lists the sAMAccountNames of all directory users. Tests
+// replace it.
+var directoryUsernames = func() ([]string, error) {
+	sambaTool := vexaexec.NewSambaTool()
+	output, err := sambaTool.UserList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %s", output)
+	}
+	return sambaTool.ParseUserList(output), nil
+}
+
+// GetUserSettings returns the limits on personal pre-auth keys
+func (s *HeadscaleService) GetUserSettings() (*models.OverlayUserSettings, error) {
+	settings := &models.OverlayUserSettings{
+		PersonalKeyLimit:      3,
+		PersonalKeyTTLMinutes: 60,
+	}
+
+	data, err := os.ReadFile(overlayUserSettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to read overlay user settings: %v", err)
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse overlay user settings: %v", err)
+	}
+	return settings, nil
+}
+
+// SaveUserSettings validates and stores the limits on personal pre-auth keys
+func (s *HeadscaleService) SaveUserSettings(settings models.OverlayUserSettings) (*models.OverlayUserSettings, error) {
+	if settings.PersonalKeyLimit < 0 || settings.PersonalKeyLimit > 10 {
+		return nil, fmt.Errorf("personal key limit must be between 0 and 10")
+	}
+	if settings.PersonalKeyTTLMinutes < 5 || settings.PersonalKeyTTLMinutes > 1440 {
+		return nil, fmt.Errorf("personal key lifetime must be between 5 and 1440 minutes")
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(overlayUserSettingsPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create settings directory: %v", err)
+	}
+	if err := os.WriteFile(overlayUserSettingsPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save overlay user settings: %v", err)
+	}
+	return &settings, nil
+}
+
+// EnsureUser returns the Headscale user matching a directory user, creating
+// it when it does not exist yet
+func (s *HeadscaleService) EnsureUser(username string) (*headscale.User, error) {
+	name, err := overlayUserFor(username)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := vexaexec.NewLdbTool().UserDN(username); err != nil {
+		return nil, fmt.Errorf("user %s not found in the directory", username)
+	}
+
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	if user, err := client.FindUser(name); err == nil {
+		return user, nil
+	}
+	return client.CreateUser(name)
+}
+
+// SyncUsers creates a Headscale user for every directory user that lacks
+// one and returns the names created
+func (s *HeadscaleService) SyncUsers() ([]string, error) {
+	users, err := NewUserService().ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := client.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, user := range existing {
+		known[user.Name] = true
+	}
+
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	shared := overlayUserOwners(usernames)
+
+	created := []string{}
+	for _, user := range users {
+		name := OverlayUserName(user.Username)
+		if name == "" || name == infrastructureUser || known[name] {
+			continue
+		}
+		if owners := shared[name]; len(owners) > 1 {
+			utils.Warn("Not creating overlay user %s: it would be shared by %s", name, strings.Join(owners, ", "))
+			continue
+		}
+		if _, err := client.CreateUser(name); err != nil {
+			utils.Warn("Failed to create overlay user for %s: %v", user.Username, err)
+			continue
+		}
+		known[name] = true
+		created = append(created, name)
+	}
+	return created, nil
+}
+
+// UserNodes returns the nodes registered under a directory user's Headscale user
+func (s *HeadscaleService) UserNodes(username string) ([]headscale.Node, error) {
+	name, err := overlayUserFor(username)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := s.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	owned := []headscale.Node{}
+	for _, node := range nodes {
+		if node.User == name {
+			owned = append(owned, node)
+		}
+	}
+	return owned, nil
+}
+
+// UserKeys returns a directory user's pre-auth keys. Key values are masked;
+// they are only shown when created.
+func (s *HeadscaleService) UserKeys(username string) ([]headscale.PreAuthKey, error) {
+	name, err := overlayUserFor(username)
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	user, err := client.FindUser(name)
+	if err != nil {
+		return []headscale.PreAuthKey{}, nil
+	}
+	keys, err := client.ListPreAuthKeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i].Key = maskKey(keys[i].Key)
+	}
+	return keys, nil
+}
+
+// CreatePersonalKey mints a short-lived single-use pre-auth key with which a
+// user enrolls one of their own devices under their Headscale user
+func (s *HeadscaleService) CreatePersonalKey(username string) (*models.PersonalPreAuthKey, error) {
+	settings, err := s.GetUserSettings()
+	if err != nil {
+		return nil, err
+	}
+	if settings.PersonalKeyLimit == 0 {
+		return nil, fmt.Errorf("personal device enrollment is disabled")
+	}
+
+	user, err := s.EnsureUser(username)
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := client.ListPreAuthKeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if active := activeKeyCount(keys, time.Now()); active >= settings.PersonalKeyLimit {
+		return nil, fmt.Errorf("you already have %d unused keys; use or let them expire before creating another", active)
+	}
+
+	ttl := time.Duration(settings.PersonalKeyTTLMinutes) * time.Minute
+	key, err := client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{
+		UserID:     user.ID,
+		Expiration: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	personal := &models.PersonalPreAuthKey{
+		Key:         key.Key,
+		OverlayUser: user.Name,
+		ExpiresAt:   time.Now().Add(ttl).UTC(),
+		LoginServer: s.GetLoginServerFull(),
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, key.Expiration); err == nil {
+		personal.ExpiresAt = expiresAt
+	}
+	if personal.LoginServer != "" {
+		personal.Command = fmt.Sprintf("tailscale up --login-server %s --authkey %s", personal.LoginServer, key.Key)
+	}
+	return personal, nil
+}
+
+// RemoveUser deletes a directory user's nodes and Headscale user during
+// offboarding. It returns the nodes removed.
+func (s *HeadscaleService) RemoveUser(username string) ([]headscale.Node, error) {
+	name, err := overlayUserFor(username)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.findUser(name)
+	if err != nil {
+		return nil, nil
+	}
+
+	nodes, err := s.UserNodes(username)
+	if err != nil {
+		return nil, err
+	}
+	client, err := headscaleClient()
+	if err != nil {
+		return nil, err
+	}
+	removed := []headscale.Node{}
+	for _, node := range nodes {
+		if err := client.DeleteNode(node.ID); err != nil {
+			return removed, err
+		}
+		removed = append(removed, node)
+	}
+	return removed, client.DeleteUser(user.ID)
+}
+
+// overlayUserFor returns the Headscale user name for a directory user.
+// Reducing names to what Headscale accepts can map different users to the
+// same overlay user (j.smith and j_smith both become j-smith); such users are
+// refused, as is the infrastructure user's name, so that nobody is handed or
+// removes another person's devices.
+func overlayUserFor(username string) (string, error) {
+	name := OverlayUserName(username)
+	if name == "" {
+		return "", fmt.Errorf("user %s has no usable characters for an overlay user name", username)
+	}
+	if name == infrastructureUser {
+		return "", fmt.Errorf("user %s would share the infrastructure overlay user", username)
+	}
+
+	usernames, err := directoryUsernames()
+	if err != nil {
+		return "", err
+	}
+	for _, other := range usernames {
+		if !strings.EqualFold(other, username) && OverlayUserName(other) == name {
+			return "", fmt.Errorf("users %s and %s would share the overlay user %s; rename one of them", username, other, name)
+		}
+	}
+	return name, nil
+}
+
+// overlayUserOwners groups directory usernames by overlay user name, so that
+// names shared by several users can be skipped
+func overlayUserOwners(usernames []string) map[string][]string {
+	owners := make(map[string][]string)
+	for _, username := range usernames {
+		if name := OverlayUserName(username); name != "" {
+			owners[name] = append(owners[name], username)
+		}
+	}
+	return owners
+}
+
+// activeKeyCount counts keys that are unused and not yet expired
+func activeKeyCount(keys []headscale.PreAuthKey, now time.Time) int {
+	count := 0
+	for _, key := range keys {
+		if key.Used {
+			continue
+		}
+		if expiresAt, err := time.Parse(time.RFC3339, key.Expiration); err == nil && expiresAt.Before(now) {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// maskKey keeps enough of a key to recognise it
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:8] + strings.Repeat("*", 8)
+}
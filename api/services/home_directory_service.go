@@ -0,0 +1,292 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/config"
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// Home directory delete actions
+const (
+	HomeDeleteArchive = "archive"
+	HomeDeleteRemove  = "remove"
+	HomeDeleteKeep    = "keep"
+)
+
+const homeDirectoryPolicyPath = "/etc/vexa/home-directories.json"
+
+// HomeDirectoryService provisions and cleans up user home directories and roaming profiles
+type HomeDirectoryService struct {
+	shareService *ShareService
+	ldbTool      *exec.LdbTool
+}
+
+// NewHomeDirectoryService creates a new HomeDirectoryService instance
+func NewHomeDirectoryService() *HomeDirectoryService {
+	return &HomeDirectoryService{
+		shareService: NewShareService(),
+		ldbTool:      exec.NewLdbTool(),
+	}
+}
+
+// GetPolicy returns the home directory policy, or defaults when none is saved
+func (s *HomeDirectoryService) GetPolicy() (*models.HomeDirectoryPolicy, error) {
+	policy := &models.HomeDirectoryPolicy{
+		HomeDrive:    "H:",
+		DeleteAction: HomeDeleteArchive,
+		ArchivePath:  "/var/lib/vexa/home-archive",
+	}
+
+	data, err := os.ReadFile(homeDirectoryPolicyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return policy, nil
+		}
+		return nil, fmt.Errorf("failed to read home directory policy: %v", err)
+	}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse home directory policy: %v", err)
+	}
+	return policy, nil
+}
+
+// SavePolicy validates and stores the home directory policy
+func (s *HomeDirectoryService) SavePolicy(policy *models.HomeDirectoryPolicy) error {
+	policy.HomeDrive = strings.ToUpper(strings.TrimSpace(policy.HomeDrive))
+	if policy.HomeDrive != "" && !strings.HasSuffix(policy.HomeDrive, ":") {
+		policy.HomeDrive += ":"
+	}
+	if policy.HomeDrive != "" && (len(policy.HomeDrive) != 2 || policy.HomeDrive[0] < 'A' || policy.HomeDrive[0] > 'Z') {
+		return fmt.Errorf("invalid home drive: %s", policy.HomeDrive)
+	}
+
+	switch policy.DeleteAction {
+	case "":
+		policy.DeleteAction = HomeDeleteArchive
+	case HomeDeleteArchive, HomeDeleteRemove, HomeDeleteKeep:
+	default:
+		return fmt.Errorf("invalid delete action: %s (expected archive, remove or keep)", policy.DeleteAction)
+	}
+	if policy.DeleteAction == HomeDeleteArchive && !filepath.IsAbs(policy.ArchivePath) {
+		return fmt.Errorf("archive path must be an absolute path")
+	}
+
+	if policy.Enabled && policy.Share == "" {
+		return fmt.Errorf("a home directory share is required when provisioning is enabled")
+	}
+	if policy.Share != "" {
+		if _, err := s.shareService.GetShare(policy.Share); err != nil {
+			return err
+		}
+	}
+	if policy.ProfileShare != "" {
+		if _, err := s.shareService.GetShare(policy.ProfileShare); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(homeDirectoryPolicyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return os.WriteFile(homeDirectoryPolicyPath, data, 0600)
+}
+
+// Provision creates the user's home directory with owner-only access and sets
+// homeDirectory, homeDrive and profilePath on the account
+func (s *HomeDirectoryService) Provision(username string) (*models.HomeDirectoryResult, error) {
+	if err := validateHomeUsername(username); err != nil {
+		return nil, err
+	}
+	policy, err := s.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if policy.Share == "" {
+		return nil, fmt.Errorf("no home directory share is configured")
+	}
+
+	share, err := s.shareService.GetShare(policy.Share)
+	if err != nil {
+		return nil, err
+	}
+	userDN, err := s.ldbTool.UserDN(username)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %s", username)
+	}
+
+	localPath := filepath.Join(share.Path, username)
+	if err := os.MkdirAll(localPath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create home directory: %v", err)
+	}
+	if err := os.Chmod(localPath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to set home directory permissions: %v", err)
+	}
+
+	workgroup := s.shareService.Workgroup()
+	cmd, err := utils.SafeCommand("chown", "-R", qualifyGroup(workgroup, username), localPath)
+	if err != nil {
+		return nil, fmt.Errorf("command sanitization failed: %v", err)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to set home directory owner: %s", strings.TrimSpace(string(output)))
+	}
+
+	// Domain Admins keep full control so the directory can be managed and archived
+	admins := qualifyGroup(workgroup, "Domain Admins")
+	cmd, err = utils.SafeCommand("setfacl", "-R", "-m", fmt.Sprintf("g:%s:rwx,d:g:%s:rwx", admins, admins), localPath)
+	if err != nil {
+		return nil, fmt.Errorf("command sanitization failed: %v", err)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		utils.Warn("Failed to grant %s access to %s: %s", admins, localPath, strings.TrimSpace(string(output)))
+	}
+
+	server := s.serverName(policy)
+	result := &models.HomeDirectoryResult{
+		HomeDirectory: fmt.Sprintf(`\\%s\%s\%s`, server, share.Name, username),
+		HomeDrive:     policy.HomeDrive,
+		LocalPath:     localPath,
+	}
+	if policy.ProfileShare != "" {
+		result.ProfilePath = fmt.Sprintf(`\\%s\%s\%s`, server, policy.ProfileShare, username)
+	}
+
+	if err := s.ldbTool.ReplaceAttribute(userDN, "homeDirectory", result.HomeDirectory); err != nil {
+		return nil, fmt.Errorf("failed to set homeDirectory: %v", err)
+	}
+	if result.HomeDrive != "" {
+		if err := s.ldbTool.ReplaceAttribute(userDN, "homeDrive", result.HomeDrive); err != nil {
+			return nil, fmt.Errorf("failed to set homeDrive: %v", err)
+		}
+	}
+	if result.ProfilePath != "" {
+		if err := s.ldbTool.ReplaceAttribute(userDN, "profilePath", result.ProfilePath); err != nil {
+			return nil, fmt.Errorf("failed to set profilePath: %v", err)
+		}
+	}
+
+	utils.Info("Provisioned home directory for %s at %s", username, localPath)
+	return result, nil
+}
+
+// Deprovision archives or removes the user's home directory and roaming profile
+// according to the policy's delete action
+func (s *HomeDirectoryService) Deprovision(username string) error {
+	if err := validateHomeUsername(username); err != nil {
+		return err
+	}
+	policy, err := s.GetPolicy()
+	if err != nil {
+		return err
+	}
+	if policy.DeleteAction == HomeDeleteKeep || policy.Share == "" {
+		return nil
+	}
+
+	var paths []string
+	if share, err := s.shareService.GetShare(policy.Share); err == nil {
+		paths = append(paths, filepath.Join(share.Path, username))
+	}
+	if policy.ProfileShare != "" {
+		if share, err := s.shareService.GetShare(policy.ProfileShare); err == nil {
+			paths = append(paths, filepath.Join(share.Path, username))
+			paths = append(paths, roamingProfileDirs(share.Path, username)...)
+		}
+	}
+
+	for _, path := range paths {
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		if policy.DeleteAction == HomeDeleteArchive {
+			if err := archiveDirectory(path, policy.ArchivePath); err != nil {
+				return err
+			}
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		utils.Info("Removed home directory %s for %s (%s)", path, username, policy.DeleteAction)
+	}
+	return nil
+}
+
+// serverName returns the server name used in UNC paths
+func (s *HomeDirectoryService) serverName(policy *models.HomeDirectoryPolicy) string {
+	if policy.Server != "" {
+		return policy.Server
+	}
+	hostname := config.LoadConfig().ServerHostname
+	if idx := strings.Index(hostname, "."); idx > 0 {
+		hostname = hostname[:idx]
+	}
+	return strings.ToUpper(hostname)
+}
+
+// archiveDirectory writes a compressed tarball of a directory into archiveDir
+func archiveDirectory(path, archiveDir string) error {
+	if err := os.MkdirAll(archiveDir, 0700); err != nil {
+		return fmt.Errorf("failed to create archive directory: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.tar.gz", filepath.Base(path), time.Now().Format("20060102-150405"))
+	archive := filepath.Join(archiveDir, name)
+
+	cmd, err := utils.SafeCommand("tar", "-czf", archive, "-C", filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("command sanitization failed: %v", err)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to archive %s: %s", path, strings.TrimSpace(string(output)))
+	}
+	if err := os.Chmod(archive, 0600); err != nil {
+		utils.Warn("Failed to restrict permissions on %s: %v", archive, err)
+	}
+
+	utils.Info("Archived %s to %s", path, archive)
+	return nil
+}
+
+// roamingProfileDirs lists the versioned profile folders Windows creates for
+// a user (user.V2, user.V6, ...). Names are compared literally, never as a
+// pattern, so one user's name cannot match another user's profile.
+func roamingProfileDirs(dir, username string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	prefix := username + ".V"
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) <= len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+			continue
+		}
+		if strings.Trim(name[len(prefix):], "0123456789") != "" {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
+
+// validateHomeUsername applies the user service's sAMAccountName character
+// check, which also keeps path separators and glob characters out
+func validateHomeUsername(username string) error {
+	if !utils.IsSafeUsername(username) || strings.HasPrefix(username, ".") {
+		return fmt.Errorf("invalid username: %s", username)
+	}
+	return nil
+}
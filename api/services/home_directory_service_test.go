@@ -0,0 +1,39 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateHomeUsername(t *testing.T) {
+	for _, username := range []string{"jsmith", "j.smith", "svc-backup", "Admin_2"} {
+		if err := validateHomeUsername(username); err != nil {
+			t.Errorf("validateHomeUsername(%q) = %v", username, err)
+		}
+	}
+	for _, username := range []string{"", "*", "j*", "js?ith", "[a-z]*", "../jsmith", `corp\jsmith`, ".hidden", "j smith", "a;b"} {
+		if err := validateHomeUsername(username); err == nil {
+			t.Errorf("validateHomeUsername(%q) accepted", username)
+		}
+	}
+}
+
+func TestRoamingProfileDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"jsmith", "jsmith.V2", "JSmith.V6", "jsmith.V", "jsmith.Vx", "jsmith.V6.bak", "jsmithers.V6", "ajsmith.V6"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := roamingProfileDirs(dir, "jsmith")
+	want := []string{filepath.Join(dir, "JSmith.V6"), filepath.Join(dir, "jsmith.V2")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("roamingProfileDirs = %v, want %v", got, want)
+	}
+	if got := roamingProfileDirs(filepath.Join(dir, "missing"), "jsmith"); got != nil {
+		t.Errorf("roamingProfileDirs of a missing share = %v", got)
+	}
+}
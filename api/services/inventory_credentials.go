@@ -0,0 +1,251 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/models"
+)
+
+const (
+	// inventoryCredentialsPath stores the check-in credential of each computer
+	inventoryCredentialsPath = "/var/lib/vexa/inventory-credentials.json"
+
+	// unboundCredentialTTL is how long a credential may wait for the first
+	// check-in that binds it to its computer
+	unboundCredentialTTL = 7 * 24 * time.Hour
+)
+
+// ErrInventoryHostnameMismatch is returned when a report names a computer
+// other than the one its credential belongs to
+var ErrInventoryHostnameMismatch = errors.New("check-in credential belongs to another computer")
+
+// inventoryCredential is the secret one computer checks in with. It is
+// issued with a deployment script and bound to the computer account's GUID
+// by the first check-in that uses it.
+type inventoryCredential struct {
+	ID           string     `json:"id"`
+	SecretHash   string     `json:"secret_hash"`             // Hex SHA-256 of the secret
+	ExpectedName string     `json:"expected_name,omitempty"` // Computer the script was issued for, if named
+	ComputerKey  string     `json:"computer_key,omitempty"`  // objectGUID (or SID) once bound
+	ComputerName string     `json:"computer_name,omitempty"` // Name when bound
+	JoinTokenID  string     `json:"join_token_id,omitempty"`
+	IssuedAt     time.Time  `json:"issued_at"`
+	BoundAt      *time.Time `json:"bound_at,omitempty"`
+}
+
+// IssueCredential creates the check-in credential embedded in a deployment
+// script. A credential issued for a named computer may only be used by that
+// computer and replaces its previous credential; one issued without a name is
+// bound to the first computer without a credential that checks in with it.
+func (s *InventoryService) IssueCredential(computerName, joinTokenID string) (string, error) {
+	name := strings.TrimSuffix(strings.TrimSpace(computerName), "$")
+	if name != "" && !IsValidComputerName(name) {
+		return "", fmt.Errorf("invalid computer name: %s", computerName)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate credential: %v", err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate credential: %v", err)
+	}
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	credentials, err := loadInventoryCredentials()
+	if err != nil {
+		return "", err
+	}
+	credentials = append(credentials, inventoryCredential{
+		ID:           id,
+		SecretHash:   hashCredentialSecret(secret),
+		ExpectedName: name,
+		JoinTokenID:  joinTokenID,
+		IssuedAt:     time.Now().UTC(),
+	})
+	if err := saveInventoryCredentials(credentials); err != nil {
+		return "", err
+	}
+	return id + "." + secret, nil
+}
+
+// IssueComputerCredential creates a credential for an existing computer, e.g.
+// one deployed before computers had their own credentials. The computer's
+// check-in configuration has to be updated with it.
+func (s *InventoryService) IssueComputerCredential(computerName string) (*models.InventoryCredential, error) {
+	name := strings.TrimSuffix(strings.TrimSpace(computerName), "$")
+	if !NewComputerService().ComputerExists(name) {
+		return nil, fmt.Errorf("computer %s not found", name)
+	}
+	credential, err := s.IssueCredential(name, "")
+	if err != nil {
+		return nil, err
+	}
+	return &models.InventoryCredential{
+		ComputerName: name,
+		Credential:   credential,
+		ExpiresAt:    time.Now().Add(unboundCredentialTTL).UTC(),
+	}, nil
+}
+
+// ValidateCredential reports whether a bearer credential was issued by Vexa
+// and is still usable. It does not check which computer may use it.
+func (s *InventoryService) ValidateCredential(credential string) bool {
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	credentials, err := loadInventoryCredentials()
+	if err != nil {
+		return false
+	}
+	return findInventoryCredential(credentials, credential, time.Now()) >= 0
+}
+
+// authorizeCheckIn checks that credential may report for the computer and
+// binds it on first use. Callers hold inventoryMutex.
+func authorizeCheckIn(credential, computerName string) error {
+	credentials, err := loadInventoryCredentials()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	index := findInventoryCredential(credentials, credential, now)
+	if index < 0 {
+		return fmt.Errorf("invalid check-in credential")
+	}
+
+	identity, err := NewComputerService().computerIdentity(computerName)
+	if err != nil {
+		return fmt.Errorf("computer %s has no directory account", computerName)
+	}
+	current := credentials[index]
+	if current.ComputerKey != "" {
+		if current.ComputerKey != identity.key() {
+			return ErrInventoryHostnameMismatch
+		}
+		return nil
+	}
+
+	// First check-in with this credential
+	if current.ExpectedName != "" && !strings.EqualFold(current.ExpectedName, identity.Name) {
+		return ErrInventoryHostnameMismatch
+	}
+	kept := credentials[:0]
+	for i, other := range credentials {
+		if i != index && other.ComputerKey == identity.key() {
+			if current.ExpectedName == "" {
+				return fmt.Errorf("%w: %s already has a credential", ErrInventoryHostnameMismatch, identity.Name)
+			}
+			continue // Replaced by the credential issued for this computer
+		}
+		kept = append(kept, other)
+	}
+	credentials = kept
+	for i := range credentials {
+		if credentials[i].ID == current.ID {
+			boundAt := now.UTC()
+			credentials[i].ComputerKey = identity.key()
+			credentials[i].ComputerName = identity.Name
+			credentials[i].BoundAt = &boundAt
+		}
+	}
+	return saveInventoryCredentials(credentials)
+}
+
+// removeInventoryCredentials drops the credentials of a deleted computer.
+// Callers hold inventoryMutex.
+func removeInventoryCredentials(computerName string) error {
+	credentials, err := loadInventoryCredentials()
+	if err != nil {
+		return err
+	}
+	kept := credentials[:0]
+	for _, credential := range credentials {
+		if strings.EqualFold(credential.ComputerName, computerName) ||
+			(credential.ComputerKey == "" && strings.EqualFold(credential.ExpectedName, computerName)) {
+			continue
+		}
+		kept = append(kept, credential)
+	}
+	if len(kept) == len(credentials) {
+		return nil
+	}
+	return saveInventoryCredentials(kept)
+}
+
+// findInventoryCredential returns the index of the credential matching a
+// bearer value of the form <id>.<secret>, or -1
+func findInventoryCredential(credentials []inventoryCredential, value string, now time.Time) int {
+	id, secret, ok := strings.Cut(value, ".")
+	if !ok || id == "" || secret == "" {
+		return -1
+	}
+	hash := hashCredentialSecret(secret)
+	for i, credential := range credentials {
+		if credential.ID != id {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(credential.SecretHash)) != 1 {
+			return -1
+		}
+		if credential.ComputerKey == "" && now.Sub(credential.IssuedAt) > unboundCredentialTTL {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+func hashCredentialSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadInventoryCredentials() ([]inventoryCredential, error) {
+	var credentials []inventoryCredential
+	data, err := os.ReadFile(inventoryCredentialsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return credentials, nil
+		}
+		return nil, fmt.Errorf("failed to read inventory credentials: %v", err)
+	}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory credentials: %v", err)
+	}
+	return credentials, nil
+}
+
+// saveInventoryCredentials stores the credentials, dropping unbound ones
+// that expired
+func saveInventoryCredentials(credentials []inventoryCredential) error {
+	now := time.Now()
+	kept := make([]inventoryCredential, 0, len(credentials))
+	for _, credential := range credentials {
+		if credential.ComputerKey == "" && now.Sub(credential.IssuedAt) > unboundCredentialTTL {
+			continue
+		}
+		kept = append(kept, credential)
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(inventoryCredentialsPath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return writeInventoryFile(inventoryCredentialsPath, data)
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/models"
+)
+
+const (
+	inventorySettingsPath = "/etc/vexa/inventory.json"
+	inventoryStorePath    = "/var/lib/vexa/inventory.json"
+	// inventoryHistoryLimit caps the change history kept per computer
+	inventoryHistoryLimit = 200
+	// Upper bounds on a single report, so a misbehaving client cannot bloat the store
+	maxInventoryUpdates = 2000
+	maxInventoryDisks   = 64
+	maxInventoryField   = 256
+)
+
+// inventoryMutex serializes access to the inventory store and the check-in
+// credentials
+var inventoryMutex sync.Mutex
+
+// inventoryRecord is the stored inventory of one computer
+type inventoryRecord struct {
+	Latest  models.ComputerInventory `json:"latest"`
+	History []models.InventoryChange `json:"history"`
+}
+
+// InventoryService receives inventory check-ins from computers and keeps the
+// latest inventory and a history of changes per computer
+type InventoryService struct{}
+
+// NewInventoryService creates a new InventoryService instance
+func NewInventoryService() *InventoryService {
+	return &InventoryService{}
+}
+
+// GetSettings returns the inventory settings
+func (s *InventoryService) GetSettings() (*models.InventorySettings, error) {
+	settings := &models.InventorySettings{IntervalHours: 4}
+
+	data, err := os.ReadFile(inventorySettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to read inventory settings: %v", err)
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory settings: %v", err)
+	}
+	return settings, nil
+}
+
+// SetInterval changes how often newly deployed computers check in. Hourly
+// scheduled tasks repeat at most every 23 hours.
+func (s *InventoryService) SetInterval(hours int) (*models.InventorySettings, error) {
+	if hours < 1 || hours > 23 {
+		return nil, fmt.Errorf("interval must be between 1 and 23 hours")
+	}
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings.IntervalHours = hours
+	if err := s.writeSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// CheckIn stores a computer's inventory report and records what changed since
+// its previous check-in. Only the computer the credential was issued to may
+// report, and only while it has a directory account.
+func (s *InventoryService) CheckIn(report models.InventoryReport, credential, sourceAddress string) (*models.ComputerInventory, []models.InventoryChange, error) {
+	name := strings.TrimSuffix(strings.TrimSpace(report.Hostname), "$")
+	if !IsValidComputerName(name) {
+		return nil, nil, fmt.Errorf("invalid hostname: %s", report.Hostname)
+	}
+	report.Hostname = name
+	normalizeInventoryReport(&report)
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	if err := authorizeCheckIn(credential, name); err != nil {
+		return nil, nil, err
+	}
+
+	records, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	inventory := models.ComputerInventory{
+		ComputerName:    name,
+		InventoryReport: report,
+		ReceivedAt:      now,
+		SourceAddress:   sourceAddress,
+	}
+
+	key := strings.ToLower(name)
+	record, exists := records[key]
+	var changes []models.InventoryChange
+	if exists {
+		changes = diffInventory(record.Latest.InventoryReport, report, now)
+	} else {
+		changes = []models.InventoryChange{{ChangedAt: now, Field: "enrolled", New: report.OSBuild}}
+	}
+
+	record.Latest = inventory
+	record.History = append(record.History, changes...)
+	if len(record.History) > inventoryHistoryLimit {
+		record.History = record.History[len(record.History)-inventoryHistoryLimit:]
+	}
+	records[key] = record
+
+	if err := s.save(records); err != nil {
+		return nil, nil, err
+	}
+	return &inventory, changes, nil
+}
+
+// Get returns the latest inventory of a computer and its change history, newest first
+func (s *InventoryService) Get(computerName string) (*models.ComputerInventory, []models.InventoryChange, error) {
+	inventoryMutex.Lock()
+	records, err := s.load()
+	inventoryMutex.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	record, ok := records[strings.ToLower(strings.TrimSuffix(computerName, "$"))]
+	if !ok {
+		return nil, nil, fmt.Errorf("no inventory received from %s", computerName)
+	}
+
+	history := make([]models.InventoryChange, len(record.History))
+	for i, change := range record.History {
+		history[len(history)-1-i] = change
+	}
+	return &record.Latest, history, nil
+}
+
+// Summaries returns the listing summary of every computer that has checked
+// in, keyed by lowercase computer name
+func (s *InventoryService) Summaries() map[string]models.InventorySummary {
+	summaries := map[string]models.InventorySummary{}
+	inventoryMutex.Lock()
+	records, err := s.load()
+	inventoryMutex.Unlock()
+	if err != nil {
+		return summaries
+	}
+
+	for key, record := range records {
+		latest := record.Latest
+		summary := models.InventorySummary{
+			OSBuild:      latest.OSBuild,
+			LoggedOnUser: latest.LoggedOnUser,
+			SerialNumber: latest.SerialNumber,
+			LastCheckIn:  latest.ReceivedAt,
+		}
+		for _, disk := range latest.Disks {
+			if disk.SizeBytes == 0 {
+				continue
+			}
+			free := float64(int(float64(disk.FreeBytes)*1000/float64(disk.SizeBytes))) / 10
+			if summary.LowestFree == nil || free < *summary.LowestFree {
+				summary.LowestFree = &free
+			}
+		}
+		summaries[key] = summary
+	}
+	return summaries
+}
+
+// Remove drops the stored inventory and check-in credentials of a deleted computer
+func (s *InventoryService) Remove(computerName string) error {
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	if err := removeInventoryCredentials(strings.TrimSuffix(computerName, "$")); err != nil {
+		return err
+	}
+	records, err := s.load()
+	if err != nil {
+		return err
+	}
+	key := strings.ToLower(strings.TrimSuffix(computerName, "$"))
+	if _, ok := records[key]; !ok {
+		return nil
+	}
+	delete(records, key)
+	return s.save(records)
+}
+
+func (s *InventoryService) load() (map[string]inventoryRecord, error) {
+	records := map[string]inventoryRecord{}
+	data, err := os.ReadFile(inventoryStorePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("failed to read inventory: %v", err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %v", err)
+	}
+	return records, nil
+}
+
+func (s *InventoryService) save(records map[string]inventoryRecord) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(inventoryStorePath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return writeInventoryFile(inventoryStorePath, data)
+}
+
+// writeInventoryFile replaces a state file by writing a new file next to it
+// and renaming it into place, so readers never see a partial file
+func writeInventoryFile(path string, data []byte) error {
+	tmpPath := path + ".vexa-new"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func (s *InventoryService) writeSettings(settings *models.InventorySettings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(inventorySettingsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return writeInventoryFile(inventorySettingsPath, data)
+}
+
+// normalizeInventoryReport trims and bounds a report and sorts its lists so
+// consecutive reports compare cleanly
+func normalizeInventoryReport(report *models.InventoryReport) {
+	clip := func(value string) string {
+		value = strings.TrimSpace(value)
+		if len(value) > maxInventoryField {
+			value = value[:maxInventoryField]
+		}
+		return value
+	}
+
+	report.OSName = clip(report.OSName)
+	report.OSVersion = clip(report.OSVersion)
+	report.OSBuild = clip(report.OSBuild)
+	report.LoggedOnUser = clip(report.LoggedOnUser)
+	report.SerialNumber = clip(report.SerialNumber)
+	report.Manufacturer = clip(report.Manufacturer)
+	report.Model = clip(report.Model)
+
+	if len(report.Updates) > maxInventoryUpdates {
+		report.Updates = report.Updates[:maxInventoryUpdates]
+	}
+	updates := make([]models.InstalledUpdate, 0, len(report.Updates))
+	for _, update := range report.Updates {
+		update.ID = clip(update.ID)
+		if update.ID == "" {
+			continue
+		}
+		update.Description = clip(update.Description)
+		update.InstalledOn = clip(update.InstalledOn)
+		updates = append(updates, update)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].ID < updates[j].ID })
+	report.Updates = updates
+
+	if len(report.Disks) > maxInventoryDisks {
+		report.Disks = report.Disks[:maxInventoryDisks]
+	}
+	disks := make([]models.DiskUsage, 0, len(report.Disks))
+	for _, disk := range report.Disks {
+		disk.Name = clip(disk.Name)
+		if disk.Name == "" {
+			continue
+		}
+		disk.FileSystem = clip(disk.FileSystem)
+		disks = append(disks, disk)
+	}
+	sort.Slice(disks, func(i, j int) bool { return disks[i].Name < disks[j].Name })
+	report.Disks = disks
+}
+
+// diffInventory lists the changes between two reports. Free disk space moves
+// constantly and is not recorded; disks appearing, disappearing or changing
+// size are.
+func diffInventory(old, current models.InventoryReport, at time.Time) []models.InventoryChange {
+	var changes []models.InventoryChange
+	record := func(field, oldValue, newValue string) {
+		changes = append(changes, models.InventoryChange{ChangedAt: at, Field: field, Old: oldValue, New: newValue})
+	}
+
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"os_name", old.OSName, current.OSName},
+		{"os_version", old.OSVersion, current.OSVersion},
+		{"os_build", old.OSBuild, current.OSBuild},
+		{"logged_on_user", old.LoggedOnUser, current.LoggedOnUser},
+		{"serial_number", old.SerialNumber, current.SerialNumber},
+		{"manufacturer", old.Manufacturer, current.Manufacturer},
+		{"model", old.Model, current.Model},
+	}
+	for _, field := range fields {
+		if field.old != field.new {
+			record(field.name, field.old, field.new)
+		}
+	}
+
+	oldUpdates := map[string]bool{}
+	for _, update := range old.Updates {
+		oldUpdates[update.ID] = true
+	}
+	newUpdates := map[string]bool{}
+	for _, update := range current.Updates {
+		newUpdates[update.ID] = true
+		if !oldUpdates[update.ID] {
+			record("update_installed", "", update.ID)
+		}
+	}
+	for _, update := range old.Updates {
+		if !newUpdates[update.ID] {
+			record("update_removed", update.ID, "")
+		}
+	}
+
+	oldDisks := map[string]models.DiskUsage{}
+	for _, disk := range old.Disks {
+		oldDisks[disk.Name] = disk
+	}
+	newDisks := map[string]bool{}
+	for _, disk := range current.Disks {
+		newDisks[disk.Name] = true
+		previous, ok := oldDisks[disk.Name]
+		switch {
+		case !ok:
+			record("disk_added", "", fmt.Sprintf("%s (%d bytes)", disk.Name, disk.SizeBytes))
+		case previous.SizeBytes != disk.SizeBytes:
+			record("disk_resized", fmt.Sprintf("%s (%d bytes)", disk.Name, previous.SizeBytes),
+				fmt.Sprintf("%s (%d bytes)", disk.Name, disk.SizeBytes))
+		}
+	}
+	for _, disk := range old.Disks {
+		if !newDisks[disk.Name] {
+			record("disk_removed", fmt.Sprintf("%s (%d bytes)", disk.Name, disk.SizeBytes), "")
+		}
+	}
+
+	return changes
+}
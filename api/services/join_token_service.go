@@ -0,0 +1,511 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const (
+	joinTokenStorePath  = "/var/lib/vexa/join-tokens.json"
+	joinTokenSigningKey = "/var/lib/vexa/deployment-signing.key"
+
+	// DefaultJoinLinkTTL is how long a script link stays valid when not specified
+	DefaultJoinLinkTTL = time.Hour
+	// MaxJoinLinkTTL caps how long a script link may stay valid
+	MaxJoinLinkTTL = 24 * time.Hour
+
+	// machineKeyTTL is the lifetime of the pre-auth key embedded in a downloaded script
+	machineKeyTTL = time.Hour
+	// joinTokenRetention is how long finished tokens are kept for review
+	joinTokenRetention = 30 * 24 * time.Hour
+)
+
+var joinTokenMutex sync.Mutex
+
+// joinTokenRecord is the stored form of a token. The full pre-auth key is kept
+// so it can be expired on revoke, and offline join data until the script is
+// downloaded; neither is returned by the API.
+type joinTokenRecord struct {
+	models.JoinToken
+	PreAuthKey      string `json:"preauth_key,omitempty"`
+	OfflineJoinBlob string `json:"offline_join_blob,omitempty"`
+}
+
+// JoinTokenService issues signed one-time deployment script links and the
+// single-use pre-auth keys minted when they are downloaded
+type JoinTokenService struct {
+	headscaleService *HeadscaleService
+}
+
+// NewJoinTokenService creates a new JoinTokenService instance
+func NewJoinTokenService() *JoinTokenService {
+	return &JoinTokenService{
+		headscaleService: NewHeadscaleService(),
+	}
+}
+
+// Issue records a new pending token whose link expires after ttl
+func (s *JoinTokenService) Issue(token models.JoinToken, ttl time.Duration) (*models.JoinToken, error) {
+	if ttl <= 0 {
+		ttl = DefaultJoinLinkTTL
+	}
+	if ttl > MaxJoinLinkTTL {
+		return nil, fmt.Errorf("link lifetime cannot exceed %s", MaxJoinLinkTTL)
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate join token: %v", err)
+	}
+
+	now := time.Now().UTC()
+	token.ID = id
+	token.Status = "pending"
+	token.IssuedAt = now
+	token.ExpiresAt = now.Add(ttl)
+
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	records = append(records, joinTokenRecord{JoinToken: token})
+	if err := s.save(records); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// SetOfflineJoinBlob stores offline join data to embed when the token's script is downloaded
+func (s *JoinTokenService) SetOfflineJoinBlob(id, blob string) error {
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := findJoinToken(records, id)
+	if i < 0 {
+		return fmt.Errorf("join token %s not found", id)
+	}
+	records[i].OfflineJoin = true
+	records[i].OfflineJoinBlob = blob
+	return s.save(records)
+}
+
+// TakeOfflineJoinBlob returns a consumed token's offline join data and removes
+// it from the store, so it is handed out only once
+func (s *JoinTokenService) TakeOfflineJoinBlob(id string) (string, error) {
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	i := findJoinToken(records, id)
+	if i < 0 {
+		return "", fmt.Errorf("join token %s not found", id)
+	}
+	blob := records[i].OfflineJoinBlob
+	if records[i].Status != "consumed" || blob == "" {
+		return "", fmt.Errorf("join token %s has no offline join data", id)
+	}
+	records[i].OfflineJoinBlob = ""
+	if err := s.save(records); err != nil {
+		return "", err
+	}
+	return blob, nil
+}
+
+// SignedPath returns the API path and signed query string for a token's download link
+func (s *JoinTokenService) SignedPath(token *models.JoinToken) (string, error) {
+	expires := strconv.FormatInt(token.ExpiresAt.Unix(), 10)
+	sig, err := s.sign(token.ID, expires)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("sig", sig)
+	return "/api/v1/deployment/download/" + token.ID + "?" + query.Encode(), nil
+}
+
+// Consume validates a signed link and marks its token as used. A token can
+// only be consumed once.
+func (s *JoinTokenService) Consume(id, expires, sig, remoteAddr string) (*models.JoinToken, error) {
+	expected, err := s.sign(id, expires)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return nil, fmt.Errorf("invalid link signature")
+	}
+
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	i := findJoinToken(records, id)
+	if i < 0 {
+		return nil, fmt.Errorf("link not found")
+	}
+	record := &records[i]
+	if strconv.FormatInt(record.ExpiresAt.Unix(), 10) != expires {
+		return nil, fmt.Errorf("invalid link signature")
+	}
+	if record.Status != "pending" {
+		return nil, fmt.Errorf("link has already been %s", record.Status)
+	}
+	if time.Now().After(record.ExpiresAt) {
+		record.Status = "expired"
+		record.OfflineJoinBlob = ""
+		s.save(records)
+		return nil, fmt.Errorf("link has expired")
+	}
+
+	markJoinTokenConsumed(record, remoteAddr)
+	if err := s.save(records); err != nil {
+		return nil, err
+	}
+	token := record.JoinToken
+	return &token, nil
+}
+
+// IssueConsumed records a token for a script downloaded directly by an
+// authenticated administrator, which needs no link
+func (s *JoinTokenService) IssueConsumed(token models.JoinToken, remoteAddr string) (*models.JoinToken, error) {
+	issued, err := s.Issue(token, DefaultJoinLinkTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	i := findJoinToken(records, issued.ID)
+	if i < 0 {
+		return nil, fmt.Errorf("join token %s not found", issued.ID)
+	}
+	markJoinTokenConsumed(&records[i], remoteAddr)
+	if err := s.save(records); err != nil {
+		return nil, err
+	}
+	consumed := records[i].JoinToken
+	return &consumed, nil
+}
+
+// MintKey creates the single-use pre-auth key for a consumed token and
+// returns the full key for embedding in the script
+func (s *JoinTokenService) MintKey(id string) (string, error) {
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	i := findJoinToken(records, id)
+	if i < 0 {
+		return "", fmt.Errorf("join token %s not found", id)
+	}
+	record := &records[i]
+	if record.Status != "consumed" || record.PreAuthKey != "" {
+		return "", fmt.Errorf("join token %s cannot mint a key in state %s", id, record.Status)
+	}
+
+	key, err := s.headscaleService.CreateMachineKey(record.ComputerName, machineKeyTTL)
+	if err != nil {
+		record.Status = "failed"
+		record.Error = err.Error()
+		s.save(records)
+		return "", err
+	}
+
+	expiry := time.Now().UTC().Add(machineKeyTTL)
+	record.PreAuthKey = key.Key
+	record.PreAuthKeyID = key.ID
+	record.PreAuthKeyPrefix = keyPrefix(key.Key)
+	record.PreAuthKeyExpiry = &expiry
+	record.MachineTag = MachineTag(record.ComputerName)
+	if err := s.save(records); err != nil {
+		return "", err
+	}
+	return key.Key, nil
+}
+
+// Fail marks a token as failed, e.g. when its script could not be rendered,
+// and expires any key already minted for it
+func (s *JoinTokenService) Fail(id string, cause error) {
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return
+	}
+	if i := findJoinToken(records, id); i >= 0 {
+		if records[i].PreAuthKey != "" {
+			if err := s.headscaleService.ExpireInfrastructureKey(records[i].PreAuthKey); err != nil {
+				utils.Warn("Failed to expire pre-auth key for join token %s: %v", id, err)
+			}
+			records[i].PreAuthKey = ""
+		}
+		records[i].Status = "failed"
+		records[i].Error = cause.Error()
+		records[i].OfflineJoinBlob = ""
+		s.save(records)
+	}
+}
+
+// List returns all tracked tokens, newest first, after refreshing their status
+// from link expiry and Headscale key usage
+func (s *JoinTokenService) List() ([]models.JoinToken, error) {
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.refresh(records) {
+		if err := s.save(records); err != nil {
+			return nil, err
+		}
+	}
+
+	tokens := make([]models.JoinToken, 0, len(records))
+	for _, record := range records {
+		tokens = append(tokens, record.JoinToken)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].IssuedAt.After(tokens[j].IssuedAt)
+	})
+	return tokens, nil
+}
+
+// Revoke invalidates a token's link and expires its pre-auth key if the key
+// has not been used yet
+func (s *JoinTokenService) Revoke(id string) (*models.JoinToken, error) {
+	joinTokenMutex.Lock()
+	defer joinTokenMutex.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	i := findJoinToken(records, id)
+	if i < 0 {
+		return nil, fmt.Errorf("join token %s not found", id)
+	}
+	record := &records[i]
+
+	switch record.Status {
+	case "pending":
+	case "consumed":
+		if record.PreAuthKey == "" {
+			return nil, fmt.Errorf("join token has already been consumed")
+		}
+		if err := s.headscaleService.ExpireInfrastructureKey(record.PreAuthKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("join token is already %s", record.Status)
+	}
+
+	record.Status = "revoked"
+	record.PreAuthKey = ""
+	record.OfflineJoinBlob = ""
+	if err := s.save(records); err != nil {
+		return nil, err
+	}
+	token := record.JoinToken
+	return &token, nil
+}
+
+// refresh updates token statuses in place and reports whether anything changed
+func (s *JoinTokenService) refresh(records []joinTokenRecord) bool {
+	now := time.Now()
+	changed := false
+
+	var used map[string]bool
+	for i := range records {
+		record := &records[i]
+		switch record.Status {
+		case "pending":
+			if now.After(record.ExpiresAt) {
+				record.Status = "expired"
+				record.OfflineJoinBlob = ""
+				changed = true
+			}
+		case "consumed":
+			if record.PreAuthKeyID == "" {
+				continue
+			}
+			if used == nil {
+				used = s.usedKeyIDs()
+			}
+			if used[record.PreAuthKeyID] {
+				record.Status = "registered"
+				record.PreAuthKey = ""
+				changed = true
+			} else if record.PreAuthKeyExpiry != nil && now.After(*record.PreAuthKeyExpiry) {
+				record.Status = "expired"
+				record.PreAuthKey = ""
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// usedKeyIDs returns the IDs of infrastructure pre-auth keys that have registered a node
+func (s *JoinTokenService) usedKeyIDs() map[string]bool {
+	used := map[string]bool{}
+	keys, err := s.headscaleService.ListInfrastructureKeys()
+	if err != nil {
+		utils.Warn("Failed to list pre-auth keys for join token status: %v", err)
+		return used
+	}
+	for _, key := range keys {
+		if key.Used {
+			used[key.ID] = true
+		}
+	}
+	return used
+}
+
+func (s *JoinTokenService) load() ([]joinTokenRecord, error) {
+	data, err := os.ReadFile(joinTokenStorePath)
+	if os.IsNotExist(err) {
+		return []joinTokenRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read join tokens: %v", err)
+	}
+
+	var records []joinTokenRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse join tokens: %v", err)
+	}
+	return records, nil
+}
+
+// save writes the token store, dropping finished tokens past the retention period
+func (s *JoinTokenService) save(records []joinTokenRecord) error {
+	cutoff := time.Now().Add(-joinTokenRetention)
+	kept := make([]joinTokenRecord, 0, len(records))
+	for _, record := range records {
+		active := record.Status == "pending" || record.PreAuthKey != ""
+		if record.IssuedAt.Before(cutoff) && !active {
+			continue
+		}
+		kept = append(kept, record)
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode join tokens: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(joinTokenStorePath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(joinTokenStorePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write join tokens: %v", err)
+	}
+	return nil
+}
+
+// sign returns the HMAC-SHA256 signature of a token link
+func (s *JoinTokenService) sign(id, expires string) (string, error) {
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "|" + expires))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// signingKey loads the link signing key, generating it on first use
+func (s *JoinTokenService) signingKey() ([]byte, error) {
+	data, err := os.ReadFile(joinTokenSigningKey)
+	if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return []byte(strings.TrimSpace(string(data))), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read signing key: %v", err)
+	}
+
+	key, err := randomHex(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(joinTokenSigningKey), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(joinTokenSigningKey, []byte(key+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %v", err)
+	}
+	return []byte(key), nil
+}
+
+func findJoinToken(records []joinTokenRecord, id string) int {
+	for i := range records {
+		if records[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func markJoinTokenConsumed(record *joinTokenRecord, remoteAddr string) {
+	now := time.Now().UTC()
+	record.Status = "consumed"
+	record.ConsumedAt = &now
+	record.ConsumedFrom = remoteAddr
+}
+
+// keyPrefix returns enough of a pre-auth key to recognise it without revealing it
+func keyPrefix(key string) string {
+	if len(key) <= 8 {
+		return key
+	}
+	return key[:8] + "..."
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
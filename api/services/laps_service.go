@@ -0,0 +1,469 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const lapsSettingsPath = "/etc/vexa/laps.json"
+
+// computerClassGUID is the schemaIDGUID of the computer class, used to scope
+// inherited ACEs to computer objects
+const computerClassGUID = "bf967a86-0de6-11d0-a285-00aa003049e2"
+
+var (
+	lapsMutex            sync.Mutex
+	lapsGroupRegex       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]{0,63}$`)
+	lapsAdminNameRegex   = regexp.MustCompile(`^[A-Za-z0-9._-]{0,20}$`)
+	lapsPasswordAttrs    = []string{"msLAPS-Password", "ms-Mcs-AdmPwd"}
+	lapsExpirationAttrs  = []string{"msLAPS-PasswordExpirationTime", "ms-Mcs-AdmPwdExpirationTime"}
+	lapsComputerAttrs    = append(append([]string{"msLAPS-EncryptedPassword"}, lapsPasswordAttrs...), lapsExpirationAttrs...)
+	lapsSchemaAttributes = []lapsSchemaAttribute{
+		// Windows LAPS, written in clear text because Samba domains lack the
+		// 2016 functional level needed for encrypted passwords
+		{"msLAPS-PasswordExpirationTime", "ms-LAPS-PasswordExpirationTime", "1.2.840.113556.1.6.44.1.1", "2.5.5.16", "65", "0"},
+		{"msLAPS-Password", "ms-LAPS-Password", "1.2.840.113556.1.6.44.1.2", "2.5.5.12", "64", "904"},
+		// Legacy Microsoft LAPS
+		{"ms-Mcs-AdmPwdExpirationTime", "ms-Mcs-AdmPwdExpirationTime", "1.2.840.113556.1.8000.2554.50051.45980.28112.18903.35903.6685103.1224907.2.2", "2.5.5.16", "65", "0"},
+		{"ms-Mcs-AdmPwd", "ms-Mcs-AdmPwd", "1.2.840.113556.1.8000.2554.50051.45980.28112.18903.35903.6685103.1224907.2.1", "2.5.5.5", "19", "904"},
+	}
+)
+
+// lapsSchemaAttribute describes an attribute added to the schema for LAPS.
+// A searchFlags value of 904 marks the password confidential, so reading it
+// needs the control access right on top of read property.
+type lapsSchemaAttribute struct {
+	ldapName    string
+	cn          string
+	oid         string
+	syntax      string
+	omSyntax    string
+	searchFlags string
+}
+
+// LAPSService manages local administrator passwords stored on computer accounts
+// by Windows LAPS or legacy Microsoft LAPS
+type LAPSService struct {
+	ldbTool   *exec.LdbTool
+	sambaTool *exec.SambaTool
+}
+
+// NewLAPSService creates a new LAPSService instance
+func NewLAPSService() *LAPSService {
+	return &LAPSService{
+		ldbTool:   exec.NewLdbTool(),
+		sambaTool: exec.NewSambaTool(),
+	}
+}
+
+// GetSettings returns the LAPS settings, with defaults when none are saved
+func (s *LAPSService) GetSettings() (*models.LAPSSettings, error) {
+	settings := &models.LAPSSettings{
+		ReaderGroup:     "LAPS Readers",
+		PasswordAgeDays: 30,
+		PasswordLength:  14,
+	}
+
+	data, err := os.ReadFile(lapsSettingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read LAPS settings: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, settings); err != nil {
+			return nil, fmt.Errorf("failed to parse LAPS settings: %v", err)
+		}
+	}
+
+	settings.SchemaInstalled = s.schemaInstalled()
+	return settings, nil
+}
+
+// SaveSettings validates and stores the LAPS settings. Directory permissions
+// follow the reader group once the schema is installed.
+func (s *LAPSService) SaveSettings(req models.LAPSSettings) (*models.LAPSSettings, error) {
+	req.ReaderGroup = strings.TrimSpace(req.ReaderGroup)
+	if !lapsGroupRegex.MatchString(req.ReaderGroup) {
+		return nil, fmt.Errorf("invalid reader group: %s", req.ReaderGroup)
+	}
+	if req.PasswordAgeDays < 1 || req.PasswordAgeDays > 365 {
+		return nil, fmt.Errorf("password age must be between 1 and 365 days")
+	}
+	if req.PasswordLength < 8 || req.PasswordLength > 64 {
+		return nil, fmt.Errorf("password length must be between 8 and 64 characters")
+	}
+	if !lapsAdminNameRegex.MatchString(req.AdminAccountName) {
+		return nil, fmt.Errorf("invalid administrator account name: %s", req.AdminAccountName)
+	}
+
+	lapsMutex.Lock()
+	defer lapsMutex.Unlock()
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	if req.Enabled && !settings.SchemaInstalled {
+		return nil, fmt.Errorf("install the LAPS schema before enabling LAPS")
+	}
+
+	groupChanged := !strings.EqualFold(settings.ReaderGroup, req.ReaderGroup)
+	settings.Enabled = req.Enabled
+	settings.ReaderGroup = req.ReaderGroup
+	settings.PasswordAgeDays = req.PasswordAgeDays
+	settings.PasswordLength = req.PasswordLength
+	settings.AdminAccountName = req.AdminAccountName
+
+	if settings.SchemaInstalled && (groupChanged || settings.ReaderGroupSID == "") {
+		if err := s.applyPermissions(settings); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.writeSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// InstallSchema adds the Windows LAPS and legacy LAPS attributes to the schema,
+// allows them on computers and grants the directory permissions
+func (s *LAPSService) InstallSchema() (*models.LAPSSettings, error) {
+	lapsMutex.Lock()
+	defer lapsMutex.Unlock()
+
+	schemaDN, err := s.ldbTool.SchemaDN()
+	if err != nil {
+		return nil, err
+	}
+	refresh := "dn:\nchangetype: modify\nadd: schemaUpdateNow\nschemaUpdateNow: 1\n"
+
+	var added []string
+	for _, attr := range lapsSchemaAttributes {
+		if s.ldbTool.AttributeInSchema(attr.ldapName) {
+			continue
+		}
+		ldif := fmt.Sprintf(`dn: CN=%s,%s
+changetype: add
+objectClass: top
+objectClass: attributeSchema
+attributeID: %s
+cn: %s
+name: %s
+lDAPDisplayName: %s
+attributeSyntax: %s
+oMSyntax: %s
+isSingleValued: TRUE
+searchFlags: %s
+`, attr.cn, schemaDN, attr.oid, attr.cn, attr.cn, attr.ldapName, attr.syntax, attr.omSyntax, attr.searchFlags)
+		if err := s.ldbTool.ModifySchema(ldif); err != nil {
+			return nil, fmt.Errorf("failed to add %s to the schema: %v", attr.ldapName, err)
+		}
+		added = append(added, attr.ldapName)
+	}
+	if len(added) > 0 {
+		if err := s.ldbTool.ModifySchema(refresh); err != nil {
+			return nil, fmt.Errorf("failed to refresh the schema: %v", err)
+		}
+	}
+
+	// Allow the attributes on computer objects
+	computerClassDN := "CN=Computer," + schemaDN
+	entries, err := s.ldbTool.SearchScope(computerClassDN, "base", "(objectClass=classSchema)", "mayContain")
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	if len(entries) > 0 {
+		for _, value := range entries[0].GetAll("mayContain") {
+			existing[strings.ToLower(value)] = true
+		}
+	}
+	var missing []string
+	for _, attr := range lapsSchemaAttributes {
+		if !existing[strings.ToLower(attr.ldapName)] {
+			missing = append(missing, attr.ldapName)
+		}
+	}
+	if len(missing) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "dn: %s\nchangetype: modify\nadd: mayContain\n", computerClassDN)
+		for _, name := range missing {
+			fmt.Fprintf(&b, "mayContain: %s\n", name)
+		}
+		if err := s.ldbTool.ModifySchema(b.String()); err != nil {
+			return nil, fmt.Errorf("failed to extend the computer class: %v", err)
+		}
+		if err := s.ldbTool.ModifySchema(refresh); err != nil {
+			return nil, fmt.Errorf("failed to refresh the schema: %v", err)
+		}
+	}
+	if len(added) > 0 || len(missing) > 0 {
+		utils.Info("Installed LAPS schema extension (attributes: %v)", added)
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyPermissions(settings); err != nil {
+		return nil, err
+	}
+	if err := s.writeSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// AuthorizeReader checks that a user may read and rotate LAPS passwords.
+// Domain users must belong to the reader group, directly or through nesting.
+// Local administrators of this server already have full access to the
+// directory database and are allowed.
+func (s *LAPSService) AuthorizeReader(username string, isDomainUser bool) error {
+	if !isDomainUser {
+		return nil
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return err
+	}
+	userDN, err := s.ldbTool.UserDN(username)
+	if err != nil {
+		return fmt.Errorf("user %s is not a member of %s", username, settings.ReaderGroup)
+	}
+
+	// LDAP_MATCHING_RULE_IN_CHAIN resolves nested group membership
+	filter := fmt.Sprintf("(&(objectClass=group)(sAMAccountName=%s)(member:1.2.840.113556.1.4.1941:=%s))",
+		exec.EscapeFilter(settings.ReaderGroup), exec.EscapeFilter(userDN))
+	entries, err := s.ldbTool.Search("", filter, "dn")
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("user %s is not a member of %s", username, settings.ReaderGroup)
+	}
+	return nil
+}
+
+// ReadPassword returns the managed local administrator password of a computer
+func (s *LAPSService) ReadPassword(computerName string) (*models.LAPSPassword, error) {
+	name, entry, err := s.computerEntry(computerName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.LAPSPassword{ComputerName: name}
+	if value := entry.Get("msLAPS-Password"); value != "" {
+		// Windows LAPS stores {"n": account, "t": hex FILETIME, "p": password}
+		var stored struct {
+			Name     string `json:"n"`
+			Time     string `json:"t"`
+			Password string `json:"p"`
+		}
+		if err := json.Unmarshal([]byte(value), &stored); err != nil {
+			return nil, fmt.Errorf("failed to parse the stored LAPS password: %v", err)
+		}
+		result.Account = stored.Name
+		result.Password = stored.Password
+		result.Source = "windows-laps"
+		if ticks, err := strconv.ParseInt(stored.Time, 16, 64); err == nil {
+			if t, ok := exec.ParseFileTime(strconv.FormatInt(ticks, 10)); ok {
+				result.UpdatedAt = &t
+			}
+		}
+		if t, ok := exec.ParseFileTime(entry.Get("msLAPS-PasswordExpirationTime")); ok {
+			result.ExpiresAt = &t
+		}
+		return result, nil
+	}
+
+	if entry.Get("msLAPS-EncryptedPassword") != "" {
+		return nil, fmt.Errorf("the password of %s is encrypted; turn off ADPasswordEncryptionEnabled on the computer", name)
+	}
+
+	if value := entry.Get("ms-Mcs-AdmPwd"); value != "" {
+		result.Password = value
+		result.Source = "legacy-laps"
+		if t, ok := exec.ParseFileTime(entry.Get("ms-Mcs-AdmPwdExpirationTime")); ok {
+			result.ExpiresAt = &t
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("no LAPS password is stored for %s", name)
+}
+
+// RotatePassword expires a computer's password so it sets a new one at its
+// next policy processing cycle
+func (s *LAPSService) RotatePassword(computerName string) (*models.LAPSRotation, error) {
+	name, entry, err := s.computerEntry(computerName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	rotated := false
+	for i, attr := range lapsExpirationAttrs {
+		if entry.Get(lapsPasswordAttrs[i]) == "" && entry.Get(attr) == "" {
+			continue
+		}
+		if err := s.ldbTool.ReplaceAttribute(entry.DN, attr, exec.FormatFileTime(now)); err != nil {
+			return nil, fmt.Errorf("failed to expire the password: %v", err)
+		}
+		rotated = true
+	}
+	if !rotated {
+		return nil, fmt.Errorf("no LAPS password is stored for %s", name)
+	}
+
+	return &models.LAPSRotation{ComputerName: name, ExpiresAt: now}, nil
+}
+
+// ScriptSettings returns the settings domain-join scripts apply, and whether
+// LAPS should be enabled on joining computers
+func (s *LAPSService) ScriptSettings() (*models.LAPSSettings, bool) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, false
+	}
+	return settings, settings.Enabled && settings.SchemaInstalled
+}
+
+// computerEntry looks up a computer and its LAPS attributes
+func (s *LAPSService) computerEntry(computerName string) (string, *exec.LDIFEntry, error) {
+	if !s.schemaInstalled() {
+		return "", nil, fmt.Errorf("the LAPS schema is not installed")
+	}
+
+	name := strings.TrimSuffix(computerName, "$")
+	filter := fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s))", exec.EscapeFilter(name+"$"))
+	entries, err := s.ldbTool.Search("", filter, lapsComputerAttrs...)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) == 0 {
+		return "", nil, fmt.Errorf("computer not found: %s", name)
+	}
+	return name, &entries[0], nil
+}
+
+// applyPermissions grants computers write access to their own LAPS attributes
+// and the reader group read and reset access, replacing grants to a previous
+// reader group. It records the group's SID on settings.
+func (s *LAPSService) applyPermissions(settings *models.LAPSSettings) error {
+	groupDN, err := s.ldbTool.GroupDN(settings.ReaderGroup)
+	if err != nil {
+		if output, err := s.sambaTool.GroupCreate(settings.ReaderGroup, exec.GroupCreateOptions{
+			Description: "Members can read and rotate local administrator passwords",
+		}); err != nil {
+			return fmt.Errorf("failed to create group %s: %s", settings.ReaderGroup, output)
+		}
+		if groupDN, err = s.ldbTool.GroupDN(settings.ReaderGroup); err != nil {
+			return err
+		}
+	}
+	groupSID, err := s.ldbTool.ObjectSID(groupDN)
+	if err != nil {
+		return err
+	}
+
+	add, err := s.permissionACEs(groupSID)
+	if err != nil {
+		return err
+	}
+	var remove []string
+	if settings.ReaderGroupSID != "" && settings.ReaderGroupSID != groupSID {
+		if remove, err = s.readerACEs(settings.ReaderGroupSID); err != nil {
+			return err
+		}
+	}
+
+	domainDN, err := s.ldbTool.DomainDN()
+	if err != nil {
+		return err
+	}
+	if err := s.ldbTool.UpdateDACL(domainDN, remove, add); err != nil {
+		return fmt.Errorf("failed to set LAPS permissions: %v", err)
+	}
+
+	settings.ReaderGroupSID = groupSID
+	utils.Info("Granted LAPS password access to %s (%s)", settings.ReaderGroup, groupSID)
+	return nil
+}
+
+// permissionACEs returns the inheritable ACEs for computers, through the
+// PRINCIPAL_SELF SID, and for the reader group
+func (s *LAPSService) permissionACEs(readerSID string) ([]string, error) {
+	aces, err := s.readerACEs(readerSID)
+	if err != nil {
+		return nil, err
+	}
+	for i, attr := range lapsPasswordAttrs {
+		passwordGUID, err := s.ldbTool.SchemaIDGUID(attr)
+		if err != nil {
+			return nil, err
+		}
+		expirationGUID, err := s.ldbTool.SchemaIDGUID(lapsExpirationAttrs[i])
+		if err != nil {
+			return nil, err
+		}
+		aces = append(aces,
+			fmt.Sprintf("(OA;CIIO;WP;%s;%s;PS)", passwordGUID, computerClassGUID),
+			fmt.Sprintf("(OA;CIIO;RPWP;%s;%s;PS)", expirationGUID, computerClassGUID),
+		)
+	}
+	return aces, nil
+}
+
+// readerACEs returns the inheritable ACEs letting a group read passwords and
+// expire them
+func (s *LAPSService) readerACEs(sid string) ([]string, error) {
+	var aces []string
+	for i, attr := range lapsPasswordAttrs {
+		passwordGUID, err := s.ldbTool.SchemaIDGUID(attr)
+		if err != nil {
+			return nil, err
+		}
+		expirationGUID, err := s.ldbTool.SchemaIDGUID(lapsExpirationAttrs[i])
+		if err != nil {
+			return nil, err
+		}
+		aces = append(aces,
+			fmt.Sprintf("(OA;CIIO;RPCR;%s;%s;%s)", passwordGUID, computerClassGUID, sid),
+			fmt.Sprintf("(OA;CIIO;RPWP;%s;%s;%s)", expirationGUID, computerClassGUID, sid),
+		)
+	}
+	return aces, nil
+}
+
+func (s *LAPSService) schemaInstalled() bool {
+	for _, attr := range lapsSchemaAttributes {
+		if !s.ldbTool.AttributeInSchema(attr.ldapName) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LAPSService) writeSettings(settings *models.LAPSSettings) error {
+	stored := *settings
+	stored.SchemaInstalled = false
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lapsSettingsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return os.WriteFile(lapsSettingsPath, data, 0600)
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+// maxLogonScriptSize caps uploaded logon scripts at 1MB
+const maxLogonScriptSize = 1 << 20
+
+var logonScriptNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}\.(bat|cmd|ps1|vbs|js|kix)$`)
+
+// NetlogonService manages logon scripts in the NETLOGON share
+type NetlogonService struct {
+	sambaTool   *exec.SambaTool
+	ldbTool     *exec.LdbTool
+	versionsDir string
+}
+
+// NewNetlogonService creates a new NetlogonService instance
+func NewNetlogonService() *NetlogonService {
+	return &NetlogonService{
+		sambaTool:   exec.NewSambaTool(),
+		ldbTool:     exec.NewLdbTool(),
+		versionsDir: "/var/lib/vexa/netlogon-versions",
+	}
+}
+
+// ListScripts returns all scripts in the NETLOGON share
+func (s *NetlogonService) ListScripts() ([]models.LogonScript, error) {
+	dir, err := s.netlogonPath()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NETLOGON share: %v", err)
+	}
+
+	scripts := make([]models.LogonScript, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !logonScriptNameRegex.MatchString(entry.Name()) {
+			continue
+		}
+		script, err := s.describeScript(dir, entry.Name())
+		if err != nil {
+			utils.Warn("Skipping logon script %s: %v", entry.Name(), err)
+			continue
+		}
+		scripts = append(scripts, *script)
+	}
+
+	return scripts, nil
+}
+
+// GetScript returns a script's metadata and content
+func (s *NetlogonService) GetScript(name string) (*models.LogonScript, []byte, error) {
+	if err := validateLogonScriptName(name); err != nil {
+		return nil, nil, err
+	}
+	dir, err := s.netlogonPath()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("script not found: %s", name)
+	}
+	script, err := s.describeScript(dir, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return script, content, nil
+}
+
+// UploadScript writes a script to NETLOGON, archiving the previous revision
+func (s *NetlogonService) UploadScript(name string, content []byte) (*models.LogonScript, error) {
+	if err := validateLogonScriptName(name); err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("script content is empty")
+	}
+	if len(content) > maxLogonScriptSize {
+		return nil, fmt.Errorf("script exceeds maximum size of %d bytes", maxLogonScriptSize)
+	}
+
+	dir, err := s.netlogonPath()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name)
+
+	if existing, err := os.ReadFile(path); err == nil {
+		if string(existing) == string(content) {
+			return s.describeScript(dir, name)
+		}
+		if err := s.archiveVersion(name, existing); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write script: %v", err)
+	}
+	utils.Info("Uploaded logon script %s (%d bytes)", name, len(content))
+	s.resetSysvolACLs()
+
+	return s.describeScript(dir, name)
+}
+
+// DeleteScript archives and removes a script from NETLOGON
+func (s *NetlogonService) DeleteScript(name string) error {
+	if err := validateLogonScriptName(name); err != nil {
+		return err
+	}
+	dir, err := s.netlogonPath()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("script not found: %s", name)
+	}
+	if err := s.archiveVersion(name, content); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete script: %v", err)
+	}
+
+	utils.Info("Deleted logon script %s", name)
+	return nil
+}
+
+// ListVersions returns the archived revisions of a script, newest first
+func (s *NetlogonService) ListVersions(name string) ([]models.LogonScriptVersion, error) {
+	if err := validateLogonScriptName(name); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.versionsDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.LogonScriptVersion{}, nil
+		}
+		return nil, fmt.Errorf("failed to read script versions: %v", err)
+	}
+
+	versions := make([]models.LogonScriptVersion, 0, len(entries))
+	for _, entry := range entries {
+		number, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(s.versionsDir, name, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, models.LogonScriptVersion{
+			Version:    number,
+			Size:       info.Size(),
+			ArchivedAt: info.ModTime(),
+			SHA256:     sha256Hex(content),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+// RestoreVersion makes an archived revision the current script
+func (s *NetlogonService) RestoreVersion(name string, version int) (*models.LogonScript, error) {
+	if err := validateLogonScriptName(name); err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.versionsDir, name, strconv.Itoa(version)))
+	if err != nil {
+		return nil, fmt.Errorf("version %d of %s not found", version, name)
+	}
+	return s.UploadScript(name, content)
+}
+
+// AssignScript sets scriptPath on the given users and on every user inside the given OUs.
+// An empty script name clears the assignment.
+func (s *NetlogonService) AssignScript(req models.AssignLogonScriptRequest) (int, error) {
+	if req.Script != "" {
+		if err := validateLogonScriptName(req.Script); err != nil {
+			return 0, err
+		}
+		dir, err := s.netlogonPath()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := os.Stat(filepath.Join(dir, req.Script)); err != nil {
+			return 0, fmt.Errorf("script not found: %s", req.Script)
+		}
+	}
+
+	dns := make([]string, 0)
+	for _, username := range req.Users {
+		dn, err := s.ldbTool.UserDN(username)
+		if err != nil {
+			return 0, fmt.Errorf("user not found: %s", username)
+		}
+		dns = append(dns, dn)
+	}
+
+	scope := "one"
+	if req.Recursive {
+		scope = "sub"
+	}
+	for _, ou := range req.OUs {
+		entries, err := s.ldbTool.SearchScope(ou, scope, "(&(objectClass=user)(!(objectClass=computer)))", "dn")
+		if err != nil {
+			return 0, fmt.Errorf("failed to list users in %s: %v", ou, err)
+		}
+		for _, entry := range entries {
+			dns = append(dns, entry.DN)
+		}
+	}
+
+	updated := 0
+	for _, dn := range dns {
+		var err error
+		if req.Script == "" {
+			err = s.ldbTool.ReplaceAttribute(dn, "scriptPath")
+		} else {
+			err = s.ldbTool.ReplaceAttribute(dn, "scriptPath", req.Script)
+		}
+		if err != nil {
+			return updated, fmt.Errorf("failed to set scriptPath on %s: %v", dn, err)
+		}
+		updated++
+	}
+
+	utils.Info("Set scriptPath=%q on %d accounts", req.Script, updated)
+	return updated, nil
+}
+
+// CheckSysvol runs samba-tool ntacl sysvolcheck
+func (s *NetlogonService) CheckSysvol() *models.SysvolCheckResult {
+	output, err := s.sambaTool.NTACLSysvolCheck()
+	return &models.SysvolCheckResult{
+		Healthy: err == nil,
+		Output:  strings.TrimSpace(output),
+	}
+}
+
+// ResetSysvol resets SYSVOL ACLs to their defaults
+func (s *NetlogonService) ResetSysvol() error {
+	output, err := s.sambaTool.NTACLSysvolReset()
+	if err != nil {
+		return fmt.Errorf("failed to reset SYSVOL ACLs: %s", output)
+	}
+	return nil
+}
+
+// netlogonPath resolves the local path of the NETLOGON share from smb.conf
+func (s *NetlogonService) netlogonPath() (string, error) {
+	cmd, cmdErr := utils.SafeCommand("testparm", "-s", "--section-name=netlogon", "--parameter-name=path")
+	if cmdErr == nil {
+		if output, err := cmd.Output(); err == nil {
+			if path := strings.TrimSpace(string(output)); path != "" {
+				return path, nil
+			}
+		}
+	}
+
+	// Fall back to the default provisioning layout
+	matches, _ := filepath.Glob(filepath.Join(SysvolRoot, "*", "scripts"))
+	if len(matches) > 0 {
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("NETLOGON share not found")
+}
+
+// archiveVersion stores a copy of a script revision under the versions directory
+func (s *NetlogonService) archiveVersion(name string, content []byte) error {
+	dir := filepath.Join(s.versionsDir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create versions directory: %v", err)
+	}
+
+	next := 1
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if n, err := strconv.Atoi(entry.Name()); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(next)), content, 0600); err != nil {
+		return fmt.Errorf("failed to archive script version: %v", err)
+	}
+	return nil
+}
+
+// describeScript builds the metadata for a script in NETLOGON
+func (s *NetlogonService) describeScript(dir, name string) (*models.LogonScript, error) {
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := 0
+	if entries, err := os.ReadDir(filepath.Join(s.versionsDir, name)); err == nil {
+		versions = len(entries)
+	}
+
+	return &models.LogonScript{
+		Name:       name,
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime(),
+		SHA256:     sha256Hex(content),
+		Versions:   versions,
+	}, nil
+}
+
+// resetSysvolACLs applies default ACLs to newly written SYSVOL files
+func (s *NetlogonService) resetSysvolACLs() {
+	if output, err := s.sambaTool.NTACLSysvolReset(); err != nil {
+		utils.Warn("Failed to reset SYSVOL ACLs: %s", output)
+	}
+}
+
+func validateLogonScriptName(name string) error {
+	if !logonScriptNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid script name: %s (allowed extensions: .bat, .cmd, .ps1, .vbs, .js, .kix)", name)
+	}
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
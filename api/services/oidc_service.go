@@ -0,0 +1,676 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const (
+	oidcSettingsPath   = "/etc/vexa/oidc.json"
+	oidcSigningKeyPath = "/var/lib/vexa/oidc-signing-key.pem"
+
+	// headscaleOIDCSecretPath holds the client secret Headscale presents
+	headscaleOIDCSecretPath = "/etc/headscale/oidc_client_secret"
+
+	// oidcIssuerPath is where the provider's endpoints are mounted
+	oidcIssuerPath = "/api/v1/oidc"
+
+	oidcClientID  = "headscale"
+	oidcCodeTTL   = time.Minute
+	oidcTokenTTL  = time.Hour
+	oidcSignature = "RS256"
+)
+
+var (
+	// oidcMutex guards the settings file and the signing key
+	oidcMutex      sync.Mutex
+	oidcSigningKey *rsa.PrivateKey
+
+	// oidcGrantMutex guards the issued authorization codes and access
+	// tokens, which only live in memory: Headscale redeems a code within
+	// seconds and reads userinfo right after
+	oidcGrantMutex sync.Mutex
+	oidcCodes      = map[string]*oidcGrant{}
+	oidcTokens     = map[string]*oidcGrant{}
+)
+
+// OIDCError is an OAuth error reported to the client as error and
+// error_description
+type OIDCError struct {
+	Code        string
+	Description string
+}
+
+func (e *OIDCError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// OIDCService is a minimal OpenID Connect provider that authenticates
+// directory users for Headscale's interactive login
+type OIDCService struct {
+	authService *AuthService
+	userService *UserService
+}
+
+// NewOIDCService creates a new OIDCService instance
+func NewOIDCService() *OIDCService {
+	return &OIDCService{
+		authService: NewAuthService(),
+		userService: NewUserService(),
+	}
+}
+
+// oidcSettings is the stored form of the settings, including the secret
+type oidcSettings struct {
+	models.OIDCSettings
+	ClientSecret string `json:"client_secret"`
+}
+
+// oidcGrant is a completed login, first as an authorization code and then
+// as an access token
+type oidcGrant struct {
+	ClientID      string
+	RedirectURI   string
+	Nonce         string
+	Scope         string
+	CodeChallenge string
+	User          models.OIDCUserInfo
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+}
+
+// headscaleOIDCBlock is the oidc section of Headscale's config
+type headscaleOIDCBlock struct {
+	OnlyStartIfOIDCIsAvailable bool     `yaml:"only_start_if_oidc_is_available"`
+	Issuer                     string   `yaml:"issuer"`
+	ClientID                   string   `yaml:"client_id"`
+	ClientSecretPath           string   `yaml:"client_secret_path"`
+	Scope                      []string `yaml:"scope"`
+	PKCE                       struct {
+		Enabled bool   `yaml:"enabled"`
+		Method  string `yaml:"method"`
+	} `yaml:"pkce"`
+}
+
+// GetSettings returns the provider settings without the client secret
+func (s *OIDCService) GetSettings() (*models.OIDCSettings, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	settings, err := loadOIDCSettings()
+	if err != nil {
+		return nil, err
+	}
+	return &settings.OIDCSettings, nil
+}
+
+// UpdateSettings enables or disables Headscale's OIDC login and rewrites
+// its oidc section accordingly
+func (s *OIDCService) UpdateSettings(req models.UpdateOIDCSettingsRequest) (*models.OIDCSettings, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	settings, err := loadOIDCSettings()
+	if err != nil {
+		return nil, err
+	}
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.Issuer != nil {
+		settings.Issuer = strings.TrimRight(strings.TrimSpace(*req.Issuer), "/")
+	}
+	if req.RotateSecret {
+		settings.ClientSecret = ""
+	}
+
+	serverURL := NewHeadscaleService().GetLoginServerFull()
+	if settings.Enabled {
+		if serverURL == "" {
+			return nil, fmt.Errorf("overlay networking is not set up")
+		}
+		if err := prepareOIDCSettings(settings, serverURL); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateIssuer(settings.Issuer); err != nil {
+		return nil, err
+	}
+	if err := saveOIDCSettings(settings); err != nil {
+		return nil, err
+	}
+
+	if serverURL != "" {
+		if err := setHeadscaleOIDC(settings); err != nil {
+			return nil, err
+		}
+		if err := restartHeadscale(); err != nil {
+			return nil, err
+		}
+	}
+	return &settings.OIDCSettings, nil
+}
+
+// ConfigureHeadscale enables the provider for the Headscale instance at
+// serverURL and wires Headscale's oidc section to it. Headscale has to be
+// (re)started afterwards.
+func (s *OIDCService) ConfigureHeadscale(serverURL string) error {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	settings, err := loadOIDCSettings()
+	if err != nil {
+		return err
+	}
+	settings.Enabled = true
+	if err := prepareOIDCSettings(settings, serverURL); err != nil {
+		return err
+	}
+	if err := saveOIDCSettings(settings); err != nil {
+		return err
+	}
+	return setHeadscaleOIDC(settings)
+}
+
+// Issuer returns the configured issuer, or one derived from the URL the
+// request reached Vexa on
+func (s *OIDCService) Issuer(baseURL string) string {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if settings, err := loadOIDCSettings(); err == nil && settings.Issuer != "" {
+		return settings.Issuer
+	}
+	return strings.TrimRight(baseURL, "/") + oidcIssuerPath
+}
+
+// Discovery returns the provider's OpenID configuration document
+func (s *OIDCService) Discovery(issuer string) map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{oidcSignature},
+		"scopes_supported":                      []string{"openid", "profile", "email", "groups"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"preferred_username", "name", "email", "email_verified", "groups",
+		},
+	}
+}
+
+// JWKS returns the public half of the signing key
+func (s *OIDCService) JWKS() (map[string]interface{}, error) {
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": oidcSignature,
+			"kid": keyID(&key.PublicKey),
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}},
+	}, nil
+}
+
+// ValidateAuthorization checks an authorization request before the login
+// form is shown or submitted. Errors that must not be redirected back to
+// the client (unknown client or redirect URI) are plain errors.
+func (s *OIDCService) ValidateAuthorization(req models.OIDCAuthorizeRequest) error {
+	oidcMutex.Lock()
+	settings, err := loadOIDCSettings()
+	oidcMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !settings.Enabled {
+		return fmt.Errorf("OIDC login is disabled")
+	}
+	if req.ClientID != settings.ClientID {
+		return fmt.Errorf("unknown client")
+	}
+	if !containsString(settings.RedirectURIs, req.RedirectURI) {
+		return fmt.Errorf("redirect URI is not registered for this client")
+	}
+	if req.ResponseType != "code" {
+		return &OIDCError{"unsupported_response_type", "only the authorization code flow is supported"}
+	}
+	if !containsString(strings.Fields(req.Scope), "openid") {
+		return &OIDCError{"invalid_scope", "the openid scope is required"}
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != "S256" {
+		return &OIDCError{"invalid_request", "only the S256 code challenge method is supported"}
+	}
+	return nil
+}
+
+// Login authenticates a directory user for an authorization request and
+// returns the redirect carrying the authorization code
+func (s *OIDCService) Login(req models.OIDCAuthorizeRequest, username, password string) (string, error) {
+	if err := s.ValidateAuthorization(req); err != nil {
+		return "", err
+	}
+
+	result, err := s.authService.Authenticate(models.LoginRequest{Username: username, Password: password})
+	if err != nil || !result.Authenticated {
+		return "", fmt.Errorf("invalid username or password")
+	}
+	if !result.IsDomainUser {
+		return "", fmt.Errorf("only domain accounts can sign in to the overlay network")
+	}
+
+	user, err := s.userInfo(username)
+	if err != nil {
+		return "", err
+	}
+	code, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	oidcGrantMutex.Lock()
+	purgeOIDCGrants(now)
+	oidcCodes[code] = &oidcGrant{
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Nonce:         req.Nonce,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		User:          *user,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(oidcCodeTTL),
+	}
+	oidcGrantMutex.Unlock()
+
+	return redirectWith(req.RedirectURI, url.Values{"code": {code}, "state": {req.State}}), nil
+}
+
+// AuthorizationError returns the redirect reporting an OAuth error to the
+// client
+func (s *OIDCService) AuthorizationError(req models.OIDCAuthorizeRequest, oidcErr *OIDCError) string {
+	return redirectWith(req.RedirectURI, url.Values{
+		"error":             {oidcErr.Code},
+		"error_description": {oidcErr.Description},
+		"state":             {req.State},
+	})
+}
+
+// Exchange redeems an authorization code for an ID token and access token
+func (s *OIDCService) Exchange(issuer string, req models.OIDCTokenRequest) (*models.OIDCTokenResponse, error) {
+	if req.GrantType != "authorization_code" {
+		return nil, &OIDCError{"unsupported_grant_type", "only authorization_code is supported"}
+	}
+
+	oidcMutex.Lock()
+	settings, err := loadOIDCSettings()
+	oidcMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled || req.ClientID != settings.ClientID || settings.ClientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(settings.ClientSecret)) != 1 {
+		return nil, &OIDCError{"invalid_client", "client authentication failed"}
+	}
+
+	now := time.Now()
+	oidcGrantMutex.Lock()
+	grant := oidcCodes[req.Code]
+	delete(oidcCodes, req.Code)
+	oidcGrantMutex.Unlock()
+
+	if grant == nil || now.After(grant.ExpiresAt) || grant.ClientID != req.ClientID {
+		return nil, &OIDCError{"invalid_grant", "authorization code is invalid or expired"}
+	}
+	if grant.RedirectURI != req.RedirectURI {
+		return nil, &OIDCError{"invalid_grant", "redirect_uri does not match the authorization request"}
+	}
+	if grant.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(req.CodeVerifier))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.CodeChallenge {
+			return nil, &OIDCError{"invalid_grant", "code_verifier does not match the code challenge"}
+		}
+	}
+
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{
+		"iss":                issuer,
+		"sub":                grant.User.Subject,
+		"aud":                grant.ClientID,
+		"exp":                now.Add(oidcTokenTTL).Unix(),
+		"iat":                now.Unix(),
+		"auth_time":          grant.AuthTime.Unix(),
+		"preferred_username": grant.User.PreferredUsername,
+		"name":               grant.User.Name,
+		"email":              grant.User.Email,
+		"email_verified":     grant.User.EmailVerified,
+		"groups":             grant.User.Groups,
+	}
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID(&key.PublicKey)
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ID token: %v", err)
+	}
+
+	accessToken, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	grant.ExpiresAt = now.Add(oidcTokenTTL)
+	oidcGrantMutex.Lock()
+	oidcTokens[accessToken] = grant
+	oidcGrantMutex.Unlock()
+
+	return &models.OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oidcTokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       grant.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims about the user an access token was issued to
+func (s *OIDCService) UserInfo(accessToken string) (*models.OIDCUserInfo, error) {
+	oidcGrantMutex.Lock()
+	defer oidcGrantMutex.Unlock()
+
+	grant := oidcTokens[accessToken]
+	if grant == nil || time.Now().After(grant.ExpiresAt) {
+		return nil, &OIDCError{"invalid_token", "access token is invalid or expired"}
+	}
+	user := grant.User
+	return &user, nil
+}
+
+// userInfo collects the claims released about a directory user. The
+// preferred username is the user's overlay user name, so Headscale names the
+// user it creates the same way Vexa does.
+func (s *OIDCService) userInfo(username string) (*models.OIDCUserInfo, error) {
+	user, err := s.userService.GetUser(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user %s: %v", username, err)
+	}
+
+	overlayUser, err := overlayUserFor(user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &models.OIDCUserInfo{
+		Subject:           strings.ToLower(user.Username),
+		PreferredUsername: overlayUser,
+		Name:              user.FullName,
+		Email:             user.Email,
+		EmailVerified:     user.Email != "",
+		Groups:            user.Groups,
+	}
+	if info.Groups == nil {
+		info.Groups = []string{}
+	}
+	if info.Email == "" {
+		if status, err := NewDomainService().GetDomainStatus(); err == nil && status != nil && status.Realm != "" {
+			info.Email = strings.ToLower(user.Username + "@" + status.Realm)
+		}
+	}
+	return info, nil
+}
+
+// prepareOIDCSettings fills in the issuer, client, redirect URI and secret
+// for the Headscale instance at serverURL and writes the secret where
+// Headscale reads it
+func prepareOIDCSettings(settings *oidcSettings, serverURL string) error {
+	server, err := url.Parse(strings.TrimRight(serverURL, "/"))
+	if err != nil || server.Host == "" {
+		return fmt.Errorf("invalid headscale server URL %q", serverURL)
+	}
+	if settings.Issuer == "" {
+		settings.Issuer = defaultOIDCIssuer(server)
+	}
+	if err := validateIssuer(settings.Issuer); err != nil {
+		return err
+	}
+	if err := requireSecureIssuer(settings.Issuer); err != nil {
+		return err
+	}
+	settings.ClientID = oidcClientID
+	callback := server.String() + "/oidc/callback"
+	if !containsString(settings.RedirectURIs, callback) {
+		settings.RedirectURIs = append(settings.RedirectURIs, callback)
+	}
+	if settings.ClientSecret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			return err
+		}
+		settings.ClientSecret = secret
+	}
+
+	if err := os.MkdirAll(filepath.Dir(headscaleOIDCSecretPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(headscaleOIDCSecretPath, []byte(settings.ClientSecret), 0600); err != nil {
+		return fmt.Errorf("failed to write headscale OIDC client secret: %v", err)
+	}
+	return nil
+}
+
+// setHeadscaleOIDC writes Headscale's oidc section for enabled settings and
+// removes it otherwise
+func setHeadscaleOIDC(settings *oidcSettings) error {
+	return updateHeadscaleConfig(func(config *headscaleConfig) error {
+		if !settings.Enabled {
+			config.OIDC = nil
+			return nil
+		}
+
+		block := &headscaleOIDCBlock{
+			Issuer:           settings.Issuer,
+			ClientID:         settings.ClientID,
+			ClientSecretPath: headscaleOIDCSecretPath,
+			Scope:            []string{"openid", "profile", "email"},
+		}
+		block.PKCE.Enabled = true
+		block.PKCE.Method = "S256"
+		config.OIDC = block
+		return nil
+	})
+}
+
+// defaultOIDCIssuer mounts the issuer on the scheme, host and port Headscale
+// is reached on, since Vexa serves both
+func defaultOIDCIssuer(server *url.URL) string {
+	return server.Scheme + "://" + server.Host + oidcIssuerPath
+}
+
+// requireSecureIssuer refuses issuers that would send authorization codes
+// and tokens in the clear. Loopback issuers are allowed for local testing.
+func requireSecureIssuer(issuer string) error {
+	parsed, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("invalid issuer %q", issuer)
+	}
+	if parsed.Scheme == "https" || isLoopbackHost(parsed.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("OIDC login requires an https issuer, got %s; set an https server URL or issuer first", issuer)
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func validateIssuer(issuer string) error {
+	if issuer == "" {
+		return nil
+	}
+	parsed, err := url.Parse(issuer)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("issuer must be an http or https URL without query or fragment")
+	}
+	return nil
+}
+
+// signingKey loads the ID token signing key, generating it on first use
+func signingKey() (*rsa.PrivateKey, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcSigningKey != nil {
+		return oidcSigningKey, nil
+	}
+
+	if data, err := os.ReadFile(oidcSigningKeyPath); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("failed to parse OIDC signing key")
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OIDC signing key: %v", err)
+		}
+		oidcSigningKey = key
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read OIDC signing key: %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate OIDC signing key: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.MkdirAll(filepath.Dir(oidcSigningKeyPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(oidcSigningKeyPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save OIDC signing key: %v", err)
+	}
+	utils.Info("Generated OIDC signing key")
+	oidcSigningKey = key
+	return key, nil
+}
+
+// keyID derives a stable key ID from a public key
+func keyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// purgeOIDCGrants drops expired codes and tokens. Callers hold oidcGrantMutex.
+func purgeOIDCGrants(now time.Time) {
+	for code, grant := range oidcCodes {
+		if now.After(grant.ExpiresAt) {
+			delete(oidcCodes, code)
+		}
+	}
+	for token, grant := range oidcTokens {
+		if now.After(grant.ExpiresAt) {
+			delete(oidcTokens, token)
+		}
+	}
+}
+
+// redirectWith appends query parameters to a redirect URI, dropping empty ones
+func redirectWith(redirectURI string, values url.Values) string {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := target.Query()
+	for key, value := range values {
+		if len(value) > 0 && value[0] != "" {
+			query.Set(key, value[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func loadOIDCSettings() (*oidcSettings, error) {
+	settings := &oidcSettings{
+		OIDCSettings: models.OIDCSettings{
+			ClientID:     oidcClientID,
+			RedirectURIs: []string{},
+		},
+	}
+
+	data, err := os.ReadFile(oidcSettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to read OIDC settings: %v", err)
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC settings: %v", err)
+	}
+	return settings, nil
+}
+
+func saveOIDCSettings(settings *oidcSettings) error {
+	settings.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(oidcSettingsPath), 0700); err != nil {
+		return fmt.Errorf("failed to create settings directory: %v", err)
+	}
+	if err := os.WriteFile(oidcSettingsPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save OIDC settings: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestDefaultOIDCIssuer(t *testing.T) {
+	cases := map[string]string{
+		"https://vexa.example.com/mesh":      "https://vexa.example.com/api/v1/oidc",
+		"https://vexa.example.com:8443/mesh": "https://vexa.example.com:8443/api/v1/oidc",
+		"http://dc1.corp.example.com:50443":  "http://dc1.corp.example.com:50443/api/v1/oidc",
+		"http://[::1]:8080":                  "http://[::1]:8080/api/v1/oidc",
+	}
+	for serverURL, want := range cases {
+		server, err := url.Parse(serverURL)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %v", serverURL, err)
+		}
+		if got := defaultOIDCIssuer(server); got != want {
+			t.Errorf("defaultOIDCIssuer(%q) = %q, want %q", serverURL, got, want)
+		}
+	}
+}
+
+func TestRequireSecureIssuer(t *testing.T) {
+	for _, issuer := range []string{
+		"https://vexa.example.com/api/v1/oidc",
+		"http://localhost:8080/api/v1/oidc",
+		"http://127.0.0.1:8080/api/v1/oidc",
+		"http://[::1]/api/v1/oidc",
+	} {
+		if err := requireSecureIssuer(issuer); err != nil {
+			t.Errorf("requireSecureIssuer(%q) = %v", issuer, err)
+		}
+	}
+	for _, issuer := range []string{
+		"http://vexa.example.com/api/v1/oidc",
+		"http://10.0.0.5:50443/api/v1/oidc",
+		"http://localhost.example.com/api/v1/oidc",
+	} {
+		if err := requireSecureIssuer(issuer); err == nil {
+			t.Errorf("requireSecureIssuer(%q) accepted a cleartext issuer", issuer)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	vexaexec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/headscale"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const (
+	overlayDNSSettingsPath = "/etc/vexa/overlay-dns.json"
+	overlayDNSStatePath    = "/var/lib/vexa/overlay-dns-state.json"
+
+	// headscaleExtraRecordsPath is the records file Headscale is pointed at
+	// while the sync is enabled. Headscale reloads it when it changes.
+	headscaleExtraRecordsPath = "/etc/headscale/extra-records.json"
+
+	overlayDNSDefaultInterval = 15
+	overlayDNSMinInterval     = 5
+	overlayDNSMaxInterval     = 1440
+
+	// overlayDNSQueryDepth bounds how many labels below a zone are read
+	overlayDNSQueryDepth = 3
+	// overlayDNSMaxCNAMEHops bounds CNAME chains followed within Samba
+	overlayDNSMaxCNAMEHops = 5
+)
+
+var (
+	overlayDNSMutex    sync.Mutex
+	overlayDNSSyncOnce sync.Once
+
+	// overlayDNSSyncTrigger wakes the record sync after the settings change
+	overlayDNSSyncTrigger = make(chan struct{}, 1)
+)
+
+// OverlayDNSService pushes selected Samba DNS records to overlay nodes as
+// Headscale extra records
+type OverlayDNSService struct {
+	sambaTool        *vexaexec.SambaTool
+	headscaleService *HeadscaleService
+}
+
+// NewOverlayDNSService creates a new OverlayDNSService instance
+func NewOverlayDNSService() *OverlayDNSService {
+	return &OverlayDNSService{
+		sambaTool:        vexaexec.NewSambaTool(),
+		headscaleService: NewHeadscaleService(),
+	}
+}
+
+// overlayDNSState records what was last written to the extra records file
+type overlayDNSState struct {
+	// StaticRecords are the extra_records moved out of Headscale's config
+	// when the sync was enabled. They are served alongside synced records
+	// and put back when it is disabled.
+	StaticRecords []headscaleExtraRecord    `json:"static_records"`
+	Records       []models.OverlayDNSRecord `json:"records"`
+	SyncedAt      *time.Time                `json:"synced_at,omitempty"`
+	LastError     string                    `json:"last_error,omitempty"`
+}
+
+// GetSettings returns the sync settings. Until they are saved the sync is
+// disabled.
+func (s *OverlayDNSService) GetSettings() (*models.OverlayDNSSync, error) {
+	settings := &models.OverlayDNSSync{
+		Zones:           []string{},
+		Records:         []string{},
+		IntervalMinutes: overlayDNSDefaultInterval,
+	}
+
+	data, err := os.ReadFile(overlayDNSSettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to read overlay DNS settings: %v", err)
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse overlay DNS settings: %v", err)
+	}
+	return settings, nil
+}
+
+// Status returns the sync settings with the records last applied. Static
+// records are listed while the sync is disabled too.
+func (s *OverlayDNSService) Status() (*models.OverlayDNSStatus, error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	state := loadOverlayDNSState()
+
+	records := state.Records
+	if !settings.Enabled {
+		records = []models.OverlayDNSRecord{}
+		if config, err := loadHeadscaleConfig(); err == nil {
+			records = staticOverlayDNSRecords(config.DNS.ExtraRecords)
+		}
+	}
+	if records == nil {
+		records = []models.OverlayDNSRecord{}
+	}
+
+	return &models.OverlayDNSStatus{
+		Settings:  *settings,
+		Records:   records,
+		SyncedAt:  state.SyncedAt,
+		LastError: state.LastError,
+	}, nil
+}
+
+// Zones lists the zones of the Samba DNS server that can be synced
+func (s *OverlayDNSService) Zones() ([]string, error) {
+	zones, err := s.sambaTool.DNSZones()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// SaveSettings validates and saves the sync settings, switches Headscale
+// between its config's extra records and the synced records file, and
+// syncs. Headscale is restarted when it is switched.
+func (s *OverlayDNSService) SaveSettings(settings models.OverlayDNSSync, updatedBy string) (*models.OverlayDNSStatus, error) {
+	zones, err := s.sambaTool.DNSZones()
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeOverlayDNSSync(&settings, zones); err != nil {
+		return nil, err
+	}
+
+	overlayDNSMutex.Lock()
+	defer overlayDNSMutex.Unlock()
+
+	settings.UpdatedAt = time.Now().UTC()
+	settings.UpdatedBy = updatedBy
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(overlayDNSSettingsPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create settings directory: %v", err)
+	}
+	if err := os.WriteFile(overlayDNSSettingsPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save overlay DNS settings: %v", err)
+	}
+
+	if settings.Enabled {
+		if _, err := s.sync(settings); err != nil {
+			return nil, err
+		}
+	} else if err := s.disable(); err != nil {
+		return nil, err
+	}
+
+	// The interval may have changed
+	select {
+	case overlayDNSSyncTrigger <- struct{}{}:
+	default:
+	}
+	return s.Status()
+}
+
+// Sync re-reads the selected records from Samba and updates the records
+// file when they changed. It reports whether it did.
+func (s *OverlayDNSService) Sync() (bool, error) {
+	overlayDNSMutex.Lock()
+	defer overlayDNSMutex.Unlock()
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return false, err
+	}
+	if !settings.Enabled {
+		return false, fmt.Errorf("overlay DNS sync is disabled")
+	}
+	return s.sync(*settings)
+}
+
+// StartSync keeps the synced records in step with Samba DNS and node
+// addresses, syncing at the configured interval
+func (s *OverlayDNSService) StartSync() {
+	overlayDNSSyncOnce.Do(func() {
+		go func() {
+			for {
+				interval := overlayDNSDefaultInterval
+				if settings, err := s.GetSettings(); err == nil {
+					interval = settings.IntervalMinutes
+				}
+				timer := time.NewTimer(time.Duration(interval) * time.Minute)
+				select {
+				case <-timer.C:
+				case <-overlayDNSSyncTrigger:
+					timer.Stop()
+					// Settings were just saved and synced; only the
+					// interval needs picking up
+					continue
+				}
+
+				settings, err := s.GetSettings()
+				if err != nil || !settings.Enabled {
+					continue
+				}
+				changed, err := s.Sync()
+				if err != nil {
+					utils.Warn("Overlay DNS sync failed: %v", err)
+					continue
+				}
+				if changed {
+					utils.LogOverlayManagement(utils.AuditContext{User: "system"}, "overlay_dns_sync", "dns", true, nil)
+				}
+			}
+		}()
+	})
+}
+
+// sync builds the records, writes the records file when they changed and
+// points Headscale at it if it is not already. Callers hold overlayDNSMutex.
+func (s *OverlayDNSService) sync(settings models.OverlayDNSSync) (bool, error) {
+	state := loadOverlayDNSState()
+
+	records, err := s.buildRecords(settings)
+	if err == nil {
+		err = s.enable(state)
+	}
+	if err != nil {
+		state.LastError = err.Error()
+		saveOverlayDNSState(state)
+		return false, err
+	}
+
+	all := append(staticOverlayDNSRecords(state.StaticRecords), records...)
+	changed := !reflect.DeepEqual(all, state.Records)
+	if _, statErr := os.Stat(headscaleExtraRecordsPath); changed || statErr != nil {
+		if err := writeExtraRecords(all); err != nil {
+			state.LastError = err.Error()
+			saveOverlayDNSState(state)
+			return false, err
+		}
+	}
+
+	now := time.Now().UTC()
+	state.Records = all
+	state.SyncedAt = &now
+	state.LastError = ""
+	saveOverlayDNSState(state)
+	return changed, nil
+}
+
+// enable points Headscale at the records file, moving the config's static
+// extra records into the state so they keep being served. Headscale is
+// only restarted when the config changes. Callers hold overlayDNSMutex.
+func (s *OverlayDNSService) enable(state *overlayDNSState) error {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return err
+	}
+	if config.DNS.ExtraRecordsPath == headscaleExtraRecordsPath {
+		return nil
+	}
+
+	// Headscale refuses to start without the file it is pointed at
+	static := config.DNS.ExtraRecords
+	if err := writeExtraRecords(staticOverlayDNSRecords(static)); err != nil {
+		return err
+	}
+	_, err = s.headscaleService.applyHeadscaleConfig(func(config *headscaleConfig) error {
+		config.DNS.ExtraRecords = nil
+		config.DNS.ExtraRecordsPath = headscaleExtraRecordsPath
+		return nil
+	}, false, nil)
+	if err != nil {
+		return err
+	}
+
+	state.StaticRecords = static
+	state.Records = nil
+	saveOverlayDNSState(state)
+	return nil
+}
+
+// disable puts the static extra records back into Headscale's config and
+// stops serving synced ones. Callers hold overlayDNSMutex.
+func (s *OverlayDNSService) disable() error {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return err
+	}
+	if config.DNS.ExtraRecordsPath != headscaleExtraRecordsPath {
+		return nil
+	}
+
+	state := loadOverlayDNSState()
+	_, err = s.headscaleService.applyHeadscaleConfig(func(config *headscaleConfig) error {
+		config.DNS.ExtraRecords = state.StaticRecords
+		config.DNS.ExtraRecordsPath = ""
+		return nil
+	}, false, nil)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(headscaleExtraRecordsPath)
+	state.StaticRecords = nil
+	state.Records = nil
+	state.LastError = ""
+	saveOverlayDNSState(state)
+	return nil
+}
+
+// buildRecords reads the selected zones and names from Samba and resolves
+// them to A and AAAA records. Records pointing at the LAN address of a mesh
+// node are rewritten to its overlay address, so overlay clients reach it
+// through the tailnet.
+func (s *OverlayDNSService) buildRecords(settings models.OverlayDNSSync) ([]models.OverlayDNSRecord, error) {
+	zones, err := s.sambaTool.DNSZones()
+	if err != nil {
+		return nil, err
+	}
+
+	// Zones to read: the selected ones and those holding selected names
+	selectedZones := map[string]bool{}
+	queryZones := map[string]bool{}
+	for _, zone := range settings.Zones {
+		selectedZones[strings.ToLower(zone)] = true
+		queryZones[strings.ToLower(zone)] = true
+	}
+	selectedNames := map[string]bool{}
+	for _, name := range settings.Records {
+		name = strings.ToLower(name)
+		zone := zoneOfDNSName(name, zones)
+		if zone == "" {
+			return nil, fmt.Errorf("no DNS zone holds %s", name)
+		}
+		selectedNames[name] = true
+		queryZones[zone] = true
+	}
+
+	var known []vexaexec.DNSRecord
+	queryOrder := make([]string, 0, len(queryZones))
+	for zone := range queryZones {
+		queryOrder = append(queryOrder, zone)
+	}
+	sort.Strings(queryOrder)
+	for _, zone := range queryOrder {
+		records, err := s.sambaTool.DNSRecords(zone, "@", overlayDNSQueryDepth)
+		if err != nil {
+			return nil, err
+		}
+		known = append(known, records...)
+	}
+
+	nodes, err := s.headscaleService.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodesByLANAddress := meshNodesByLANAddress(nodes, known)
+
+	byName := map[string][]vexaexec.DNSRecord{}
+	for _, record := range known {
+		byName[record.Name] = append(byName[record.Name], record)
+	}
+
+	seen := map[string]bool{}
+	records := []models.OverlayDNSRecord{}
+	for _, record := range known {
+		if !selectedNames[record.Name] && !selectedZones[strings.ToLower(zoneOfDNSName(record.Name, zones))] {
+			continue
+		}
+		for _, target := range resolveDNSRecord(record, byName) {
+			synced := models.OverlayDNSRecord{Name: record.Name, Type: target.Type, Value: target.Data}
+			if record.Type == "CNAME" {
+				synced.Source = record.Data
+			}
+			if node, ok := nodesByLANAddress[target.Data]; ok {
+				if address := overlayAddress(node, target.Type); address != "" {
+					synced.Source = target.Data
+					synced.Value = address
+					synced.MeshNode = node.GivenName
+				}
+			}
+			key := synced.Name + " " + synced.Type + " " + synced.Value
+			if !seen[key] {
+				seen[key] = true
+				records = append(records, synced)
+			}
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		if records[i].Type != records[j].Type {
+			return records[i].Type < records[j].Type
+		}
+		return records[i].Value < records[j].Value
+	})
+	return records, nil
+}
+
+// resolveDNSRecord returns the A and AAAA records a record stands for,
+// following CNAMEs through the records read from Samba. CNAMEs leaving the
+// synced zones cannot be served as extra records and resolve to nothing.
+func resolveDNSRecord(record vexaexec.DNSRecord, byName map[string][]vexaexec.DNSRecord) []vexaexec.DNSRecord {
+	for hops := 0; hops <= overlayDNSMaxCNAMEHops; hops++ {
+		switch record.Type {
+		case "A", "AAAA":
+			return []vexaexec.DNSRecord{record}
+		case "CNAME":
+			targets := byName[strings.ToLower(record.Data)]
+			var resolved []vexaexec.DNSRecord
+			for _, target := range targets {
+				if target.Type == "A" || target.Type == "AAAA" {
+					resolved = append(resolved, target)
+				}
+			}
+			if len(resolved) > 0 || len(targets) == 0 {
+				return resolved
+			}
+			record = targets[0]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// meshNodesByLANAddress maps the LAN addresses Samba has on record for mesh
+// nodes to the node. A node is matched by its host record, named after the
+// node's hostname or MagicDNS name.
+func meshNodesByLANAddress(nodes []headscale.Node, records []vexaexec.DNSRecord) map[string]headscale.Node {
+	byHostname := map[string]headscale.Node{}
+	for _, node := range nodes {
+		for _, name := range []string{node.Name, node.GivenName} {
+			if name != "" {
+				byHostname[strings.ToLower(name)] = node
+			}
+		}
+	}
+
+	byAddress := map[string]headscale.Node{}
+	for _, record := range records {
+		if record.Type != "A" && record.Type != "AAAA" {
+			continue
+		}
+		host, _, _ := strings.Cut(record.Name, ".")
+		if node, ok := byHostname[host]; ok {
+			byAddress[record.Data] = node
+		}
+	}
+	return byAddress
+}
+
+// overlayAddress returns the node's overlay address for an A or AAAA record
+func overlayAddress(node headscale.Node, recordType string) string {
+	if recordType == "A" {
+		return node.IPv4()
+	}
+	return node.IPv6()
+}
+
+// zoneOfDNSName returns the most specific zone holding name
+func zoneOfDNSName(name string, zones []string) string {
+	best := ""
+	for _, zone := range zones {
+		lower := strings.ToLower(zone)
+		if (name == lower || strings.HasSuffix(name, "."+lower)) && len(lower) > len(best) {
+			best = lower
+		}
+	}
+	return best
+}
+
+// staticOverlayDNSRecords lists extra records from Headscale's config
+func staticOverlayDNSRecords(records []headscaleExtraRecord) []models.OverlayDNSRecord {
+	static := []models.OverlayDNSRecord{}
+	for _, record := range records {
+		static = append(static, models.OverlayDNSRecord{
+			Name:   record.Name,
+			Type:   record.Type,
+			Value:  record.Value,
+			Static: true,
+		})
+	}
+	return static
+}
+
+// writeExtraRecords writes the records file in the format Headscale reads.
+// It is rewritten in place rather than replaced, so Headscale's file watch
+// keeps following it.
+func writeExtraRecords(records []models.OverlayDNSRecord) error {
+	extra := []headscaleExtraRecord{}
+	for _, record := range records {
+		extra = append(extra, headscaleExtraRecord{Name: record.Name, Type: record.Type, Value: record.Value})
+	}
+	data, err := json.MarshalIndent(extra, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(headscaleExtraRecordsPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write extra records: %v", err)
+	}
+	return nil
+}
+
+// normalizeOverlayDNSSync validates sync settings against the zones Samba
+// serves and brings names into a canonical form
+func normalizeOverlayDNSSync(settings *models.OverlayDNSSync, zones []string) error {
+	if settings.IntervalMinutes == 0 {
+		settings.IntervalMinutes = overlayDNSDefaultInterval
+	}
+	if settings.IntervalMinutes < overlayDNSMinInterval || settings.IntervalMinutes > overlayDNSMaxInterval {
+		return fmt.Errorf("interval_minutes must be between %d and %d", overlayDNSMinInterval, overlayDNSMaxInterval)
+	}
+
+	known := map[string]bool{}
+	for _, zone := range zones {
+		known[strings.ToLower(zone)] = true
+	}
+
+	normalizedZones := []string{}
+	for _, zone := range settings.Zones {
+		zone = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), "."))
+		if !known[zone] {
+			return fmt.Errorf("unknown DNS zone: %s", zone)
+		}
+		if !containsString(normalizedZones, zone) {
+			normalizedZones = append(normalizedZones, zone)
+		}
+	}
+
+	normalizedRecords := []string{}
+	for _, name := range settings.Records {
+		name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		if !dnsNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid record name: %s", name)
+		}
+		if zoneOfDNSName(name, zones) == "" {
+			return fmt.Errorf("no DNS zone holds %s", name)
+		}
+		if !containsString(normalizedRecords, name) {
+			normalizedRecords = append(normalizedRecords, name)
+		}
+	}
+
+	if settings.Enabled && len(normalizedZones) == 0 && len(normalizedRecords) == 0 {
+		return fmt.Errorf("select at least one zone or record to sync")
+	}
+	settings.Zones = normalizedZones
+	settings.Records = normalizedRecords
+	return nil
+}
+
+func loadOverlayDNSState() *overlayDNSState {
+	state := &overlayDNSState{}
+	data, err := os.ReadFile(overlayDNSStatePath)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		utils.Warn("Failed to parse overlay DNS state: %v", err)
+	}
+	return state
+}
+
+func saveOverlayDNSState(state *overlayDNSState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(overlayDNSStatePath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return os.WriteFile(overlayDNSStatePath, data, 0600)
+}
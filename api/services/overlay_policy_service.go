@@ -0,0 +1,470 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	vexaexec "github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const (
+	overlayPolicySettingsPath = "/etc/vexa/overlay-policy.json"
+	overlayPolicyStatePath    = "/var/lib/vexa/overlay-policy-state.json"
+
+	// headscalePendingPolicyPath holds a candidate policy while it is checked
+	headscalePendingPolicyPath = "/etc/headscale/acl.pending.json"
+
+	// overlayPolicySyncInterval bounds how long a membership change made
+	// outside Vexa takes to reach the policy
+	overlayPolicySyncInterval = 5 * time.Minute
+)
+
+var (
+	overlayPolicyMutex    sync.Mutex
+	overlayPolicySyncOnce sync.Once
+
+	// overlayPolicySyncTrigger wakes the group sync after a membership change
+	overlayPolicySyncTrigger = make(chan struct{}, 1)
+)
+
+// OverlayPolicyService manages the Headscale ACL policy
+type OverlayPolicyService struct {
+	ldbTool       *vexaexec.LdbTool
+	headscaleTool *vexaexec.HeadscaleTool
+}
+
+// NewOverlayPolicyService creates a new OverlayPolicyService instance
+func NewOverlayPolicyService() *OverlayPolicyService {
+	return &OverlayPolicyService{
+		ldbTool:       vexaexec.NewLdbTool(),
+		headscaleTool: vexaexec.NewHeadscaleTool(),
+	}
+}
+
+// overlayPolicyState records what was last written to the Headscale policy
+type overlayPolicyState struct {
+	Groups       map[string][]string `json:"groups"`
+	GroupSources map[string]string   `json:"group_sources"`
+	AppliedAt    *time.Time          `json:"applied_at,omitempty"`
+	LastError    string              `json:"last_error,omitempty"`
+}
+
+// headscalePolicy is the policy document Headscale loads
+type headscalePolicy struct {
+	Groups    map[string][]string     `json:"groups,omitempty"`
+	TagOwners map[string][]string     `json:"tagOwners,omitempty"`
+	Hosts     map[string]string       `json:"hosts,omitempty"`
+	ACLs      []models.OverlayACLRule `json:"acls"`
+}
+
+// allowAllRule is Headscale's behaviour without a policy
+var allowAllRule = models.OverlayACLRule{
+	Action:       "accept",
+	Sources:      []string{"*"},
+	Destinations: []string{"*:*"},
+}
+
+// TriggerOverlayPolicySync asks the background sync to regenerate the policy
+// groups now rather than at its next interval. It never blocks.
+func TriggerOverlayPolicySync() {
+	select {
+	case overlayPolicySyncTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// GetPolicy returns the managed policy. Until one is saved the policy is
+// disabled and allows all traffic.
+func (s *OverlayPolicyService) GetPolicy() (*models.OverlayPolicy, error) {
+	policy := &models.OverlayPolicy{
+		SyncedGroups: []string{"Domain Admins"},
+		ACLs:         []models.OverlayACLRule{allowAllRule},
+	}
+
+	data, err := os.ReadFile(overlayPolicySettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return policy, nil
+		}
+		return nil, fmt.Errorf("failed to read overlay policy: %v", err)
+	}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse overlay policy: %v", err)
+	}
+	return policy, nil
+}
+
+// Status returns the managed policy with the groups last applied
+func (s *OverlayPolicyService) Status() (*models.OverlayPolicyStatus, error) {
+	policy, err := s.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	state := loadOverlayPolicyState()
+	return &models.OverlayPolicyStatus{
+		Policy:       *policy,
+		Groups:       state.Groups,
+		GroupSources: state.GroupSources,
+		AppliedAt:    state.AppliedAt,
+		LastError:    state.LastError,
+	}, nil
+}
+
+// SavePolicy validates a policy with headscale policy check and applies it.
+// Nothing is saved when validation fails.
+func (s *OverlayPolicyService) SavePolicy(policy models.OverlayPolicy, updatedBy string) (*models.OverlayPolicyStatus, error) {
+	if err := normalizeOverlayPolicy(&policy); err != nil {
+		return nil, err
+	}
+
+	overlayPolicyMutex.Lock()
+	defer overlayPolicyMutex.Unlock()
+
+	groups, sources, err := s.generateGroups(policy.SyncedGroups)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(policy, groups, sources); err != nil {
+		return nil, err
+	}
+
+	policy.UpdatedAt = time.Now().UTC()
+	policy.UpdatedBy = updatedBy
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(overlayPolicySettingsPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create settings directory: %v", err)
+	}
+	if err := os.WriteFile(overlayPolicySettingsPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save overlay policy: %v", err)
+	}
+
+	return s.Status()
+}
+
+// SyncGroups regenerates the policy groups from directory membership and
+// applies the policy when they changed. It reports whether it did.
+func (s *OverlayPolicyService) SyncGroups() (bool, error) {
+	overlayPolicyMutex.Lock()
+	defer overlayPolicyMutex.Unlock()
+
+	policy, err := s.GetPolicy()
+	if err != nil || !policy.Enabled {
+		return false, err
+	}
+
+	state := loadOverlayPolicyState()
+	groups, sources, err := s.generateGroups(policy.SyncedGroups)
+	if err == nil {
+		if reflect.DeepEqual(groups, state.Groups) {
+			return false, nil
+		}
+		err = s.apply(*policy, groups, sources)
+	}
+	if err != nil {
+		state.LastError = err.Error()
+		saveOverlayPolicyState(state)
+		return false, err
+	}
+	return true, nil
+}
+
+// StartGroupSync keeps the policy groups in step with directory membership,
+// syncing on an interval and whenever TriggerOverlayPolicySync is called
+func (s *OverlayPolicyService) StartGroupSync() {
+	overlayPolicySyncOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(overlayPolicySyncInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-overlayPolicySyncTrigger:
+				}
+				changed, err := s.SyncGroups()
+				if err != nil {
+					utils.Warn("Overlay policy group sync failed: %v", err)
+					continue
+				}
+				if changed {
+					utils.LogOverlayManagement(utils.AuditContext{User: "system"}, "overlay_policy_group_sync", "policy", true, nil)
+				}
+			}
+		}()
+	})
+}
+
+// CheckPolicy validates a policy with headscale without applying it
+func (s *OverlayPolicyService) CheckPolicy(policy models.OverlayPolicy) error {
+	if err := normalizeOverlayPolicy(&policy); err != nil {
+		return err
+	}
+
+	overlayPolicyMutex.Lock()
+	defer overlayPolicyMutex.Unlock()
+
+	groups, _, err := s.generateGroups(policy.SyncedGroups)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(headscalePendingPolicyPath)
+	_, err = s.writeChecked(headscalePendingPolicyPath, renderOverlayPolicy(policy, groups))
+	return err
+}
+
+// apply checks the rendered policy and sets it through Headscale's API,
+// which applies it to connected nodes without a restart. A disabled policy
+// sets allow-all rules without groups. Callers hold overlayPolicyMutex.
+func (s *OverlayPolicyService) apply(policy models.OverlayPolicy, groups map[string][]string, sources map[string]string) error {
+	document := renderOverlayPolicy(policy, groups)
+	if !policy.Enabled {
+		document = headscalePolicy{ACLs: []models.OverlayACLRule{allowAllRule}}
+	}
+
+	data, err := s.writeChecked(headscalePendingPolicyPath, document)
+	os.Remove(headscalePendingPolicyPath)
+	if err != nil {
+		return err
+	}
+	if err := useDatabasePolicy(); err != nil {
+		return err
+	}
+	if err := setLivePolicy(data); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	state := overlayPolicyState{Groups: groups, GroupSources: sources, AppliedAt: &now}
+	if !policy.Enabled {
+		state.Groups = map[string][]string{}
+		state.GroupSources = map[string]string{}
+	}
+	return saveOverlayPolicyState(state)
+}
+
+// writeChecked writes a policy document and validates it with headscale. It
+// returns the document as written.
+func (s *OverlayPolicyService) writeChecked(path string, document headscalePolicy) ([]byte, error) {
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write policy: %v", err)
+	}
+	if output, err := s.headscaleTool.CheckPolicy(path); err != nil {
+		return nil, fmt.Errorf("policy rejected by headscale: %s", strings.TrimSpace(output))
+	}
+	return data, nil
+}
+
+// setLivePolicy sets a checked policy document through Headscale's API
+func setLivePolicy(data []byte) error {
+	client, err := headscaleClient()
+	if err != nil {
+		return err
+	}
+	if err := client.SetPolicy(string(data)); err != nil {
+		return fmt.Errorf("policy rejected by headscale: %v", err)
+	}
+	return nil
+}
+
+// generateGroups builds the policy groups from the members of directory
+// groups, including members of nested groups. Members are referenced as
+// "<headscale user>@", the user form of headscale's policy format.
+func (s *OverlayPolicyService) generateGroups(names []string) (map[string][]string, map[string]string, error) {
+	groups := make(map[string][]string)
+	sources := make(map[string]string)
+
+	usernames, err := directoryUsernames()
+	if err != nil {
+		return nil, nil, err
+	}
+	owners := overlayUserOwners(usernames)
+
+	for _, name := range names {
+		key := OverlayGroupName(name)
+		if key == "" {
+			return nil, nil, fmt.Errorf("group %s has no usable characters for a policy group name", name)
+		}
+		if existing, ok := sources[key]; ok {
+			return nil, nil, fmt.Errorf("groups %s and %s both map to %s", existing, name, key)
+		}
+
+		dn, err := s.ldbTool.GroupDN(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("group %s not found", name)
+		}
+		entries, err := s.ldbTool.Search("",
+			fmt.Sprintf("(&(objectClass=user)(!(objectClass=computer))(memberOf:1.2.840.113556.1.4.1941:=%s))", vexaexec.EscapeFilter(dn)),
+			"sAMAccountName")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read members of %s: %v", name, err)
+		}
+
+		members := []string{}
+		for _, entry := range entries {
+			user := OverlayUserName(entry.Get("sAMAccountName"))
+			if user == "" {
+				continue
+			}
+			// A shared overlay user would grant the group's access to everyone mapped to it
+			if len(owners[user]) > 1 {
+				utils.Warn("Leaving %s out of %s: overlay user %s is shared by %s", entry.Get("sAMAccountName"), key, user, strings.Join(owners[user], ", "))
+				continue
+			}
+			members = append(members, user+"@")
+		}
+		sort.Strings(members)
+
+		groups[key] = members
+		sources[key] = name
+	}
+	return groups, sources, nil
+}
+
+// OverlayGroupName returns the policy group generated for a directory group,
+// e.g. "group:domain-admins" for "Domain Admins"
+func OverlayGroupName(groupName string) string {
+	name := aclTagName(groupName)
+	if name == "" {
+		return ""
+	}
+	return "group:" + name
+}
+
+func renderOverlayPolicy(policy models.OverlayPolicy, groups map[string][]string) headscalePolicy {
+	return headscalePolicy{
+		Groups:    groups,
+		TagOwners: policy.TagOwners,
+		Hosts:     policy.Hosts,
+		ACLs:      policy.ACLs,
+	}
+}
+
+// normalizeOverlayPolicy fills defaults and rejects malformed entries before
+// the policy is handed to headscale for the full check
+func normalizeOverlayPolicy(policy *models.OverlayPolicy) error {
+	seen := make(map[string]bool)
+	groups := make([]string, 0, len(policy.SyncedGroups))
+	for _, name := range policy.SyncedGroups {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		groups = append(groups, name)
+	}
+	policy.SyncedGroups = groups
+
+	for tag, owners := range policy.TagOwners {
+		if !aclTagRegex.MatchString(tag) {
+			return fmt.Errorf("invalid tag owner entry %q: tags look like tag:name", tag)
+		}
+		if err := checkPolicyEntries("tag owner", owners, true); err != nil {
+			return err
+		}
+	}
+	for name, address := range policy.Hosts {
+		if !nodeNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid host name %q", name)
+		}
+		if _, _, err := net.ParseCIDR(address); err != nil && net.ParseIP(address) == nil {
+			return fmt.Errorf("host %s must be an IP address or CIDR prefix", name)
+		}
+	}
+
+	if len(policy.ACLs) == 0 && policy.Enabled {
+		return fmt.Errorf("an enabled policy needs at least one rule; without rules all traffic is denied")
+	}
+	for i := range policy.ACLs {
+		rule := &policy.ACLs[i]
+		if rule.Action == "" {
+			rule.Action = "accept"
+		}
+		if rule.Action != "accept" {
+			return fmt.Errorf("rule %d: only accept rules are supported", i+1)
+		}
+		if err := checkPolicyEntries(fmt.Sprintf("rule %d source", i+1), rule.Sources, false); err != nil {
+			return err
+		}
+		if err := checkPolicyEntries(fmt.Sprintf("rule %d destination", i+1), rule.Destinations, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPolicyEntries rejects empty lists and entries with whitespace or quotes
+func checkPolicyEntries(label string, entries []string, allowEmpty bool) error {
+	if len(entries) == 0 && !allowEmpty {
+		return fmt.Errorf("%s list is empty", label)
+	}
+	for _, entry := range entries {
+		if entry == "" || strings.ContainsAny(entry, " \t\r\n\"'") {
+			return fmt.Errorf("invalid %s %q", label, entry)
+		}
+	}
+	return nil
+}
+
+// useDatabasePolicy switches Headscale from a policy file to the policy kept
+// in its database, which is the one the API can set. Headscale is restarted
+// when the mode changes.
+func useDatabasePolicy() error {
+	config, err := loadHeadscaleConfig()
+	if err != nil {
+		return err
+	}
+	if config.Policy.Mode == "database" {
+		return nil
+	}
+	_, err = NewHeadscaleService().applyHeadscaleConfig(func(config *headscaleConfig) error {
+		config.Policy.Mode = "database"
+		config.Policy.Path = ""
+		return nil
+	}, false, nil)
+	if err != nil {
+		return err
+	}
+	return waitForHeadscaleAPI()
+}
+
+func loadOverlayPolicyState() overlayPolicyState {
+	state := overlayPolicyState{
+		Groups:       map[string][]string{},
+		GroupSources: map[string]string{},
+	}
+	data, err := os.ReadFile(overlayPolicyStatePath)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		utils.Warn("Failed to parse overlay policy state: %v", err)
+	}
+	return state
+}
+
+func saveOverlayPolicyState(state overlayPolicyState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(overlayPolicyStatePath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return os.WriteFile(overlayPolicyStatePath, data, 0600)
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,9 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-	"text/template"
 	"time"
 
+	"github.com/griffinwebnet/vexa/api/headscale"
 	"github.com/griffinwebnet/vexa/api/utils"
 )
 
@@ -34,8 +33,9 @@ type JoinScripts struct {
 	Linux   string `json:"linux"`
 }
 
-// SetupOverlay configures Headscale and Tailscale
-func (s *OverlayService) SetupOverlay(fqdn string) error {
+// SetupOverlay configures Headscale and Tailscale. With enableOIDC,
+// Headscale's interactive login is wired to Vexa's OIDC provider.
+func (s *OverlayService) SetupOverlay(fqdn string, enableOIDC bool) error {
 	utils.Info("Setting up overlay networking for FQDN: %s", fqdn)
 	// Install Headscale
 	utils.Info("Installing Headscale")
@@ -46,7 +46,7 @@ func (s *OverlayService) SetupOverlay(fqdn string) error {
 	utils.Info("Headscale installation completed")
 
 	// Configure Headscale
-	if err := s.configureHeadscale(fqdn); err != nil {
+	if err := s.configureHeadscale(fqdn, enableOIDC); err != nil {
 		return fmt.Errorf("failed to configure headscale: %v", err)
 	}
 
@@ -182,7 +182,7 @@ func (s *OverlayService) installHeadscale() error {
 }
 
 // configureHeadscale sets up Headscale configuration
-func (s *OverlayService) configureHeadscale(fqdn string) error {
+func (s *OverlayService) configureHeadscale(fqdn string, enableOIDC bool) error {
 	// Get the actual AD domain from domain service
 	domainService := NewDomainService()
 	domainStatus, err := domainService.GetDomainStatus()
@@ -227,110 +227,20 @@ func (s *OverlayService) configureHeadscale(fqdn string) error {
 		return err
 	}
 
-	// Create config from template - following working examples
-	tmpl := template.Must(template.New("config").Parse(`---
-# Vexa Mesh Configuration
-server_url: http://{{ .FQDN }}:50443
-listen_addr: 0.0.0.0:50443
-metrics_listen_addr: 127.0.0.1:9090
-grpc_listen_addr: 127.0.0.1:50444
-grpc_allow_insecure: true
-
-noise:
-  private_key_path: /var/lib/headscale/noise_private.key
-
-prefixes:
-  v4: 100.64.0.0/10
-  v6: fd7a:115c:a1e0::/48
-  allocation: sequential
-
-derp:
-  server:
-    enabled: false
-  urls:
-    - https://controlplane.tailscale.com/derpmap/default
-  auto_update_enabled: true
-  update_frequency: 24h
-
-disable_check_updates: false
-ephemeral_node_inactivity_timeout: 30m
-
-database:
-  type: sqlite
-  debug: false
-  gorm:
-    prepare_stmt: true
-    parameterized_queries: true
-    skip_err_record_not_found: true
-    slow_threshold: 1000
-  sqlite:
-    path: /var/lib/headscale/db.sqlite
-    write_ahead_log: true
-    wal_autocheckpoint: 1000
-
-log:
-  format: text
-  level: info
-
-policy:
-  mode: file
-  path: ""
-
-enable_windows_networking: true
-allow_netbios_broadcast: true
-
-dns:
-  magic_dns: true
-  base_domain: {{ .NetBIOSDomain }}.mesh
-  override_local_dns: true
-  nameservers:
-    global:
-      - 1.1.1.1
-      - 8.8.8.8
-    split:
-      {{ .Realm }}:
-        - 100.64.0.1
-  search_domains:
-    - {{ .Realm }}
-    - {{ .NetBIOSDomain }}.mesh
-    - {{ .NetBIOSDomain }}
-  extra_records:
-    - name: "{{ .Realm }}"
-      type: "A"
-      value: "100.64.0.1"
-    - name: "{{ .NetBIOSDomain }}"
-      type: "A"
-      value: "100.64.0.1"
-    - name: "{{ .ServerHostname }}.{{ .Realm }}"
-      type: "A"
-      value: "100.64.0.1"
-
-unix_socket: /var/run/headscale/headscale.sock
-unix_socket_permission: "0770"
-logtail:
-  enabled: false
-randomize_client_port: false`))
-
-	f, err := os.Create("/etc/headscale/config.yaml")
-	if err != nil {
+	// Write the config, keeping keys an earlier setup or an administrator
+	// added that Vexa does not manage
+	config := defaultHeadscaleConfig(fqdn, netbiosDomain, realm, serverHostname)
+	if err := updateHeadscaleConfig(func(current *headscaleConfig) error {
+		*current = *config
+		return nil
+	}); err != nil {
 		return err
 	}
-	defer f.Close()
-
-	data := struct {
-		FQDN           string
-		NetBIOSDomain  string
-		Realm          string
-		ServerHostname string
-	}{
-		FQDN:           fqdn,
-		NetBIOSDomain:  netbiosDomain,
-		Realm:          realm,
-		ServerHostname: serverHostname,
-	}
 
-	if err := tmpl.Execute(f, data); err != nil {
-		return err
+	if enableOIDC {
+		if err := NewOIDCService().ConfigureHeadscale(config.ServerURL); err != nil {
+			return fmt.Errorf("failed to configure headscale OIDC login: %v", err)
+		}
 	}
 
 	return nil
@@ -515,22 +425,21 @@ func (s *OverlayService) joinMeshLocal(fqdn string, meshDomain string) error {
 		time.Sleep(3 * time.Second)
 	}
 
-	// Additional check - test if headscale CLI can connect
-	fmt.Printf("DEBUG: Testing Headscale CLI connectivity\n")
+	// Generate the API key Vexa manages Headscale with. Retrying doubles as
+	// a check that the CLI can reach the freshly started server.
+	fmt.Printf("DEBUG: Generating Headscale API key\n")
+	var keyErr error
 	for i := 0; i < 10; i++ {
-		testCmd, testCmdErr := utils.SafeCommand("headscale", "users", "list", "-c", "/etc/headscale/config.yaml")
-		if testCmdErr != nil {
-			fmt.Printf("DEBUG: Command sanitization failed: %v\n", testCmdErr)
+		if _, keyErr = resetHeadscaleAPIKey(); keyErr == nil {
+			fmt.Printf("DEBUG: Headscale API key generated after %d attempts\n", i+1)
 			break
 		}
-		_, testErr := testCmd.CombinedOutput()
-		if testErr == nil {
-			fmt.Printf("DEBUG: Headscale CLI is responsive after %d attempts\n", i+1)
-			break
-		}
-		fmt.Printf("DEBUG: Headscale CLI not responsive, attempt %d/10: %v\n", i+1, testErr)
+		fmt.Printf("DEBUG: Headscale CLI not responsive, attempt %d/10: %v\n", i+1, keyErr)
 		time.Sleep(2 * time.Second)
 	}
+	if keyErr != nil {
+		return fmt.Errorf("failed to generate headscale API key: %v", keyErr)
+	}
 
 	// Check if headscale is actually running
 	statusCmd, statusCmdErr := utils.SafeCommand("systemctl", "is-active", "headscale")
@@ -544,71 +453,30 @@ func (s *OverlayService) joinMeshLocal(fqdn string, meshDomain string) error {
 		}
 	}
 
-	// Create a user called 'infrastructure' and get its ID
-	fmt.Printf("DEBUG: Creating infrastructure user\n")
-	userCmd, userCmdErr := utils.SafeCommand("headscale", "users", "create", "infrastructure", "-c", "/etc/headscale/config.yaml")
-	if userCmdErr != nil {
-		fmt.Printf("DEBUG: Command sanitization failed: %v\n", userCmdErr)
-	} else {
-		userOutput, userErr := userCmd.CombinedOutput()
-		if userErr != nil {
-			// If it fails because the user already exists, that's fine
-			fmt.Printf("DEBUG: User creation output: %s\n", string(userOutput))
-			fmt.Printf("DEBUG: User might already exist, continuing...\n")
-		}
-	}
-
-	// Get the user ID for the infrastructure user
-	fmt.Printf("DEBUG: Getting infrastructure user ID\n")
-	listCmd, listCmdErr := utils.SafeCommand("headscale", "users", "list", "-c", "/etc/headscale/config.yaml", "-o", "json")
-	if listCmdErr != nil {
-		return fmt.Errorf("command sanitization failed: %v", listCmdErr)
-	}
-	listOutput, listErr := listCmd.CombinedOutput()
-	if listErr != nil {
-		return fmt.Errorf("failed to list users: %v, output: %s", listErr, string(listOutput))
-	}
-
-	// Parse the JSON output to find the infrastructure user ID
-	var users []struct {
-		ID   int    `json:"id"`
-		Name string `json:"name"`
-	}
-	if err := json.Unmarshal(listOutput, &users); err != nil {
-		return fmt.Errorf("failed to parse users list: %v", err)
+	client, err := headscaleClient()
+	if err != nil {
+		return err
 	}
 
-	var userID int
-	for _, user := range users {
-		if user.Name == "infrastructure" {
-			userID = user.ID
-			break
+	// Create a user called 'infrastructure'
+	fmt.Printf("DEBUG: Ensuring infrastructure user exists\n")
+	user, err := client.FindUser(infrastructureUser)
+	if err != nil {
+		if user, err = client.CreateUser(infrastructureUser); err != nil {
+			return err
 		}
 	}
+	fmt.Printf("DEBUG: Found infrastructure user with ID: %s\n", user.ID)
 
-	if userID == 0 {
-		return fmt.Errorf("infrastructure user not found")
-	}
-
-	fmt.Printf("DEBUG: Found infrastructure user with ID: %d\n", userID)
-
-	// Generate a pre-auth key for this server using the user ID
-	fmt.Printf("DEBUG: Creating pre-auth key for infrastructure user (ID: %d)\n", userID)
-	cmd, cmdErr := utils.SafeCommand("headscale", "preauthkeys", "create", "--reusable", "--expiration", "131400h", "-u", fmt.Sprintf("%d", userID), "-c", "/etc/headscale/config.yaml", "-o", "json")
-	if cmdErr != nil {
-		return fmt.Errorf("command sanitization failed: %v", cmdErr)
-	}
-	output, err := cmd.CombinedOutput()
+	// Generate a pre-auth key for this server
+	fmt.Printf("DEBUG: Creating pre-auth key for infrastructure user (ID: %s)\n", user.ID)
+	key, err := client.CreatePreAuthKey(headscale.CreatePreAuthKeyRequest{
+		UserID:     user.ID,
+		Reusable:   true,
+		Expiration: time.Now().Add(131400 * time.Hour),
+	})
 	if err != nil {
-		// Add more detailed error information
 		fmt.Printf("DEBUG: Pre-auth key creation failed: %v\n", err)
-		fmt.Printf("DEBUG: Command output: %s\n", string(output))
-
-		// Check if Headscale is actually running
-		if statusCmd, statusErr := utils.SafeCommand("systemctl", "status", "headscale"); statusErr == nil {
-			statusOutput, _ := statusCmd.CombinedOutput()
-			fmt.Printf("DEBUG: Headscale service status: %s\n", string(statusOutput))
-		}
 
 		// Try to get more detailed logs
 		if logCmd, logErr := utils.SafeCommand("journalctl", "-u", "headscale", "--no-pager", "-n", "20"); logErr == nil {
@@ -616,18 +484,10 @@ func (s *OverlayService) joinMeshLocal(fqdn string, meshDomain string) error {
 			fmt.Printf("DEBUG: Recent Headscale logs: %s\n", string(logOutput))
 		}
 
-		return fmt.Errorf("failed to create pre-auth key: %v, output: %s", err, string(output))
-	}
-
-	// Parse JSON output to get the key
-	var keyResponse struct {
-		Key string `json:"key"`
-	}
-	if err := json.Unmarshal(output, &keyResponse); err != nil {
-		return fmt.Errorf("failed to parse pre-auth key response: %v", err)
+		return err
 	}
 
-	authKey := strings.TrimSpace(keyResponse.Key)
+	authKey := key.Key
 	fmt.Printf("DEBUG: Pre-auth key created: %s\n", authKey)
 
 	// Use localhost for the login server to avoid external connectivity dependency
@@ -661,32 +521,16 @@ func (s *OverlayService) joinMeshLocal(fqdn string, meshDomain string) error {
 
 // AddMachine generates scripts for joining a new machine
 func (s *OverlayService) AddMachine(name string) (*JoinScripts, error) {
-	// Generate pre-auth key
-	cmd, cmdErr := utils.SafeCommand("headscale", "preauthkey", "create", "--reusable", "--expiration", "8760h")
-	if cmdErr != nil {
-		return nil, fmt.Errorf("command sanitization failed: %v", cmdErr)
-	}
-	output, err := cmd.Output()
+	// Generate a single-use key that tags the node with the machine name and
+	// expires like the keys embedded in downloaded join scripts
+	key, err := NewHeadscaleService().CreateMachineKey(name, machineKeyTTL)
 	if err != nil {
 		return nil, err
 	}
-	authKey := strings.TrimSpace(string(output))
+	authKey := key.Key
 
 	// Get login server URL from config/env
-	serverURL := os.Getenv("HEADSCALE_SERVER_URL")
-	if serverURL == "" {
-		if content, err := os.ReadFile("/etc/headscale/config.yaml"); err == nil {
-			lines := strings.Split(string(content), "\n")
-			for _, raw := range lines {
-				line := strings.TrimSpace(raw)
-				if strings.HasPrefix(line, "server_url:") {
-					val := strings.TrimSpace(strings.TrimPrefix(line, "server_url:"))
-					serverURL = strings.Trim(val, "\"'")
-					break
-				}
-			}
-		}
-	}
+	serverURL := NewHeadscaleService().GetLoginServerFull()
 	if serverURL == "" {
 		serverURL = "http://localhost:8080/mesh"
 	}
@@ -799,20 +643,7 @@ func (s *OverlayService) GetOverlayStatus() (map[string]interface{}, error) {
 
 	// Derive configured FQDN from Headscale server_url
 	var fqdn string
-	serverURL := os.Getenv("HEADSCALE_SERVER_URL")
-	if serverURL == "" {
-		if content, err := os.ReadFile("/etc/headscale/config.yaml"); err == nil {
-			lines := strings.Split(string(content), "\n")
-			for _, raw := range lines {
-				line := strings.TrimSpace(raw)
-				if strings.HasPrefix(line, "server_url:") {
-					val := strings.TrimSpace(strings.TrimPrefix(line, "server_url:"))
-					serverURL = strings.Trim(val, "\"'")
-					break
-				}
-			}
-		}
-	}
+	serverURL := NewHeadscaleService().GetLoginServerFull()
 	if serverURL != "" {
 		if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
 			fqdn = u.Hostname()
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const posixSettingsPath = "/etc/vexa/posix.json"
+
+// posixMutex serialises ID allocation so concurrent creates don't pick the same number
+var posixMutex sync.Mutex
+
+// PosixService manages RFC2307 attributes (uidNumber, gidNumber, loginShell, unixHomeDirectory)
+type PosixService struct {
+	ldbTool *exec.LdbTool
+}
+
+// NewPosixService creates a new PosixService instance
+func NewPosixService() *PosixService {
+	return &PosixService{
+		ldbTool: exec.NewLdbTool(),
+	}
+}
+
+// GetSettings returns the ID allocation settings, or defaults when none are saved
+func (s *PosixService) GetSettings() (*models.PosixSettings, error) {
+	settings := &models.PosixSettings{
+		AutoAssign:   true,
+		UIDMin:       10000,
+		UIDMax:       999999,
+		GIDMin:       10000,
+		GIDMax:       999999,
+		DefaultShell: "/bin/bash",
+		HomeTemplate: "/home/%u",
+	}
+
+	data, err := os.ReadFile(posixSettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to read POSIX settings: %v", err)
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse POSIX settings: %v", err)
+	}
+	return settings, nil
+}
+
+// SaveSettings validates and stores the ID allocation settings
+func (s *PosixService) SaveSettings(settings *models.PosixSettings) error {
+	if settings.UIDMin < 1000 || settings.UIDMax <= settings.UIDMin {
+		return fmt.Errorf("invalid UID range %d-%d (minimum must be at least 1000)", settings.UIDMin, settings.UIDMax)
+	}
+	if settings.GIDMin < 1000 || settings.GIDMax <= settings.GIDMin {
+		return fmt.Errorf("invalid GID range %d-%d (minimum must be at least 1000)", settings.GIDMin, settings.GIDMax)
+	}
+	if !filepath.IsAbs(settings.DefaultShell) {
+		return fmt.Errorf("default shell must be an absolute path")
+	}
+	if !strings.HasPrefix(settings.HomeTemplate, "/") || !strings.Contains(settings.HomeTemplate, "%u") {
+		return fmt.Errorf("home template must be an absolute path containing %%u")
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(posixSettingsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return os.WriteFile(posixSettingsPath, data, 0600)
+}
+
+// AutoAssignEnabled reports whether new accounts should receive POSIX attributes
+func (s *PosixService) AutoAssignEnabled() bool {
+	settings, err := s.GetSettings()
+	if err != nil {
+		utils.Warn("Failed to load POSIX settings: %v", err)
+		return false
+	}
+	return settings.AutoAssign
+}
+
+// AssignUser sets RFC2307 attributes on a user. Values in attrs take precedence;
+// anything missing is allocated or filled from the settings. Existing IDs are kept.
+func (s *PosixService) AssignUser(username string, attrs models.PosixAttributes) (*models.PosixAssignment, error) {
+	posixMutex.Lock()
+	defer posixMutex.Unlock()
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.ldbTool.Search("", fmt.Sprintf("(&(objectClass=user)(!(objectClass=computer))(sAMAccountName=%s))", exec.EscapeFilter(username)),
+		"uidNumber", "gidNumber", "loginShell", "unixHomeDirectory")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("user not found: %s", username)
+	}
+	entry := entries[0]
+
+	uid, _ := strconv.Atoi(entry.Get("uidNumber"))
+	if attrs.UIDNumber != nil {
+		uid = *attrs.UIDNumber
+	}
+	if uid == 0 {
+		used, err := s.usedIDs("uidNumber")
+		if err != nil {
+			return nil, err
+		}
+		if uid, err = allocateID(used, settings.UIDMin, settings.UIDMax); err != nil {
+			return nil, fmt.Errorf("failed to allocate uidNumber: %v", err)
+		}
+	}
+
+	gid, _ := strconv.Atoi(entry.Get("gidNumber"))
+	if attrs.GIDNumber != nil {
+		gid = *attrs.GIDNumber
+	}
+	if gid == 0 {
+		// Primary group is Domain Users, which needs a gidNumber of its own
+		if gid, err = s.ensureGroupGID("Domain Users", settings); err != nil {
+			return nil, err
+		}
+	}
+
+	shell := entry.Get("loginShell")
+	if attrs.LoginShell != nil {
+		shell = *attrs.LoginShell
+	}
+	if shell == "" {
+		shell = settings.DefaultShell
+	}
+
+	home := entry.Get("unixHomeDirectory")
+	if attrs.UnixHomeDirectory != nil {
+		home = *attrs.UnixHomeDirectory
+	}
+	if home == "" {
+		home = strings.ReplaceAll(settings.HomeTemplate, "%u", strings.ToLower(username))
+	}
+
+	final := models.PosixAttributes{
+		UIDNumber:         &uid,
+		GIDNumber:         &gid,
+		LoginShell:        &shell,
+		UnixHomeDirectory: &home,
+	}
+	if err := s.applyUser(entry.DN, final); err != nil {
+		return nil, err
+	}
+
+	utils.Info("Assigned POSIX attributes to %s (uid=%d gid=%d)", username, uid, gid)
+	return &models.PosixAssignment{Name: username, UIDNumber: uid, GIDNumber: gid}, nil
+}
+
+// UpdateUser changes only the RFC2307 attributes present in attrs
+func (s *PosixService) UpdateUser(username string, attrs models.PosixAttributes) error {
+	if attrs.UIDNumber == nil && attrs.GIDNumber == nil && attrs.LoginShell == nil && attrs.UnixHomeDirectory == nil {
+		return nil
+	}
+
+	posixMutex.Lock()
+	defer posixMutex.Unlock()
+
+	dn, err := s.ldbTool.UserDN(username)
+	if err != nil {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	return s.applyUser(dn, attrs)
+}
+
+// AssignGroup sets gidNumber on a group, allocating one when gid is nil. An existing gidNumber is kept.
+func (s *PosixService) AssignGroup(name string, gid *int) (*models.PosixAssignment, error) {
+	posixMutex.Lock()
+	defer posixMutex.Unlock()
+
+	if gid != nil {
+		if err := s.setGroupGID(name, *gid); err != nil {
+			return nil, err
+		}
+		return &models.PosixAssignment{Name: name, GIDNumber: *gid}, nil
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := s.ensureGroupGID(name, settings)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PosixAssignment{Name: name, GIDNumber: assigned}, nil
+}
+
+// UpdateGroup changes a group's gidNumber
+func (s *PosixService) UpdateGroup(name string, gid int) error {
+	posixMutex.Lock()
+	defer posixMutex.Unlock()
+
+	return s.setGroupGID(name, gid)
+}
+
+// GroupGID returns a group's gidNumber, or 0 when it has none
+func (s *PosixService) GroupGID(name string) int {
+	entries, err := s.ldbTool.Search("", fmt.Sprintf("(&(objectClass=group)(sAMAccountName=%s))", exec.EscapeFilter(name)), "gidNumber")
+	if err != nil || len(entries) == 0 {
+		return 0
+	}
+	gid, _ := strconv.Atoi(entries[0].Get("gidNumber"))
+	return gid
+}
+
+// Backfill assigns IDs to every user and group that lacks them
+func (s *PosixService) Backfill(dryRun bool) (*models.PosixBackfillResult, error) {
+	posixMutex.Lock()
+	defer posixMutex.Unlock()
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	usedUIDs, err := s.usedIDs("uidNumber")
+	if err != nil {
+		return nil, err
+	}
+	usedGIDs, err := s.usedIDs("gidNumber")
+	if err != nil {
+		return nil, err
+	}
+	domainDN, err := s.ldbTool.DomainDN()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.PosixBackfillResult{
+		DryRun: dryRun,
+		Users:  []models.PosixAssignment{},
+		Groups: []models.PosixAssignment{},
+		Errors: []string{},
+	}
+
+	// Groups first so users can pick up the Domain Users gidNumber
+	groups, err := s.ldbTool.Search(domainDN, "(&(objectClass=group)(!(gidNumber=*)))", "sAMAccountName")
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if strings.Contains(strings.ToLower(group.DN), ",cn=builtin,") {
+			continue
+		}
+		name := group.Get("sAMAccountName")
+		gid, err := allocateID(usedGIDs, settings.GIDMin, settings.GIDMax)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+			break
+		}
+		if !dryRun {
+			if err := s.ldbTool.ReplaceAttribute(group.DN, "gidNumber", strconv.Itoa(gid)); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+		}
+		result.Groups = append(result.Groups, models.PosixAssignment{Name: name, GIDNumber: gid})
+	}
+
+	primaryGID := s.GroupGID("Domain Users")
+	for _, assignment := range result.Groups {
+		if strings.EqualFold(assignment.Name, "Domain Users") {
+			primaryGID = assignment.GIDNumber
+		}
+	}
+
+	users, err := s.ldbTool.Search(domainDN, "(&(objectClass=user)(!(objectClass=computer))(!(uidNumber=*)))",
+		"sAMAccountName", "gidNumber", "loginShell", "unixHomeDirectory")
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		name := user.Get("sAMAccountName")
+		if name == "krbtgt" || name == "Guest" {
+			continue
+		}
+		uid, err := allocateID(usedUIDs, settings.UIDMin, settings.UIDMax)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+			break
+		}
+		gid, _ := strconv.Atoi(user.Get("gidNumber"))
+		if gid == 0 {
+			gid = primaryGID
+		}
+
+		if !dryRun {
+			shell := user.Get("loginShell")
+			if shell == "" {
+				shell = settings.DefaultShell
+			}
+			home := user.Get("unixHomeDirectory")
+			if home == "" {
+				home = strings.ReplaceAll(settings.HomeTemplate, "%u", strings.ToLower(name))
+			}
+			attrs := models.PosixAttributes{UIDNumber: &uid, LoginShell: &shell, UnixHomeDirectory: &home}
+			if gid != 0 {
+				attrs.GIDNumber = &gid
+			}
+			if err := s.applyUser(user.DN, attrs); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+		}
+		result.Users = append(result.Users, models.PosixAssignment{Name: name, UIDNumber: uid, GIDNumber: gid})
+	}
+
+	utils.Info("POSIX backfill (dry_run=%t): %d users, %d groups, %d errors", dryRun, len(result.Users), len(result.Groups), len(result.Errors))
+	return result, nil
+}
+
+// applyUser validates and writes RFC2307 attributes to a user DN
+func (s *PosixService) applyUser(dn string, attrs models.PosixAttributes) error {
+	if attrs.UIDNumber != nil {
+		if *attrs.UIDNumber < 1000 {
+			return fmt.Errorf("uidNumber must be at least 1000")
+		}
+		if err := s.checkUnique("uidNumber", *attrs.UIDNumber, dn, "(objectClass=user)"); err != nil {
+			return err
+		}
+	}
+	if attrs.GIDNumber != nil && *attrs.GIDNumber < 100 {
+		return fmt.Errorf("gidNumber must be at least 100")
+	}
+	if attrs.LoginShell != nil && *attrs.LoginShell != "" && !filepath.IsAbs(*attrs.LoginShell) {
+		return fmt.Errorf("login shell must be an absolute path")
+	}
+	if attrs.UnixHomeDirectory != nil && *attrs.UnixHomeDirectory != "" && !filepath.IsAbs(*attrs.UnixHomeDirectory) {
+		return fmt.Errorf("unix home directory must be an absolute path")
+	}
+
+	if attrs.UIDNumber != nil {
+		if err := s.ldbTool.ReplaceAttribute(dn, "uidNumber", strconv.Itoa(*attrs.UIDNumber)); err != nil {
+			return fmt.Errorf("failed to set uidNumber: %v", err)
+		}
+	}
+	if attrs.GIDNumber != nil {
+		if err := s.ldbTool.ReplaceAttribute(dn, "gidNumber", strconv.Itoa(*attrs.GIDNumber)); err != nil {
+			return fmt.Errorf("failed to set gidNumber: %v", err)
+		}
+	}
+	if attrs.LoginShell != nil {
+		if err := s.ldbTool.ReplaceAttribute(dn, "loginShell", optionalValue(*attrs.LoginShell)...); err != nil {
+			return fmt.Errorf("failed to set loginShell: %v", err)
+		}
+	}
+	if attrs.UnixHomeDirectory != nil {
+		if err := s.ldbTool.ReplaceAttribute(dn, "unixHomeDirectory", optionalValue(*attrs.UnixHomeDirectory)...); err != nil {
+			return fmt.Errorf("failed to set unixHomeDirectory: %v", err)
+		}
+	}
+	return nil
+}
+
+// ensureGroupGID returns a group's gidNumber, allocating one if needed. Callers hold posixMutex.
+func (s *PosixService) ensureGroupGID(name string, settings *models.PosixSettings) (int, error) {
+	if gid := s.GroupGID(name); gid != 0 {
+		return gid, nil
+	}
+
+	used, err := s.usedIDs("gidNumber")
+	if err != nil {
+		return 0, err
+	}
+	gid, err := allocateID(used, settings.GIDMin, settings.GIDMax)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate gidNumber: %v", err)
+	}
+	if err := s.setGroupGID(name, gid); err != nil {
+		return 0, err
+	}
+	return gid, nil
+}
+
+// setGroupGID writes a validated gidNumber to a group. Callers hold posixMutex.
+func (s *PosixService) setGroupGID(name string, gid int) error {
+	if gid < 100 {
+		return fmt.Errorf("gidNumber must be at least 100")
+	}
+	dn, err := s.ldbTool.GroupDN(name)
+	if err != nil {
+		return fmt.Errorf("group not found: %s", name)
+	}
+	if err := s.checkUnique("gidNumber", gid, dn, "(objectClass=group)"); err != nil {
+		return err
+	}
+	if err := s.ldbTool.ReplaceAttribute(dn, "gidNumber", strconv.Itoa(gid)); err != nil {
+		return fmt.Errorf("failed to set gidNumber: %v", err)
+	}
+
+	utils.Info("Set gidNumber=%d on group %s", gid, name)
+	return nil
+}
+
+// checkUnique fails when another object of the given class already uses the ID
+func (s *PosixService) checkUnique(attribute string, id int, dn, classFilter string) error {
+	entries, err := s.ldbTool.Search("", fmt.Sprintf("(&%s(%s=%d))", classFilter, attribute, id), "sAMAccountName")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.EqualFold(entry.DN, dn) {
+			return fmt.Errorf("%s %d is already used by %s", attribute, id, entry.Get("sAMAccountName"))
+		}
+	}
+	return nil
+}
+
+// usedIDs returns the set of values in use for uidNumber or gidNumber
+func (s *PosixService) usedIDs(attribute string) (map[int]bool, error) {
+	entries, err := s.ldbTool.Search("", fmt.Sprintf("(%s=*)", attribute), attribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing %s values: %v", attribute, err)
+	}
+	used := make(map[int]bool, len(entries))
+	for _, entry := range entries {
+		if id, err := strconv.Atoi(entry.Get(attribute)); err == nil {
+			used[id] = true
+		}
+	}
+	return used, nil
+}
+
+// allocateID returns the lowest unused ID in [min, max] and marks it used
+func allocateID(used map[int]bool, min, max int) (int, error) {
+	for id := min; id <= max; id++ {
+		if !used[id] {
+			used[id] = true
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("ID range %d-%d is exhausted", min, max)
+}
+
+// optionalValue returns a single-value slice, or nil to clear the attribute
+func optionalValue(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+const (
+	// reachabilityWorkers bounds how many computers are probed at once
+	reachabilityWorkers = 16
+	// reachabilityTimeout bounds each individual probe
+	reachabilityTimeout = time.Second
+)
+
+// reachabilityPorts are the TCP ports probed: SMB, RDP and SSH
+var reachabilityPorts = []int{445, 3389, 22}
+
+// reachabilityCache holds the latest probe result per computer name, shared by
+// the background monitor and every ReachabilityService
+var reachabilityCache = struct {
+	sync.RWMutex
+	results  map[string]models.Reachability
+	inFlight map[string]bool
+}{
+	results:  map[string]models.Reachability{},
+	inFlight: map[string]bool{},
+}
+
+var reachabilityMonitorOnce sync.Once
+
+// ReachabilityService probes computers over ICMP and TCP and caches the results
+type ReachabilityService struct{}
+
+// NewReachabilityService creates a new ReachabilityService instance
+func NewReachabilityService() *ReachabilityService {
+	return &ReachabilityService{}
+}
+
+// StartMonitor probes the targets returned by targets every interval in the
+// background. Only the first call starts a monitor. When targets returns nil,
+// e.g. because the computers could not be listed, that cycle is skipped and
+// the cached results are kept.
+func (s *ReachabilityService) StartMonitor(interval time.Duration, targets func() map[string]string) {
+	reachabilityMonitorOnce.Do(func() {
+		utils.Info("Starting reachability monitor (interval %s)", interval)
+		go func() {
+			for {
+				if current := targets(); current != nil {
+					s.Refresh(current)
+				}
+				time.Sleep(interval)
+			}
+		}()
+	})
+}
+
+// Get returns the cached results for the given names
+func (s *ReachabilityService) Get(names []string) map[string]models.Reachability {
+	reachabilityCache.RLock()
+	defer reachabilityCache.RUnlock()
+
+	results := make(map[string]models.Reachability, len(names))
+	for _, name := range names {
+		if result, ok := reachabilityCache.results[name]; ok {
+			results[name] = result
+		}
+	}
+	return results
+}
+
+// Refresh probes every target (name to address) concurrently and waits for the
+// results. Cached results for names no longer in targets are dropped.
+func (s *ReachabilityService) Refresh(targets map[string]string) {
+	s.probeAll(targets)
+
+	reachabilityCache.Lock()
+	for name := range reachabilityCache.results {
+		if _, ok := targets[name]; !ok {
+			delete(reachabilityCache.results, name)
+		}
+	}
+	reachabilityCache.Unlock()
+}
+
+// ProbeMissing probes, in the background, targets that have no cached result yet
+func (s *ReachabilityService) ProbeMissing(targets map[string]string) {
+	missing := map[string]string{}
+	reachabilityCache.RLock()
+	for name, address := range targets {
+		if _, ok := reachabilityCache.results[name]; !ok && !reachabilityCache.inFlight[name] {
+			missing[name] = address
+		}
+	}
+	reachabilityCache.RUnlock()
+
+	if len(missing) > 0 {
+		go s.probeAll(missing)
+	}
+}
+
+// probeAll runs the probes through a bounded worker pool and stores the results
+func (s *ReachabilityService) probeAll(targets map[string]string) {
+	names := make([]string, 0, len(targets))
+	reachabilityCache.Lock()
+	for name := range targets {
+		reachabilityCache.inFlight[name] = true
+		names = append(names, name)
+	}
+	reachabilityCache.Unlock()
+	sort.Strings(names)
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < reachabilityWorkers && i < len(names); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				result := s.Probe(targets[name])
+
+				reachabilityCache.Lock()
+				reachabilityCache.results[name] = result
+				delete(reachabilityCache.inFlight, name)
+				reachabilityCache.Unlock()
+			}
+		}()
+	}
+
+	for _, name := range names {
+		jobs <- name
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Probe resolves an address and checks it with ICMP and the TCP ports in parallel
+func (s *ReachabilityService) Probe(address string) models.Reachability {
+	result := models.Reachability{
+		Address:   address,
+		OpenPorts: []int{},
+		CheckedAt: time.Now().UTC(),
+	}
+
+	ip := address
+	if net.ParseIP(address) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*reachabilityTimeout)
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, address)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			result.Error = fmt.Sprintf("cannot resolve %s", address)
+			return result
+		}
+		ip = addrs[0].IP.String()
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				ip = addr.IP.String()
+				break
+			}
+		}
+		result.Address = ip
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if pingHost(ip) {
+			mu.Lock()
+			result.ICMP = true
+			mu.Unlock()
+		}
+	}()
+
+	for _, port := range reachabilityPorts {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), reachabilityTimeout)
+			if err != nil {
+				return
+			}
+			conn.Close()
+			mu.Lock()
+			result.OpenPorts = append(result.OpenPorts, port)
+			mu.Unlock()
+		}(port)
+	}
+
+	wg.Wait()
+	sort.Ints(result.OpenPorts)
+	result.Reachable = result.ICMP || len(result.OpenPorts) > 0
+	return result
+}
+
+func pingHost(host string) bool {
+	cmd, err := utils.SafeCommand("ping", "-c", "1", "-W", "1", host)
+	if err != nil {
+		return false
+	}
+	return cmd.Run() == nil
+}
@@ -0,0 +1,572 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/smbconf"
+	"github.com/griffinwebnet/vexa/api/utils"
+)
+
+var shareNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]{0,79}$`)
+
+// maxShareCommentLength caps share comments, which clients show next to the share
+const maxShareCommentLength = 256
+
+// systemShares are sections managed by Samba itself
+var systemShares = map[string]bool{
+	"global":   true,
+	"netlogon": true,
+	"sysvol":   true,
+	"homes":    true,
+	"printers": true,
+	"print$":   true,
+	"ipc$":     true,
+}
+
+// smbConfMutex serialises read-modify-write cycles on smb.conf
+var smbConfMutex sync.Mutex
+
+// ShareService manages SMB file shares in smb.conf
+type ShareService struct {
+	ldbTool  *exec.LdbTool
+	confPath string
+}
+
+// NewShareService creates a new ShareService instance
+func NewShareService() *ShareService {
+	return &ShareService{
+		ldbTool:  exec.NewLdbTool(),
+		confPath: smbconf.DefaultPath,
+	}
+}
+
+// ListShares returns all shares defined in smb.conf
+func (s *ShareService) ListShares() ([]models.Share, error) {
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]models.Share, 0)
+	for _, section := range cfg.Sections {
+		if strings.EqualFold(section.Name, "global") {
+			continue
+		}
+		shares = append(shares, shareFromSection(section))
+	}
+	return shares, nil
+}
+
+// GetShare returns a single share
+func (s *ShareService) GetShare(name string) (*models.Share, error) {
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	section := cfg.Section(name)
+	if section == nil || strings.EqualFold(name, "global") {
+		return nil, fmt.Errorf("share not found: %s", name)
+	}
+	share := shareFromSection(section)
+	return &share, nil
+}
+
+// CreateShare adds a new share section and reloads Samba
+func (s *ShareService) CreateShare(req models.CreateShareRequest) (*models.Share, error) {
+	if err := validateShareName(req.Name); err != nil {
+		return nil, err
+	}
+	path, err := validateSharePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateShareComment(req.Comment); err != nil {
+		return nil, err
+	}
+
+	smbConfMutex.Lock()
+	defer smbConfMutex.Unlock()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Section(req.Name) != nil {
+		return nil, fmt.Errorf("share already exists: %s", req.Name)
+	}
+
+	if req.CreatePath {
+		if err := os.MkdirAll(path, 0770); err != nil {
+			return nil, fmt.Errorf("failed to create share path: %v", err)
+		}
+	} else if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("share path does not exist: %s", path)
+	}
+
+	browseable := true
+	if req.Browseable != nil {
+		browseable = *req.Browseable
+	}
+
+	section := cfg.AddSection(req.Name)
+	if err := section.Set("path", path); err != nil {
+		return nil, err
+	}
+	if req.Comment != "" {
+		if err := section.Set("comment", req.Comment); err != nil {
+			return nil, err
+		}
+	}
+	section.SetBool("browseable", browseable)
+	section.SetBool("read only", req.ReadOnly)
+	section.SetBool("guest ok", req.GuestOK)
+
+	if err := s.saveConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	utils.Info("Created share %s at %s", req.Name, path)
+	share := shareFromSection(section)
+	return &share, nil
+}
+
+// UpdateShare modifies an existing share's settings and reloads Samba
+func (s *ShareService) UpdateShare(name string, req models.UpdateShareRequest) (*models.Share, error) {
+	if systemShares[strings.ToLower(name)] {
+		return nil, fmt.Errorf("share %s is managed by Samba and cannot be modified", name)
+	}
+	if req.Comment != nil {
+		if err := validateShareComment(*req.Comment); err != nil {
+			return nil, err
+		}
+	}
+
+	smbConfMutex.Lock()
+	defer smbConfMutex.Unlock()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	section := cfg.Section(name)
+	if section == nil {
+		return nil, fmt.Errorf("share not found: %s", name)
+	}
+
+	if req.Path != nil {
+		path, err := validateSharePath(*req.Path)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("share path does not exist: %s", path)
+		}
+		if err := section.Set("path", path); err != nil {
+			return nil, err
+		}
+	}
+	if req.Comment != nil {
+		if *req.Comment == "" {
+			section.Delete("comment")
+		} else if err := section.Set("comment", *req.Comment); err != nil {
+			return nil, err
+		}
+	}
+	if req.Browseable != nil {
+		section.SetBool("browseable", *req.Browseable)
+	}
+	if req.ReadOnly != nil {
+		section.SetBool("read only", *req.ReadOnly)
+	}
+	if req.GuestOK != nil {
+		section.SetBool("guest ok", *req.GuestOK)
+	}
+
+	if err := s.saveConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	utils.Info("Updated share %s", name)
+	share := shareFromSection(section)
+	return &share, nil
+}
+
+// DeleteShare removes a share section and reloads Samba. The directory is left in place.
+func (s *ShareService) DeleteShare(name string) error {
+	if systemShares[strings.ToLower(name)] {
+		return fmt.Errorf("share %s is managed by Samba and cannot be deleted", name)
+	}
+
+	smbConfMutex.Lock()
+	defer smbConfMutex.Unlock()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return err
+	}
+	if !cfg.DeleteSection(name) {
+		return fmt.Errorf("share not found: %s", name)
+	}
+	if err := s.saveConfig(cfg); err != nil {
+		return err
+	}
+
+	utils.Info("Deleted share %s", name)
+	return nil
+}
+
+// GetShareACL returns the group access list of a share and the POSIX ACL of its path
+func (s *ShareService) GetShareACL(name string) (*models.ShareACL, error) {
+	share, err := s.GetShare(name)
+	if err != nil {
+		return nil, err
+	}
+
+	acl := &models.ShareACL{
+		Share:      share.Name,
+		Entries:    shareAccessEntries(share),
+		Filesystem: []string{},
+	}
+
+	cmd, cmdErr := utils.SafeCommand("getfacl", "-p", "--omit-header", share.Path)
+	if cmdErr == nil {
+		if output, err := cmd.Output(); err == nil {
+			for _, line := range strings.Split(string(output), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					acl.Filesystem = append(acl.Filesystem, line)
+				}
+			}
+		} else {
+			utils.Warn("getfacl failed for %s: %v", share.Path, err)
+		}
+	}
+
+	return acl, nil
+}
+
+// SetShareACL replaces the groups allowed on a share. Share-level access is written as
+// valid users / read list / write list; filesystem access is applied with setfacl.
+func (s *ShareService) SetShareACL(name string, req models.SetShareACLRequest) (*models.ShareACL, error) {
+	if systemShares[strings.ToLower(name)] {
+		return nil, fmt.Errorf("share %s is managed by Samba and cannot be modified", name)
+	}
+	for _, entry := range req.Entries {
+		if entry.Access != "read" && entry.Access != "full" {
+			return nil, fmt.Errorf("invalid access level %q for %s (expected read or full)", entry.Access, entry.Group)
+		}
+		if _, err := s.ldbTool.GroupDN(entry.Group); err != nil {
+			return nil, fmt.Errorf("group not found: %s", entry.Group)
+		}
+	}
+
+	smbConfMutex.Lock()
+	cfg, err := s.loadConfig()
+	if err != nil {
+		smbConfMutex.Unlock()
+		return nil, err
+	}
+	section := cfg.Section(name)
+	if section == nil {
+		smbConfMutex.Unlock()
+		return nil, fmt.Errorf("share not found: %s", name)
+	}
+
+	workgroup := ""
+	if global := cfg.Section("global"); global != nil {
+		workgroup, _ = global.Get("workgroup")
+	}
+	previous := shareAccessEntries(&models.Share{
+		ValidUsers: parseShareList(section, "valid users"),
+		ReadList:   parseShareList(section, "read list"),
+		WriteList:  parseShareList(section, "write list"),
+	})
+
+	var valid, read, write []string
+	for _, entry := range req.Entries {
+		principal := formatSharePrincipal(workgroup, entry.Group)
+		valid = append(valid, principal)
+		if entry.Access == "full" {
+			write = append(write, principal)
+		} else {
+			read = append(read, principal)
+		}
+	}
+	lists := []struct {
+		key        string
+		principals []string
+	}{{"valid users", valid}, {"read list", read}, {"write list", write}}
+	for _, list := range lists {
+		if err := setShareList(section, list.key, list.principals); err != nil {
+			smbConfMutex.Unlock()
+			return nil, err
+		}
+	}
+
+	path, _ := section.Get("path")
+	err = s.saveConfig(cfg)
+	smbConfMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ApplyFilesystem && path != "" {
+		if err := applyFilesystemACL(path, workgroup, previous, req.Entries); err != nil {
+			return nil, err
+		}
+	}
+
+	utils.Info("Updated access list for share %s (%d entries)", name, len(req.Entries))
+	return s.GetShareACL(name)
+}
+
+// Workgroup returns the NetBIOS domain name from the [global] section
+func (s *ShareService) Workgroup() string {
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return ""
+	}
+	if global := cfg.Section("global"); global != nil {
+		workgroup, _ := global.Get("workgroup")
+		return workgroup
+	}
+	return ""
+}
+
+// loadConfig reads and parses smb.conf
+func (s *ShareService) loadConfig() (*smbconf.Config, error) {
+	data, err := os.ReadFile(s.confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read smb.conf: %v", err)
+	}
+	cfg, err := smbconf.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse smb.conf: %v", err)
+	}
+	return cfg, nil
+}
+
+// saveConfig validates the new configuration with testparm, replaces smb.conf and reloads Samba
+func (s *ShareService) saveConfig(cfg *smbconf.Config) error {
+	tmpPath := s.confPath + ".vexa-new"
+	if err := os.WriteFile(tmpPath, cfg.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write smb.conf: %v", err)
+	}
+	defer os.Remove(tmpPath)
+
+	cmd, err := utils.SafeCommand("testparm", "-s", tmpPath)
+	if err != nil {
+		return fmt.Errorf("command sanitization failed: %v", err)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("smb.conf validation failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	if current, err := os.ReadFile(s.confPath); err == nil {
+		if err := os.WriteFile(s.confPath+".bak", current, 0644); err != nil {
+			utils.Warn("Failed to back up smb.conf: %v", err)
+		}
+	}
+	if err := os.Rename(tmpPath, s.confPath); err != nil {
+		return fmt.Errorf("failed to replace smb.conf: %v", err)
+	}
+
+	reload, err := utils.SafeCommand("smbcontrol", "all", "reload-config")
+	if err != nil {
+		utils.Warn("Command sanitization failed for smbcontrol: %v", err)
+		return nil
+	}
+	if output, err := reload.CombinedOutput(); err != nil {
+		utils.Warn("Failed to reload Samba configuration: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// shareFromSection converts an smb.conf section into a Share
+func shareFromSection(section *smbconf.Section) models.Share {
+	path, _ := section.Get("path")
+	comment, _ := section.Get("comment")
+
+	readOnly := section.GetBool("read only", true)
+	if _, ok := section.Get("writable"); ok {
+		readOnly = !section.GetBool("writable", false)
+	} else if _, ok := section.Get("writeable"); ok {
+		readOnly = !section.GetBool("writeable", false)
+	}
+
+	return models.Share{
+		Name:       section.Name,
+		Path:       path,
+		Comment:    comment,
+		Browseable: section.GetBool("browseable", section.GetBool("browsable", true)),
+		ReadOnly:   readOnly,
+		GuestOK:    section.GetBool("guest ok", section.GetBool("public", false)),
+		ValidUsers: parseShareList(section, "valid users"),
+		ReadList:   parseShareList(section, "read list"),
+		WriteList:  parseShareList(section, "write list"),
+		System:     systemShares[strings.ToLower(section.Name)],
+	}
+}
+
+// shareAccessEntries derives group access entries from a share's user lists
+func shareAccessEntries(share *models.Share) []models.ShareAccessEntry {
+	entries := make([]models.ShareAccessEntry, 0)
+	seen := map[string]bool{}
+	add := func(group, access string) {
+		key := strings.ToLower(group)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		entries = append(entries, models.ShareAccessEntry{Group: group, Access: access})
+	}
+	for _, group := range share.WriteList {
+		add(group, "full")
+	}
+	for _, group := range share.ReadList {
+		add(group, "read")
+	}
+	for _, group := range share.ValidUsers {
+		if share.ReadOnly {
+			add(group, "read")
+		} else {
+			add(group, "full")
+		}
+	}
+	return entries
+}
+
+// parseShareList splits a Samba user list, stripping group prefixes, quotes and the domain
+func parseShareList(section *smbconf.Section, key string) []string {
+	value, ok := section.Get(key)
+	if !ok {
+		return []string{}
+	}
+
+	var items []string
+	var current strings.Builder
+	inQuotes := false
+	flush := func() {
+		item := strings.TrimLeft(strings.TrimSpace(current.String()), "@+&")
+		item = strings.Trim(item, `"`)
+		if idx := strings.LastIndex(item, `\`); idx >= 0 {
+			item = item[idx+1:]
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+		current.Reset()
+	}
+	for _, r := range value {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case (r == ',' || r == ' ' || r == '\t') && !inQuotes:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+// setShareList writes a Samba user list, removing the parameter when empty
+func setShareList(section *smbconf.Section, key string, principals []string) error {
+	if len(principals) == 0 {
+		section.Delete(key)
+		return nil
+	}
+	return section.Set(key, strings.Join(principals, ", "))
+}
+
+// formatSharePrincipal renders a domain group as a quoted smb.conf group reference
+func formatSharePrincipal(workgroup, group string) string {
+	return fmt.Sprintf(`@"%s"`, qualifyGroup(workgroup, group))
+}
+
+// qualifyGroup prefixes a group with the NetBIOS domain name
+func qualifyGroup(workgroup, group string) string {
+	if workgroup == "" {
+		return group
+	}
+	return workgroup + `\` + group
+}
+
+// applyFilesystemACL replaces named-group POSIX ACL entries on a share path
+func applyFilesystemACL(path, workgroup string, previous, entries []models.ShareAccessEntry) error {
+	for _, entry := range previous {
+		group := qualifyGroup(workgroup, entry.Group)
+		cmd, err := utils.SafeCommand("setfacl", "-R", "-x", fmt.Sprintf("g:%s,d:g:%s", group, group), path)
+		if err != nil {
+			return fmt.Errorf("command sanitization failed: %v", err)
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			utils.Warn("Failed to remove ACL for %s on %s: %s", group, path, strings.TrimSpace(string(output)))
+		}
+	}
+
+	for _, entry := range entries {
+		perms := "rX"
+		if entry.Access == "full" {
+			perms = "rwX"
+		}
+		group := qualifyGroup(workgroup, entry.Group)
+		spec := fmt.Sprintf("g:%s:%s,d:g:%s:%s", group, perms, group, perms)
+		cmd, err := utils.SafeCommand("setfacl", "-R", "-m", spec, path)
+		if err != nil {
+			return fmt.Errorf("command sanitization failed: %v", err)
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set ACL for %s: %s", entry.Group, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func validateShareName(name string) error {
+	if !shareNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid share name: %s", name)
+	}
+	if systemShares[strings.ToLower(name)] {
+		return fmt.Errorf("share name %s is reserved", name)
+	}
+	return nil
+}
+
+func validateSharePath(path string) (string, error) {
+	if err := smbconf.ValidateValue(path); err != nil {
+		return "", fmt.Errorf("invalid share path: %v", err)
+	}
+	if !filepath.IsAbs(path) || strings.Contains(path, "..") {
+		return "", fmt.Errorf("share path must be an absolute path: %s", path)
+	}
+	clean := filepath.Clean(path)
+	for _, reserved := range []string{"/", "/etc", "/proc", "/sys", "/dev", "/boot", "/usr", "/bin", "/sbin", "/lib", "/var/lib/samba/private"} {
+		if clean == reserved || (reserved != "/" && strings.HasPrefix(clean, reserved+"/")) {
+			return "", fmt.Errorf("share path is not allowed: %s", clean)
+		}
+	}
+	return clean, nil
+}
+
+// validateShareComment checks a comment before it is written to smb.conf
+func validateShareComment(comment string) error {
+	if len(comment) > maxShareCommentLength {
+		return fmt.Errorf("share comment must be at most %d characters", maxShareCommentLength)
+	}
+	if err := smbconf.ValidateValue(comment); err != nil {
+		return fmt.Errorf("invalid share comment: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/griffinwebnet/vexa/api/exec"
+	"github.com/griffinwebnet/vexa/api/models"
+	"github.com/griffinwebnet/vexa/api/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+const sshKeySettingsPath = "/etc/vexa/ssh-keys.json"
+
+// maxSSHKeysPerUser limits how many keys a single account can hold
+const maxSSHKeysPerUser = 20
+
+var ldapAttributeRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]{0,63}$`)
+
+// SSHKeyService stores SSH public keys on directory user accounts
+type SSHKeyService struct {
+	ldbTool *exec.LdbTool
+}
+
+// NewSSHKeyService creates a new SSHKeyService instance
+func NewSSHKeyService() *SSHKeyService {
+	return &SSHKeyService{
+		ldbTool: exec.NewLdbTool(),
+	}
+}
+
+// GetSettings returns the SSH key settings, generating a lookup token on first use
+func (s *SSHKeyService) GetSettings() (*models.SSHKeySettings, error) {
+	settings := &models.SSHKeySettings{Attribute: "sshPublicKey"}
+
+	data, err := os.ReadFile(sshKeySettingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read SSH key settings: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, settings); err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key settings: %v", err)
+		}
+	}
+
+	if settings.LookupToken == "" {
+		token, err := generateLookupToken()
+		if err != nil {
+			return nil, err
+		}
+		settings.LookupToken = token
+		if err := s.writeSettings(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	settings.SchemaPresent = s.attributeInSchema(settings.Attribute)
+	return settings, nil
+}
+
+// SetAttribute changes the directory attribute used to store keys
+func (s *SSHKeyService) SetAttribute(attribute string) (*models.SSHKeySettings, error) {
+	if !ldapAttributeRegex.MatchString(attribute) {
+		return nil, fmt.Errorf("invalid attribute name: %s", attribute)
+	}
+	if !s.attributeInSchema(attribute) {
+		return nil, fmt.Errorf("attribute %s does not exist in the schema", attribute)
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings.Attribute = attribute
+	if err := s.writeSettings(settings); err != nil {
+		return nil, err
+	}
+	settings.SchemaPresent = true
+	return settings, nil
+}
+
+// RegenerateLookupToken replaces the token servers use to fetch authorized keys
+func (s *SSHKeyService) RegenerateLookupToken() (*models.SSHKeySettings, error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	token, err := generateLookupToken()
+	if err != nil {
+		return nil, err
+	}
+	settings.LookupToken = token
+	if err := s.writeSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// ValidateLookupToken checks a bearer token against the configured lookup token
+func (s *SSHKeyService) ValidateLookupToken(token string) bool {
+	settings, err := s.GetSettings()
+	if err != nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(settings.LookupToken)) == 1
+}
+
+// InstallSchema adds the OpenSSH-LPK sshPublicKey attribute and ldapPublicKey
+// auxiliary class to the schema and attaches the class to users
+func (s *SSHKeyService) InstallSchema() error {
+	if s.attributeInSchema("sshPublicKey") {
+		return nil
+	}
+
+	schemaDN, err := s.ldbTool.SchemaDN()
+	if err != nil {
+		return err
+	}
+
+	refresh := "dn:\nchangetype: modify\nadd: schemaUpdateNow\nschemaUpdateNow: 1\n"
+	steps := []string{
+		fmt.Sprintf(`dn: CN=sshPublicKey,%s
+changetype: add
+objectClass: top
+objectClass: attributeSchema
+attributeID: 1.3.6.1.4.1.24552.500.1.1.1.13
+cn: sshPublicKey
+name: sshPublicKey
+lDAPDisplayName: sshPublicKey
+description: OpenSSH public key
+attributeSyntax: 2.5.5.10
+oMSyntax: 4
+isSingleValued: FALSE
+`, schemaDN),
+		refresh,
+		fmt.Sprintf(`dn: CN=ldapPublicKey,%s
+changetype: add
+objectClass: top
+objectClass: classSchema
+governsID: 1.3.6.1.4.1.24552.500.1.1.2.0
+cn: ldapPublicKey
+name: ldapPublicKey
+lDAPDisplayName: ldapPublicKey
+description: OpenSSH LPK auxiliary class
+subClassOf: top
+objectClassCategory: 3
+defaultObjectCategory: CN=ldapPublicKey,%s
+mayContain: sshPublicKey
+`, schemaDN, schemaDN),
+		refresh,
+		fmt.Sprintf(`dn: CN=User,%s
+changetype: modify
+add: auxiliaryClass
+auxiliaryClass: ldapPublicKey
+`, schemaDN),
+		refresh,
+	}
+
+	for _, ldif := range steps {
+		if err := s.ldbTool.ModifySchema(ldif); err != nil {
+			return fmt.Errorf("failed to extend schema: %v", err)
+		}
+	}
+
+	utils.Info("Installed sshPublicKey schema extension")
+	return nil
+}
+
+// ListKeys returns the SSH keys stored on a user account
+func (s *SSHKeyService) ListKeys(username string) ([]models.SSHKey, error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.userEntry(username, settings.Attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]models.SSHKey, 0)
+	for _, value := range entry.GetAll(settings.Attribute) {
+		key, err := parseSSHKey(value)
+		if err != nil {
+			utils.Warn("Ignoring unparseable SSH key on %s: %v", username, err)
+			continue
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+// AddKey validates a public key and stores it on the user account
+func (s *SSHKeyService) AddKey(username string, req models.AddSSHKeyRequest) (*models.SSHKey, error) {
+	key, err := parseSSHKey(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if req.Fingerprint != "" && req.Fingerprint != key.Fingerprint && "SHA256:"+req.Fingerprint != key.Fingerprint {
+		return nil, fmt.Errorf("fingerprint mismatch: key has %s", key.Fingerprint)
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	if !settings.SchemaPresent {
+		return nil, fmt.Errorf("attribute %s is not in the schema; install the SSH key schema extension first", settings.Attribute)
+	}
+
+	existing, err := s.ListKeys(username)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxSSHKeysPerUser {
+		return nil, fmt.Errorf("a maximum of %d SSH keys is allowed per user", maxSSHKeysPerUser)
+	}
+	for _, k := range existing {
+		if k.Fingerprint == key.Fingerprint {
+			return nil, fmt.Errorf("key %s is already registered", key.Fingerprint)
+		}
+	}
+
+	dn, err := s.ldbTool.UserDN(username)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %s", username)
+	}
+	if err := s.ldbTool.AddAttributeValues(dn, settings.Attribute, key.PublicKey); err != nil {
+		return nil, fmt.Errorf("failed to store SSH key: %v", err)
+	}
+
+	utils.Info("Added SSH key %s for %s", key.Fingerprint, username)
+	return key, nil
+}
+
+// RemoveKey deletes the key with the given fingerprint from the user account
+func (s *SSHKeyService) RemoveKey(username, fingerprint string) error {
+	if fingerprint == "" {
+		return fmt.Errorf("fingerprint is required")
+	}
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = "SHA256:" + fingerprint
+	}
+
+	settings, err := s.GetSettings()
+	if err != nil {
+		return err
+	}
+	entry, err := s.userEntry(username, settings.Attribute)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range entry.GetAll(settings.Attribute) {
+		key, err := parseSSHKey(value)
+		if err != nil || key.Fingerprint != fingerprint {
+			continue
+		}
+		if err := s.ldbTool.DeleteAttributeValues(entry.DN, settings.Attribute, value); err != nil {
+			return fmt.Errorf("failed to remove SSH key: %v", err)
+		}
+		utils.Info("Removed SSH key %s for %s", fingerprint, username)
+		return nil
+	}
+	return fmt.Errorf("key not found: %s", fingerprint)
+}
+
+// AuthorizedKeys returns the user's keys in authorized_keys format. Disabled
+// accounts return no keys.
+func (s *SSHKeyService) AuthorizedKeys(username string) (string, error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return "", err
+	}
+	entry, err := s.userEntry(normalizeSSHUsername(username), settings.Attribute, "userAccountControl")
+	if err != nil {
+		return "", err
+	}
+
+	// UF_ACCOUNTDISABLE
+	if uac, err := strconv.Atoi(entry.Get("userAccountControl")); err == nil && uac&0x2 != 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	for _, value := range entry.GetAll(settings.Attribute) {
+		key, err := parseSSHKey(value)
+		if err != nil {
+			continue
+		}
+		b.WriteString(key.PublicKey + "\n")
+	}
+	return b.String(), nil
+}
+
+// userEntry looks up a user and the requested attributes
+func (s *SSHKeyService) userEntry(username string, attributes ...string) (*exec.LDIFEntry, error) {
+	filter := fmt.Sprintf("(&(objectClass=user)(!(objectClass=computer))(sAMAccountName=%s))", exec.EscapeFilter(username))
+	entries, err := s.ldbTool.Search("", filter, attributes...)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("user not found: %s", username)
+	}
+	return &entries[0], nil
+}
+
+// attributeInSchema reports whether an attribute is defined in the schema
+func (s *SSHKeyService) attributeInSchema(attribute string) bool {
+	return s.ldbTool.AttributeInSchema(attribute)
+}
+
+func (s *SSHKeyService) writeSettings(settings *models.SSHKeySettings) error {
+	stored := *settings
+	stored.SchemaPresent = false
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sshKeySettingsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return os.WriteFile(sshKeySettingsPath, data, 0600)
+}
+
+// parseSSHKey validates an authorized_keys line and normalises it to "type base64 comment"
+func parseSSHKey(line string) (*models.SSHKey, error) {
+	line = strings.TrimSpace(line)
+	if strings.ContainsAny(line, "\r\n") {
+		return nil, fmt.Errorf("public key must be a single line")
+	}
+
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH public key: %v", err)
+	}
+	if len(options) > 0 {
+		return nil, fmt.Errorf("key options are not allowed")
+	}
+
+	switch pub.Type() {
+	case ssh.KeyAlgoDSA:
+		return nil, fmt.Errorf("DSA keys are not supported")
+	case ssh.KeyAlgoRSA:
+		if cryptoPub, ok := pub.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoPub.CryptoPublicKey().(interface{ Size() int }); ok && rsaKey.Size()*8 < 2048 {
+				return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+			}
+		}
+	}
+
+	normalized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		normalized += " " + comment
+	}
+
+	return &models.SSHKey{
+		Type:        pub.Type(),
+		Comment:     comment,
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		PublicKey:   normalized,
+	}, nil
+}
+
+// normalizeSSHUsername strips realm or domain qualifiers sshd may pass (%u)
+func normalizeSSHUsername(username string) string {
+	if idx := strings.LastIndex(username, `\`); idx >= 0 {
+		username = username[idx+1:]
+	}
+	if idx := strings.Index(username, "@"); idx >= 0 {
+		username = username[:idx]
+	}
+	return username
+}
+
+func generateLookupToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lookup token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/griffinwebnet/vexa/api/exec"
@@ -11,13 +12,19 @@ import (
 
 // UserService handles user-related business logic
 type UserService struct {
-	sambaTool *exec.SambaTool
+	sambaTool    *exec.SambaTool
+	ldbTool      *exec.LdbTool
+	homeService  *HomeDirectoryService
+	posixService *PosixService
 }
 
 // NewUserService creates a new UserService instance
 func NewUserService() *UserService {
 	return &UserService{
-		sambaTool: exec.NewSambaTool(),
+		sambaTool:    exec.NewSambaTool(),
+		ldbTool:      exec.NewLdbTool(),
+		homeService:  NewHomeDirectoryService(),
+		posixService: NewPosixService(),
 	}
 }
 
@@ -85,9 +92,45 @@ func (s *UserService) CreateUser(req models.CreateUserRequest) error {
 		}
 	}
 
+	// Provision home directory and roaming profile paths per policy
+	if s.shouldCreateHomeDirectory(req) {
+		if _, err := s.homeService.Provision(req.Username); err != nil {
+			// User created but home directory failed - log warning but don't fail
+			utils.Warn("Failed to provision home directory for user %s: %v", req.Username, err)
+		}
+	}
+
+	// Assign RFC2307 attributes when auto-assignment is on or values were supplied
+	if s.posixService.AutoAssignEnabled() || req.UIDNumber != nil || req.GIDNumber != nil {
+		if _, err := s.posixService.AssignUser(req.Username, req.PosixAttributes); err != nil {
+			utils.Warn("Failed to assign POSIX attributes for user %s: %v", req.Username, err)
+		}
+	}
+
+	// Give the user a matching overlay user for their own devices
+	if headscaleService := NewHeadscaleService(); headscaleService.IsEnabled() {
+		if _, err := headscaleService.EnsureUser(req.Username); err != nil {
+			utils.Warn("Failed to create overlay user for %s: %v", req.Username, err)
+		}
+	}
+
+	TriggerOverlayPolicySync()
 	return nil
 }
 
+// shouldCreateHomeDirectory applies the request override over the policy default
+func (s *UserService) shouldCreateHomeDirectory(req models.CreateUserRequest) bool {
+	if req.CreateHomeDirectory != nil {
+		return *req.CreateHomeDirectory
+	}
+	policy, err := s.homeService.GetPolicy()
+	if err != nil {
+		utils.Warn("Failed to load home directory policy: %v", err)
+		return false
+	}
+	return policy.Enabled
+}
+
 // GetUser returns details for a specific user
 func (s *UserService) GetUser(username string) (*models.User, error) {
 	output, err := s.sambaTool.UserShow(username)
@@ -150,6 +193,38 @@ func (s *UserService) parseUserShowOutput(username, output string) *models.User
 			user.Description = strings.TrimSpace(strings.TrimPrefix(line, "description:"))
 		}
 
+		if strings.HasPrefix(line, "homeDirectory:") {
+			user.HomeDirectory = strings.TrimSpace(strings.TrimPrefix(line, "homeDirectory:"))
+		}
+
+		if strings.HasPrefix(line, "homeDrive:") {
+			user.HomeDrive = strings.TrimSpace(strings.TrimPrefix(line, "homeDrive:"))
+		}
+
+		if strings.HasPrefix(line, "profilePath:") {
+			user.ProfilePath = strings.TrimSpace(strings.TrimPrefix(line, "profilePath:"))
+		}
+
+		if strings.HasPrefix(line, "uidNumber:") {
+			user.UIDNumber, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "uidNumber:")))
+		}
+
+		if strings.HasPrefix(line, "gidNumber:") {
+			user.GIDNumber, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "gidNumber:")))
+		}
+
+		if strings.HasPrefix(line, "loginShell:") {
+			user.LoginShell = strings.TrimSpace(strings.TrimPrefix(line, "loginShell:"))
+		}
+
+		if strings.HasPrefix(line, "unixHomeDirectory:") {
+			user.UnixHomeDirectory = strings.TrimSpace(strings.TrimPrefix(line, "unixHomeDirectory:"))
+		}
+
+		if strings.HasPrefix(line, "scriptPath:") {
+			user.LogonScript = strings.TrimSpace(strings.TrimPrefix(line, "scriptPath:"))
+		}
+
 		if strings.Contains(line, "userAccountControl:") {
 			// Check if account is disabled (bit 2 = disabled)
 			uac := strings.TrimSpace(strings.TrimPrefix(line, "userAccountControl:"))
@@ -245,6 +320,7 @@ func (s *UserService) UpdateUser(username string, req models.UpdateUserRequest)
 	// Update group membership if provided
 	if req.Group != nil {
 		utils.Info("Updating group membership for user %s to: %s", username, *req.Group)
+		defer TriggerOverlayPolicySync()
 
 		// First, get current groups the user belongs to
 		currentGroups, err := s.getUserGroups(username)
@@ -278,6 +354,33 @@ func (s *UserService) UpdateUser(username string, req models.UpdateUserRequest)
 		}
 	}
 
+	// Update home directory attributes if provided (empty values clear them)
+	homeAttributes := []struct {
+		name  string
+		value *string
+	}{
+		{"homeDirectory", req.HomeDirectory},
+		{"homeDrive", req.HomeDrive},
+		{"profilePath", req.ProfilePath},
+	}
+	for _, attr := range homeAttributes {
+		if attr.value == nil {
+			continue
+		}
+		var values []string
+		if *attr.value != "" {
+			values = append(values, *attr.value)
+		}
+		if err := s.ldbTool.ReplaceAttribute(userDN, attr.name, values...); err != nil {
+			return fmt.Errorf("failed to update %s: %v", attr.name, err)
+		}
+	}
+
+	// Update RFC2307 attributes if provided
+	if err := s.posixService.UpdateUser(username, req.PosixAttributes); err != nil {
+		return fmt.Errorf("failed to update POSIX attributes: %v", err)
+	}
+
 	// TODO: Update OU path if provided (this requires moving the user object in LDAP)
 	// This is more complex and would require LDAP modify operations
 
@@ -291,9 +394,30 @@ func (s *UserService) DeleteUser(username string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %s", output)
 	}
+
+	// Archive or remove the home directory and profile per policy
+	if err := s.homeService.Deprovision(username); err != nil {
+		utils.Warn("Failed to clean up home directory for user %s: %v", username, err)
+	}
+
+	// Remove the user's own devices from the overlay
+	if headscaleService := NewHeadscaleService(); headscaleService.IsEnabled() {
+		removed, err := headscaleService.RemoveUser(username)
+		if err != nil {
+			utils.Warn("Failed to remove overlay user for %s: %v", username, err)
+		} else if len(removed) > 0 {
+			utils.Info("Removed %d overlay nodes of user %s", len(removed), username)
+		}
+	}
+	TriggerOverlayPolicySync()
 	return nil
 }
 
+// ProvisionHomeDirectory creates the home directory for an existing user
+func (s *UserService) ProvisionHomeDirectory(username string) (*models.HomeDirectoryResult, error) {
+	return s.homeService.Provision(username)
+}
+
 // DisableUser disables a user account
 func (s *UserService) DisableUser(username string) error {
 
@@ -0,0 +1,250 @@
+package smbconf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// DefaultPath is the location of the Samba configuration file
+const DefaultPath = "/etc/samba/smb.conf"
+
+// Param is a single "key = value" line within a section
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Section is a bracketed smb.conf section. Comment lines directly above the
+// header and between parameters are kept so rewrites don't lose them.
+type Section struct {
+	Name     string
+	Comments []string
+	Params   []Param
+	trailing map[int][]string
+}
+
+// Config is an ordered smb.conf document
+type Config struct {
+	Header   []string
+	Sections []*Section
+}
+
+// Parse reads smb.conf content, preserving section and parameter order
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	var current *Section
+	var pending []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var continued string
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+
+		// Backslash continuation joins physical lines into one logical line
+		if strings.HasSuffix(strings.TrimRight(raw, " \t"), "\\") {
+			continued += strings.TrimSuffix(strings.TrimRight(raw, " \t"), "\\")
+			continue
+		}
+		line := strings.TrimSpace(continued + raw)
+		continued = ""
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			pending = append(pending, raw)
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated section header", lineNo)
+			}
+			current = &Section{
+				Name:     strings.TrimSpace(line[1:end]),
+				Comments: pending,
+				trailing: map[int][]string{},
+			}
+			pending = nil
+			cfg.Sections = append(cfg.Sections, current)
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: parameter outside of a section", lineNo)
+		}
+		if len(pending) > 0 {
+			current.trailing[len(current.Params)] = pending
+			pending = nil
+		}
+		current.Params = append(current.Params, Param{
+			Key:   strings.TrimSpace(line[:eq]),
+			Value: strings.TrimSpace(line[eq+1:]),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		cfg.Header = pending
+	} else if len(pending) > 0 {
+		current.trailing[len(current.Params)] = pending
+	}
+	return cfg, nil
+}
+
+// Bytes renders the document back to smb.conf syntax
+func (c *Config) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, line := range c.Header {
+		buf.WriteString(line + "\n")
+	}
+	for _, section := range c.Sections {
+		for _, line := range section.Comments {
+			buf.WriteString(line + "\n")
+		}
+		buf.WriteString("[" + section.Name + "]\n")
+		for i, param := range section.Params {
+			for _, line := range section.trailing[i] {
+				buf.WriteString(line + "\n")
+			}
+			buf.WriteString("\t" + param.Key + " = " + param.Value + "\n")
+		}
+		for _, line := range section.trailing[len(section.Params)] {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// Section returns the named section (case-insensitive), or nil
+func (c *Config) Section(name string) *Section {
+	for _, section := range c.Sections {
+		if strings.EqualFold(section.Name, name) {
+			return section
+		}
+	}
+	return nil
+}
+
+// AddSection appends a new empty section and returns it
+func (c *Config) AddSection(name string) *Section {
+	section := &Section{Name: name, trailing: map[int][]string{}}
+	if len(c.Sections) > 0 || len(c.Header) > 0 {
+		section.Comments = []string{""}
+	}
+	c.Sections = append(c.Sections, section)
+	return section
+}
+
+// DeleteSection removes the named section. It reports whether a section was removed.
+func (c *Config) DeleteSection(name string) bool {
+	for i, section := range c.Sections {
+		if strings.EqualFold(section.Name, name) {
+			c.Sections = append(c.Sections[:i], c.Sections[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a parameter value. Keys match case-insensitively and ignore spacing,
+// as Samba does ("read only" == "readonly").
+func (s *Section) Get(key string) (string, bool) {
+	for _, param := range s.Params {
+		if normalizeKey(param.Key) == normalizeKey(key) {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetBool returns a boolean parameter, falling back to def when it's unset or invalid
+func (s *Section) GetBool(key string, def bool) bool {
+	value, ok := s.Get(key)
+	if !ok {
+		return def
+	}
+	switch strings.ToLower(value) {
+	case "yes", "true", "1", "on":
+		return true
+	case "no", "false", "0", "off":
+		return false
+	}
+	return def
+}
+
+// Set replaces a parameter value or appends it when it doesn't exist. Values
+// that ValidateValue rejects are not stored.
+func (s *Section) Set(key, value string) error {
+	if err := ValidateValue(value); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	for i, param := range s.Params {
+		if normalizeKey(param.Key) == normalizeKey(key) {
+			s.Params[i].Value = value
+			return nil
+		}
+	}
+	s.Params = append(s.Params, Param{Key: key, Value: value})
+	return nil
+}
+
+// SetBool sets a boolean parameter using Samba's yes/no spelling
+func (s *Section) SetBool(key string, value bool) {
+	if value {
+		s.Set(key, "yes")
+	} else {
+		s.Set(key, "no")
+	}
+}
+
+// ValidateValue checks that a value stays on its own line when rendered.
+// Line breaks and other control characters would start new parameters, and
+// a trailing backslash would join the next line onto the value.
+func ValidateValue(value string) error {
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("control characters are not allowed")
+		}
+	}
+	if strings.HasSuffix(strings.TrimRight(value, " "), "\\") {
+		return fmt.Errorf("a trailing backslash is not allowed")
+	}
+	return nil
+}
+
+// Delete removes a parameter from the section
+func (s *Section) Delete(key string) {
+	for i, param := range s.Params {
+		if normalizeKey(param.Key) == normalizeKey(key) {
+			s.Params = append(s.Params[:i], s.Params[i+1:]...)
+			// Comments that preceded the removed line move to the next one
+			shifted := map[int][]string{}
+			for idx := 0; idx <= len(s.Params)+1; idx++ {
+				lines, ok := s.trailing[idx]
+				if !ok {
+					continue
+				}
+				target := idx
+				if idx > i {
+					target = idx - 1
+				}
+				shifted[target] = append(shifted[target], lines...)
+			}
+			s.trailing = shifted
+			return
+		}
+	}
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.Join(strings.Fields(key), ""))
+}
@@ -0,0 +1,108 @@
+package smbconf
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleConfig = `# Global parameters
+[global]
+	workgroup = CORP
+	realm = CORP.EXAMPLE.COM
+	server role = active directory domain controller
+
+[sysvol]
+	path = /var/lib/samba/sysvol
+	read only = No
+
+# Finance team share
+[finance]
+	path = /srv/shares/finance
+	comment = Finance files
+	; kept between parameters
+	valid users = @"CORP\Finance"
+	read only = no
+`
+
+func TestRoundTrip(t *testing.T) {
+	cfg, err := Parse([]byte(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := string(cfg.Bytes()); got != sampleConfig {
+		t.Fatalf("round trip changed the file:\n%s", got)
+	}
+
+	section := cfg.Section("FINANCE")
+	if section == nil {
+		t.Fatal("finance section not found")
+	}
+	if err := section.Set("comment", "Finance and payroll"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	section.SetBool("readonly", true)
+
+	reparsed, err := Parse(cfg.Bytes())
+	if err != nil {
+		t.Fatalf("Parse after edit: %v", err)
+	}
+	finance := reparsed.Section("finance")
+	if comment, _ := finance.Get("comment"); comment != "Finance and payroll" {
+		t.Errorf("comment = %q", comment)
+	}
+	if !finance.GetBool("read only", false) {
+		t.Error("read only was not set")
+	}
+	if len(finance.Params) != 4 {
+		t.Errorf("got %d parameters, want 4", len(finance.Params))
+	}
+	if !strings.Contains(string(reparsed.Bytes()), "; kept between parameters") {
+		t.Error("comment line between parameters was lost")
+	}
+}
+
+func TestSetRejectsLineInjection(t *testing.T) {
+	values := []string{
+		"Finance\n\troot preexec = /bin/sh -c id",
+		"Finance\r\n[evil]",
+		"/srv/shares/finance\x00",
+		"tab\tseparated",
+		"Finance \\",
+	}
+	for _, value := range values {
+		cfg, err := Parse([]byte(sampleConfig))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		section := cfg.Section("finance")
+		if err := section.Set("comment", value); err == nil {
+			t.Errorf("Set(%q) succeeded", value)
+		}
+		if err := section.Set("root preexec", value); err == nil {
+			t.Errorf("Set(%q) on a new parameter succeeded", value)
+		}
+
+		reparsed, err := Parse(cfg.Bytes())
+		if err != nil {
+			t.Fatalf("Parse after rejected Set: %v", err)
+		}
+		finance := reparsed.Section("finance")
+		if _, ok := finance.Get("root preexec"); ok {
+			t.Errorf("Set(%q) added root preexec", value)
+		}
+		if comment, _ := finance.Get("comment"); comment != "Finance files" {
+			t.Errorf("Set(%q) changed the comment to %q", value, comment)
+		}
+		if len(reparsed.Sections) != 3 {
+			t.Errorf("Set(%q) produced %d sections", value, len(reparsed.Sections))
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	for _, value := range []string{"", "Finance files", `@"CORP\Finance", @"CORP\Payroll"`, "/srv/shares/ünïcode"} {
+		if err := ValidateValue(value); err != nil {
+			t.Errorf("ValidateValue(%q) = %v", value, err)
+		}
+	}
+}
@@ -17,16 +17,10 @@ type AuditContext struct {
 
 // GetAuditContext extracts audit information from Gin context
 func GetAuditContext(c *gin.Context) AuditContext {
-	// Get user from JWT claims if available
+	// Get user set by the auth middleware from the JWT claims, if any
 	user := "anonymous"
-	if claims, exists := c.Get("user_claims"); exists {
-		if userClaims, ok := claims.(map[string]interface{}); ok {
-			if username, exists := userClaims["username"]; exists {
-				if usernameStr, ok := username.(string); ok {
-					user = usernameStr
-				}
-			}
-		}
+	if username := c.GetString("username"); username != "" {
+		user = username
 	}
 
 	// Get IP address
@@ -167,6 +161,29 @@ func LogComputerManagement(ctx AuditContext, action string, computerName string,
 	Audit(event)
 }
 
+// LogOverlayManagement logs overlay network management events. The resource
+// names what was acted on, e.g. "node:12".
+func LogOverlayManagement(ctx AuditContext, action string, resource string, success bool, details map[string]interface{}) {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+
+	event := AuditEvent{
+		Timestamp: time.Now(),
+		User:      ctx.User,
+		Action:    action,
+		Category:  "overlay_management",
+		Resource:  resource,
+		Details:   details,
+		IPAddress: ctx.IPAddress,
+		UserAgent: ctx.UserAgent,
+		SessionID: ctx.SessionID,
+		Success:   success,
+	}
+
+	Audit(event)
+}
+
 // LogSystemManagement logs system management events
 func LogSystemManagement(ctx AuditContext, action string, success bool, details map[string]interface{}) {
 	if details == nil {
@@ -234,6 +251,31 @@ func LogSecurityEvent(ctx AuditContext, action string, severity string, success
 	Audit(event)
 }
 
+// LogSecretAccess logs access to a stored secret such as a computer's local
+// administrator password. Callers must not disclose or change the secret when
+// it returns an error.
+func LogSecretAccess(ctx AuditContext, action string, computerName string, success bool, details map[string]interface{}) error {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["computer_name"] = computerName
+
+	event := AuditEvent{
+		Timestamp: time.Now(),
+		User:      ctx.User,
+		Action:    action,
+		Category:  "secret_access",
+		Resource:  "computer:" + computerName,
+		Details:   details,
+		IPAddress: ctx.IPAddress,
+		UserAgent: ctx.UserAgent,
+		SessionID: ctx.SessionID,
+		Success:   success,
+	}
+
+	return AuditRequired(event)
+}
+
 // AuditMiddleware logs all API requests
 func AuditMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -199,6 +199,56 @@ func NewCommandSanitizer() *CommandSanitizer {
 				PositionalArgs: map[int]ArgValidator{},
 				MaxArgs:        10,
 			},
+			"ldbsearch": {
+				Allowed:        true,
+				StaticArgs:     []string{"-H", "-b", "-s", "base", "one", "sub"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        20,
+			},
+			"ldbmodify": {
+				Allowed:    true,
+				StaticArgs: []string{"-H", "--option=dsdb:schema update allowed=true"},
+				PositionalArgs: map[int]ArgValidator{
+					1: isSafePath,
+				},
+				MaxArgs: 3,
+			},
+			"net": {
+				Allowed:        true,
+				StaticArgs:     []string{"offlinejoin", "provision", "reuse", "-U"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        10,
+			},
+			"smbcontrol": {
+				Allowed:        true,
+				StaticArgs:     []string{"all", "smbd", "reload-config"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        2,
+			},
+			"setfacl": {
+				Allowed:        true,
+				StaticArgs:     []string{"-R", "-m", "-x", "-b", "-d"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        6,
+			},
+			"chown": {
+				Allowed:        true,
+				StaticArgs:     []string{"-R"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        3,
+			},
+			"tar": {
+				Allowed:        true,
+				StaticArgs:     []string{"-czf", "-xzf", "-C"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        6,
+			},
+			"getfacl": {
+				Allowed:        true,
+				StaticArgs:     []string{"-p", "--omit-header"},
+				PositionalArgs: map[int]ArgValidator{},
+				MaxArgs:        4,
+			},
 			"smbclient": {
 				Allowed:    true,
 				StaticArgs: []string{"//localhost/ipc$", "//localhost/netlogon", "-L", "localhost", "-U", "-c", "exit"},
@@ -445,6 +495,12 @@ func isSafeProcessName(process string) bool {
 	return true
 }
 
+// IsSafeUsername reports whether a username passes the same character check
+// applied to usernames handed to samba-tool
+func IsSafeUsername(username string) bool {
+	return isSafeUsername(username)
+}
+
 // isSafeUsername validates usernames
 func isSafeUsername(username string) bool {
 	if len(username) == 0 || len(username) > 100 {
@@ -562,6 +618,10 @@ func isSafeHeadscaleArg(arg string) bool {
 		"--help", "users", "list", "create", "preauthkeys", "nodes", "migrate",
 		"infrastructure", "-c", "/etc/headscale/config.yaml", "-o", "json",
 		"--reusable", "--expiration", "131400h", "-u", "--output", "version",
+		"expire", "--user", "--tags", "--ephemeral", "tag", "-i", "-t",
+		"rename", "delete", "move", "--force", "approve-routes", "-r", "destroy",
+		"policy", "check", "--file", "/etc/headscale/acl.pending.json",
+		"configtest", "/etc/headscale/config.pending.yaml", "apikeys", "--prefix",
 	}
 
 	for _, allowed := range allowedArgs {
@@ -575,6 +635,34 @@ func isSafeHeadscaleArg(arg string) bool {
 		return true
 	}
 
+	// Allow key expirations, ACL tag lists and pre-auth keys
+	if matched, _ := regexp.MatchString(`^\d+[mhd]$`, arg); matched {
+		return true
+	}
+	if matched, _ := regexp.MatchString(`^tag:[a-z0-9-]+(,tag:[a-z0-9-]+)*$`, arg); matched {
+		return true
+	}
+	if matched, _ := regexp.MatchString(`^[A-Za-z0-9_-]{5,15}$`, arg); matched { // API key prefixes
+		return true
+	}
+	if matched, _ := regexp.MatchString(`^[A-Za-z0-9-]{16,128}$`, arg); matched {
+		return true
+	}
+
+	// Allow route prefix lists; an empty list withdraws all approved routes
+	if arg == "" {
+		return true
+	}
+	if matched, _ := regexp.MatchString(`^[0-9a-fA-F:.]+/\d{1,3}(,[0-9a-fA-F:.]+/\d{1,3})*$`, arg); matched {
+		return true
+	}
+
+	// Allow node and user names; they cannot start with a dash so they are
+	// never read as flags
+	if matched, _ := regexp.MatchString(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`, arg); matched {
+		return true
+	}
+
 	return false
 }
 
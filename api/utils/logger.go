@@ -476,6 +476,31 @@ func (l *Logger) Audit(event AuditEvent) {
 	}
 }
 
+// AuditRequired logs an audit event and returns an error unless it reached the
+// audit log, for actions that must not proceed unaudited
+func (l *Logger) AuditRequired(event AuditEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %v", err)
+	}
+
+	if l.auditLog == nil {
+		return fmt.Errorf("audit log is not available")
+	}
+	if err := l.auditLog.write("AUDIT", string(jsonData)); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+
+	if l.vexaLog != nil {
+		l.vexaLog.write("AUDIT", string(jsonData))
+	}
+	return nil
+}
+
 // Close closes all log files
 func (l *Logger) Close() error {
 	var err error
@@ -534,3 +559,7 @@ func Error(format string, args ...interface{}) {
 func Audit(event AuditEvent) {
 	GetLogger().Audit(event)
 }
+
+func AuditRequired(event AuditEvent) error {
+	return GetLogger().AuditRequired(event)
+}